@@ -15,6 +15,10 @@ var (
 )
 
 func runDeleteBlobs(ctx context.Context, rep *repo.Repository) error {
+	if err := rep.CheckDeletionAllowed(); err != nil {
+		return errors.Wrap(err, "deleting blobs is not allowed")
+	}
+
 	for _, b := range *blobDeleteBlobIDs {
 		err := rep.Blobs.DeleteBlob(ctx, blob.ID(b))
 		if err != nil {
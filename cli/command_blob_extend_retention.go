@@ -0,0 +1,125 @@
+package cli
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/blob"
+)
+
+var (
+	blobExtendRetentionCommand  = blobCommands.Command("extend-retention", "Extend object lock retention of all blobs still referenced by the repository")
+	blobExtendRetentionParallel = blobExtendRetentionCommand.Flag("parallel", "Number of parallel operations").Default("5").Int()
+	blobExtendRetentionDryRun   = blobExtendRetentionCommand.Flag("dry-run", "Only print the number of blobs whose retention would be extended").Short('n').Bool()
+)
+
+// retentionExtender is implemented by storage providers that support extending retention of individual blobs.
+type retentionExtender interface {
+	ExtendRetention(ctx context.Context, id blob.ID) error
+}
+
+func runBlobExtendRetentionCommand(ctx context.Context, rep *repo.Repository) error {
+	// open a separate instance of the storage to get access to the provider, bypassing any wrappers.
+	st, err := blob.NewStorage(ctx, rep.Blobs.ConnectionInfo())
+	if err != nil {
+		return errors.Wrap(err, "unable to open storage")
+	}
+
+	defer st.Close(ctx) //nolint:errcheck
+
+	ext, ok := st.(retentionExtender)
+	if !ok {
+		return errors.Errorf("storage type %v does not support retention", rep.Blobs.ConnectionInfo().Type)
+	}
+
+	var mu sync.Mutex
+
+	unreferenced := map[blob.ID]bool{}
+
+	if err := rep.Content.IterateUnreferencedBlobs(ctx, *blobExtendRetentionParallel, func(bm blob.Metadata) error {
+		mu.Lock()
+		unreferenced[bm.BlobID] = true
+		mu.Unlock()
+		return nil
+	}); err != nil {
+		return errors.Wrap(err, "error looking for unreferenced blobs")
+	}
+
+	var referenced []blob.ID
+
+	if err := st.ListBlobs(ctx, "", func(bm blob.Metadata) error {
+		if !unreferenced[bm.BlobID] {
+			referenced = append(referenced, bm.BlobID)
+		}
+		return nil
+	}); err != nil {
+		return errors.Wrap(err, "error listing blobs")
+	}
+
+	if *blobExtendRetentionDryRun {
+		printStderr("Would extend retention of %v blobs (%v unreferenced blobs skipped).\n", len(referenced), len(unreferenced))
+		return nil
+	}
+
+	printStderr("Extending retention of %v blobs...\n", len(referenced))
+
+	if err := extendRetentionInParallel(ctx, ext, referenced, *blobExtendRetentionParallel); err != nil {
+		return err
+	}
+
+	printStderr("Extended retention of %v blobs.\n", len(referenced))
+
+	return nil
+}
+
+func extendRetentionInParallel(ctx context.Context, ext retentionExtender, ids []blob.ID, parallel int) error {
+	if parallel <= 0 {
+		parallel = 1
+	}
+
+	ch := make(chan blob.ID)
+	errch := make(chan error, parallel)
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < parallel; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for id := range ch {
+				if err := ext.ExtendRetention(ctx, id); err != nil {
+					errch <- errors.Wrapf(err, "unable to extend retention of %q", id)
+					return
+				}
+			}
+		}()
+	}
+
+	var err error
+
+	for i := 0; i < len(ids) && err == nil; i++ {
+		select {
+		case ch <- ids[i]:
+		case err = <-errch:
+		}
+	}
+
+	close(ch)
+	wg.Wait()
+	close(errch)
+
+	if err != nil {
+		return err
+	}
+
+	return <-errch
+}
+
+func init() {
+	blobExtendRetentionCommand.Action(repositoryAction(runBlobExtendRetentionCommand))
+}
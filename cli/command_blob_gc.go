@@ -17,6 +17,12 @@ var (
 )
 
 func runBlobGarbageCollectCommand(ctx context.Context, rep *repo.Repository) error {
+	if *blobGarbageCollectCommandDelete == "yes" {
+		if err := rep.CheckDeletionAllowed(); err != nil {
+			return errors.Wrap(err, "garbage collection is not allowed")
+		}
+	}
+
 	var mu sync.Mutex
 
 	var unused []blob.Metadata
@@ -46,14 +52,30 @@ func runBlobGarbageCollectCommand(ctx context.Context, rep *repo.Repository) err
 		return nil
 	}
 
+	var locked int
+
 	for _, u := range unused {
 		printStderr("Deleting unused blob %q (%v bytes)...\n", u.BlobID, u.Length)
 
-		if err := rep.Blobs.DeleteBlob(ctx, u.BlobID); err != nil {
+		err := rep.Blobs.DeleteBlob(ctx, u.BlobID)
+		if err == blob.ErrBlobLocked {
+			// blobs protected by retention policy will be deleted by a future GC after the lock expires.
+			printStderr("Blob %q is locked by retention policy, skipping.\n", u.BlobID)
+
+			locked++
+
+			continue
+		}
+
+		if err != nil {
 			return errors.Wrapf(err, "unable to delete blob %q", u.BlobID)
 		}
 	}
 
+	if locked > 0 {
+		printStderr("Skipped %v blobs locked by retention policy.\n", locked)
+	}
+
 	return nil
 }
 
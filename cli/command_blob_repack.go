@@ -0,0 +1,61 @@
+package cli
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/units"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/content"
+)
+
+var (
+	blobRepackCommand         = blobCommands.Command("repack", "Rewrite live contents of pack blobs with little live data and delete old packs after a safety delay")
+	blobRepackMinLiveFraction = blobRepackCommand.Flag("min-live-fraction", "Repack pack blobs where the fraction of live data is below this value").Default("0.5").Float64()
+	blobRepackSafetyDelay     = blobRepackCommand.Flag("safety-delay", "Minimum time between rewriting contents of a pack blob and deleting it").Default(content.DefaultRepackSafetyDelay.String()).Duration()
+	blobRepackDryRun          = blobRepackCommand.Flag("dry-run", "Do not make any changes, only print what would happen").Short('n').Bool()
+)
+
+func runBlobRepackCommand(ctx context.Context, rep *repo.Repository) error {
+	if !*blobRepackDryRun {
+		if err := rep.CheckDeletionAllowed(); err != nil {
+			return errors.Wrap(err, "repacking is not allowed")
+		}
+	}
+
+	stats, err := rep.Content.Repack(ctx, content.RepackOptions{
+		MinLiveFraction: *blobRepackMinLiveFraction,
+		SafetyDelay:     *blobRepackSafetyDelay,
+		DryRun:          *blobRepackDryRun,
+	})
+	if err != nil {
+		return errors.Wrap(err, "error repacking")
+	}
+
+	verb := "Repacked"
+	if *blobRepackDryRun {
+		verb = "Would repack"
+	}
+
+	printStderr("%v %v pack blobs, rewriting %v contents (%v) and reclaiming %v.\n",
+		verb,
+		stats.RepackedPacks,
+		stats.RewrittenContents,
+		units.BytesStringBase10(stats.RewrittenBytes),
+		units.BytesStringBase10(stats.ReclaimableBytes))
+
+	if stats.DeletedPacks > 0 {
+		printStderr("Deleted %v previously repacked pack blobs (%v).\n", stats.DeletedPacks, units.BytesStringBase10(stats.DeletedBytes))
+	}
+
+	if stats.PendingPacks > 0 {
+		printStderr("%v repacked pack blobs will be deleted by a future repack after the safety delay of %v.\n", stats.PendingPacks, *blobRepackSafetyDelay)
+	}
+
+	return nil
+}
+
+func init() {
+	blobRepackCommand.Action(repositoryAction(runBlobRepackCommand))
+}
@@ -0,0 +1,75 @@
+package cli
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/blob/mirror"
+)
+
+var (
+	blobSyncCheckCommand = blobCommands.Command("sync-check", "Check that all replicas of mirrored storage contain the same blobs")
+	blobSyncCheckPrefix  = blobSyncCheckCommand.Flag("prefix", "Blob ID prefix").String()
+	blobSyncCheckRepair  = blobSyncCheckCommand.Flag("repair", "Copy missing blobs to replicas that don't have them").Bool()
+)
+
+func runBlobSyncCheckCommand(ctx context.Context, rep *repo.Repository) error {
+	ci := rep.Blobs.ConnectionInfo()
+
+	opt, ok := ci.Config.(*mirror.Options)
+	if !ok {
+		return errors.Errorf("repository does not use mirrored storage (storage type: %v)", ci.Type)
+	}
+
+	if *blobSyncCheckRepair && rep.CheckDeletionAllowed() == repo.ErrReadOnly {
+		return errors.Wrap(repo.ErrReadOnly, "unable to repair replicas")
+	}
+
+	replicas, err := mirror.OpenReplicas(ctx, opt)
+	if err != nil {
+		return errors.Wrap(err, "unable to open replicas")
+	}
+
+	defer func() {
+		for _, r := range replicas {
+			r.Close(ctx) //nolint:errcheck
+		}
+	}()
+
+	missing, err := mirror.FindMissingBlobs(ctx, replicas, blob.ID(*blobSyncCheckPrefix))
+	if err != nil {
+		return errors.Wrap(err, "unable to find missing blobs")
+	}
+
+	if len(missing) == 0 {
+		printStderr("All %v replicas are in sync.\n", len(replicas))
+		return nil
+	}
+
+	for _, mb := range missing {
+		printStdout("%-70v %10v missing on replicas %v\n", mb.BlobID, mb.Length, mb.MissingOn)
+	}
+
+	if !*blobSyncCheckRepair {
+		return errors.Errorf("found %v blobs missing on some replicas, pass --repair to copy them", len(missing))
+	}
+
+	for _, mb := range missing {
+		printStderr("Copying blob %q from replica #%v to %v...\n", mb.BlobID, mb.Source, mb.MissingOn)
+
+		if err := mirror.RepairMissingBlob(ctx, replicas, mb); err != nil {
+			return err
+		}
+	}
+
+	printStderr("Repaired %v blobs.\n", len(missing))
+
+	return nil
+}
+
+func init() {
+	blobSyncCheckCommand.Action(repositoryAction(runBlobSyncCheckCommand))
+}
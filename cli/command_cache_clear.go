@@ -15,23 +15,26 @@ var (
 
 func runCacheClearCommand(ctx context.Context, rep *repo.Repository) error {
 	if d := rep.Content.CachingOptions.CacheDirectory; d != "" {
-		printStderr("Clearing cache directory: %v.\n", d)
+		return clearCacheDirectory(d)
+	}
 
-		err := os.RemoveAll(d)
-		if err != nil {
-			return err
-		}
+	return errors.New("caching not enabled")
+}
 
-		if err := os.MkdirAll(d, 0700); err != nil {
-			return err
-		}
+func clearCacheDirectory(d string) error {
+	printStderr("Clearing cache directory: %v.\n", d)
 
-		printStderr("Cache cleared.\n")
+	if err := os.RemoveAll(d); err != nil {
+		return err
+	}
 
-		return nil
+	if err := os.MkdirAll(d, 0700); err != nil {
+		return err
 	}
 
-	return errors.New("caching not enabled")
+	printStderr("Cache cleared.\n")
+
+	return nil
 }
 
 func init() {
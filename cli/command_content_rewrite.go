@@ -19,6 +19,7 @@ var (
 
 	contentRewriteShortPacks    = contentRewriteCommand.Flag("short", "Rewrite contents from short packs").Bool()
 	contentRewriteFormatVersion = contentRewriteCommand.Flag("format-version", "Rewrite contents using the provided format version").Default("-1").Int()
+	contentRewriteRetiredKeys   = contentRewriteCommand.Flag("retired-keys", "Rewrite contents encrypted with retired master keys").Bool()
 	contentRewritePackPrefix    = contentRewriteCommand.Flag("pack-prefix", "Only rewrite contents from pack blobs with a given prefix").String()
 	contentRewriteDryRun        = contentRewriteCommand.Flag("dry-run", "Do not actually rewrite, only print what would happen").Short('n').Bool()
 )
@@ -111,6 +112,11 @@ func getContentToRewrite(ctx context.Context, rep *repo.Repository) <-chan conte
 		if *contentRewriteFormatVersion != -1 {
 			findContentWithFormatVersion(rep, ch, *contentRewriteFormatVersion)
 		}
+
+		// add all contents encrypted with master keys retired by key rotation
+		if *contentRewriteRetiredKeys {
+			findContentWithRetiredKeys(rep, ch)
+		}
 	}()
 
 	return ch
@@ -147,6 +153,17 @@ func findContentWithFormatVersion(rep *repo.Repository, ch chan contentInfoOrErr
 		})
 }
 
+func findContentWithRetiredKeys(rep *repo.Repository, ch chan contentInfoOrError) {
+	_ = rep.Content.IterateContents(
+		content.IterateOptions{IncludeDeleted: true},
+		func(b content.Info) error {
+			if b.EncryptionKeyID != rep.Content.Format.EncryptionKeyID && strings.HasPrefix(string(b.PackBlobID), *contentRewritePackPrefix) {
+				ch <- contentInfoOrError{Info: b}
+			}
+			return nil
+		})
+}
+
 func findContentInShortPacks(rep *repo.Repository, ch chan contentInfoOrError, threshold int64) {
 	if err := rep.Content.IterateContentInShortPacks(threshold, func(ci content.Info) error {
 		if ci.ID.HasPrefix() == *contentRewritePrefixed {
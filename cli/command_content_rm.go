@@ -3,6 +3,8 @@ package cli
 import (
 	"context"
 
+	"github.com/pkg/errors"
+
 	"github.com/kopia/kopia/repo"
 )
 
@@ -13,6 +15,10 @@ var (
 )
 
 func runContentRemoveCommand(ctx context.Context, rep *repo.Repository) error {
+	if err := rep.CheckDeletionAllowed(); err != nil {
+		return errors.Wrap(err, "removing contents is not allowed")
+	}
+
 	for _, contentID := range toContentIDs(*contentRemoveIDs) {
 		if err := rep.Content.DeleteContent(contentID); err != nil {
 			return err
@@ -0,0 +1,68 @@
+package cli
+
+import (
+	"context"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/units"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/content"
+)
+
+const scrubStateFileName = "scrub.json"
+
+var (
+	contentScrubCommand = contentCommands.Command("scrub", "Verify integrity of a sample of pack blobs, rotating through the entire repository over time")
+
+	contentScrubPercent      = contentScrubCommand.Flag("percent", "Percentage of pack blobs to verify in a single run").Default("10").Float64()
+	contentScrubPeriod       = contentScrubCommand.Flag("period", "Time after which verified pack blobs are verified again").Default(content.DefaultScrubPeriod.String()).Duration()
+	contentScrubChecksumOnly = contentScrubCommand.Flag("checksum-only", "Only verify authentication codes without decrypting contents").Bool()
+	contentScrubParallel     = contentScrubCommand.Flag("parallel", "Number of pack blobs to verify in parallel").Default("4").Int()
+	contentScrubStateFile    = contentScrubCommand.Flag("state-file", "Local file tracking scrub progress (default is in cache directory)").String()
+)
+
+func runContentScrubCommand(ctx context.Context, rep *repo.Repository) error {
+	stateFile := *contentScrubStateFile
+	if stateFile == "" {
+		cacheDir := rep.Content.CachingOptions.CacheDirectory
+		if cacheDir == "" {
+			return errors.Errorf("cache directory is not configured, must specify --state-file")
+		}
+
+		stateFile = filepath.Join(cacheDir, scrubStateFileName)
+	}
+
+	stats, err := rep.Content.Scrub(ctx, content.ScrubOptions{
+		StateFile:    stateFile,
+		Percent:      *contentScrubPercent,
+		Period:       *contentScrubPeriod,
+		ChecksumOnly: *contentScrubChecksumOnly,
+		Parallel:     *contentScrubParallel,
+	})
+	if err != nil {
+		return errors.Wrap(err, "scrub error")
+	}
+
+	for _, e := range stats.Errors {
+		if e.ContentID != "" {
+			log.Errorf("content %v in %v is corrupted: %v", e.ContentID, e.PackBlobID, e.Error)
+		} else {
+			log.Errorf("unable to read %v: %v", e.PackBlobID, e.Error)
+		}
+	}
+
+	printStderr("Verified %v of %v due pack blobs (%v total) with %v contents, downloaded %v.\n",
+		stats.VerifiedPacks, stats.DuePacks, stats.TotalPacks, stats.VerifiedContents, units.BytesStringBase10(stats.DownloadedBytes))
+
+	if len(stats.Errors) > 0 {
+		return errors.Errorf("encountered %v errors", len(stats.Errors))
+	}
+
+	return nil
+}
+
+func init() {
+	contentScrubCommand.Action(repositoryAction(runContentScrubCommand))
+}
@@ -3,10 +3,12 @@ package cli
 import (
 	"context"
 	"fmt"
+	"sort"
 	"strconv"
 
 	"github.com/kopia/kopia/internal/units"
 	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/compression"
 	"github.com/kopia/kopia/repo/content"
 )
 
@@ -16,12 +18,12 @@ var (
 )
 
 func runContentStatsCommand(ctx context.Context, rep *repo.Repository) error {
-	var sizeThreshold uint32 = 10
+	var sizeThreshold uint64 = 10
 
-	countMap := map[uint32]int{}
-	totalSizeOfContentsUnder := map[uint32]int64{}
+	countMap := map[uint64]int{}
+	totalSizeOfContentsUnder := map[uint64]int64{}
 
-	var sizeThresholds []uint32
+	var sizeThresholds []uint64
 
 	for i := 0; i < 8; i++ {
 		sizeThresholds = append(sizeThresholds, sizeThreshold)
@@ -31,11 +33,22 @@ func runContentStatsCommand(ctx context.Context, rep *repo.Repository) error {
 
 	var totalSize, count int64
 
+	compressionStats := map[content.ID]*contentCompressionStats{}
+
 	if err := rep.Content.IterateContents(
 		content.IterateOptions{},
 		func(b content.Info) error {
 			totalSize += int64(b.Length)
 			count++
+
+			cs := compressionStats[b.ID.Prefix()]
+			if cs == nil {
+				cs = &contentCompressionStats{}
+				compressionStats[b.ID.Prefix()] = cs
+			}
+
+			cs.add(b)
+
 			for s := range countMap {
 				if b.Length < s {
 					countMap[s]++
@@ -63,7 +76,7 @@ func runContentStatsCommand(ctx context.Context, rep *repo.Repository) error {
 
 	fmt.Printf("Histogram:\n\n")
 
-	var lastSize uint32
+	var lastSize uint64
 
 	for _, size := range sizeThresholds {
 		fmt.Printf("%9v between %v and %v (total %v)\n",
@@ -76,9 +89,64 @@ func runContentStatsCommand(ctx context.Context, rep *repo.Repository) error {
 		lastSize = size
 	}
 
+	printCompressionStats(compressionStats, sizeToString)
+
 	return nil
 }
 
+// contentCompressionStats summarizes compression savings of contents with a given prefix.
+type contentCompressionStats struct {
+	count           int64
+	compressedCount int64
+	originalBytes   int64
+	storedBytes     int64
+}
+
+// nolint:gocritic
+func (s *contentCompressionStats) add(b content.Info) {
+	s.count++
+
+	if b.CompressionHeaderID != compression.NoCompression {
+		s.compressedCount++
+		s.originalBytes += int64(b.OriginalLength)
+		s.storedBytes += int64(b.Length)
+	}
+}
+
+func printCompressionStats(stats map[content.ID]*contentCompressionStats, sizeToString func(int64) string) {
+	var prefixes []string
+
+	for p := range stats {
+		prefixes = append(prefixes, string(p))
+	}
+
+	sort.Strings(prefixes)
+
+	fmt.Printf("\nCompression by prefix:\n\n")
+
+	for _, p := range prefixes {
+		s := stats[content.ID(p)]
+
+		if p == "" {
+			p = "(none)"
+		}
+
+		var savings float64
+		if s.originalBytes > 0 {
+			savings = 100 * float64(s.originalBytes-s.storedBytes) / float64(s.originalBytes)
+		}
+
+		fmt.Printf("%-8v %9v contents, %9v compressed, %v -> %v (%.1f%% savings)\n",
+			p,
+			s.count,
+			s.compressedCount,
+			sizeToString(s.originalBytes),
+			sizeToString(s.storedBytes),
+			savings,
+		)
+	}
+}
+
 func init() {
 	contentStatsCommand.Action(repositoryAction(runContentStatsCommand))
 }
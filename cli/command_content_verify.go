@@ -2,6 +2,7 @@ package cli
 
 import (
 	"context"
+	"sync"
 	"sync/atomic"
 
 	"github.com/pkg/errors"
@@ -15,6 +16,9 @@ var (
 
 	contentVerifyIDs      = contentVerifyCommand.Arg("id", "IDs of blocks to show (or 'all')").Required().Strings()
 	contentVerifyParallel = contentVerifyCommand.Flag("parallel", "Parallelism").Int()
+	contentVerifyRepair   = contentVerifyCommand.Flag("repair", "Reconstruct contents of pack blobs damaged by corruption using erasure coding parity and rewrite them into new pack blobs").Bool()
+
+	contentVerifyCheckedPacks sync.Map
 )
 
 func runContentVerifyCommand(ctx context.Context, rep *repo.Repository) error {
@@ -55,6 +59,13 @@ func verifyAllContents(ctx context.Context, rep *repo.Repository) error {
 }
 
 func contentVerify(ctx context.Context, r *repo.Repository, contentID content.ID) error {
+	if *contentVerifyRepair {
+		if err := repairContentPack(ctx, r, contentID); err != nil {
+			log.Warningf("unable to repair pack of content %v: %v", contentID, err)
+			return err
+		}
+	}
+
 	if _, err := r.Content.GetContent(ctx, contentID); err != nil {
 		log.Warningf("content %v is invalid: %v", contentID, err)
 		return err
@@ -65,6 +76,33 @@ func contentVerify(ctx context.Context, r *repo.Repository, contentID content.ID
 	return nil
 }
 
+// repairContentPack repairs the pack blob containing the provided content, unless it was already checked.
+func repairContentPack(ctx context.Context, r *repo.Repository, contentID content.ID) error {
+	ci, err := r.Content.ContentInfo(ctx, contentID)
+	if err != nil {
+		return err
+	}
+
+	if ci.PackBlobID == "" {
+		return nil
+	}
+
+	if _, checked := contentVerifyCheckedPacks.LoadOrStore(ci.PackBlobID, true); checked {
+		return nil
+	}
+
+	repaired, err := r.Content.RepairPackBlob(ctx, ci.PackBlobID)
+	if err != nil {
+		return err
+	}
+
+	if repaired > 0 {
+		log.Noticef("repaired %v corrupted shards of pack blob %v", repaired, ci.PackBlobID)
+	}
+
+	return nil
+}
+
 func init() {
 	contentVerifyCommand.Action(repositoryAction(runContentVerifyCommand))
 }
@@ -3,6 +3,8 @@ package cli
 import (
 	"context"
 
+	"github.com/pkg/errors"
+
 	"github.com/kopia/kopia/repo"
 	"github.com/kopia/kopia/repo/content"
 )
@@ -16,6 +18,10 @@ var (
 )
 
 func runOptimizeCommand(ctx context.Context, rep *repo.Repository) error {
+	if err := rep.CheckDeletionAllowed(); err != nil {
+		return errors.Wrap(err, "index compaction is not allowed")
+	}
+
 	return rep.Content.CompactIndexes(ctx, content.CompactOptions{
 		MinSmallBlobs:        *optimizeMinSmallBlobs,
 		MaxSmallBlobs:        *optimizeMaxSmallBlobs,
@@ -0,0 +1,70 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/content"
+)
+
+var (
+	indexRebuildCommand    = indexCommands.Command("rebuild", "Rebuild all indexes from pack blobs and report differences with current indexes")
+	indexRebuildParallel   = indexRebuildCommand.Flag("parallel", "Number of pack blobs to read in parallel").Default("8").Int()
+	indexRebuildCommit     = indexRebuildCommand.Flag("commit", "Replace current index blobs with rebuilt index").Bool()
+	indexRebuildReportFile = indexRebuildCommand.Flag("report-file", "Write JSON report to the provided file instead of stdout").String()
+)
+
+func runIndexRebuildCommand(ctx context.Context, rep *repo.Repository) error {
+	if *indexRebuildCommit {
+		if err := rep.CheckDeletionAllowed(); err != nil {
+			return errors.Wrap(err, "index rebuild is not allowed")
+		}
+	}
+
+	report, err := rep.Content.RebuildIndex(ctx, content.IndexRebuildOptions{
+		Parallel: *indexRebuildParallel,
+		Commit:   *indexRebuildCommit,
+	})
+	if report != nil {
+		if werr := writeIndexRebuildReport(report); werr != nil {
+			return werr
+		}
+
+		printStderr("Scanned %v pack blobs (%v failed), recovered %v contents, %v committed.\n",
+			report.PackBlobsScanned, len(report.FailedPackBlobs), report.ContentsRecovered, report.ContentsCommitted)
+		printStderr("Missing: %v, extra: %v, conflicting: %v\n", len(report.Missing), len(report.Extra), len(report.Conflicting))
+
+		switch {
+		case report.Committed:
+			printStderr("Wrote %v index blobs with %v contents, deleted %v old index blobs.\n",
+				len(report.WrittenIndexBlobs), report.RebuiltIndexContents, len(report.DeletedIndexBlobs))
+		case report.HasDifferences() && !*indexRebuildCommit:
+			printStderr("Indexes differ from pack blobs, re-run with --commit to replace them.\n")
+		}
+	}
+
+	return err
+}
+
+func writeIndexRebuildReport(report *content.IndexRebuildReport) error {
+	b, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "unable to marshal report")
+	}
+
+	if *indexRebuildReportFile != "" {
+		return ioutil.WriteFile(*indexRebuildReportFile, append(b, '\n'), 0600) //nolint:gomnd
+	}
+
+	printStdout("%s\n", b)
+
+	return nil
+}
+
+func init() {
+	indexRebuildCommand.Action(repositoryAction(runIndexRebuildCommand))
+}
@@ -22,6 +22,9 @@ var (
 	policySetInterval   = policySetCommand.Flag("snapshot-interval", "Interval between snapshots").DurationList()
 	policySetTimesOfDay = policySetCommand.Flag("snapshot-time", "Times of day when to take snapshot (HH:mm)").Strings()
 
+	// Bandwidth schedule.
+	policySetBandwidthSchedule = policySetCommand.Flag("bandwidth-schedule", "Daily window with storage bandwidth limits in bytes per second, which lower limits configured for the repository, 0 means no additional limit (or 'inherit')").PlaceHolder("HH:mm-HH:mm=UPLOAD[/DOWNLOAD]").Strings()
+
 	// Expiration policies.
 	policySetKeepLatest  = policySetCommand.Flag("keep-latest", "Number of most recent backups to keep per source (or 'inherit')").PlaceHolder("N").String()
 	policySetKeepHourly  = policySetCommand.Flag("keep-hourly", "Number of most-recent hourly backups to keep per source (or 'inherit')").PlaceHolder("N").String()
@@ -56,6 +59,20 @@ var (
 	policySetClearDotIgnore  = policySetCommand.Flag("clear-dot-ignore", "Clear list of paths in the dot-ignore list").Bool()
 	policySetMaxFileSize     = policySetCommand.Flag("max-file-size", "Exclude files above given size").PlaceHolder("N").String()
 
+	// Extended attributes.
+	policySetExtendedAttributes = policySetCommand.Flag("xattrs", "Capture extended attributes, including POSIX ACLs and SELinux labels (or 'inherit')").Enum("true", "false", inheritPolicyString)
+
+	// Special files.
+	policySetSpecialFiles = policySetCommand.Flag("special-files", "Capture named pipes, device nodes and sockets, which older versions of kopia can't read (or 'inherit')").Enum("true", "false", inheritPolicyString)
+
+	// Actions.
+	policySetBeforeFolderAction       = policySetCommand.Flag("before-folder-action", "Command to run before snapshotting the folder, with arguments separated by spaces (or 'inherit')").PlaceHolder("COMMAND").String()
+	policySetAfterFolderAction        = policySetCommand.Flag("after-folder-action", "Command to run after snapshotting the folder, with arguments separated by spaces (or 'inherit')").PlaceHolder("COMMAND").String()
+	policySetBeforeSnapshotRootAction = policySetCommand.Flag("before-snapshot-root-action", "Command to run before snapshotting the root of a source, with arguments separated by spaces (or 'inherit')").PlaceHolder("COMMAND").String()
+	policySetAfterSnapshotRootAction  = policySetCommand.Flag("after-snapshot-root-action", "Command to run after snapshotting the root of a source, with arguments separated by spaces (or 'inherit')").PlaceHolder("COMMAND").String()
+	policySetActionCommandTimeout     = policySetCommand.Flag("action-command-timeout", "Maximum duration of action commands being set").Duration()
+	policySetActionCommandMode        = policySetCommand.Flag("action-command-mode", "Whether failures of action commands being set fail the snapshot").Default(policy.ActionModeFail).Enum(policy.ActionModeFail, policy.ActionModeWarn)
+
 	// General policy.
 	policySetInherit = policySetCommand.Flag(inheritPolicyString, "Enable or disable inheriting policies from the parent").BoolList()
 )
@@ -92,6 +109,11 @@ func setPolicy(ctx context.Context, rep *repo.Repository) error {
 			return errors.New("no changes specified")
 		}
 
+		// actions are not inherited from global and host policies, which apply to many clients.
+		if target.UserName == "" && p.Actions != (policy.ActionsPolicy{}) {
+			return errors.Errorf("actions can't be defined in global or host policies")
+		}
+
 		if err := policy.SetPolicy(ctx, rep, target, p); err != nil {
 			return errors.Wrapf(err, "can't save policy for %v", target)
 		}
@@ -115,6 +137,10 @@ func setPolicyFromFlags(p *policy.Policy, changeCount *int) error {
 		return errors.Wrap(err, "scheduling policy")
 	}
 
+	if err := setActionsFromFlags(&p.Actions, changeCount); err != nil {
+		return errors.Wrap(err, "actions")
+	}
+
 	if err := applyPolicyNumber64("maximum file size", &p.FilesPolicy.MaxFileSize, *policySetMaxFileSize, changeCount); err != nil {
 		return errors.Wrap(err, "maximum file size")
 	}
@@ -149,6 +175,31 @@ func setFilesPolicyFromFlags(fp *policy.FilesPolicy, changeCount *int) {
 	} else {
 		fp.IgnoreRules = addRemoveDedupeAndSort("ignored files", fp.IgnoreRules, *policySetAddIgnore, *policySetRemoveIgnore, changeCount)
 	}
+
+	setOptionalBoolFromFlag("capturing of extended attributes", *policySetExtendedAttributes, &fp.ExtendedAttributes, changeCount)
+	setOptionalBoolFromFlag("capturing of special files", *policySetSpecialFiles, &fp.SpecialFiles, changeCount)
+}
+
+// setOptionalBoolFromFlag applies the value of a 'true', 'false' or 'inherit' flag to an optional policy setting.
+func setOptionalBoolFromFlag(desc, v string, val **bool, changeCount *int) {
+	switch v {
+	case "":
+		// not set
+	case inheritPolicyString:
+		*changeCount++
+
+		*val = nil
+
+		printStderr(" - inheriting %v from parent\n", desc)
+
+	default:
+		*changeCount++
+
+		b := v == "true"
+		*val = &b
+
+		printStderr(" - setting %v to %v\n", desc, b)
+	}
 }
 
 func setRetentionPolicyFromFlags(rp *policy.RetentionPolicy, changeCount *int) error {
@@ -214,6 +265,33 @@ func setSchedulingPolicyFromFlags(sp *policy.SchedulingPolicy, changeCount *int)
 		}
 	}
 
+	if len(*policySetBandwidthSchedule) > 0 {
+		var windows []policy.BandwidthWindow
+
+		for _, s := range *policySetBandwidthSchedule {
+			if s == inheritPolicyString {
+				windows = nil
+				break
+			}
+
+			var w policy.BandwidthWindow
+			if err := w.Parse(s); err != nil {
+				return errors.Wrap(err, "unable to parse bandwidth schedule")
+			}
+
+			windows = append(windows, w)
+		}
+		*changeCount++
+
+		sp.BandwidthSchedule = windows
+
+		if windows == nil {
+			printStderr(" - resetting bandwidth schedule to default value inherited from parent\n")
+		} else {
+			printStderr(" - setting bandwidth schedule to %v\n", windows)
+		}
+	}
+
 	return nil
 }
 
@@ -265,6 +343,61 @@ func setCompressionPolicyFromFlags(p *policy.CompressionPolicy, changeCount *int
 	return nil
 }
 
+func setActionsFromFlags(p *policy.ActionsPolicy, changeCount *int) error {
+	if err := setActionCommandFromFlags("before-folder", &p.BeforeFolder, *policySetBeforeFolderAction, changeCount); err != nil {
+		return err
+	}
+
+	if err := setActionCommandFromFlags("after-folder", &p.AfterFolder, *policySetAfterFolderAction, changeCount); err != nil {
+		return err
+	}
+
+	if err := setActionCommandFromFlags("before-snapshot-root", &p.BeforeSnapshotRoot, *policySetBeforeSnapshotRootAction, changeCount); err != nil {
+		return err
+	}
+
+	return setActionCommandFromFlags("after-snapshot-root", &p.AfterSnapshotRoot, *policySetAfterSnapshotRootAction, changeCount)
+}
+
+func setActionCommandFromFlags(actionName string, cmd **policy.ActionCommand, value string, changeCount *int) error {
+	if value == "" {
+		return nil
+	}
+
+	*changeCount++
+
+	if value == inheritPolicyString {
+		printStderr(" - removing %v action\n", actionName)
+
+		*cmd = nil
+
+		return nil
+	}
+
+	// arguments are separated by whitespace and can't contain it, scripts can be used for more complex commands.
+	fields := strings.Fields(value)
+	if len(fields) == 0 {
+		return errors.Errorf("invalid %v action: missing command", actionName)
+	}
+
+	c := &policy.ActionCommand{
+		Command:        fields[0],
+		Arguments:      fields[1:],
+		TimeoutSeconds: int(policySetActionCommandTimeout.Seconds()),
+		Mode:           *policySetActionCommandMode,
+	}
+
+	if err := c.Validate(); err != nil {
+		return errors.Wrapf(err, "invalid %v action", actionName)
+	}
+
+	printStderr(" - setting %v action to %v\n", actionName, value)
+
+	*cmd = c
+
+	return nil
+}
+
 func addRemoveDedupeAndSort(desc string, base, add, remove []string, changeCount *int) []string {
 	entries := map[string]bool{}
 	for _, b := range base {
@@ -3,6 +3,7 @@ package cli
 import (
 	"context"
 	"fmt"
+	"strings"
 
 	"github.com/pkg/errors"
 
@@ -83,6 +84,8 @@ func printPolicy(p *policy.Policy, parents []*policy.Policy) {
 	printSchedulingPolicy(p, parents)
 	printStdout("\n")
 	printCompressionPolicy(p, parents)
+	printStdout("\n")
+	printActionsPolicy(p, parents)
 }
 
 func printRetentionPolicy(p *policy.Policy, parents []*policy.Policy) {
@@ -153,6 +156,18 @@ func printFilesPolicy(p *policy.Policy, parents []*policy.Policy) {
 				return pol.FilesPolicy.MaxFileSize != 0
 			}))
 	}
+
+	printStdout("  Capture extended attributes: %5v  %v\n",
+		p.FilesPolicy.CaptureExtendedAttributes(),
+		getDefinitionPoint(parents, func(pol *policy.Policy) bool {
+			return pol.FilesPolicy.ExtendedAttributes != nil
+		}))
+
+	printStdout("  Capture special files:       %5v  %v\n",
+		p.FilesPolicy.CaptureSpecialFiles(),
+		getDefinitionPoint(parents, func(pol *policy.Policy) bool {
+			return pol.FilesPolicy.SpecialFiles != nil
+		}))
 }
 
 func printSchedulingPolicy(p *policy.Policy, parents []*policy.Policy) {
@@ -187,6 +202,20 @@ func printSchedulingPolicy(p *policy.Policy, parents []*policy.Policy) {
 		any = true
 	}
 
+	if len(p.SchedulingPolicy.BandwidthSchedule) > 0 {
+		printStdout("  Bandwidth schedule:                    %v\n", getDefinitionPoint(parents, func(pol *policy.Policy) bool {
+			return len(pol.SchedulingPolicy.BandwidthSchedule) > 0
+		}))
+
+		for _, w := range p.SchedulingPolicy.BandwidthSchedule {
+			printStdout("    %v-%v  upload: %v  download: %v\n", w.Start, w.End,
+				formatSpeedLimit(w.MaxUploadSpeedBytesPerSecond),
+				formatSpeedLimit(w.MaxDownloadSpeedBytesPerSecond))
+		}
+
+		any = true
+	}
+
 	if !any {
 		printStdout("  None\n")
 	}
@@ -240,6 +269,49 @@ func printCompressionPolicy(p *policy.Policy, parents []*policy.Policy) {
 	}
 }
 
+func printActionsPolicy(p *policy.Policy, parents []*policy.Policy) {
+	printStdout("Actions:\n")
+
+	any := false
+
+	for _, a := range []struct {
+		name string
+		get  func(pol *policy.Policy) *policy.ActionCommand
+	}{
+		{"Before snapshot root:", func(pol *policy.Policy) *policy.ActionCommand { return pol.Actions.BeforeSnapshotRoot }},
+		{"After snapshot root:", func(pol *policy.Policy) *policy.ActionCommand { return pol.Actions.AfterSnapshotRoot }},
+		{"Before folder:", func(pol *policy.Policy) *policy.ActionCommand { return pol.Actions.BeforeFolder }},
+		{"After folder:", func(pol *policy.Policy) *policy.ActionCommand { return pol.Actions.AfterFolder }},
+	} {
+		a := a
+
+		cmd := a.get(p)
+		if cmd == nil {
+			continue
+		}
+
+		printStdout("  %-22v %v\n", a.name, getDefinitionPoint(parents, func(pol *policy.Policy) bool {
+			return a.get(pol) != nil
+		}))
+		printStdout("    Command: %v\n", strings.Join(append([]string{cmd.Command}, cmd.Arguments...), " "))
+		printStdout("    Timeout: %v  Mode: %v\n", cmd.Timeout(), actionMode(cmd))
+
+		any = true
+	}
+
+	if !any {
+		printStdout("  None\n")
+	}
+}
+
+func actionMode(cmd *policy.ActionCommand) string {
+	if cmd.FailOnError() {
+		return policy.ActionModeFail
+	}
+
+	return policy.ActionModeWarn
+}
+
 func valueOrNotSet(p *int) string {
 	if p == nil {
 		return "-"
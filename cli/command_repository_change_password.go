@@ -0,0 +1,52 @@
+package cli
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo"
+)
+
+var (
+	changePasswordCommand     = repositoryCommands.Command("change-password", "Change repository password.")
+	changePasswordNewPassword = changePasswordCommand.Flag("new-password", "New repository password.").Envar("KOPIA_NEW_PASSWORD").String()
+)
+
+func runChangePasswordCommand(ctx context.Context, rep *repo.Repository) error {
+	newPassword := *changePasswordNewPassword
+
+	if newPassword == "" {
+		var err error
+
+		newPassword, err = askForNewPassword("Enter new repository password: ")
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := rep.ChangePassword(ctx, newPassword); err != nil {
+		return errors.Wrap(err, "unable to change password")
+	}
+
+	if _, ok := getPersistedPassword(repositoryConfigFileName(), getUserName()); ok {
+		if err := persistPassword(repositoryConfigFileName(), getUserName(), newPassword); err != nil {
+			return errors.Wrap(err, "unable to persist new password")
+		}
+	}
+
+	// integrity of local cache is protected using a key derived from the password.
+	if d := rep.Content.CachingOptions.CacheDirectory; d != "" {
+		if err := clearCacheDirectory(d); err != nil {
+			return errors.Wrap(err, "unable to clear cache")
+		}
+	}
+
+	printStderr("Password changed. Other clients must reconnect using the new password.\n")
+
+	return nil
+}
+
+func init() {
+	changePasswordCommand.Action(repositoryAction(runChangePasswordCommand))
+}
@@ -20,6 +20,9 @@ var (
 	connectMaxCacheSizeMB         int64
 	connectMaxMetadataCacheSizeMB int64
 	connectMaxListCacheDuration   time.Duration
+	connectReadOnly               bool
+	connectAppendOnly             bool
+	connectEnableActions          bool
 )
 
 func setupConnectOptions(cmd *kingpin.CmdClause) {
@@ -30,6 +33,9 @@ func setupConnectOptions(cmd *kingpin.CmdClause) {
 	cmd.Flag("content-cache-size-mb", "Size of local content cache").PlaceHolder("MB").Default("5000").Int64Var(&connectMaxCacheSizeMB)
 	cmd.Flag("metadata-cache-size-mb", "Size of local metadata cache").PlaceHolder("MB").Default("500").Int64Var(&connectMaxMetadataCacheSizeMB)
 	cmd.Flag("max-list-cache-duration", "Duration of index cache").Default("600s").Hidden().DurationVar(&connectMaxListCacheDuration)
+	cmd.Flag("readonly", "Make repository read-only to avoid accidental changes").BoolVar(&connectReadOnly)
+	cmd.Flag("append-only", "Allow adding data to the repository, but prevent deleting or overwriting existing blobs").BoolVar(&connectAppendOnly)
+	cmd.Flag("enable-actions", "Allow snapshots to run commands defined as actions in policies stored in the repository").BoolVar(&connectEnableActions)
 }
 
 func connectOptions() repo.ConnectOptions {
@@ -39,6 +45,9 @@ func connectOptions() repo.ConnectOptions {
 			MaxCacheSizeBytes:       connectMaxCacheSizeMB << 20, //nolint:gomnd
 			MaxListCacheDurationSec: int(connectMaxListCacheDuration.Seconds()),
 		},
+		ReadOnly:      connectReadOnly,
+		AppendOnly:    connectAppendOnly,
+		EnableActions: connectEnableActions,
 	}
 }
 
@@ -2,6 +2,7 @@ package cli
 
 import (
 	"context"
+	"strconv"
 	"strings"
 
 	"github.com/pkg/errors"
@@ -18,6 +19,8 @@ var (
 
 	createBlockHashFormat       = createCommand.Flag("block-hash", "Block hash algorithm.").PlaceHolder("ALGO").Default(content.DefaultHash).Enum(content.SupportedHashAlgorithms()...)
 	createBlockEncryptionFormat = createCommand.Flag("encryption", "Block encryption algorithm.").PlaceHolder("ALGO").Default(content.DefaultEncryption).Enum(content.SupportedEncryptionAlgorithms()...)
+	createECC                   = createCommand.Flag("ecc", "Erasure coding scheme used to protect pack blobs against corruption.").PlaceHolder("SCHEME").Default(content.NoECC).Enum(content.SupportedECCSchemes()...)
+	createIndexVersion          = createCommand.Flag("index-version", "Pack index format version, version 2 is required for content compression and key rotation, but can't be read by older versions of kopia.").PlaceHolder("VERSION").Default(strconv.Itoa(content.DefaultIndexVersion)).Enum("1", "2")
 	createSplitter              = createCommand.Flag("object-splitter", "The splitter to use for new objects in the repository").Default(object.DefaultSplitter).Enum(object.SupportedSplitters...)
 
 	createOnly = createCommand.Flag("create-only", "Create repository, but don't connect to it.").Short('c').Bool()
@@ -40,10 +43,14 @@ func init() {
 }
 
 func newRepositoryOptionsFromFlags() *repo.NewRepositoryOptions {
+	indexVersion, _ := strconv.Atoi(*createIndexVersion) // validated by the flag
+
 	return &repo.NewRepositoryOptions{
 		BlockFormat: content.FormattingOptions{
-			Hash:       *createBlockHashFormat,
-			Encryption: *createBlockEncryptionFormat,
+			Hash:         *createBlockHashFormat,
+			Encryption:   *createBlockEncryptionFormat,
+			ECC:          *createECC,
+			IndexVersion: indexVersion,
 		},
 
 		ObjectFormat: object.Format{
@@ -82,6 +89,11 @@ func runCreateCommandWithStorage(ctx context.Context, st blob.Storage) error {
 	printStderr("  block hash:          %v\n", options.BlockFormat.Hash)
 	printStderr("  encryption:          %v\n", options.BlockFormat.Encryption)
 	printStderr("  splitter:            %v\n", options.ObjectFormat.Splitter)
+	printStderr("  index format:        v%v\n", options.BlockFormat.IndexVersion)
+
+	if options.BlockFormat.ECC != content.NoECC {
+		printStderr("  erasure coding:      %v\n", options.BlockFormat.ECC)
+	}
 
 	if err := repo.Initialize(ctx, st, options, password); err != nil {
 		return errors.Wrap(err, "cannot initialize repository")
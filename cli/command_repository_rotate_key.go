@@ -0,0 +1,36 @@
+package cli
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo"
+)
+
+var (
+	rotateKeyCommand = repositoryCommands.Command("rotate-key", "Generate a new master key for encrypting repository contents. "+
+		"Master keys are stored in the format blob, which is encrypted using the repository password, so anyone who knows "+
+		"the password can read the new key as well. If the password may have leaked, also change it using 'kopia repository change-password'.")
+)
+
+func runRotateKeyCommand(ctx context.Context, rep *repo.Repository) error {
+	keyID, err := rep.RotateKey(ctx)
+	if err != nil {
+		return errors.Wrap(err, "unable to rotate key")
+	}
+
+	printStderr("Rotated master key, new contents will be encrypted using key %v.\n", keyID)
+	printStderr("Existing contents remain readable using retired keys. To re-encrypt them, run:\n\n")
+	printStderr("  $ kopia content rewrite --retired-keys\n")
+	printStderr("  $ kopia index optimize --all\n\n")
+	printStderr("Pack blobs left unused by re-encryption can then be removed using 'kopia blob gc'.\n")
+	printStderr("The new key does not protect against a leaked password, since it is encrypted using the password.\n")
+	printStderr("If the password may have leaked, change it using 'kopia repository change-password'.\n")
+
+	return nil
+}
+
+func init() {
+	rotateKeyCommand.Action(repositoryAction(runRotateKeyCommand))
+}
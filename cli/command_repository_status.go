@@ -39,6 +39,7 @@ func runStatusCommand(ctx context.Context, rep *repo.Repository) error {
 	fmt.Printf("Block hash:          %v\n", rep.Content.Format.Hash)
 	fmt.Printf("Block encryption:    %v\n", rep.Content.Format.Encryption)
 	fmt.Printf("Block fmt version:   %v\n", rep.Content.Format.Version)
+	fmt.Printf("Encryption key ID:   %v\n", rep.Content.Format.EncryptionKeyID)
 	fmt.Printf("Max pack length:     %v\n", units.BytesStringBase2(int64(rep.Content.Format.MaxPackSize)))
 	fmt.Printf("Splitter:            %v\n", rep.Objects.Format.Splitter)
 
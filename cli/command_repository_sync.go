@@ -0,0 +1,252 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/units"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/blob"
+)
+
+var (
+	syncToCommand = repositoryCommands.Command("sync-to", "Synchronizes contents of this repository to another location")
+
+	syncToDryRun   = syncToCommand.Flag("dry-run", "Do not perform copying or deletion, only print what would happen").Short('n').Bool()
+	syncToDelete   = syncToCommand.Flag("delete", "Delete blobs in the destination that don't exist in the source").Bool()
+	syncToParallel = syncToCommand.Flag("parallel", "Number of parallel copies").Default("5").Int()
+)
+
+func runSyncWithStorage(ctx context.Context, src, dst blob.Storage) error {
+	defer dst.Close(ctx) //nolint:errcheck
+
+	if err := ensureSameRepository(ctx, src, dst); err != nil {
+		return err
+	}
+
+	printStderr("Looking for blobs to synchronize...\n")
+
+	srcBlobs, err := blob.ListAllBlobs(ctx, src, "")
+	if err != nil {
+		return errors.Wrap(err, "error listing source blobs")
+	}
+
+	dstBlobs, err := listBlobsByID(ctx, dst)
+	if err != nil {
+		return errors.Wrap(err, "error listing destination blobs")
+	}
+
+	var (
+		toCopy      []blob.Metadata
+		totalBytes  int64
+		unchanged   int
+		srcBlobByID = map[blob.ID]bool{}
+	)
+
+	for _, bm := range srcBlobs {
+		srcBlobByID[bm.BlobID] = true
+
+		if d, ok := dstBlobs[bm.BlobID]; ok && d.Length == bm.Length && !d.Timestamp.Before(bm.Timestamp) {
+			unchanged++
+			continue
+		}
+
+		toCopy = append(toCopy, bm)
+		totalBytes += bm.Length
+	}
+
+	var toDelete []blob.Metadata
+
+	for id, bm := range dstBlobs {
+		if !srcBlobByID[id] {
+			toDelete = append(toDelete, bm)
+		}
+	}
+
+	printStderr("Found %v blobs to copy (%v), %v unchanged, %v extraneous in the destination.\n", len(toCopy), units.BytesStringBase10(totalBytes), unchanged, len(toDelete))
+
+	for _, group := range groupBySyncOrder(toCopy) {
+		if err := copyBlobsInParallel(ctx, src, dst, group); err != nil {
+			return err
+		}
+	}
+
+	if len(toDelete) == 0 {
+		return nil
+	}
+
+	if !*syncToDelete {
+		printStderr("Not deleting %v extraneous blobs, pass --delete to delete them.\n", len(toDelete))
+		return nil
+	}
+
+	for _, bm := range toDelete {
+		if *syncToDryRun {
+			printStderr("Would delete %v (%v)\n", bm.BlobID, units.BytesStringBase10(bm.Length))
+			continue
+		}
+
+		printStderr("Deleting %v (%v)\n", bm.BlobID, units.BytesStringBase10(bm.Length))
+
+		if err := dst.DeleteBlob(ctx, bm.BlobID); err != nil {
+			return errors.Wrapf(err, "error deleting %v", bm.BlobID)
+		}
+	}
+
+	return nil
+}
+
+// syncOrder returns the order in which blobs are copied, so that the destination remains usable if
+// synchronization is interrupted: pack blobs first, followed by indexes and the format blob last.
+func syncOrder(id blob.ID) int {
+	switch {
+	case id == repo.FormatBlobID:
+		return 2 //nolint:gomnd
+	case strings.HasPrefix(string(id), "n"):
+		return 1
+	default:
+		return 0
+	}
+}
+
+// groupBySyncOrder splits blobs into groups that must be copied one after another.
+func groupBySyncOrder(blobs []blob.Metadata) [][]blob.Metadata {
+	sort.Slice(blobs, func(i, j int) bool {
+		return syncOrder(blobs[i].BlobID) < syncOrder(blobs[j].BlobID)
+	})
+
+	var result [][]blob.Metadata
+
+	for i, bm := range blobs {
+		if i == 0 || syncOrder(bm.BlobID) != syncOrder(blobs[i-1].BlobID) {
+			result = append(result, nil)
+		}
+
+		result[len(result)-1] = append(result[len(result)-1], bm)
+	}
+
+	return result
+}
+
+func copyBlobsInParallel(ctx context.Context, src, dst blob.Storage, toCopy []blob.Metadata) error {
+	ch := make(chan blob.Metadata)
+	errch := make(chan error, *syncToParallel)
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < *syncToParallel; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for bm := range ch {
+				if err := syncCopyBlob(ctx, src, dst, bm); err != nil {
+					errch <- err
+					return
+				}
+			}
+		}()
+	}
+
+	var err error
+
+	for i := 0; i < len(toCopy) && err == nil; i++ {
+		select {
+		case ch <- toCopy[i]:
+		case err = <-errch:
+		}
+	}
+
+	close(ch)
+	wg.Wait()
+	close(errch)
+
+	if err != nil {
+		return err
+	}
+
+	return <-errch
+}
+
+func syncCopyBlob(ctx context.Context, src, dst blob.Storage, bm blob.Metadata) error {
+	if *syncToDryRun {
+		printStderr("Would copy %v (%v)\n", bm.BlobID, units.BytesStringBase10(bm.Length))
+		return nil
+	}
+
+	printStderr("Copying %v (%v)\n", bm.BlobID, units.BytesStringBase10(bm.Length))
+
+	data, err := src.GetBlob(ctx, bm.BlobID, 0, -1)
+	if err != nil {
+		return errors.Wrapf(err, "error reading %v", bm.BlobID)
+	}
+
+	if err := dst.PutBlob(ctx, bm.BlobID, data); err != nil {
+		return errors.Wrapf(err, "error writing %v", bm.BlobID)
+	}
+
+	return nil
+}
+
+func listBlobsByID(ctx context.Context, st blob.Storage) (map[blob.ID]blob.Metadata, error) {
+	result := map[blob.ID]blob.Metadata{}
+
+	err := st.ListBlobs(ctx, "", func(bm blob.Metadata) error {
+		result[bm.BlobID] = bm
+		return nil
+	})
+
+	return result, err
+}
+
+// ensureSameRepository verifies that the destination is either empty or contains the same repository
+// as the source, to prevent accidentally overwriting or deleting unrelated data.
+func ensureSameRepository(ctx context.Context, src, dst blob.Storage) error {
+	srcID, err := readRepositoryUniqueID(ctx, src)
+	if err != nil {
+		return errors.Wrap(err, "unable to read source repository format")
+	}
+
+	dstID, err := readRepositoryUniqueID(ctx, dst)
+
+	switch {
+	case err == blob.ErrBlobNotFound:
+		if err := ensureEmpty(ctx, dst); err != nil {
+			return errors.Wrap(err, "destination does not contain a repository")
+		}
+
+		return nil
+
+	case err != nil:
+		return errors.Wrap(err, "unable to read destination repository format")
+
+	case dstID != srcID:
+		return errors.New("destination contains a different repository")
+
+	default:
+		return nil
+	}
+}
+
+func readRepositoryUniqueID(ctx context.Context, st blob.Storage) (string, error) {
+	b, err := st.GetBlob(ctx, repo.FormatBlobID, 0, -1)
+	if err != nil {
+		return "", err
+	}
+
+	var f struct {
+		UniqueID []byte `json:"uniqueID"`
+	}
+
+	if err := json.Unmarshal(b, &f); err != nil {
+		return "", errors.Wrap(err, "invalid format blob")
+	}
+
+	return string(f.UniqueID), nil
+}
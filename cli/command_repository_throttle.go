@@ -0,0 +1,62 @@
+package cli
+
+import (
+	"context"
+
+	"github.com/kopia/kopia/internal/units"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/blob/throttling"
+)
+
+var (
+	repositoryThrottleCommand       = repositoryCommands.Command("throttle", "Show or change storage bandwidth limits persisted in the repository configuration")
+	repositoryThrottleUploadSpeed   = repositoryThrottleCommand.Flag("max-upload-speed", "Maximum upload speed, 0 means unlimited").PlaceHolder("BYTES_PER_SEC").Default("-1").Int()
+	repositoryThrottleDownloadSpeed = repositoryThrottleCommand.Flag("max-download-speed", "Maximum download speed, 0 means unlimited").PlaceHolder("BYTES_PER_SEC").Default("-1").Int()
+)
+
+func runRepositoryThrottleCommand(ctx context.Context, rep *repo.Repository) error {
+	limits, changed := applyThrottlingFlags(rep.ThrottlingLimits(), *repositoryThrottleUploadSpeed, *repositoryThrottleDownloadSpeed)
+	if changed {
+		if err := rep.SetThrottlingLimits(limits); err != nil {
+			return err
+		}
+	}
+
+	printThrottlingLimits(limits)
+
+	return nil
+}
+
+// applyThrottlingFlags updates the provided limits with values of flags, where -1 means no change.
+func applyThrottlingFlags(limits throttling.Limits, upload, download int) (throttling.Limits, bool) {
+	changed := false
+
+	if upload != -1 {
+		limits.MaxUploadSpeedBytesPerSecond = upload
+		changed = true
+	}
+
+	if download != -1 {
+		limits.MaxDownloadSpeedBytesPerSecond = download
+		changed = true
+	}
+
+	return limits, changed
+}
+
+func printThrottlingLimits(limits throttling.Limits) {
+	printStdout("Max upload speed:   %v\n", formatSpeedLimit(limits.MaxUploadSpeedBytesPerSecond))
+	printStdout("Max download speed: %v\n", formatSpeedLimit(limits.MaxDownloadSpeedBytesPerSecond))
+}
+
+func formatSpeedLimit(bytesPerSecond int) string {
+	if bytesPerSecond <= 0 {
+		return "unlimited"
+	}
+
+	return units.BytesStringBase10(int64(bytesPerSecond)) + "/s"
+}
+
+func init() {
+	repositoryThrottleCommand.Action(repositoryAction(runRepositoryThrottleCommand))
+}
@@ -45,18 +45,21 @@ var (
 
 	restoreOverwriteDirectories = true
 	restoreOverwriteFiles       = true
+	restoreExtendedAttributes   = false
 )
 
 func addRestoreFlags(cmd *kingpin.CmdClause) {
 	cmd.Flag("overwrite-directories", "Overwrite existing directories").BoolVar(&restoreOverwriteDirectories)
 	cmd.Flag("overwrite-files", "Specifies whether or not to overwrite already existing files").
 		BoolVar(&restoreOverwriteFiles)
+	cmd.Flag("xattrs", "Restore extended attributes, including POSIX ACLs and SELinux labels, and remove attributes that are not in the snapshot").BoolVar(&restoreExtendedAttributes)
 }
 
 func restoreOptions() localfs.CopyOptions {
 	return localfs.CopyOptions{
-		OverwriteDirectories: restoreOverwriteDirectories,
-		OverwriteFiles:       restoreOverwriteFiles,
+		OverwriteDirectories:      restoreOverwriteDirectories,
+		OverwriteFiles:            restoreOverwriteFiles,
+		RestoreExtendedAttributes: restoreExtendedAttributes,
 	}
 }
 
@@ -0,0 +1,36 @@
+package cli
+
+import (
+	"context"
+
+	"github.com/kopia/kopia/internal/serverapi"
+	"github.com/kopia/kopia/repo/blob/throttling"
+)
+
+var (
+	serverThrottleCommand       = serverCommands.Command("throttle", "Show or change storage bandwidth limits of a running server")
+	serverThrottleUploadSpeed   = serverThrottleCommand.Flag("max-upload-speed", "Maximum upload speed, 0 means unlimited").PlaceHolder("BYTES_PER_SEC").Default("-1").Int()
+	serverThrottleDownloadSpeed = serverThrottleCommand.Flag("max-download-speed", "Maximum download speed, 0 means unlimited").PlaceHolder("BYTES_PER_SEC").Default("-1").Int()
+)
+
+func init() {
+	serverThrottleCommand.Action(serverAction(runServerThrottle))
+}
+
+func runServerThrottle(ctx context.Context, cli *serverapi.Client) error {
+	var limits throttling.Limits
+	if err := cli.Get("throttle", &limits); err != nil {
+		return err
+	}
+
+	limits, changed := applyThrottlingFlags(limits, *serverThrottleUploadSpeed, *serverThrottleDownloadSpeed)
+	if changed {
+		if err := cli.Post("throttle/set", &limits, &limits); err != nil {
+			return err
+		}
+	}
+
+	printThrottlingLimits(limits)
+
+	return nil
+}
@@ -8,9 +8,12 @@ import (
 )
 
 var (
-	snapshotGCCommand       = snapshotCommands.Command("gc", "Remove contents not used by any snapshot")
+	snapshotGCCommand = snapshotCommands.Command("gc", "Remove contents not used by any snapshot. "+
+		"Contents are only deleted when they were already found to be unused by the previous run with --delete, "+
+		"so the first run only marks them for deletion. No contents are deleted while any snapshot is being "+
+		"created, including by other hosts, until their write sessions end or time out.")
 	snapshotGCMinContentAge = snapshotGCCommand.Flag("min-age", "Minimum content age to allow deletion").Default("24h").Duration()
-	snapshotGCDelete        = snapshotGCCommand.Flag("delete", "Delete unreferenced contents").Bool()
+	snapshotGCDelete        = snapshotGCCommand.Flag("delete", "Mark unreferenced contents for deletion and delete contents marked by the previous run").Bool()
 )
 
 func runSnapshotGCCommand(ctx context.Context, rep *repo.Repository) error {
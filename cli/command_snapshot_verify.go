@@ -134,11 +134,16 @@ func (v *verifier) doVerifyDirectory(ctx context.Context, oid object.ID, path st
 		objectID := e.(object.HasObjectID).ObjectID()
 		childPath := path + "/" + e.Name()
 
-		if e.IsDir() {
+		switch {
+		case e.IsDir():
 			v.enqueueVerifyDirectory(ctx, objectID, childPath)
-		} else {
+		case objectID != "":
 			v.enqueueVerifyObject(ctx, objectID, childPath)
 		}
+
+		if h, ok := e.(snapshot.HasDirEntry); ok && h.DirEntry().ExtendedAttributesObjectID != "" {
+			v.enqueueVerifyObject(ctx, h.DirEntry().ExtendedAttributesObjectID, childPath+" (extended attributes)")
+		}
 	}
 
 	return nil
@@ -0,0 +1,32 @@
+package cli
+
+import (
+	"context"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/blob/azure"
+)
+
+func init() {
+	var options azure.Options
+
+	RegisterStorageConnectFlags(
+		"azure",
+		"an Azure blob storage",
+		func(cmd *kingpin.CmdClause) {
+			cmd.Flag("container", "Name of the Azure blob container").Required().StringVar(&options.Container)
+			cmd.Flag("storage-account", "Azure storage account name (overrides AZURE_STORAGE_ACCOUNT environment variable)").Required().Envar("AZURE_STORAGE_ACCOUNT").StringVar(&options.StorageAccount)
+			cmd.Flag("storage-key", "Azure storage account key (overrides AZURE_STORAGE_KEY environment variable)").Required().Envar("AZURE_STORAGE_KEY").StringVar(&options.StorageKey)
+			cmd.Flag("storage-domain", "Azure storage domain").Default("").StringVar(&options.StorageDomain)
+			cmd.Flag("endpoint", "Override the storage service endpoint URL (e.g. when using Azurite emulator)").StringVar(&options.Endpoint)
+			cmd.Flag("prefix", "Prefix to use for objects in the bucket").StringVar(&options.Prefix)
+			cmd.Flag("max-download-speed", "Limit the download speed.").PlaceHolder("BYTES_PER_SEC").IntVar(&options.MaxDownloadSpeedBytesPerSecond)
+			cmd.Flag("max-upload-speed", "Limit the upload speed.").PlaceHolder("BYTES_PER_SEC").IntVar(&options.MaxUploadSpeedBytesPerSecond)
+		},
+		func(ctx context.Context, isNew bool) (blob.Storage, error) {
+			return azure.New(ctx, &options)
+		},
+	)
+}
@@ -0,0 +1,66 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+
+	"github.com/pkg/errors"
+	"gopkg.in/alecthomas/kingpin.v2"
+
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/blob/mirror"
+)
+
+// loadStorageConnectionInfo reads storage connection information from either a repository
+// configuration file or a JSON file containing just the storage type and configuration.
+func loadStorageConnectionInfo(fileName string) (blob.ConnectionInfo, error) {
+	b, err := ioutil.ReadFile(fileName) //nolint:gosec
+	if err != nil {
+		return blob.ConnectionInfo{}, errors.Wrap(err, "unable to read storage configuration")
+	}
+
+	var lc repo.LocalConfig
+	if err := lc.Load(bytes.NewReader(b)); err != nil {
+		return blob.ConnectionInfo{}, errors.Wrapf(err, "unable to parse %v", fileName)
+	}
+
+	if lc.Storage.Type != "" {
+		return lc.Storage, nil
+	}
+
+	var ci blob.ConnectionInfo
+	if err := json.Unmarshal(b, &ci); err != nil {
+		return blob.ConnectionInfo{}, errors.Wrapf(err, "unable to parse %v", fileName)
+	}
+
+	return ci, nil
+}
+
+func init() {
+	var replicaFiles []string
+
+	RegisterStorageConnectFlags(
+		"mirror",
+		"multiple mirrored storages",
+		func(cmd *kingpin.CmdClause) {
+			cmd.Flag("replica", "Path to configuration file of a replica storage, repeat for each replica (the first one is used for reads)").Required().StringsVar(&replicaFiles)
+		},
+		func(ctx context.Context, isNew bool) (blob.Storage, error) {
+			var opt mirror.Options
+
+			for _, f := range replicaFiles {
+				ci, err := loadStorageConnectionInfo(f)
+				if err != nil {
+					return nil, err
+				}
+
+				opt.Replicas = append(opt.Replicas, ci)
+			}
+
+			return mirror.New(ctx, &opt)
+		},
+	)
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/pkg/errors"
 	kingpin "gopkg.in/alecthomas/kingpin.v2"
 
+	"github.com/kopia/kopia/repo"
 	"github.com/kopia/kopia/repo/blob"
 )
 
@@ -29,6 +30,18 @@ func RegisterStorageConnectFlags(
 
 			return runCreateCommandWithStorage(ctx, st)
 		})
+
+		// Set up 'sync-to' subcommand, the destination is created if it does not exist.
+		cc = syncToCommand.Command(name, "Synchronize repository data to another repository in "+description)
+		flags(cc)
+		cc.Action(repositoryAction(func(ctx context.Context, rep *repo.Repository) error {
+			st, err := connect(ctx, true)
+			if err != nil {
+				return errors.Wrap(err, "can't connect to storage")
+			}
+
+			return runSyncWithStorage(ctx, rep.Blobs, st)
+		}))
 	}
 
 	// Set up 'connect' subcommand
@@ -0,0 +1,39 @@
+package cli
+
+import (
+	"context"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/blob/rclone"
+)
+
+func init() {
+	var (
+		options     rclone.Options
+		connectFlat bool
+	)
+
+	RegisterStorageConnectFlags(
+		"rclone",
+		"an rclone-based provider",
+		func(cmd *kingpin.CmdClause) {
+			cmd.Flag("remote-path", "RClone remote:path").Required().StringVar(&options.RemotePath)
+			cmd.Flag("flat", "Use flat directory structure").BoolVar(&connectFlat)
+			cmd.Flag("rclone-exe", "Path to rclone binary").StringVar(&options.RCloneExe)
+			cmd.Flag("rclone-args", "Pass additional parameters to rclone").StringsVar(&options.RCloneArgs)
+			cmd.Flag("rclone-env", "Pass additional environment (key=value) to rclone").StringsVar(&options.RCloneEnv)
+			cmd.Flag("rclone-debug", "Log rclone output").BoolVar(&options.Debug)
+		},
+		func(ctx context.Context, isNew bool) (blob.Storage, error) {
+			ro := options
+
+			if connectFlat {
+				ro.DirectoryShards = []int{}
+			}
+
+			return rclone.New(ctx, &ro)
+		},
+	)
+}
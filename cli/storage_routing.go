@@ -0,0 +1,57 @@
+package cli
+
+import (
+	"context"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/alecthomas/kingpin.v2"
+
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/blob/routing"
+)
+
+func init() {
+	var (
+		defaultStorageFile string
+		routeSpecs         []string
+	)
+
+	RegisterStorageConnectFlags(
+		"routing",
+		"multiple storages selected by blob ID prefix",
+		func(cmd *kingpin.CmdClause) {
+			cmd.Flag("default", "Path to configuration file of the storage used for blobs not matching any route").Required().StringVar(&defaultStorageFile)
+			cmd.Flag("route", "Route blobs with the given prefix to the storage described in configuration file (can be repeated)").PlaceHolder("PREFIX=FILE").StringsVar(&routeSpecs)
+		},
+		func(ctx context.Context, isNew bool) (blob.Storage, error) {
+			var opt routing.Options
+
+			ci, err := loadStorageConnectionInfo(defaultStorageFile)
+			if err != nil {
+				return nil, err
+			}
+
+			opt.Default = ci
+
+			for _, spec := range routeSpecs {
+				parts := strings.SplitN(spec, "=", 2) //nolint:gomnd
+				if len(parts) != 2 {
+					return nil, errors.Errorf("invalid route %q, expected PREFIX=FILE", spec)
+				}
+
+				ci, err := loadStorageConnectionInfo(parts[1])
+				if err != nil {
+					return nil, err
+				}
+
+				opt.Routes = append(opt.Routes, routing.Route{
+					Prefix:  blob.ID(parts[0]),
+					Storage: ci,
+				})
+			}
+
+			return routing.New(ctx, &opt)
+		},
+	)
+}
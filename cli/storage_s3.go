@@ -25,6 +25,8 @@ func init() {
 			cmd.Flag("disable-tls", "Disable TLS security (HTTPS)").BoolVar(&s3options.DoNotUseTLS)
 			cmd.Flag("max-download-speed", "Limit the download speed.").PlaceHolder("BYTES_PER_SEC").IntVar(&s3options.MaxDownloadSpeedBytesPerSecond)
 			cmd.Flag("max-upload-speed", "Limit the upload speed.").PlaceHolder("BYTES_PER_SEC").IntVar(&s3options.MaxUploadSpeedBytesPerSecond)
+			cmd.Flag("retention-mode", "Object lock retention mode to apply to written blobs (requires bucket with object lock enabled)").EnumVar(&s3options.RetentionMode, "GOVERNANCE", "COMPLIANCE")
+			cmd.Flag("retention-period", "Object lock retention period").DurationVar(&s3options.RetentionPeriod)
 		},
 		func(ctx context.Context, isNew bool) (blob.Storage, error) {
 			return s3.New(ctx, &s3options)
@@ -1,6 +1,7 @@
 package fs
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"io"
@@ -9,10 +10,12 @@ import (
 	"time"
 )
 
-// Entry represents a filesystem entry, which can be Directory, File, or Symlink
+// Entry represents a filesystem entry, which can be Directory, File, Symlink or Special
 type Entry interface {
 	os.FileInfo
 	Owner() OwnerInfo
+	ExtendedAttributes(ctx context.Context) (ExtendedAttributes, error)
+	LinkInfo() LinkInfo
 }
 
 // OwnerInfo describes owner of a filesystem entry
@@ -21,6 +24,39 @@ type OwnerInfo struct {
 	GroupID uint32
 }
 
+// LinkInfo identifies the file underlying a filesystem entry by its device and inode numbers, which allows
+// detecting hard links. Zero value indicates that the information is not available.
+type LinkInfo struct {
+	Device uint64
+	Inode  uint64
+	Links  uint64
+}
+
+// IsHardLink returns true if the entry is one of multiple hard links to the same file.
+func (li LinkInfo) IsHardLink() bool {
+	return li.Links > 1
+}
+
+// ExtendedAttributes maps names of extended attributes of a filesystem entry to their values.
+// POSIX ACLs are represented as 'system.posix_acl_access' and 'system.posix_acl_default' attributes.
+type ExtendedAttributes map[string][]byte
+
+// Equal returns true if both sets of extended attributes have the same names and values.
+func (a ExtendedAttributes) Equal(other ExtendedAttributes) bool {
+	if len(a) != len(other) {
+		return false
+	}
+
+	for k, v := range a {
+		ov, ok := other[k]
+		if !ok || !bytes.Equal(v, ov) {
+			return false
+		}
+	}
+
+	return true
+}
+
 // Entries is a list of entries sorted by name.
 type Entries []Entry
 
@@ -32,6 +68,17 @@ type Reader interface {
 	Entry() (Entry, error)
 }
 
+// Hole describes a range of a sparse file that contains no data and reads as zeros.
+type Hole struct {
+	Offset int64 `json:"off"`
+	Length int64 `json:"len"`
+}
+
+// SparseReader is implemented by readers of sparse files, which can report ranges of the file that contain no data.
+type SparseReader interface {
+	Holes() ([]Hole, error)
+}
+
 // File represents an entry that is a file.
 type File interface {
 	Entry
@@ -80,6 +127,19 @@ type Symlink interface {
 	Readlink(ctx context.Context) (string, error)
 }
 
+// Special represents an entry that is neither a file, a directory nor a symbolic link, such as a named pipe,
+// a device node or a socket. The kind of the entry is indicated by its Mode().
+type Special interface {
+	Entry
+	Device() DeviceInfo
+}
+
+// DeviceInfo describes major and minor numbers of a device node.
+type DeviceInfo struct {
+	Major uint32 `json:"major"`
+	Minor uint32 `json:"minor"`
+}
+
 // FindByName returns an entry with a given name, or nil if not found.
 func (e Entries) FindByName(n string) Entry {
 	i := sort.Search(
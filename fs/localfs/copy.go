@@ -3,6 +3,7 @@ package localfs
 import (
 	"context"
 	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 
@@ -12,6 +13,8 @@ import (
 	"github.com/kopia/kopia/fs"
 )
 
+var errSpecialNotSupported = errors.New("special files are not supported on this platform")
+
 // CopyOptions contains the options for copying a file system tree
 type CopyOptions struct {
 	// If a directory already exists, overwrite the directory.
@@ -20,6 +23,9 @@ type CopyOptions struct {
 	// the copier does not modify already existing files and returns an error
 	// instead.
 	OverwriteFiles bool
+	// Restore extended attributes, including POSIX ACLs and SELinux labels, and remove
+	// attributes of existing files and directories that are not in the snapshot.
+	RestoreExtendedAttributes bool
 }
 
 // Copy copies e into targetPath in the local file system. If e is an
@@ -36,13 +42,16 @@ func Copy(ctx context.Context, targetPath string, e fs.Entry, opt CopyOptions) e
 		return err
 	}
 
-	c := copier{CopyOptions: opt}
+	c := copier{CopyOptions: opt, hardLinks: map[fs.LinkInfo]string{}}
 
 	return c.copyEntry(ctx, e, targetPath)
 }
 
 type copier struct {
 	CopyOptions
+
+	// paths of restored files that have other hard links, keyed by the original device and inode
+	hardLinks map[fs.LinkInfo]string
 }
 
 func (c *copier) copyEntry(ctx context.Context, e fs.Entry, targetPath string) error {
@@ -52,11 +61,20 @@ func (c *copier) copyEntry(ctx context.Context, e fs.Entry, targetPath string) e
 	case fs.Directory:
 		err = c.copyDirectory(ctx, e, targetPath)
 	case fs.File:
+		if existing := c.hardLinks[hardLinkKey(e)]; existing != "" {
+			return c.createHardLink(existing, targetPath)
+		}
+
 		err = c.copyFileContent(ctx, targetPath, e)
 	case fs.Symlink:
 		// Not yet implemented
 		log.Warningf("Not creating symlink %q from %v", targetPath, e)
 		return nil
+	case fs.Special:
+		if err = c.createSpecial(targetPath, e); err == errSpecialNotSupported || os.IsPermission(err) {
+			log.Warningf("Not creating special file %q: %v", targetPath, err)
+			return nil
+		}
 	default:
 		return errors.Errorf("invalid FS entry type for %q: %#v", targetPath, e)
 	}
@@ -65,11 +83,69 @@ func (c *copier) copyEntry(ctx context.Context, e fs.Entry, targetPath string) e
 		return err
 	}
 
-	return c.setAttributes(targetPath, e)
+	if err := c.setAttributes(ctx, targetPath, e); err != nil {
+		return err
+	}
+
+	if _, ok := e.(fs.File); ok && e.LinkInfo().IsHardLink() {
+		c.hardLinks[hardLinkKey(e)] = targetPath
+	}
+
+	return nil
+}
+
+// hardLinkKey returns the key identifying the file underlying the provided entry.
+func hardLinkKey(e fs.Entry) fs.LinkInfo {
+	li := e.LinkInfo()
+	if !li.IsHardLink() {
+		return fs.LinkInfo{}
+	}
+
+	return fs.LinkInfo{Device: li.Device, Inode: li.Inode}
+}
+
+// createHardLink creates targetPath as a hard link to an already restored file.
+func (c *copier) createHardLink(existingPath, targetPath string) error {
+	if err := c.removeExistingFile(targetPath); err != nil {
+		return err
+	}
+
+	log.Debug("creating hard link: ", targetPath)
+
+	return os.Link(existingPath, targetPath)
+}
+
+// createSpecial creates a named pipe, device node or socket at targetPath.
+func (c *copier) createSpecial(targetPath string, e fs.Special) error {
+	if err := c.removeExistingFile(targetPath); err != nil {
+		return err
+	}
+
+	log.Debug("creating special file: ", targetPath)
+
+	return createSpecial(targetPath, e.Mode(), e.Device())
+}
+
+// removeExistingFile removes a file that already exists at targetPath, if overwriting files is allowed.
+func (c *copier) removeExistingFile(targetPath string) error {
+	switch _, err := os.Lstat(targetPath); {
+	case os.IsNotExist(err):
+		return nil
+	case err == nil:
+		if !c.OverwriteFiles {
+			return errors.Errorf("unable to create %q, it already exists", targetPath)
+		}
+
+		log.Debug("Overwriting existing file: ", targetPath)
+
+		return errors.Wrap(os.Remove(targetPath), "unable to remove "+targetPath)
+	default:
+		return errors.Wrap(err, "failed to stat "+targetPath)
+	}
 }
 
-// set permission, modification time and user/group ids on targetPath
-func (c *copier) setAttributes(targetPath string, e fs.Entry) error {
+// set permission, modification time, user/group ids and optionally extended attributes on targetPath
+func (c *copier) setAttributes(ctx context.Context, targetPath string, e fs.Entry) error {
 	const modBits = os.ModePerm | os.ModeSetgid | os.ModeSetuid | os.ModeSticky
 
 	le, err := NewEntry(targetPath)
@@ -84,6 +160,25 @@ func (c *copier) setAttributes(targetPath string, e fs.Entry) error {
 		}
 	}
 
+	// Set extended attributes from e and remove others, before permissions which might prevent it
+	if c.RestoreExtendedAttributes {
+		want, err := e.ExtendedAttributes(ctx)
+		if err != nil {
+			return err
+		}
+
+		existing, err := le.ExtendedAttributes(ctx)
+		if err != nil {
+			return err
+		}
+
+		if !existing.Equal(want) {
+			if err = setExtendedAttributes(targetPath, want, existing); err != nil {
+				return err
+			}
+		}
+	}
+
 	// Set file permissions from e
 	if (le.Mode() & modBits) != (e.Mode() & modBits) {
 		if err = os.Chmod(targetPath, e.Mode()&modBits); err != nil && !os.IsPermission(err) {
@@ -167,9 +262,96 @@ func (c *copier) copyFileContent(ctx context.Context, targetPath string, f fs.Fi
 
 	log.Debug("copying file contents to: ", targetPath)
 
+	if sr, ok := r.(fs.SparseReader); ok {
+		holes, err := sr.Holes()
+		if err != nil {
+			return errors.Wrap(err, "unable to determine holes of "+targetPath)
+		}
+
+		if len(holes) > 0 {
+			return writeSparseFile(targetPath, r, f.Size(), holes)
+		}
+	}
+
 	return atomic.WriteFile(targetPath, r)
 }
 
+// writeSparseFile atomically writes contents of a sparse file to targetPath, skipping over the holes
+// so that they remain unallocated.
+func writeSparseFile(targetPath string, r io.ReadSeeker, size int64, holes []fs.Hole) (err error) {
+	dir, file := filepath.Split(targetPath)
+
+	f, err := ioutil.TempFile(dir, file)
+	if err != nil {
+		return errors.Wrap(err, "cannot create temp file")
+	}
+
+	defer func() {
+		if err != nil {
+			os.Remove(f.Name()) //nolint:errcheck
+		}
+	}()
+
+	defer f.Close() //nolint:errcheck
+
+	var offset int64
+
+	for _, h := range holes {
+		if err = copyRange(f, r, offset, h.Offset-offset); err != nil {
+			return err
+		}
+
+		offset = h.Offset + h.Length
+	}
+
+	// copy data after the last hole until the end of file
+	if err = copyRange(f, r, offset, -1); err != nil {
+		return err
+	}
+
+	// extend the file if it ends with a hole
+	fi, err := f.Stat()
+	if err != nil {
+		return errors.Wrap(err, "unable to stat temp file")
+	}
+
+	if fi.Size() < size {
+		if err = f.Truncate(size); err != nil {
+			return errors.Wrap(err, "unable to set file size")
+		}
+	}
+
+	if err = f.Close(); err != nil {
+		return errors.Wrap(err, "unable to close temp file")
+	}
+
+	return atomic.ReplaceFile(f.Name(), targetPath)
+}
+
+// copyRange copies length bytes (or until EOF if negative) at the provided offset from r to the same offset in f.
+func copyRange(f *os.File, r io.ReadSeeker, offset, length int64) error {
+	if length == 0 {
+		return nil
+	}
+
+	if _, err := r.Seek(offset, io.SeekStart); err != nil {
+		return errors.Wrap(err, "unable to seek source")
+	}
+
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return errors.Wrap(err, "unable to seek target")
+	}
+
+	var src io.Reader = r
+	if length > 0 {
+		src = io.LimitReader(r, length)
+	}
+
+	_, err := io.Copy(f, src)
+
+	return errors.Wrap(err, "unable to copy data")
+}
+
 func isEmptyDirectory(name string) (bool, error) {
 	f, err := os.Open(name) //nolint:gosec
 	if err != nil {
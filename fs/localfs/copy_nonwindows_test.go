@@ -0,0 +1,64 @@
+// +build !windows
+
+package localfs
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCopyHardLinks(t *testing.T) {
+	ctx := context.Background()
+
+	tmp, err := ioutil.TempDir("", "kopia")
+	if err != nil {
+		t.Fatalf("cannot create temp directory: %v", err)
+	}
+
+	defer os.RemoveAll(tmp)
+
+	src := filepath.Join(tmp, "src")
+	assertNoError(t, os.MkdirAll(filepath.Join(src, "d1"), 0777))
+	assertNoError(t, ioutil.WriteFile(filepath.Join(src, "f1"), []byte{1, 2, 3}, 0600))
+	assertNoError(t, ioutil.WriteFile(filepath.Join(src, "f2"), []byte{1, 2, 3}, 0600))
+	assertNoError(t, os.Link(filepath.Join(src, "f1"), filepath.Join(src, "d1", "f1")))
+	assertNoError(t, os.Link(filepath.Join(src, "f1"), filepath.Join(src, "f3")))
+
+	e1, err := NewEntry(filepath.Join(src, "f1"))
+	assertNoError(t, err)
+
+	e2, err := NewEntry(filepath.Join(src, "d1", "f1"))
+	assertNoError(t, err)
+
+	if li1, li2 := e1.LinkInfo(), e2.LinkInfo(); li1 != li2 || li1.Links != 3 {
+		t.Errorf("unexpected link info: %+v and %+v", li1, li2)
+	}
+
+	dir, err := Directory(src)
+	assertNoError(t, err)
+
+	dst := filepath.Join(tmp, "dst")
+	assertNoError(t, Copy(ctx, dst, dir, CopyOptions{}))
+
+	fi1, err := os.Stat(filepath.Join(dst, "f1"))
+	assertNoError(t, err)
+
+	for _, linked := range []string{"f3", "d1/f1"} {
+		fi, err := os.Stat(filepath.Join(dst, linked))
+		assertNoError(t, err)
+
+		if !os.SameFile(fi1, fi) {
+			t.Errorf("%v was not restored as a hard link", linked)
+		}
+	}
+
+	fi2, err := os.Stat(filepath.Join(dst, "f2"))
+	assertNoError(t, err)
+
+	if os.SameFile(fi1, fi2) {
+		t.Errorf("f2 was unexpectedly restored as a hard link")
+	}
+}
@@ -0,0 +1,85 @@
+// +build linux
+
+package localfs
+
+import (
+	"io"
+	"os"
+	"syscall"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/fs"
+)
+
+const (
+	seekData = 3 // SEEK_DATA
+	seekHole = 4 // SEEK_HOLE
+
+	statBlockSize = 512
+)
+
+// findHoles returns ranges of the file that contain no data, using SEEK_DATA and SEEK_HOLE.
+// The current offset of the file is preserved.
+func findHoles(f *os.File) ([]fs.Hole, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	size := fi.Size()
+
+	// files with all blocks allocated have no holes
+	if stat, ok := fi.Sys().(*syscall.Stat_t); !ok || stat.Blocks*statBlockSize >= size {
+		return nil, nil
+	}
+
+	pos, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Seek(pos, io.SeekStart) //nolint:errcheck
+
+	var holes []fs.Hole
+
+	for offset := int64(0); offset < size; {
+		holeStart, err := f.Seek(offset, seekHole)
+		if err != nil {
+			if isSeekErrno(err, syscall.EINVAL) {
+				// not supported by the file system
+				return nil, nil
+			}
+
+			return nil, errors.Wrap(err, "unable to find hole")
+		}
+
+		if holeStart >= size {
+			break
+		}
+
+		dataStart, err := f.Seek(holeStart, seekData)
+		if err != nil {
+			if !isSeekErrno(err, syscall.ENXIO) {
+				return nil, errors.Wrap(err, "unable to find data")
+			}
+
+			// no more data until the end of file
+			dataStart = size
+		}
+
+		if dataStart > size {
+			dataStart = size
+		}
+
+		holes = append(holes, fs.Hole{Offset: holeStart, Length: dataStart - holeStart})
+		offset = dataStart
+	}
+
+	return holes, nil
+}
+
+func isSeekErrno(err error, errno syscall.Errno) bool {
+	pe, ok := err.(*os.PathError)
+	return ok && pe.Err == errno
+}
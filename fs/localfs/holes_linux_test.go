@@ -0,0 +1,120 @@
+// +build linux
+
+package localfs
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/kopia/kopia/fs"
+)
+
+const sparseFileSize = 3 << 20
+
+// createSparseFile creates a file with data at the beginning and in the middle, surrounded by holes.
+func createSparseFile(t *testing.T, path string) []byte {
+	t.Helper()
+
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("unable to create file: %v", err)
+	}
+
+	defer f.Close() //nolint:errcheck
+
+	want := make([]byte, sparseFileSize)
+	copy(want, "first")
+	copy(want[1<<20:], "second")
+
+	for _, off := range []int64{0, 1 << 20} {
+		if _, err := f.WriteAt(want[off:off+10], off); err != nil {
+			t.Fatalf("unable to write: %v", err)
+		}
+	}
+
+	if err := f.Truncate(sparseFileSize); err != nil {
+		t.Fatalf("unable to truncate: %v", err)
+	}
+
+	return want
+}
+
+func allocatedBytes(t *testing.T, path string) int64 {
+	t.Helper()
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("unable to stat: %v", err)
+	}
+
+	return fi.Sys().(*syscall.Stat_t).Blocks * statBlockSize
+}
+
+func TestSparseFiles(t *testing.T) {
+	ctx := context.Background()
+
+	tmp, err := ioutil.TempDir("", "kopia")
+	if err != nil {
+		t.Fatalf("cannot create temp directory: %v", err)
+	}
+
+	defer os.RemoveAll(tmp)
+
+	src := filepath.Join(tmp, "src")
+	assertNoError(t, os.Mkdir(src, 0777))
+
+	want := createSparseFile(t, filepath.Join(src, "sparse"))
+
+	if allocatedBytes(t, filepath.Join(src, "sparse")) >= sparseFileSize {
+		t.Skip("sparse files not supported by the file system")
+	}
+
+	e, err := NewEntry(filepath.Join(src, "sparse"))
+	assertNoError(t, err)
+
+	r, err := e.(fs.File).Open(ctx)
+	assertNoError(t, err)
+
+	defer r.Close() //nolint:errcheck
+
+	holes, err := r.(fs.SparseReader).Holes()
+	assertNoError(t, err)
+
+	if len(holes) == 0 {
+		t.Fatalf("no holes found")
+	}
+
+	if last := holes[len(holes)-1]; last.Offset+last.Length != sparseFileSize {
+		t.Errorf("unexpected last hole: %+v", last)
+	}
+
+	// finding holes must not affect reading
+	got, err := ioutil.ReadAll(r)
+	assertNoError(t, err)
+
+	if !bytes.Equal(got, want) {
+		t.Errorf("unexpected file contents")
+	}
+
+	dir, err := Directory(src)
+	assertNoError(t, err)
+
+	dst := filepath.Join(tmp, "dst")
+	assertNoError(t, Copy(ctx, dst, dir, CopyOptions{}))
+
+	got, err = ioutil.ReadFile(filepath.Join(dst, "sparse"))
+	assertNoError(t, err)
+
+	if !bytes.Equal(got, want) {
+		t.Errorf("unexpected contents of copied file")
+	}
+
+	if allocated := allocatedBytes(t, filepath.Join(dst, "sparse")); allocated >= sparseFileSize {
+		t.Errorf("copied file is not sparse, %v bytes allocated", allocated)
+	}
+}
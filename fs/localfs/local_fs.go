@@ -36,6 +36,7 @@ type filesystemEntry struct {
 	mtimeNanos int64
 	mode       os.FileMode
 	owner      fs.OwnerInfo
+	link       fs.LinkInfo
 
 	parentDir string
 }
@@ -72,6 +73,16 @@ func (e *filesystemEntry) Owner() fs.OwnerInfo {
 	return e.owner
 }
 
+// ExtendedAttributes reads extended attributes of the entry on each call, since they are only needed
+// when enabled by policy. Attributes that can't be read are skipped with a warning.
+func (e *filesystemEntry) ExtendedAttributes(ctx context.Context) (fs.ExtendedAttributes, error) {
+	return readExtendedAttributes(e.mode, e.fullPath()), nil
+}
+
+func (e *filesystemEntry) LinkInfo() fs.LinkInfo {
+	return e.link
+}
+
 var _ os.FileInfo = (*filesystemEntry)(nil)
 
 func newEntry(fi os.FileInfo, parentDir string) filesystemEntry {
@@ -81,6 +92,7 @@ func newEntry(fi os.FileInfo, parentDir string) filesystemEntry {
 		fi.ModTime().UnixNano(),
 		fi.Mode(),
 		platformSpecificOwnerInfo(fi),
+		platformSpecificLinkInfo(fi),
 		parentDir,
 	}
 }
@@ -97,6 +109,11 @@ type filesystemFile struct {
 	filesystemEntry
 }
 
+type filesystemSpecial struct {
+	filesystemEntry
+	device fs.DeviceInfo
+}
+
 func (fsd *filesystemDirectory) Size() int64 {
 	// force directory size to always be zero
 	return 0
@@ -239,6 +256,10 @@ func (f *fileWithMetadata) Entry() (fs.Entry, error) {
 	return &filesystemFile{newEntry(fi, filepath.Dir(f.Name()))}, nil
 }
 
+func (f *fileWithMetadata) Holes() ([]fs.Hole, error) {
+	return findHoles(f.File)
+}
+
 func (fsf *filesystemFile) Open(ctx context.Context) (fs.Reader, error) {
 	f, err := os.Open(fsf.fullPath())
 	if err != nil {
@@ -248,30 +269,22 @@ func (fsf *filesystemFile) Open(ctx context.Context) (fs.Reader, error) {
 	return &fileWithMetadata{f}, nil
 }
 
+func (fss *filesystemSpecial) Device() fs.DeviceInfo {
+	return fss.device
+}
+
 func (fsl *filesystemSymlink) Readlink(ctx context.Context) (string, error) {
 	return os.Readlink(fsl.fullPath())
 }
 
-// NewEntry returns fs.Entry for the specified path, the result will be one of supported entry types: fs.File, fs.Directory, fs.Symlink.
+// NewEntry returns fs.Entry for the specified path, the result will be one of supported entry types: fs.File, fs.Directory, fs.Symlink, fs.Special.
 func NewEntry(path string) (fs.Entry, error) {
 	fi, err := os.Lstat(path)
 	if err != nil {
 		return nil, err
 	}
 
-	switch fi.Mode() & os.ModeType {
-	case os.ModeDir:
-		return &filesystemDirectory{newEntry(fi, filepath.Dir(path))}, nil
-
-	case os.ModeSymlink:
-		return &filesystemSymlink{newEntry(fi, filepath.Dir(path))}, nil
-
-	case 0:
-		return &filesystemFile{newEntry(fi, filepath.Dir(path))}, nil
-
-	default:
-		return nil, errors.Errorf("unsupported filesystem entry: %v", fi)
-	}
+	return entryFromChildFileInfo(fi, filepath.Dir(path))
 }
 
 // Directory returns fs.Directory for the specified path.
@@ -299,6 +312,9 @@ func entryFromChildFileInfo(fi os.FileInfo, parentDir string) (fs.Entry, error)
 	case 0:
 		return &filesystemFile{newEntry(fi, parentDir)}, nil
 
+	case os.ModeNamedPipe, os.ModeSocket, os.ModeDevice, os.ModeDevice | os.ModeCharDevice:
+		return &filesystemSpecial{newEntry(fi, parentDir), platformSpecificDeviceInfo(fi)}, nil
+
 	default:
 		return nil, errors.Errorf("unsupported filesystem entry: %v", fi)
 	}
@@ -307,3 +323,4 @@ func entryFromChildFileInfo(fi os.FileInfo, parentDir string) (fs.Entry, error)
 var _ fs.Directory = &filesystemDirectory{}
 var _ fs.File = &filesystemFile{}
 var _ fs.Symlink = &filesystemSymlink{}
+var _ fs.Special = &filesystemSpecial{}
@@ -18,3 +18,14 @@ func platformSpecificOwnerInfo(fi os.FileInfo) fs.OwnerInfo {
 
 	return oi
 }
+
+func platformSpecificLinkInfo(fi os.FileInfo) fs.LinkInfo {
+	var li fs.LinkInfo
+	if stat, ok := fi.Sys().(*syscall.Stat_t); ok {
+		li.Device = uint64(stat.Dev)  //nolint:unconvert
+		li.Inode = uint64(stat.Ino)   //nolint:unconvert
+		li.Links = uint64(stat.Nlink) //nolint:unconvert
+	}
+
+	return li
+}
@@ -9,3 +9,7 @@ import (
 func platformSpecificOwnerInfo(fi os.FileInfo) fs.OwnerInfo {
 	return fs.OwnerInfo{}
 }
+
+func platformSpecificLinkInfo(fi os.FileInfo) fs.LinkInfo {
+	return fs.LinkInfo{}
+}
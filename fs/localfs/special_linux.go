@@ -0,0 +1,49 @@
+// +build linux
+
+package localfs
+
+import (
+	"os"
+	"syscall"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/fs"
+)
+
+func platformSpecificDeviceInfo(fi os.FileInfo) fs.DeviceInfo {
+	stat, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok || fi.Mode()&os.ModeDevice == 0 {
+		return fs.DeviceInfo{}
+	}
+
+	rdev := uint64(stat.Rdev) //nolint:unconvert
+
+	return fs.DeviceInfo{
+		Major: uint32((rdev>>8)&0xfff | (rdev>>32)&^0xfff), //nolint:gomnd
+		Minor: uint32(rdev&0xff | (rdev>>12)&^0xff),        //nolint:gomnd
+	}
+}
+
+// createSpecial creates a named pipe, device node or socket with the provided mode at the specified path.
+func createSpecial(path string, mode os.FileMode, dev fs.DeviceInfo) error {
+	var typ uint32
+
+	switch {
+	case mode&os.ModeNamedPipe != 0:
+		typ = syscall.S_IFIFO
+	case mode&os.ModeSocket != 0:
+		typ = syscall.S_IFSOCK
+	case mode&os.ModeCharDevice != 0:
+		typ = syscall.S_IFCHR
+	case mode&os.ModeDevice != 0:
+		typ = syscall.S_IFBLK
+	default:
+		return errors.Errorf("unsupported special file mode: %v", mode)
+	}
+
+	major, minor := uint64(dev.Major), uint64(dev.Minor)
+	rdev := minor&0xff | (major&0xfff)<<8 | (minor&^0xff)<<12 | (major&^0xfff)<<32 //nolint:gomnd
+
+	return syscall.Mknod(path, typ|uint32(mode.Perm()), int(rdev))
+}
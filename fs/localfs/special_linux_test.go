@@ -0,0 +1,84 @@
+// +build linux
+
+package localfs
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/kopia/kopia/fs"
+)
+
+func TestSpecialFiles(t *testing.T) {
+	ctx := context.Background()
+
+	tmp, err := ioutil.TempDir("", "kopia")
+	if err != nil {
+		t.Fatalf("cannot create temp directory: %v", err)
+	}
+
+	defer os.RemoveAll(tmp)
+
+	src := filepath.Join(tmp, "src")
+	assertNoError(t, os.Mkdir(src, 0777))
+	assertNoError(t, syscall.Mkfifo(filepath.Join(src, "fifo"), 0640))
+
+	l, err := net.Listen("unix", filepath.Join(src, "socket"))
+	assertNoError(t, err)
+
+	defer l.Close() //nolint:errcheck
+
+	// creating device nodes requires privileges
+	hasDevice := syscall.Mknod(filepath.Join(src, "null"), syscall.S_IFCHR|0666, 1<<8|3) == nil
+
+	cases := map[string]os.FileMode{
+		"fifo":   os.ModeNamedPipe,
+		"socket": os.ModeSocket,
+	}
+
+	if hasDevice {
+		cases["null"] = os.ModeDevice | os.ModeCharDevice
+	}
+
+	for name, typ := range cases {
+		e, err := NewEntry(filepath.Join(src, name))
+		assertNoError(t, err)
+
+		if _, ok := e.(fs.Special); !ok || e.Mode()&os.ModeType != typ {
+			t.Errorf("unexpected entry for %v: %T %v", name, e, e.Mode())
+		}
+	}
+
+	if hasDevice {
+		e, err := NewEntry(filepath.Join(src, "null"))
+		assertNoError(t, err)
+
+		if got, want := e.(fs.Special).Device(), (fs.DeviceInfo{Major: 1, Minor: 3}); got != want {
+			t.Errorf("unexpected device info: %+v, want %+v", got, want)
+		}
+	}
+
+	dir, err := Directory(src)
+	assertNoError(t, err)
+
+	dst := filepath.Join(tmp, "dst")
+	assertNoError(t, Copy(ctx, dst, dir, CopyOptions{}))
+
+	for name, typ := range cases {
+		fi, err := os.Lstat(filepath.Join(dst, name))
+		assertNoError(t, err)
+
+		if fi.Mode()&os.ModeType != typ {
+			t.Errorf("unexpected mode of restored %v: %v", name, fi.Mode())
+		}
+	}
+
+	if fi, err := os.Lstat(filepath.Join(dst, "fifo")); err == nil && fi.Mode().Perm() != 0640 {
+		t.Errorf("unexpected permissions of restored fifo: %v", fi.Mode())
+	}
+}
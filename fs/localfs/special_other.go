@@ -0,0 +1,19 @@
+// +build !linux
+
+package localfs
+
+import (
+	"os"
+
+	"github.com/kopia/kopia/fs"
+)
+
+func platformSpecificDeviceInfo(fi os.FileInfo) fs.DeviceInfo {
+	return fs.DeviceInfo{}
+}
+
+// createSpecial creates a named pipe, device node or socket with the provided mode at the specified path.
+// Special files can only be created on Linux.
+func createSpecial(path string, mode os.FileMode, dev fs.DeviceInfo) error {
+	return errSpecialNotSupported
+}
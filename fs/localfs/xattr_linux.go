@@ -0,0 +1,142 @@
+// +build linux
+
+package localfs
+
+import (
+	"bytes"
+	"os"
+	"sort"
+	"syscall"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/fs"
+)
+
+// readExtendedAttributes returns extended attributes of the entry at the provided path, including POSIX ACLs.
+// Attributes of symlinks are not read, since that would follow the link.
+func readExtendedAttributes(mode os.FileMode, path string) fs.ExtendedAttributes {
+	if mode&os.ModeSymlink != 0 {
+		return nil
+	}
+
+	list, err := readXattrBuffer(func(b []byte) (int, error) {
+		return syscall.Listxattr(path, b)
+	})
+	if err != nil {
+		if !isXattrNotSupported(err) {
+			log.Warningf("unable to list extended attributes of %v: %v", path, err)
+		}
+
+		return nil
+	}
+
+	var result fs.ExtendedAttributes
+
+	for _, n := range bytes.Split(list, []byte{0}) {
+		if len(n) == 0 {
+			continue
+		}
+
+		name := string(n)
+
+		v, err := readXattrBuffer(func(b []byte) (int, error) {
+			return syscall.Getxattr(path, name, b)
+		})
+		if err != nil {
+			// attribute may have been removed after listing
+			if err != syscall.ENODATA {
+				log.Warningf("unable to read extended attribute %v of %v: %v", name, path, err)
+			}
+
+			continue
+		}
+
+		if result == nil {
+			result = fs.ExtendedAttributes{}
+		}
+
+		result[name] = v
+	}
+
+	return result
+}
+
+// readXattrBuffer invokes the provided function to determine the required buffer size and again to read the data,
+// retrying if the data grows in between.
+func readXattrBuffer(f func(b []byte) (int, error)) ([]byte, error) {
+	for {
+		sz, err := f(nil)
+		if err != nil {
+			return nil, err
+		}
+
+		buf := make([]byte, sz)
+		if sz == 0 {
+			return buf, nil
+		}
+
+		n, err := f(buf)
+		if err == syscall.ERANGE {
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		return buf[0:n], nil
+	}
+}
+
+// setExtendedAttributes sets the provided extended attributes, including POSIX ACLs, on the entry at the provided path
+// and removes existing attributes that are not provided. Attributes that cannot be set or removed due to insufficient
+// privileges or lack of support in the target file system are skipped with a warning.
+func setExtendedAttributes(path string, attrs, existing fs.ExtendedAttributes) error {
+	var names []string
+	for n := range attrs {
+		names = append(names, n)
+	}
+
+	sort.Strings(names)
+
+	for _, n := range names {
+		if v, ok := existing[n]; ok && bytes.Equal(v, attrs[n]) {
+			continue
+		}
+
+		if err := syscall.Setxattr(path, n, attrs[n], 0); err != nil {
+			if isXattrPermissionError(err) {
+				log.Warningf("unable to set extended attribute %v on %v: %v", n, path, err)
+				continue
+			}
+
+			return errors.Wrapf(err, "unable to set extended attribute %v on %v", n, path)
+		}
+	}
+
+	for n := range existing {
+		if _, ok := attrs[n]; ok {
+			continue
+		}
+
+		if err := syscall.Removexattr(path, n); err != nil && err != syscall.ENODATA {
+			if isXattrPermissionError(err) {
+				log.Warningf("unable to remove extended attribute %v from %v: %v", n, path, err)
+				continue
+			}
+
+			return errors.Wrapf(err, "unable to remove extended attribute %v from %v", n, path)
+		}
+	}
+
+	return nil
+}
+
+func isXattrPermissionError(err error) bool {
+	return err == syscall.EPERM || err == syscall.EACCES || isXattrNotSupported(err)
+}
+
+func isXattrNotSupported(err error) bool {
+	return err == syscall.ENOTSUP
+}
@@ -0,0 +1,82 @@
+// +build linux
+
+package localfs
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/kopia/kopia/fs"
+)
+
+func TestExtendedAttributes(t *testing.T) {
+	ctx := context.Background()
+
+	tmp, err := ioutil.TempDir("", "kopia")
+	if err != nil {
+		t.Fatalf("cannot create temp directory: %v", err)
+	}
+
+	defer os.RemoveAll(tmp)
+
+	src := filepath.Join(tmp, "src")
+	assertNoError(t, os.Mkdir(src, 0777))
+	assertNoError(t, ioutil.WriteFile(filepath.Join(src, "f1"), []byte{1, 2, 3}, 0600))
+
+	if err = syscall.Setxattr(filepath.Join(src, "f1"), "user.kopia-test", []byte("some-value"), 0); err != nil {
+		if err == syscall.ENOTSUP {
+			t.Skip("extended attributes not supported by the file system")
+		}
+
+		t.Fatalf("unable to set extended attribute: %v", err)
+	}
+
+	e, err := NewEntry(filepath.Join(src, "f1"))
+	assertNoError(t, err)
+
+	want := fs.ExtendedAttributes{"user.kopia-test": []byte("some-value")}
+	if got := extendedAttributes(t, e); !got.Equal(want) {
+		t.Errorf("unexpected extended attributes: %v, want %v", got, want)
+	}
+
+	dir, err := Directory(src)
+	assertNoError(t, err)
+
+	for _, restore := range []bool{false, true} {
+		dst := filepath.Join(tmp, "dst")
+		assertNoError(t, os.RemoveAll(dst))
+		assertNoError(t, Copy(ctx, dst, dir, CopyOptions{RestoreExtendedAttributes: restore}))
+
+		e, err := NewEntry(filepath.Join(dst, "f1"))
+		assertNoError(t, err)
+
+		if got := extendedAttributes(t, e); got.Equal(want) != restore {
+			t.Errorf("unexpected extended attributes of copied file: %v (restore: %v)", got, restore)
+		}
+	}
+
+	// attributes of existing directories that are not in the source are removed when overwriting.
+	dst := filepath.Join(tmp, "dst")
+	assertNoError(t, syscall.Setxattr(dst, "user.kopia-stale", []byte("stale"), 0))
+	assertNoError(t, Copy(ctx, dst, dir, CopyOptions{RestoreExtendedAttributes: true, OverwriteFiles: true, OverwriteDirectories: true}))
+
+	e, err = NewEntry(dst)
+	assertNoError(t, err)
+
+	if got := extendedAttributes(t, e); len(got) != 0 {
+		t.Errorf("unexpected extended attributes of overwritten directory: %v", got)
+	}
+}
+
+func extendedAttributes(t *testing.T, e fs.Entry) fs.ExtendedAttributes {
+	t.Helper()
+
+	attrs, err := e.ExtendedAttributes(context.Background())
+	assertNoError(t, err)
+
+	return attrs
+}
@@ -0,0 +1,25 @@
+// +build !linux
+
+package localfs
+
+import (
+	"os"
+
+	"github.com/kopia/kopia/fs"
+)
+
+// readExtendedAttributes returns extended attributes of the entry at the provided path.
+// Extended attributes are only supported on Linux.
+func readExtendedAttributes(mode os.FileMode, path string) fs.ExtendedAttributes {
+	return nil
+}
+
+// setExtendedAttributes sets the provided extended attributes on the entry at the provided path.
+// Extended attributes are only supported on Linux.
+func setExtendedAttributes(path string, attrs, existing fs.ExtendedAttributes) error {
+	if len(attrs) > 0 {
+		log.Warningf("extended attributes are not supported on this platform, not setting them on %v", path)
+	}
+
+	return nil
+}
@@ -34,6 +34,8 @@ type entry struct {
 	size    int64
 	modTime time.Time
 	owner   fs.OwnerInfo
+	xattrs  fs.ExtendedAttributes
+	link    fs.LinkInfo
 }
 
 func (e entry) Name() string {
@@ -64,6 +66,14 @@ func (e entry) Owner() fs.OwnerInfo {
 	return e.owner
 }
 
+func (e entry) ExtendedAttributes(ctx context.Context) (fs.ExtendedAttributes, error) {
+	return e.xattrs, nil
+}
+
+func (e entry) LinkInfo() fs.LinkInfo {
+	return e.link
+}
+
 // Directory is mock in-memory implementation of fs.Directory
 type Directory struct {
 	entry
@@ -201,6 +211,16 @@ func (imf *File) SetContents(b []byte) {
 	}
 }
 
+// SetExtendedAttributes changes extended attributes of a given file.
+func (imf *File) SetExtendedAttributes(a fs.ExtendedAttributes) {
+	imf.xattrs = a
+}
+
+// SetLinkInfo changes device, inode and link count of a given file.
+func (imf *File) SetLinkInfo(li fs.LinkInfo) {
+	imf.link = li
+}
+
 type fileReader struct {
 	ReaderSeekerCloser
 	entry fs.Entry
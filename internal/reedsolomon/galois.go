@@ -0,0 +1,152 @@
+package reedsolomon
+
+import (
+	"github.com/pkg/errors"
+)
+
+// generatorPolynomial is the irreducible polynomial x^8 + x^4 + x^3 + x^2 + 1 used to construct GF(2^8).
+const generatorPolynomial = 0x11d
+
+var (
+	expTable [510]byte
+	logTable [256]byte
+)
+
+func init() {
+	x := 1
+
+	for i := 0; i < 255; i++ {
+		expTable[i] = byte(x)
+		expTable[i+255] = byte(x)
+		logTable[x] = byte(i)
+
+		x <<= 1
+		if x&0x100 != 0 {
+			x ^= generatorPolynomial
+		}
+	}
+}
+
+func galMul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+
+	return expTable[int(logTable[a])+int(logTable[b])]
+}
+
+func galDiv(a, b byte) byte {
+	if a == 0 {
+		return 0
+	}
+
+	return expTable[int(logTable[a])+255-int(logTable[b])]
+}
+
+// galExp returns a raised to the power of n.
+func galExp(a byte, n int) byte {
+	if n == 0 {
+		return 1
+	}
+
+	if a == 0 {
+		return 0
+	}
+
+	return expTable[(int(logTable[a])*n)%255]
+}
+
+// mulAdd computes output ^= c * input.
+func mulAdd(c byte, input, output []byte) {
+	if c == 0 {
+		return
+	}
+
+	logC := int(logTable[c])
+
+	for i, v := range input {
+		if v != 0 {
+			output[i] ^= expTable[logC+int(logTable[v])]
+		}
+	}
+}
+
+func newMatrix(rows, cols int) [][]byte {
+	m := make([][]byte, rows)
+	for r := range m {
+		m[r] = make([]byte, cols)
+	}
+
+	return m
+}
+
+func multiply(a, b [][]byte) [][]byte {
+	result := newMatrix(len(a), len(b[0]))
+
+	for r := range a {
+		for c := range b[0] {
+			var v byte
+			for i := range b {
+				v ^= galMul(a[r][i], b[i][c])
+			}
+
+			result[r][c] = v
+		}
+	}
+
+	return result
+}
+
+// invert returns the inverse of a square matrix using Gauss-Jordan elimination.
+func invert(m [][]byte) ([][]byte, error) {
+	n := len(m)
+
+	// work on [m | I]
+	work := newMatrix(n, 2*n)
+
+	for r := 0; r < n; r++ {
+		copy(work[r], m[r])
+		work[r][n+r] = 1
+	}
+
+	for c := 0; c < n; c++ {
+		pivot := -1
+
+		for r := c; r < n; r++ {
+			if work[r][c] != 0 {
+				pivot = r
+				break
+			}
+		}
+
+		if pivot < 0 {
+			return nil, errors.New("matrix is singular")
+		}
+
+		work[c], work[pivot] = work[pivot], work[c]
+
+		if d := work[c][c]; d != 1 {
+			for i := range work[c] {
+				work[c][i] = galDiv(work[c][i], d)
+			}
+		}
+
+		for r := 0; r < n; r++ {
+			if r == c || work[r][c] == 0 {
+				continue
+			}
+
+			f := work[r][c]
+			for i := range work[r] {
+				work[r][i] ^= galMul(f, work[c][i])
+			}
+		}
+	}
+
+	result := newMatrix(n, n)
+	for r := 0; r < n; r++ {
+		copy(result[r], work[r][n:])
+	}
+
+	return result, nil
+}
@@ -0,0 +1,162 @@
+// Package reedsolomon implements systematic Reed-Solomon erasure coding over GF(2^8).
+package reedsolomon
+
+import (
+	"github.com/pkg/errors"
+)
+
+// maxTotalShards is the maximum number of data and parity shards supported by GF(2^8).
+const maxTotalShards = 256
+
+// Encoder computes parity shards for a fixed number of data shards and reconstructs missing shards.
+type Encoder struct {
+	dataShards   int
+	parityShards int
+
+	// matrix is the (dataShards+parityShards) x dataShards encoding matrix whose top rows form an identity matrix.
+	matrix [][]byte
+}
+
+// New returns a new Encoder for the provided number of data and parity shards.
+func New(dataShards, parityShards int) (*Encoder, error) {
+	if dataShards <= 0 || parityShards <= 0 {
+		return nil, errors.Errorf("invalid number of shards: %v data, %v parity", dataShards, parityShards)
+	}
+
+	if dataShards+parityShards > maxTotalShards {
+		return nil, errors.Errorf("too many shards: %v", dataShards+parityShards)
+	}
+
+	total := dataShards + parityShards
+
+	// vandermonde matrix, any dataShards rows of which are linearly independent.
+	vm := newMatrix(total, dataShards)
+
+	for r := 0; r < total; r++ {
+		for c := 0; c < dataShards; c++ {
+			vm[r][c] = galExp(byte(r), c)
+		}
+	}
+
+	// make the encoding systematic by multiplying by inverse of the top square matrix.
+	top, err := invert(vm[0:dataShards])
+	if err != nil {
+		return nil, err
+	}
+
+	return &Encoder{
+		dataShards:   dataShards,
+		parityShards: parityShards,
+		matrix:       multiply(vm, top),
+	}, nil
+}
+
+// DataShards returns the number of data shards.
+func (e *Encoder) DataShards() int {
+	return e.dataShards
+}
+
+// ParityShards returns the number of parity shards.
+func (e *Encoder) ParityShards() int {
+	return e.parityShards
+}
+
+// Encode computes parity shards from data shards. All shards must be allocated and have the same length.
+func (e *Encoder) Encode(shards [][]byte) error {
+	if err := e.checkShards(shards, false); err != nil {
+		return err
+	}
+
+	for p := 0; p < e.parityShards; p++ {
+		e.computeRow(e.matrix[e.dataShards+p], shards[0:e.dataShards], shards[e.dataShards+p])
+	}
+
+	return nil
+}
+
+// Reconstruct recomputes missing shards, which must be passed as nil slices.
+// At least DataShards() shards must be present.
+func (e *Encoder) Reconstruct(shards [][]byte) error {
+	if err := e.checkShards(shards, true); err != nil {
+		return err
+	}
+
+	var (
+		present   [][]byte
+		subMatrix [][]byte
+		shardSize int
+	)
+
+	for i, s := range shards {
+		if s == nil {
+			continue
+		}
+
+		shardSize = len(s)
+
+		if len(present) < e.dataShards {
+			present = append(present, s)
+			subMatrix = append(subMatrix, e.matrix[i])
+		}
+	}
+
+	if len(present) < e.dataShards {
+		return errors.Errorf("too few shards to reconstruct: %v, need %v", len(present), e.dataShards)
+	}
+
+	decode, err := invert(subMatrix)
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < e.dataShards; i++ {
+		if shards[i] == nil {
+			shards[i] = make([]byte, shardSize)
+			e.computeRow(decode[i], present, shards[i])
+		}
+	}
+
+	for p := 0; p < e.parityShards; p++ {
+		if shards[e.dataShards+p] == nil {
+			shards[e.dataShards+p] = make([]byte, shardSize)
+			e.computeRow(e.matrix[e.dataShards+p], shards[0:e.dataShards], shards[e.dataShards+p])
+		}
+	}
+
+	return nil
+}
+
+func (e *Encoder) checkShards(shards [][]byte, allowNil bool) error {
+	if len(shards) != e.dataShards+e.parityShards {
+		return errors.Errorf("invalid number of shards: %v, expected %v", len(shards), e.dataShards+e.parityShards)
+	}
+
+	size := -1
+
+	for _, s := range shards {
+		if s == nil && allowNil {
+			continue
+		}
+
+		if size == -1 {
+			size = len(s)
+		}
+
+		if len(s) != size {
+			return errors.Errorf("shards have different sizes")
+		}
+	}
+
+	return nil
+}
+
+// computeRow sets output to the linear combination of inputs with the provided coefficients.
+func (e *Encoder) computeRow(coefficients []byte, inputs [][]byte, output []byte) {
+	for i := range output {
+		output[i] = 0
+	}
+
+	for c, in := range inputs {
+		mulAdd(coefficients[c], in, output)
+	}
+}
@@ -0,0 +1,95 @@
+package reedsolomon
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+func TestReconstruct(t *testing.T) {
+	cases := []struct {
+		dataShards, parityShards int
+	}{
+		{1, 1},
+		{4, 2},
+		{10, 4},
+		{17, 3},
+	}
+
+	for _, tc := range cases {
+		e, err := New(tc.dataShards, tc.parityShards)
+		if err != nil {
+			t.Fatalf("unable to create encoder: %v", err)
+		}
+
+		rnd := rand.New(rand.NewSource(int64(tc.dataShards)))
+		total := tc.dataShards + tc.parityShards
+
+		shards := make([][]byte, total)
+		for i := range shards {
+			shards[i] = make([]byte, 100)
+			if i < tc.dataShards {
+				rnd.Read(shards[i]) //nolint:errcheck
+			}
+		}
+
+		if err := e.Encode(shards); err != nil {
+			t.Fatalf("encode error: %v", err)
+		}
+
+		// remove up to parityShards random shards and reconstruct.
+		for attempt := 0; attempt < 20; attempt++ {
+			damaged := make([][]byte, total)
+			copy(damaged, shards)
+
+			for _, i := range rnd.Perm(total)[0:tc.parityShards] {
+				damaged[i] = nil
+			}
+
+			if err := e.Reconstruct(damaged); err != nil {
+				t.Fatalf("reconstruct error: %v", err)
+			}
+
+			for i := range shards {
+				if !bytes.Equal(damaged[i], shards[i]) {
+					t.Fatalf("shard %v was not reconstructed correctly (%v+%v)", i, tc.dataShards, tc.parityShards)
+				}
+			}
+		}
+
+		// too many missing shards.
+		damaged := make([][]byte, total)
+		copy(damaged, shards)
+
+		for i := 0; i <= tc.parityShards; i++ {
+			damaged[i] = nil
+		}
+
+		if err := e.Reconstruct(damaged); err == nil {
+			t.Errorf("unexpected success reconstructing with too many missing shards")
+		}
+	}
+}
+
+func TestInvalidShards(t *testing.T) {
+	if _, err := New(0, 2); err == nil {
+		t.Errorf("unexpected success with zero data shards")
+	}
+
+	if _, err := New(200, 100); err == nil {
+		t.Errorf("unexpected success with too many shards")
+	}
+
+	e, err := New(2, 1)
+	if err != nil {
+		t.Fatalf("unable to create encoder: %v", err)
+	}
+
+	if err := e.Encode([][]byte{{1}, {2, 3}, {0}}); err == nil {
+		t.Errorf("unexpected success encoding shards of different sizes")
+	}
+
+	if err := e.Encode([][]byte{{1}, {2}}); err == nil {
+		t.Errorf("unexpected success encoding wrong number of shards")
+	}
+}
@@ -125,6 +125,45 @@ func (e *Environment) MustReopen(t *testing.T) {
 	}
 }
 
+// MustOpenAnother opens another instance of the repository, which must be closed by the caller.
+func (e *Environment) MustOpenAnother(t *testing.T) *repo.Repository {
+	r, err := repo.Open(context.Background(), e.configFile(), masterPassword, &repo.Options{})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	return r
+}
+
+// MustReconnect closes the repository, connects to it again using provided options and reopens it.
+func (e *Environment) MustReconnect(t *testing.T, opt repo.ConnectOptions) {
+	ctx := context.Background()
+
+	if err := e.Repository.Close(ctx); err != nil {
+		t.Fatalf("close error: %v", err)
+	}
+
+	if err := repo.Disconnect(e.configFile()); err != nil {
+		t.Fatalf("error disconnecting: %v", err)
+	}
+
+	st, err := filesystem.New(ctx, &filesystem.Options{
+		Path: e.storageDir,
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	if err = repo.Connect(ctx, e.configFile(), st, masterPassword, opt); err != nil {
+		t.Fatalf("can't connect: %v", err)
+	}
+
+	e.Repository, err = repo.Open(ctx, e.configFile(), masterPassword, &repo.Options{})
+	if err != nil {
+		t.Fatalf("can't open: %v", err)
+	}
+}
+
 // VerifyBlobCount verifies that the underlying storage contains the specified number of blobs.
 func (e *Environment) VerifyBlobCount(t *testing.T, want int) {
 	var got int
@@ -12,3 +12,7 @@ type apiError struct {
 func internalServerError(err error) *apiError {
 	return &apiError{500, fmt.Sprintf("internal server error: %v", err)}
 }
+
+func requestError(message string) *apiError {
+	return &apiError{400, message}
+}
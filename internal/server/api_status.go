@@ -11,6 +11,7 @@ func (s *Server) handleStatus(ctx context.Context, r *http.Request) (interface{}
 	bf := s.rep.Content.Format
 	bf.HMACSecret = nil
 	bf.MasterKey = nil
+	bf.RetiredMasterKeys = nil
 
 	return &serverapi.StatusResponse{
 		ConfigFile:      s.rep.ConfigFile,
@@ -0,0 +1,30 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/kopia/kopia/repo/blob/throttling"
+)
+
+func (s *Server) handleThrottleGet(ctx context.Context, r *http.Request) (interface{}, *apiError) {
+	l := s.rep.ThrottlingLimits()
+	return &l, nil
+}
+
+func (s *Server) handleThrottleSet(ctx context.Context, r *http.Request) (interface{}, *apiError) {
+	var l throttling.Limits
+
+	if err := json.NewDecoder(r.Body).Decode(&l); err != nil {
+		return nil, requestError("malformed request body")
+	}
+
+	log.Infof("changing throttling limits to %+v", l)
+
+	if err := s.rep.SetThrottlingLimits(l); err != nil {
+		return nil, internalServerError(err)
+	}
+
+	return &l, nil
+}
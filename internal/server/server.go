@@ -45,6 +45,8 @@ func (s *Server) APIHandlers() http.Handler {
 	mux.HandleFunc("/api/v1/sources/resume", s.handleAPI(s.handleResume, "POST"))
 	mux.HandleFunc("/api/v1/sources/upload", s.handleAPI(s.handleUpload, "POST"))
 	mux.HandleFunc("/api/v1/sources/cancel", s.handleAPI(s.handleCancel, "POST"))
+	mux.HandleFunc("/api/v1/throttle", s.handleAPI(s.handleThrottleGet, "GET"))
+	mux.HandleFunc("/api/v1/throttle/set", s.handleAPI(s.handleThrottleSet, "POST"))
 	mux.HandleFunc("/api/v1/objects/", s.handleObjectGet)
 
 	return mux
@@ -0,0 +1,65 @@
+// Package appendonly implements wrapper around Storage that only allows new blobs to be added.
+package appendonly
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo/blob"
+)
+
+var (
+	// ErrDeleteNotAllowed is returned when an attempt is made to delete a blob from append-only storage.
+	ErrDeleteNotAllowed = errors.New("deleting blobs is not allowed in append-only storage")
+
+	// ErrOverwriteNotAllowed is returned when an attempt is made to overwrite an existing blob in append-only storage.
+	ErrOverwriteNotAllowed = errors.New("overwriting blobs is not allowed in append-only storage")
+)
+
+type appendOnlyStorage struct {
+	base blob.Storage
+}
+
+func (s *appendOnlyStorage) GetBlob(ctx context.Context, id blob.ID, offset, length int64) ([]byte, error) {
+	return s.base.GetBlob(ctx, id, offset, length)
+}
+
+// PutBlob writes the blob only if it does not already exist. Note that the check is not atomic with respect
+// to the write, so it only protects against overwrites performed through the wrapper, not concurrent writers.
+func (s *appendOnlyStorage) PutBlob(ctx context.Context, id blob.ID, data []byte) error {
+	// zero-length read is the cheapest way to determine whether the blob exists.
+	_, err := s.base.GetBlob(ctx, id, 0, 0)
+
+	switch err {
+	case nil:
+		return ErrOverwriteNotAllowed
+
+	case blob.ErrBlobNotFound:
+		return s.base.PutBlob(ctx, id, data)
+
+	default:
+		return errors.Wrapf(err, "unable to determine whether blob %q exists", id)
+	}
+}
+
+func (s *appendOnlyStorage) DeleteBlob(ctx context.Context, id blob.ID) error {
+	return ErrDeleteNotAllowed
+}
+
+func (s *appendOnlyStorage) ListBlobs(ctx context.Context, prefix blob.ID, callback func(blob.Metadata) error) error {
+	return s.base.ListBlobs(ctx, prefix, callback)
+}
+
+func (s *appendOnlyStorage) Close(ctx context.Context) error {
+	return s.base.Close(ctx)
+}
+
+func (s *appendOnlyStorage) ConnectionInfo() blob.ConnectionInfo {
+	return s.base.ConnectionInfo()
+}
+
+// NewWrapper returns a Storage wrapper that allows adding new blobs but rejects deleting or overwriting existing ones.
+func NewWrapper(wrapped blob.Storage) blob.Storage {
+	return &appendOnlyStorage{base: wrapped}
+}
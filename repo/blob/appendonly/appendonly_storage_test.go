@@ -0,0 +1,49 @@
+package appendonly
+
+import (
+	"context"
+	"testing"
+
+	"github.com/kopia/kopia/internal/blobtesting"
+)
+
+func TestAppendOnlyStorage(t *testing.T) {
+	ctx := context.Background()
+
+	data := blobtesting.DataMap{}
+	underlying := blobtesting.NewMapStorage(data, nil, nil)
+
+	if err := underlying.PutBlob(ctx, "existing", []byte{1, 2, 3, 4}); err != nil {
+		t.Fatalf("unable to put blob: %v", err)
+	}
+
+	st := NewWrapper(underlying)
+
+	if err := st.PutBlob(ctx, "new", []byte{5, 6, 7, 8}); err != nil {
+		t.Errorf("unable to put new blob: %v", err)
+	}
+
+	if got, want := st.PutBlob(ctx, "existing", []byte{5, 6, 7, 8}), ErrOverwriteNotAllowed; got != want {
+		t.Errorf("unexpected PutBlob() error: %v, want %v", got, want)
+	}
+
+	if got, want := st.DeleteBlob(ctx, "existing"), ErrDeleteNotAllowed; got != want {
+		t.Errorf("unexpected DeleteBlob() error: %v, want %v", got, want)
+	}
+
+	if got, want := st.DeleteBlob(ctx, "no-such-blob"), ErrDeleteNotAllowed; got != want {
+		t.Errorf("unexpected DeleteBlob() error: %v, want %v", got, want)
+	}
+
+	blobtesting.AssertGetBlob(ctx, t, st, "existing", []byte{1, 2, 3, 4})
+	blobtesting.AssertGetBlob(ctx, t, st, "new", []byte{5, 6, 7, 8})
+	blobtesting.AssertListResults(ctx, t, st, "", "existing", "new")
+
+	if got, want := st.ConnectionInfo().Type, underlying.ConnectionInfo().Type; got != want {
+		t.Errorf("unexpected connection info %v, want %v", got, want)
+	}
+
+	if err := st.Close(ctx); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+}
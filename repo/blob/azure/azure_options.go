@@ -0,0 +1,27 @@
+package azure
+
+// Options defines options for Azure blob storage storage.
+type Options struct {
+	// Container is the name of the azure storage container where data is stored.
+	Container string `json:"container"`
+
+	// Prefix specifies additional string to prepend to all objects.
+	Prefix string `json:"prefix,omitempty"`
+
+	// StorageAccount is the name of the Azure storage account.
+	StorageAccount string `json:"storageAccount"`
+
+	// StorageKey is the shared key of the storage account.
+	StorageKey string `json:"storageKey" kopia:"sensitive"`
+
+	// StorageDomain is the domain suffix of the storage service endpoint (defaults to 'blob.core.windows.net').
+	StorageDomain string `json:"storageDomain,omitempty"`
+
+	// Endpoint overrides the service URL derived from StorageAccount and StorageDomain,
+	// which is useful for emulators such as Azurite (e.g. 'http://127.0.0.1:10000/devstoreaccount1').
+	Endpoint string `json:"endpoint,omitempty"`
+
+	MaxUploadSpeedBytesPerSecond int `json:"maxUploadSpeedBytesPerSecond,omitempty"`
+
+	MaxDownloadSpeedBytesPerSecond int `json:"maxDownloadSpeedBytesPerSecond,omitempty"`
+}
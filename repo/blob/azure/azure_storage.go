@@ -0,0 +1,321 @@
+// Package azure implements Storage based on an Azure Blob Storage container.
+package azure
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/Azure/azure-pipeline-go/pipeline"
+	"github.com/Azure/azure-storage-blob-go/azblob"
+	"github.com/efarrer/iothrottler"
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/retry"
+	"github.com/kopia/kopia/internal/throttle"
+	"github.com/kopia/kopia/repo/blob"
+)
+
+const (
+	azStorageType = "azure"
+
+	defaultStorageDomain = "blob.core.windows.net"
+)
+
+type azStorage struct {
+	Options
+
+	ctx       context.Context
+	container azblob.ContainerURL
+
+	downloadThrottler *iothrottler.IOThrottlerPool
+	uploadThrottler   *iothrottler.IOThrottlerPool
+}
+
+func (az *azStorage) GetBlob(ctx context.Context, b blob.ID, offset, length int64) ([]byte, error) {
+	if offset < 0 {
+		return nil, errors.Errorf("invalid offset")
+	}
+
+	attempt := func() (interface{}, error) {
+		bu := az.container.NewBlobURL(az.getObjectNameString(b))
+
+		if length == 0 {
+			// zero-length reads only need to confirm that the blob exists.
+			if _, err := bu.GetProperties(ctx, azblob.BlobAccessConditions{}); err != nil {
+				return nil, err
+			}
+
+			return []byte{}, nil
+		}
+
+		count := int64(azblob.CountToEnd)
+		if length > 0 {
+			count = length
+		}
+
+		resp, err := bu.Download(ctx, offset, count, azblob.BlobAccessConditions{}, false)
+		if err != nil {
+			return nil, err
+		}
+
+		body := resp.Body(azblob.RetryReaderOptions{})
+		defer body.Close() //nolint:errcheck
+
+		throttled, done := blob.ThrottleDownload(ctx, body)
+		defer done()
+
+		return ioutil.ReadAll(throttled)
+	}
+
+	v, err := exponentialBackoff(fmt.Sprintf("GetBlob(%q,%v,%v)", b, offset, length), attempt)
+	if err != nil {
+		return nil, translateError(err)
+	}
+
+	fetched := v.([]byte)
+	if len(fetched) != int(length) && length >= 0 {
+		return nil, errors.Errorf("invalid offset/length")
+	}
+
+	return fetched, nil
+}
+
+func exponentialBackoff(desc string, att retry.AttemptFunc) (interface{}, error) {
+	return retry.WithExponentialBackoff(desc, att, isRetriableError)
+}
+
+func isRetriableError(err error) bool {
+	if se, ok := err.(azblob.StorageError); ok {
+		// retry on server errors, not on client errors
+		return se.Response().StatusCode >= 500
+	}
+
+	return false
+}
+
+func translateError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if se, ok := err.(azblob.StorageError); ok {
+		switch se.ServiceCode() {
+		case azblob.ServiceCodeBlobNotFound, azblob.ServiceCodeContainerNotFound:
+			return blob.ErrBlobNotFound
+		}
+
+		if se.Response() != nil && se.Response().StatusCode == http.StatusNotFound {
+			return blob.ErrBlobNotFound
+		}
+	}
+
+	return errors.Wrap(err, "unexpected Azure error")
+}
+
+func (az *azStorage) PutBlob(ctx context.Context, b blob.ID, data []byte) error {
+	opt := azblob.UploadToBlockBlobOptions{
+		BlobHTTPHeaders: azblob.BlobHTTPHeaders{
+			ContentType: "application/x-kopia",
+		},
+	}
+
+	progressCallback := blob.ProgressCallback(ctx)
+	if progressCallback != nil {
+		progressCallback(string(b), 0, int64(len(data)))
+		defer progressCallback(string(b), int64(len(data)), int64(len(data)))
+
+		opt.Progress = func(completed int64) {
+			if completed != int64(len(data)) {
+				progressCallback(string(b), completed, int64(len(data)))
+			}
+		}
+	}
+
+	attempt := func() (interface{}, error) {
+		bu := az.container.NewBlockBlobURL(az.getObjectNameString(b))
+
+		if len(data) > azblob.BlockBlobMaxUploadBlobBytes {
+			return azblob.UploadBufferToBlockBlob(ctx, data, bu, opt)
+		}
+
+		// upload in a single request, streaming the body through the upload throttle.
+		body := blob.NewUploadBody(ctx, data)
+		defer body.Close() //nolint:errcheck
+
+		var r io.ReadSeeker = body
+		if opt.Progress != nil {
+			r = pipeline.NewRequestBodyProgress(body, opt.Progress)
+		}
+
+		return bu.Upload(ctx, r, opt.BlobHTTPHeaders, opt.Metadata, opt.AccessConditions)
+	}
+
+	_, err := exponentialBackoff(fmt.Sprintf("PutBlob(%q)", b), attempt)
+
+	return translateError(err)
+}
+
+func (az *azStorage) DeleteBlob(ctx context.Context, b blob.ID) error {
+	attempt := func() (interface{}, error) {
+		return az.container.NewBlobURL(az.getObjectNameString(b)).Delete(ctx, azblob.DeleteSnapshotsOptionInclude, azblob.BlobAccessConditions{})
+	}
+
+	_, err := exponentialBackoff(fmt.Sprintf("DeleteBlob(%q)", b), attempt)
+	err = translateError(err)
+
+	if err == blob.ErrBlobNotFound {
+		return nil
+	}
+
+	return err
+}
+
+func (az *azStorage) getObjectNameString(b blob.ID) string {
+	return az.Prefix + string(b)
+}
+
+func (az *azStorage) ListBlobs(ctx context.Context, prefix blob.ID, callback func(blob.Metadata) error) error {
+	opt := azblob.ListBlobsSegmentOptions{
+		Prefix: az.getObjectNameString(prefix),
+	}
+
+	for marker := (azblob.Marker{}); marker.NotDone(); {
+		v, err := exponentialBackoff(fmt.Sprintf("ListBlobs(%q)", prefix), func() (interface{}, error) {
+			return az.container.ListBlobsFlatSegment(ctx, marker, opt)
+		})
+		if err != nil {
+			return translateError(err)
+		}
+
+		resp := v.(*azblob.ListBlobsFlatSegmentResponse)
+
+		for _, it := range resp.Segment.BlobItems {
+			bm := blob.Metadata{
+				BlobID:    blob.ID(it.Name[len(az.Prefix):]),
+				Timestamp: it.Properties.LastModified,
+			}
+
+			if it.Properties.ContentLength != nil {
+				bm.Length = *it.Properties.ContentLength
+			}
+
+			if err := callback(bm); err != nil {
+				return err
+			}
+		}
+
+		marker = resp.NextMarker
+	}
+
+	return nil
+}
+
+func (az *azStorage) ConnectionInfo() blob.ConnectionInfo {
+	return blob.ConnectionInfo{
+		Type:   azStorageType,
+		Config: &az.Options,
+	}
+}
+
+func (az *azStorage) Close(ctx context.Context) error {
+	return nil
+}
+
+func (az *azStorage) String() string {
+	return fmt.Sprintf("azure://%v/%v", az.Container, az.Prefix)
+}
+
+func toBandwidth(bytesPerSecond int) iothrottler.Bandwidth {
+	if bytesPerSecond <= 0 {
+		return iothrottler.Unlimited
+	}
+
+	return iothrottler.Bandwidth(bytesPerSecond) * iothrottler.BytesPerSecond
+}
+
+// newHTTPSender returns pipeline factory that sends requests using the provided HTTP client.
+func newHTTPSender(hc *http.Client) pipeline.Factory {
+	return pipeline.FactoryFunc(func(next pipeline.Policy, po *pipeline.PolicyOptions) pipeline.PolicyFunc {
+		return func(ctx context.Context, request pipeline.Request) (pipeline.Response, error) {
+			resp, err := hc.Do(request.WithContext(ctx))
+			if err != nil {
+				err = pipeline.NewError(err, "HTTP request failed")
+			}
+
+			return pipeline.NewHTTPResponse(resp), err
+		}
+	})
+}
+
+func (opt *Options) serviceURL() string {
+	if opt.Endpoint != "" {
+		return strings.TrimSuffix(opt.Endpoint, "/")
+	}
+
+	domain := opt.StorageDomain
+	if domain == "" {
+		domain = defaultStorageDomain
+	}
+
+	return fmt.Sprintf("https://%v.%v", opt.StorageAccount, domain)
+}
+
+// New creates new Azure Blob Storage-backed storage with specified options:
+//
+// - the 'Container', 'StorageAccount' and 'StorageKey' fields are required and all other parameters are optional.
+func New(ctx context.Context, opt *Options) (blob.Storage, error) {
+	if opt.Container == "" {
+		return nil, errors.New("container name must be specified")
+	}
+
+	if opt.StorageAccount == "" {
+		return nil, errors.New("storage account must be specified")
+	}
+
+	cred, err := azblob.NewSharedKeyCredential(opt.StorageAccount, opt.StorageKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to initialize storage credentials")
+	}
+
+	u, err := url.Parse(opt.serviceURL() + "/" + opt.Container)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid storage endpoint")
+	}
+
+	downloadThrottler := iothrottler.NewIOThrottlerPool(toBandwidth(opt.MaxDownloadSpeedBytesPerSecond))
+	uploadThrottler := iothrottler.NewIOThrottlerPool(toBandwidth(opt.MaxUploadSpeedBytesPerSecond))
+
+	hc := &http.Client{
+		Transport: throttle.NewRoundTripper(http.DefaultTransport, downloadThrottler, uploadThrottler),
+	}
+
+	p := azblob.NewPipeline(cred, azblob.PipelineOptions{
+		// retries are handled by exponentialBackoff()
+		Retry:      azblob.RetryOptions{MaxTries: 1},
+		HTTPSender: newHTTPSender(hc),
+	})
+
+	return &azStorage{
+		Options:           *opt,
+		ctx:               ctx,
+		container:         azblob.NewContainerURL(*u, p),
+		downloadThrottler: downloadThrottler,
+		uploadThrottler:   uploadThrottler,
+	}, nil
+}
+
+func init() {
+	blob.AddSupportedStorage(
+		azStorageType,
+		func() interface{} {
+			return &Options{}
+		},
+		func(ctx context.Context, o interface{}) (blob.Storage, error) {
+			return New(ctx, o.(*Options))
+		})
+}
@@ -0,0 +1,134 @@
+package azure
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-storage-blob-go/azblob"
+
+	"github.com/kopia/kopia/internal/blobtesting"
+	"github.com/kopia/kopia/repo/blob"
+)
+
+// Well-known development account of the Azurite emulator (https://github.com/Azure/Azurite)
+const (
+	azuriteHost       = "127.0.0.1:10000"
+	azuriteAccount    = "devstoreaccount1"
+	azuriteAccountKey = "Eby8vdM02xNOcqFlqUwJPLlmEtlCDXJ1OUzFT50uSRZ6IFsuFq2UVErCz4I6tq/K1SZFPTOtr/KBHBeksoGMGw==" //nolint:gosec
+	azuriteContainer  = "kopia-test"
+)
+
+func endpointReachable(host string) bool {
+	conn, err := net.DialTimeout("tcp4", host, 5*time.Second)
+	if err == nil {
+		conn.Close()
+		return true
+	}
+
+	return false
+}
+
+func TestAzureStorageAzurite(t *testing.T) {
+	if !endpointReachable(azuriteHost) {
+		t.Skip("Azurite emulator not reachable")
+	}
+
+	opt := &Options{
+		Container:      azuriteContainer,
+		StorageAccount: azuriteAccount,
+		StorageKey:     azuriteAccountKey,
+		Endpoint:       "http://" + azuriteHost + "/" + azuriteAccount,
+	}
+
+	createContainer(t, opt)
+	verifyAzureStorage(t, opt)
+}
+
+func TestAzureStorage(t *testing.T) {
+	container := os.Getenv("KOPIA_AZURE_TEST_CONTAINER")
+	if container == "" {
+		t.Skip("KOPIA_AZURE_TEST_CONTAINER not provided")
+	}
+
+	storageAccount := os.Getenv("KOPIA_AZURE_TEST_STORAGE_ACCOUNT")
+	if storageAccount == "" {
+		t.Skip("KOPIA_AZURE_TEST_STORAGE_ACCOUNT not provided")
+	}
+
+	storageKey := os.Getenv("KOPIA_AZURE_TEST_STORAGE_KEY")
+	if storageKey == "" {
+		t.Skip("KOPIA_AZURE_TEST_STORAGE_KEY not provided")
+	}
+
+	verifyAzureStorage(t, &Options{
+		Container:      container,
+		StorageAccount: storageAccount,
+		StorageKey:     storageKey,
+	})
+}
+
+func TestAzureStorageInvalidOptions(t *testing.T) {
+	ctx := context.Background()
+
+	if _, err := New(ctx, &Options{StorageAccount: "foo"}); err == nil {
+		t.Errorf("unexpected success without container")
+	}
+
+	if _, err := New(ctx, &Options{Container: "foo"}); err == nil {
+		t.Errorf("unexpected success without storage account")
+	}
+
+	if _, err := New(ctx, &Options{Container: "foo", StorageAccount: "bar", StorageKey: "not-base64!"}); err == nil {
+		t.Errorf("unexpected success with invalid storage key")
+	}
+}
+
+func verifyAzureStorage(t *testing.T, opt *Options) {
+	ctx := context.Background()
+
+	data := make([]byte, 8)
+	rand.Read(data) //nolint:errcheck
+
+	o := *opt
+	o.Prefix = fmt.Sprintf("test-%v-%x-", time.Now().Unix(), data)
+
+	st, err := New(ctx, &o)
+	if err != nil {
+		t.Fatalf("unable to connect to Azure: %v", err)
+	}
+
+	blobtesting.VerifyStorage(ctx, t, st)
+	blobtesting.AssertConnectionInfoRoundTrips(ctx, t, st)
+
+	// delete everything we created
+	if err := st.ListBlobs(ctx, "", func(bm blob.Metadata) error {
+		return st.DeleteBlob(ctx, bm.BlobID)
+	}); err != nil {
+		t.Fatalf("unable to clear Azure container: %v", err)
+	}
+
+	if err := st.Close(ctx); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+}
+
+func createContainer(t *testing.T, opt *Options) {
+	cred, err := azblob.NewSharedKeyCredential(opt.StorageAccount, opt.StorageKey)
+	if err != nil {
+		t.Fatalf("can't initialize credentials: %v", err)
+	}
+
+	u, err := url.Parse(opt.serviceURL() + "/" + opt.Container)
+	if err != nil {
+		t.Fatalf("invalid URL: %v", err)
+	}
+
+	// ignore error, the container may already exist
+	_, _ = azblob.NewContainerURL(*u, azblob.NewPipeline(cred, azblob.PipelineOptions{})).Create(context.Background(), nil, azblob.PublicAccessNone)
+}
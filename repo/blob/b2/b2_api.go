@@ -0,0 +1,376 @@
+package b2
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1" //nolint:gosec
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo/blob"
+)
+
+const (
+	defaultAPIEndpoint = "https://api.backblazeb2.com"
+	apiVersionPath     = "/b2api/v2/"
+
+	// action reported by B2 for regular file versions, as opposed to hide markers.
+	actionUpload = "upload"
+)
+
+// apiError is the error returned by B2 API.
+type apiError struct {
+	Status  int    `json:"status"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("B2 error %v (%v): %v", e.Status, e.Code, e.Message)
+}
+
+// isExpiredToken returns true if the error indicates that authorization or upload token needs to be re-acquired.
+func (e *apiError) isExpiredToken() bool {
+	return e.Status == http.StatusUnauthorized && (e.Code == "expired_auth_token" || e.Code == "bad_auth_token")
+}
+
+type authorizeAccountResponse struct {
+	AccountID          string `json:"accountId"`
+	AuthorizationToken string `json:"authorizationToken"`
+	APIURL             string `json:"apiUrl"`
+	DownloadURL        string `json:"downloadUrl"`
+}
+
+type bucketInfo struct {
+	BucketID   string `json:"bucketId"`
+	BucketName string `json:"bucketName"`
+}
+
+type listBucketsRequest struct {
+	AccountID  string `json:"accountId"`
+	BucketName string `json:"bucketName,omitempty"`
+}
+
+type listBucketsResponse struct {
+	Buckets []bucketInfo `json:"buckets"`
+}
+
+type getUploadURLRequest struct {
+	BucketID string `json:"bucketId"`
+}
+
+type uploadURL struct {
+	UploadURL          string `json:"uploadUrl"`
+	AuthorizationToken string `json:"authorizationToken"`
+}
+
+// fileInfo describes a single version of a file or a hide marker.
+type fileInfo struct {
+	FileID          string `json:"fileId"`
+	FileName        string `json:"fileName"`
+	ContentLength   int64  `json:"contentLength"`
+	Action          string `json:"action"`
+	UploadTimestamp int64  `json:"uploadTimestamp"`
+}
+
+type listFilesRequest struct {
+	BucketID      string `json:"bucketId"`
+	StartFileName string `json:"startFileName,omitempty"`
+	StartFileID   string `json:"startFileId,omitempty"`
+	MaxFileCount  int    `json:"maxFileCount,omitempty"`
+	Prefix        string `json:"prefix,omitempty"`
+}
+
+type listFilesResponse struct {
+	Files        []fileInfo `json:"files"`
+	NextFileName string     `json:"nextFileName"`
+	NextFileID   string     `json:"nextFileId"`
+}
+
+type deleteFileVersionRequest struct {
+	FileName string `json:"fileName"`
+	FileID   string `json:"fileId"`
+}
+
+// apiClient is a minimal client of the native B2 API (https://www.backblaze.com/b2/docs/).
+type apiClient struct {
+	hc          *http.Client
+	apiEndpoint string
+	keyID       string
+	key         string
+
+	mu         sync.Mutex
+	auth       *authorizeAccountResponse
+	uploadURLs []*uploadURL
+}
+
+// authorization returns current account authorization, authorizing the account if needed.
+func (c *apiClient) authorization(ctx context.Context) (*authorizeAccountResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.auth != nil {
+		return c.auth, nil
+	}
+
+	req, err := http.NewRequest(http.MethodGet, c.apiEndpoint+apiVersionPath+"b2_authorize_account", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.SetBasicAuth(c.keyID, c.key)
+
+	var resp authorizeAccountResponse
+	if err := c.do(ctx, req, &resp); err != nil {
+		return nil, errors.Wrap(err, "unable to authorize account")
+	}
+
+	c.auth = &resp
+
+	return c.auth, nil
+}
+
+// invalidateAuthorization discards cached authorization and upload URLs if they were issued for the provided authorization.
+func (c *apiClient) invalidateAuthorization(auth *authorizeAccountResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.auth == auth {
+		c.auth = nil
+		c.uploadURLs = nil
+	}
+}
+
+// do sends the provided request and decodes JSON response into 'result' (if not nil).
+func (c *apiClient) do(ctx context.Context, req *http.Request, result interface{}) error {
+	resp, err := c.hc.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close() //nolint:errcheck
+
+	var r io.Reader = resp.Body
+
+	if _, ok := result.(*[]byte); ok {
+		// throttle downloads of file contents.
+		throttled, done := blob.ThrottleDownload(ctx, r)
+		defer done()
+
+		r = throttled
+	}
+
+	body, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		return newAPIError(resp.StatusCode, body)
+	}
+
+	if result == nil {
+		return nil
+	}
+
+	if b, ok := result.(*[]byte); ok {
+		*b = body
+		return nil
+	}
+
+	return json.Unmarshal(body, result)
+}
+
+func newAPIError(status int, body []byte) error {
+	e := &apiError{}
+	if err := json.Unmarshal(body, e); err != nil || e.Code == "" {
+		e.Code = http.StatusText(status)
+		e.Message = string(body)
+	}
+
+	e.Status = status
+
+	return e
+}
+
+// call invokes the named B2 API method, re-authorizing once if the authorization token has expired.
+func (c *apiClient) call(ctx context.Context, method string, request, result interface{}) error {
+	payload, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	for attempt := 0; ; attempt++ {
+		auth, err := c.authorization(ctx)
+		if err != nil {
+			return err
+		}
+
+		req, err := http.NewRequest(http.MethodPost, auth.APIURL+apiVersionPath+method, bytes.NewReader(payload))
+		if err != nil {
+			return err
+		}
+
+		req.Header.Set("Authorization", auth.AuthorizationToken)
+		req.Header.Set("Content-Type", "application/json")
+
+		err = c.do(ctx, req, result)
+		if ae, ok := err.(*apiError); ok && ae.isExpiredToken() && attempt == 0 {
+			c.invalidateAuthorization(auth)
+			continue
+		}
+
+		return err
+	}
+}
+
+func (c *apiClient) findBucket(ctx context.Context, name string) (*bucketInfo, error) {
+	auth, err := c.authorization(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp listBucketsResponse
+	if err := c.call(ctx, "b2_list_buckets", &listBucketsRequest{AccountID: auth.AccountID, BucketName: name}, &resp); err != nil {
+		return nil, err
+	}
+
+	for _, b := range resp.Buckets {
+		if b.BucketName == name {
+			b := b
+			return &b, nil
+		}
+	}
+
+	return nil, errors.Errorf("bucket %q not found", name)
+}
+
+// acquireUploadURL returns upload URL from the pool or gets a new one. Upload URLs can't be used concurrently,
+// so each one must be returned to the pool using releaseUploadURL() after use.
+func (c *apiClient) acquireUploadURL(ctx context.Context, bucketID string) (*uploadURL, error) {
+	c.mu.Lock()
+	if n := len(c.uploadURLs); n > 0 {
+		u := c.uploadURLs[n-1]
+		c.uploadURLs = c.uploadURLs[0 : n-1]
+		c.mu.Unlock()
+
+		return u, nil
+	}
+	c.mu.Unlock()
+
+	var u uploadURL
+	if err := c.call(ctx, "b2_get_upload_url", &getUploadURLRequest{BucketID: bucketID}, &u); err != nil {
+		return nil, err
+	}
+
+	return &u, nil
+}
+
+func (c *apiClient) releaseUploadURL(u *uploadURL) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.uploadURLs = append(c.uploadURLs, u)
+}
+
+func (c *apiClient) uploadFile(ctx context.Context, bucketID, fileName string, data []byte) (*fileInfo, error) {
+	u, err := c.acquireUploadURL(ctx, bucketID)
+	if err != nil {
+		return nil, err
+	}
+
+	body := blob.NewUploadBody(ctx, data)
+	defer body.Close() //nolint:errcheck
+
+	req, err := http.NewRequest(http.MethodPost, u.UploadURL, body)
+	if err != nil {
+		return nil, err
+	}
+
+	h := sha1.Sum(data) //nolint:gosec
+
+	req.ContentLength = int64(len(data))
+	req.Header.Set("Authorization", u.AuthorizationToken)
+	req.Header.Set("X-Bz-File-Name", escapeFileName(fileName))
+	req.Header.Set("Content-Type", "application/x-kopia")
+	req.Header.Set("X-Bz-Content-Sha1", hex.EncodeToString(h[:]))
+
+	var fi fileInfo
+	if err := c.do(ctx, req, &fi); err != nil {
+		// upload URL may no longer be usable after a failure, don't return it to the pool.
+		return nil, err
+	}
+
+	c.releaseUploadURL(u)
+
+	return &fi, nil
+}
+
+// downloadFileByName downloads the latest version of the file, optionally limited to the provided range.
+func (c *apiClient) downloadFileByName(ctx context.Context, bucketName, fileName string, offset, length int64) ([]byte, error) {
+	for attempt := 0; ; attempt++ {
+		auth, err := c.authorization(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		req, err := http.NewRequest(http.MethodGet, auth.DownloadURL+"/file/"+bucketName+"/"+escapeFileName(fileName), nil)
+		if err != nil {
+			return nil, err
+		}
+
+		req.Header.Set("Authorization", auth.AuthorizationToken)
+
+		switch {
+		case length > 0:
+			req.Header.Set("Range", fmt.Sprintf("bytes=%v-%v", offset, offset+length-1))
+		case offset > 0:
+			req.Header.Set("Range", fmt.Sprintf("bytes=%v-", offset))
+		}
+
+		var data []byte
+
+		err = c.do(ctx, req, &data)
+		if ae, ok := err.(*apiError); ok && ae.isExpiredToken() && attempt == 0 {
+			c.invalidateAuthorization(auth)
+			continue
+		}
+
+		return data, err
+	}
+}
+
+func (c *apiClient) listFileNames(ctx context.Context, req *listFilesRequest) (*listFilesResponse, error) {
+	var resp listFilesResponse
+	if err := c.call(ctx, "b2_list_file_names", req, &resp); err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+}
+
+func (c *apiClient) listFileVersions(ctx context.Context, req *listFilesRequest) (*listFilesResponse, error) {
+	var resp listFilesResponse
+	if err := c.call(ctx, "b2_list_file_versions", req, &resp); err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+}
+
+func (c *apiClient) deleteFileVersion(ctx context.Context, fileName, fileID string) error {
+	return c.call(ctx, "b2_delete_file_version", &deleteFileVersionRequest{FileName: fileName, FileID: fileID}, nil)
+}
+
+// escapeFileName percent-encodes the file name as required by B2, leaving slashes intact.
+func escapeFileName(s string) string {
+	return strings.Replace(url.PathEscape(s), "%2F", "/", -1)
+}
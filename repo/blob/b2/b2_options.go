@@ -0,0 +1,31 @@
+package b2
+
+// Options defines options for B2-based storage.
+type Options struct {
+	// BucketName is the name of the bucket where data is stored.
+	BucketName string `json:"bucket"`
+
+	// Prefix specifies additional string to prepend to all objects.
+	Prefix string `json:"prefix,omitempty"`
+
+	// KeyID is the ID of the application key (or the account ID when using the master key).
+	KeyID string `json:"keyID"`
+
+	// Key is the application key.
+	Key string `json:"key" kopia:"sensitive"`
+
+	// APIEndpoint optionally overrides the URL used to authorize the account.
+	APIEndpoint string `json:"apiEndpoint,omitempty"`
+
+	MaxUploadSpeedBytesPerSecond int `json:"maxUploadSpeedBytesPerSecond,omitempty"`
+
+	MaxDownloadSpeedBytesPerSecond int `json:"maxDownloadSpeedBytesPerSecond,omitempty"`
+}
+
+func (o *Options) apiEndpoint() string {
+	if o.APIEndpoint == "" {
+		return defaultAPIEndpoint
+	}
+
+	return o.APIEndpoint
+}
@@ -0,0 +1,319 @@
+// Package b2 implements Storage based on a Backblaze B2 bucket using the native B2 API.
+package b2
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/efarrer/iothrottler"
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/retry"
+	"github.com/kopia/kopia/internal/throttle"
+	"github.com/kopia/kopia/repo/blob"
+)
+
+const (
+	b2storageType = "b2"
+
+	// maximum number of files returned by a single list call.
+	maxListFileCount = 1000
+)
+
+type b2Storage struct {
+	Options
+
+	ctx    context.Context
+	cli    *apiClient
+	bucket *bucketInfo
+
+	downloadThrottler *iothrottler.IOThrottlerPool
+	uploadThrottler   *iothrottler.IOThrottlerPool
+}
+
+func (s *b2Storage) GetBlob(ctx context.Context, id blob.ID, offset, length int64) ([]byte, error) {
+	if offset < 0 {
+		return nil, errors.Errorf("invalid offset")
+	}
+
+	if length == 0 {
+		// zero-length reads only need to confirm that the blob exists.
+		return s.getEmptyBlob(ctx, id)
+	}
+
+	attempt := func() (interface{}, error) {
+		return s.cli.downloadFileByName(ctx, s.bucket.BucketName, s.getObjectNameString(id), offset, length)
+	}
+
+	v, err := exponentialBackoff(fmt.Sprintf("GetBlob(%q,%v,%v)", id, offset, length), attempt)
+	if err != nil {
+		return nil, translateError(err)
+	}
+
+	fetched := v.([]byte)
+	if len(fetched) != int(length) && length > 0 {
+		return nil, errors.Errorf("invalid offset/length")
+	}
+
+	return fetched, nil
+}
+
+func (s *b2Storage) getEmptyBlob(ctx context.Context, id blob.ID) ([]byte, error) {
+	fileName := s.getObjectNameString(id)
+
+	v, err := exponentialBackoff(fmt.Sprintf("GetBlob(%q,0,0)", id), func() (interface{}, error) {
+		return s.cli.listFileNames(ctx, &listFilesRequest{
+			BucketID:      s.bucket.BucketID,
+			StartFileName: fileName,
+			MaxFileCount:  1,
+			Prefix:        fileName,
+		})
+	})
+	if err != nil {
+		return nil, translateError(err)
+	}
+
+	for _, f := range v.(*listFilesResponse).Files {
+		if f.FileName == fileName && f.Action == actionUpload {
+			return []byte{}, nil
+		}
+	}
+
+	return nil, blob.ErrBlobNotFound
+}
+
+func exponentialBackoff(desc string, att retry.AttemptFunc) (interface{}, error) {
+	return retry.WithExponentialBackoff(desc, att, isRetriableError)
+}
+
+func isRetriableError(err error) bool {
+	switch err := err.(type) {
+	case *apiError:
+		// retry on server errors and throttling, not on client errors
+		return err.Status >= 500 || err.Status == http.StatusTooManyRequests || err.Status == http.StatusRequestTimeout || err.isExpiredToken()
+
+	case *url.Error:
+		// transport-level failures.
+		return true
+
+	default:
+		return false
+	}
+}
+
+func translateError(err error) error {
+	if ae, ok := err.(*apiError); ok {
+		if ae.Code == "file_not_present" {
+			return blob.ErrBlobNotFound
+		}
+
+		switch ae.Status {
+		case http.StatusNotFound:
+			return blob.ErrBlobNotFound
+
+		case http.StatusRequestedRangeNotSatisfiable:
+			return errors.Errorf("invalid offset/length")
+		}
+	}
+
+	return err
+}
+
+func (s *b2Storage) PutBlob(ctx context.Context, id blob.ID, data []byte) error {
+	progressCallback := blob.ProgressCallback(ctx)
+	if progressCallback != nil {
+		progressCallback(string(id), 0, int64(len(data)))
+		defer progressCallback(string(id), int64(len(data)), int64(len(data)))
+	}
+
+	_, err := exponentialBackoff(fmt.Sprintf("PutBlob(%q)", id), func() (interface{}, error) {
+		return s.cli.uploadFile(ctx, s.bucket.BucketID, s.getObjectNameString(id), data)
+	})
+
+	return translateError(err)
+}
+
+// DeleteBlob removes all versions of the blob, including hide markers, so that no
+// old versions linger in the bucket and keep consuming space.
+func (s *b2Storage) DeleteBlob(ctx context.Context, id blob.ID) error {
+	fileName := s.getObjectNameString(id)
+
+	versions, err := s.listFileVersions(ctx, fileName)
+	if err != nil {
+		return translateError(err)
+	}
+
+	for _, f := range versions {
+		f := f
+
+		err := retry.WithExponentialBackoffNoValue(fmt.Sprintf("DeleteBlob(%q,%v)", id, f.FileID), func() error {
+			return s.cli.deleteFileVersion(ctx, f.FileName, f.FileID)
+		}, isRetriableError)
+
+		if err := translateError(err); err != nil && err != blob.ErrBlobNotFound {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// listFileVersions returns all versions and hide markers of the file with the given name.
+func (s *b2Storage) listFileVersions(ctx context.Context, fileName string) ([]fileInfo, error) {
+	var result []fileInfo
+
+	req := &listFilesRequest{
+		BucketID:      s.bucket.BucketID,
+		StartFileName: fileName,
+		MaxFileCount:  maxListFileCount,
+		Prefix:        fileName,
+	}
+
+	for {
+		v, err := exponentialBackoff(fmt.Sprintf("listFileVersions(%q)", fileName), func() (interface{}, error) {
+			return s.cli.listFileVersions(ctx, req)
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		resp := v.(*listFilesResponse)
+
+		for _, f := range resp.Files {
+			if f.FileName == fileName {
+				result = append(result, f)
+			}
+		}
+
+		if resp.NextFileName != fileName {
+			return result, nil
+		}
+
+		req.StartFileName = resp.NextFileName
+		req.StartFileID = resp.NextFileID
+	}
+}
+
+func (s *b2Storage) getObjectNameString(id blob.ID) string {
+	return s.Prefix + string(id)
+}
+
+func (s *b2Storage) ListBlobs(ctx context.Context, prefix blob.ID, callback func(blob.Metadata) error) error {
+	req := &listFilesRequest{
+		BucketID:     s.bucket.BucketID,
+		MaxFileCount: maxListFileCount,
+		Prefix:       s.getObjectNameString(prefix),
+	}
+
+	for {
+		v, err := exponentialBackoff(fmt.Sprintf("ListBlobs(%q)", prefix), func() (interface{}, error) {
+			return s.cli.listFileNames(ctx, req)
+		})
+		if err != nil {
+			return translateError(err)
+		}
+
+		resp := v.(*listFilesResponse)
+
+		for _, f := range resp.Files {
+			// skip anything that's not a regular file version, such as hide markers.
+			if f.Action != actionUpload {
+				continue
+			}
+
+			bm := blob.Metadata{
+				BlobID:    blob.ID(f.FileName[len(s.Prefix):]),
+				Length:    f.ContentLength,
+				Timestamp: time.Unix(0, f.UploadTimestamp*int64(time.Millisecond)),
+			}
+
+			if err := callback(bm); err != nil {
+				return err
+			}
+		}
+
+		if resp.NextFileName == "" {
+			return nil
+		}
+
+		req.StartFileName = resp.NextFileName
+	}
+}
+
+func (s *b2Storage) ConnectionInfo() blob.ConnectionInfo {
+	return blob.ConnectionInfo{
+		Type:   b2storageType,
+		Config: &s.Options,
+	}
+}
+
+func (s *b2Storage) Close(ctx context.Context) error {
+	return nil
+}
+
+func (s *b2Storage) String() string {
+	return fmt.Sprintf("b2://%v/%v", s.BucketName, s.Prefix)
+}
+
+func toBandwidth(bytesPerSecond int) iothrottler.Bandwidth {
+	if bytesPerSecond <= 0 {
+		return iothrottler.Unlimited
+	}
+
+	return iothrottler.Bandwidth(bytesPerSecond) * iothrottler.BytesPerSecond
+}
+
+// New creates new B2-backed storage with specified options:
+//
+// - the 'BucketName', 'KeyID' and 'Key' fields are required and all other parameters are optional.
+func New(ctx context.Context, opt *Options) (blob.Storage, error) {
+	if opt.BucketName == "" {
+		return nil, errors.New("bucket name must be specified")
+	}
+
+	if opt.KeyID == "" || opt.Key == "" {
+		return nil, errors.New("key ID and key must be specified")
+	}
+
+	downloadThrottler := iothrottler.NewIOThrottlerPool(toBandwidth(opt.MaxDownloadSpeedBytesPerSecond))
+	uploadThrottler := iothrottler.NewIOThrottlerPool(toBandwidth(opt.MaxUploadSpeedBytesPerSecond))
+
+	cli := &apiClient{
+		hc: &http.Client{
+			Transport: throttle.NewRoundTripper(http.DefaultTransport, downloadThrottler, uploadThrottler),
+		},
+		apiEndpoint: opt.apiEndpoint(),
+		keyID:       opt.KeyID,
+		key:         opt.Key,
+	}
+
+	v, err := exponentialBackoff(fmt.Sprintf("findBucket(%q)", opt.BucketName), func() (interface{}, error) {
+		return cli.findBucket(ctx, opt.BucketName)
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to open bucket")
+	}
+
+	return &b2Storage{
+		Options:           *opt,
+		ctx:               ctx,
+		cli:               cli,
+		bucket:            v.(*bucketInfo),
+		downloadThrottler: downloadThrottler,
+		uploadThrottler:   uploadThrottler,
+	}, nil
+}
+
+func init() {
+	blob.AddSupportedStorage(
+		b2storageType,
+		func() interface{} {
+			return &Options{}
+		},
+		func(ctx context.Context, o interface{}) (blob.Storage, error) {
+			return New(ctx, o.(*Options))
+		})
+}
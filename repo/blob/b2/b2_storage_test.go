@@ -0,0 +1,480 @@
+package b2
+
+import (
+	"context"
+	"crypto/sha1" //nolint:gosec
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kopia/kopia/internal/blobtesting"
+	"github.com/kopia/kopia/repo/blob"
+)
+
+const (
+	fakeKeyID      = "fake-key-id"
+	fakeKey        = "fake-key"
+	fakeBucketName = "fake-bucket"
+	fakeBucketID   = "fake-bucket-id"
+)
+
+type fakeFile struct {
+	fileInfo
+	data []byte
+}
+
+// fakeB2Server implements the subset of native B2 API used by the storage, including
+// file versions and hide markers.
+type fakeB2Server struct {
+	mu          sync.Mutex
+	url         string
+	files       []*fakeFile // sorted by name and then from newest to oldest
+	nextID      int
+	token       string
+	expireToken bool
+}
+
+func (s *fakeB2Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r.URL.Path == apiVersionPath+"b2_authorize_account" {
+		s.authorize(w, r)
+		return
+	}
+
+	if r.Header.Get("Authorization") != s.token {
+		writeFakeError(w, http.StatusUnauthorized, "bad_auth_token")
+		return
+	}
+
+	if s.expireToken {
+		s.expireToken = false
+		writeFakeError(w, http.StatusUnauthorized, "expired_auth_token")
+
+		return
+	}
+
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/file/"+fakeBucketName+"/"):
+		s.download(w, r)
+	case r.URL.Path == "/upload/"+fakeBucketID:
+		s.upload(w, r)
+	case strings.HasPrefix(r.URL.Path, apiVersionPath):
+		s.apiCall(w, r, strings.TrimPrefix(r.URL.Path, apiVersionPath))
+	default:
+		writeFakeError(w, http.StatusNotFound, "not_found")
+	}
+}
+
+func writeFakeError(w http.ResponseWriter, status int, code string) {
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(&apiError{Status: status, Code: code, Message: code}) //nolint:errcheck
+}
+
+func (s *fakeB2Server) authorize(w http.ResponseWriter, r *http.Request) {
+	if u, p, ok := r.BasicAuth(); !ok || u != fakeKeyID || p != fakeKey {
+		writeFakeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	s.nextID++
+	s.token = fmt.Sprintf("token-%v", s.nextID)
+
+	json.NewEncoder(w).Encode(&authorizeAccountResponse{ //nolint:errcheck
+		AccountID:          "fake-account",
+		AuthorizationToken: s.token,
+		APIURL:             s.url,
+		DownloadURL:        s.url,
+	})
+}
+
+func (s *fakeB2Server) latest(name string) *fakeFile {
+	for _, f := range s.files {
+		if f.FileName == name {
+			return f
+		}
+	}
+
+	return nil
+}
+
+func (s *fakeB2Server) add(name, action string, data []byte) *fakeFile {
+	s.nextID++
+
+	f := &fakeFile{
+		fileInfo: fileInfo{
+			FileID:          fmt.Sprintf("file-%v", s.nextID),
+			FileName:        name,
+			ContentLength:   int64(len(data)),
+			Action:          action,
+			UploadTimestamp: time.Now().UnixNano() / int64(time.Millisecond),
+		},
+		data: data,
+	}
+
+	// newest versions are stored first, so insert before other versions of the same name.
+	pos := sort.Search(len(s.files), func(i int) bool {
+		return s.files[i].FileName >= name
+	})
+
+	s.files = append(s.files, nil)
+	copy(s.files[pos+1:], s.files[pos:])
+	s.files[pos] = f
+
+	return f
+}
+
+func (s *fakeB2Server) download(w http.ResponseWriter, r *http.Request) {
+	name, _ := url.PathUnescape(strings.TrimPrefix(r.URL.EscapedPath(), "/file/"+fakeBucketName+"/"))
+
+	f := s.latest(name)
+	if f == nil || f.Action != actionUpload {
+		writeFakeError(w, http.StatusNotFound, "not_found")
+		return
+	}
+
+	data := f.data
+
+	if rng := r.Header.Get("Range"); rng != "" {
+		var start, end int64
+
+		end = int64(len(data)) - 1
+
+		if strings.HasSuffix(rng, "-") {
+			fmt.Sscanf(rng, "bytes=%d-", &start) //nolint:errcheck
+		} else {
+			fmt.Sscanf(rng, "bytes=%d-%d", &start, &end) //nolint:errcheck
+		}
+
+		if start >= int64(len(data)) {
+			writeFakeError(w, http.StatusRequestedRangeNotSatisfiable, "range_not_satisfiable")
+			return
+		}
+
+		if end >= int64(len(data)) {
+			end = int64(len(data)) - 1
+		}
+
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write(data[start : end+1]) //nolint:errcheck
+
+		return
+	}
+
+	w.Write(data) //nolint:errcheck
+}
+
+func (s *fakeB2Server) upload(w http.ResponseWriter, r *http.Request) {
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeFakeError(w, http.StatusBadRequest, "bad_request")
+		return
+	}
+
+	h := sha1.Sum(data) //nolint:gosec
+	if r.Header.Get("X-Bz-Content-Sha1") != hex.EncodeToString(h[:]) {
+		writeFakeError(w, http.StatusBadRequest, "bad_request")
+		return
+	}
+
+	name, _ := url.PathUnescape(r.Header.Get("X-Bz-File-Name"))
+
+	json.NewEncoder(w).Encode(&s.add(name, actionUpload, data).fileInfo) //nolint:errcheck
+}
+
+func (s *fakeB2Server) apiCall(w http.ResponseWriter, r *http.Request, method string) {
+	var req struct {
+		listFilesRequest
+		deleteFileVersionRequest
+		BucketName string `json:"bucketName"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeFakeError(w, http.StatusBadRequest, "bad_request")
+		return
+	}
+
+	var resp interface{}
+
+	switch method {
+	case "b2_list_buckets":
+		resp = &listBucketsResponse{Buckets: []bucketInfo{{BucketID: fakeBucketID, BucketName: fakeBucketName}}}
+
+	case "b2_get_upload_url":
+		resp = &uploadURL{UploadURL: s.url + "/upload/" + fakeBucketID, AuthorizationToken: s.token}
+
+	case "b2_list_file_names":
+		resp = s.listFiles(&req.listFilesRequest, false)
+
+	case "b2_list_file_versions":
+		resp = s.listFiles(&req.listFilesRequest, true)
+
+	case "b2_hide_file":
+		resp = &s.add(req.deleteFileVersionRequest.FileName, "hide", nil).fileInfo
+
+	case "b2_delete_file_version":
+		for i, f := range s.files {
+			if f.FileID == req.FileID && f.FileName == req.deleteFileVersionRequest.FileName {
+				s.files = append(s.files[0:i], s.files[i+1:]...)
+				resp = &f.fileInfo
+
+				break
+			}
+		}
+
+		if resp == nil {
+			writeFakeError(w, http.StatusBadRequest, "file_not_present")
+			return
+		}
+
+	default:
+		writeFakeError(w, http.StatusBadRequest, "bad_request")
+		return
+	}
+
+	json.NewEncoder(w).Encode(resp) //nolint:errcheck
+}
+
+func (s *fakeB2Server) listFiles(req *listFilesRequest, allVersions bool) *listFilesResponse {
+	resp := &listFilesResponse{Files: []fileInfo{}}
+	seen := map[string]bool{}
+	started := req.StartFileID == ""
+
+	for _, f := range s.files {
+		if !strings.HasPrefix(f.FileName, req.Prefix) || f.FileName < req.StartFileName {
+			continue
+		}
+
+		if !started {
+			started = f.FileID == req.StartFileID && f.FileName == req.StartFileName
+			if !started {
+				continue
+			}
+		}
+
+		if !allVersions {
+			if seen[f.FileName] {
+				continue
+			}
+
+			seen[f.FileName] = true
+
+			if f.Action != actionUpload {
+				continue
+			}
+		}
+
+		if len(resp.Files) == req.MaxFileCount {
+			resp.NextFileName = f.FileName
+			if allVersions {
+				resp.NextFileID = f.FileID
+			}
+
+			break
+		}
+
+		resp.Files = append(resp.Files, f.fileInfo)
+	}
+
+	return resp
+}
+
+func newFakeB2Server() (*fakeB2Server, func()) {
+	fs := &fakeB2Server{}
+	srv := httptest.NewServer(fs)
+	fs.url = srv.URL
+
+	return fs, srv.Close
+}
+
+func TestB2StorageFakeServer(t *testing.T) {
+	fs, cleanup := newFakeB2Server()
+	defer cleanup()
+
+	ctx := context.Background()
+
+	st, err := New(ctx, &Options{
+		BucketName:  fakeBucketName,
+		KeyID:       fakeKeyID,
+		Key:         fakeKey,
+		APIEndpoint: fs.url,
+		Prefix:      "some-prefix/",
+	})
+	if err != nil {
+		t.Fatalf("unable to connect to B2: %v", err)
+	}
+
+	blobtesting.VerifyStorage(ctx, t, st)
+	blobtesting.AssertConnectionInfoRoundTrips(ctx, t, st)
+
+	if err := st.Close(ctx); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+}
+
+func TestB2StorageVersionsAndHideMarkers(t *testing.T) {
+	fs, cleanup := newFakeB2Server()
+	defer cleanup()
+
+	ctx := context.Background()
+
+	st, err := New(ctx, &Options{
+		BucketName:  fakeBucketName,
+		KeyID:       fakeKeyID,
+		Key:         fakeKey,
+		APIEndpoint: fs.url,
+	})
+	if err != nil {
+		t.Fatalf("unable to connect to B2: %v", err)
+	}
+
+	// overwriting creates multiple versions, the newest one must be visible.
+	for i := 0; i < 3; i++ {
+		if err := st.PutBlob(ctx, "blob1", []byte{byte(i)}); err != nil {
+			t.Fatalf("unable to put blob: %v", err)
+		}
+	}
+
+	blobtesting.AssertGetBlob(ctx, t, st, "blob1", []byte{2})
+	blobtesting.AssertListResults(ctx, t, st, "", "blob1")
+
+	// blob hidden outside of kopia (e.g. by a lifecycle rule) must not be visible.
+	if err := st.PutBlob(ctx, "blob2", []byte{1, 2, 3}); err != nil {
+		t.Fatalf("unable to put blob: %v", err)
+	}
+
+	fs.mu.Lock()
+	fs.add("blob2", "hide", nil)
+	fs.mu.Unlock()
+
+	blobtesting.AssertGetBlobNotFound(ctx, t, st, "blob2")
+	blobtesting.AssertListResults(ctx, t, st, "", "blob1")
+
+	if _, err := st.GetBlob(ctx, "blob2", 0, 0); err != blob.ErrBlobNotFound {
+		t.Errorf("unexpected error when reading empty range of hidden blob: %v", err)
+	}
+
+	// deleting removes all versions and hide markers.
+	for _, id := range []blob.ID{"blob1", "blob2"} {
+		if err := st.DeleteBlob(ctx, id); err != nil {
+			t.Fatalf("unable to delete blob: %v", err)
+		}
+	}
+
+	if len(fs.files) != 0 {
+		t.Errorf("unexpected files left after deletion: %v", fs.files)
+	}
+
+	// expired authorization tokens are transparently renewed.
+	fs.mu.Lock()
+	fs.expireToken = true
+	fs.mu.Unlock()
+
+	if err := st.PutBlob(ctx, "blob3", []byte{1}); err != nil {
+		t.Fatalf("unable to put blob after token expiration: %v", err)
+	}
+
+	fs.mu.Lock()
+	fs.expireToken = true
+	fs.mu.Unlock()
+
+	blobtesting.AssertGetBlob(ctx, t, st, "blob3", []byte{1})
+}
+
+func TestB2StoragePagination(t *testing.T) {
+	fs, cleanup := newFakeB2Server()
+	defer cleanup()
+
+	ctx := context.Background()
+
+	st, err := New(ctx, &Options{
+		BucketName:  fakeBucketName,
+		KeyID:       fakeKeyID,
+		Key:         fakeKey,
+		APIEndpoint: fs.url,
+	})
+	if err != nil {
+		t.Fatalf("unable to connect to B2: %v", err)
+	}
+
+	var want []blob.ID
+
+	for i := 0; i < maxListFileCount+10; i++ {
+		id := blob.ID(fmt.Sprintf("blob-%05v", i))
+		want = append(want, id)
+
+		fs.mu.Lock()
+		fs.add(string(id), actionUpload, []byte{1})
+		fs.mu.Unlock()
+	}
+
+	blobtesting.AssertListResults(ctx, t, st, "blob-", want...)
+}
+
+func TestB2StorageInvalidCredentials(t *testing.T) {
+	fs, cleanup := newFakeB2Server()
+	defer cleanup()
+
+	if _, err := New(context.Background(), &Options{
+		BucketName:  fakeBucketName,
+		KeyID:       fakeKeyID,
+		Key:         "wrong-key",
+		APIEndpoint: fs.url,
+	}); err == nil {
+		t.Errorf("unexpected success with invalid credentials")
+	}
+}
+
+func TestB2Storage(t *testing.T) {
+	bucket := os.Getenv("KOPIA_B2_TEST_BUCKET")
+	if bucket == "" {
+		t.Skip("KOPIA_B2_TEST_BUCKET not provided")
+	}
+
+	keyID := os.Getenv("KOPIA_B2_TEST_KEY_ID")
+	if keyID == "" {
+		t.Skip("KOPIA_B2_TEST_KEY_ID not provided")
+	}
+
+	key := os.Getenv("KOPIA_B2_TEST_KEY")
+	if key == "" {
+		t.Skip("KOPIA_B2_TEST_KEY not provided")
+	}
+
+	ctx := context.Background()
+
+	st, err := New(ctx, &Options{
+		BucketName: bucket,
+		KeyID:      keyID,
+		Key:        key,
+		Prefix:     fmt.Sprintf("test-%v-", time.Now().UnixNano()),
+	})
+	if err != nil {
+		t.Fatalf("unable to connect to B2: %v", err)
+	}
+
+	blobtesting.VerifyStorage(ctx, t, st)
+	blobtesting.AssertConnectionInfoRoundTrips(ctx, t, st)
+
+	// delete everything we created
+	if err := st.ListBlobs(ctx, "", func(bm blob.Metadata) error {
+		return st.DeleteBlob(ctx, bm.BlobID)
+	}); err != nil {
+		t.Fatalf("unable to clear B2 bucket: %v", err)
+	}
+
+	if err := st.Close(ctx); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+}
@@ -51,7 +51,10 @@ func (gcs *gcsStorage) GetBlob(ctx context.Context, b blob.ID, offset, length in
 		}
 		defer reader.Close() //nolint:errcheck
 
-		return ioutil.ReadAll(reader)
+		throttled, done := blob.ThrottleDownload(ctx, reader)
+		defer done()
+
+		return ioutil.ReadAll(throttled)
 	}
 
 	v, err := exponentialBackoff(fmt.Sprintf("GetBlob(%q,%v,%v)", b, offset, length), attempt)
@@ -121,7 +124,10 @@ func (gcs *gcsStorage) PutBlob(ctx context.Context, b blob.ID, data []byte) erro
 		}
 	}
 
-	_, err := io.Copy(writer, bytes.NewReader(data))
+	body, done := blob.ThrottleUpload(ctx, bytes.NewReader(data))
+	defer done()
+
+	_, err := io.Copy(writer, body)
 	if err != nil {
 		// cancel context before closing the writer causes it to abandon the upload.
 		cancel()
@@ -0,0 +1,77 @@
+package mirror
+
+import (
+	"context"
+	"sort"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo/blob"
+)
+
+// MissingBlob describes a blob that is not present on all replicas.
+type MissingBlob struct {
+	blob.Metadata
+
+	Source    int   // index of the first replica that has the blob
+	MissingOn []int // indexes of replicas that don't have the blob
+}
+
+// FindMissingBlobs lists blobs with the provided prefix in all replicas and returns the blobs
+// that are missing on at least one of them, sorted by blob ID.
+func FindMissingBlobs(ctx context.Context, replicas []blob.Storage, prefix blob.ID) ([]MissingBlob, error) {
+	present := make([]map[blob.ID]bool, len(replicas))
+	first := map[blob.ID]*MissingBlob{}
+
+	for i, r := range replicas {
+		present[i] = map[blob.ID]bool{}
+
+		if err := r.ListBlobs(ctx, prefix, func(bm blob.Metadata) error {
+			present[i][bm.BlobID] = true
+
+			if first[bm.BlobID] == nil {
+				first[bm.BlobID] = &MissingBlob{Metadata: bm, Source: i}
+			}
+
+			return nil
+		}); err != nil {
+			return nil, errors.Wrapf(err, "unable to list blobs in replica #%v", i)
+		}
+	}
+
+	var result []MissingBlob
+
+	for id, mb := range first {
+		for i := range replicas {
+			if !present[i][id] {
+				mb.MissingOn = append(mb.MissingOn, i)
+			}
+		}
+
+		if len(mb.MissingOn) > 0 {
+			result = append(result, *mb)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].BlobID < result[j].BlobID
+	})
+
+	return result, nil
+}
+
+// RepairMissingBlob copies the blob from the source replica to all replicas where it is missing.
+func RepairMissingBlob(ctx context.Context, replicas []blob.Storage, mb MissingBlob) error {
+	data, err := replicas[mb.Source].GetBlob(ctx, mb.BlobID, 0, -1)
+	if err != nil {
+		return errors.Wrapf(err, "unable to read blob %q from replica #%v", mb.BlobID, mb.Source)
+	}
+
+	for _, i := range mb.MissingOn {
+		if err := replicas[i].PutBlob(ctx, mb.BlobID, data); err != nil {
+			return errors.Wrapf(err, "unable to write blob %q to replica #%v", mb.BlobID, i)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,10 @@
+package mirror
+
+import "github.com/kopia/kopia/repo/blob"
+
+// Options defines options for mirrored storage.
+type Options struct {
+	// Replicas is the list of storages holding identical copies of all blobs.
+	// Reads are attempted in order, so the fastest or most reliable storage should be listed first.
+	Replicas []blob.ConnectionInfo `json:"replicas"`
+}
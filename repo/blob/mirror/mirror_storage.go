@@ -0,0 +1,224 @@
+// Package mirror implements Storage that keeps identical copies of all blobs in multiple underlying storages.
+package mirror
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/repologging"
+	"github.com/kopia/kopia/repo/blob"
+)
+
+const mirrorStorageType = "mirror"
+
+var log = repologging.Logger("repo/mirror")
+
+type mirrorStorage struct {
+	Options
+
+	replicas []blob.Storage
+}
+
+// GetBlob returns the blob from the first replica that can provide it, falling back to subsequent
+// replicas if the blob is not found or the replica returns an error.
+func (s *mirrorStorage) GetBlob(ctx context.Context, id blob.ID, offset, length int64) ([]byte, error) {
+	var lastErr error
+
+	for i, r := range s.replicas {
+		data, err := r.GetBlob(ctx, id, offset, length)
+		if err == nil {
+			return data, nil
+		}
+
+		if err != blob.ErrBlobNotFound {
+			log.Warningf("unable to get blob %q from replica #%v: %v", id, i, err)
+			lastErr = err
+		}
+	}
+
+	if lastErr != nil {
+		return nil, lastErr
+	}
+
+	return nil, blob.ErrBlobNotFound
+}
+
+// PutBlob writes the blob to all replicas in parallel and fails if any of the writes fails.
+func (s *mirrorStorage) PutBlob(ctx context.Context, id blob.ID, data []byte) error {
+	return s.forEachReplica(func(r blob.Storage) error {
+		return r.PutBlob(ctx, id, data)
+	})
+}
+
+// DeleteBlob deletes the blob from all replicas in parallel and fails if any of the deletions fails.
+func (s *mirrorStorage) DeleteBlob(ctx context.Context, id blob.ID) error {
+	return s.forEachReplica(func(r blob.Storage) error {
+		return r.DeleteBlob(ctx, id)
+	})
+}
+
+// forEachReplica invokes the provided function for all replicas in parallel and returns combined error.
+func (s *mirrorStorage) forEachReplica(cb func(r blob.Storage) error) error {
+	errs := make([]error, len(s.replicas))
+
+	var wg sync.WaitGroup
+
+	for i, r := range s.replicas {
+		wg.Add(1)
+
+		go func(i int, r blob.Storage) {
+			defer wg.Done()
+
+			errs[i] = cb(r)
+		}(i, r)
+	}
+
+	wg.Wait()
+
+	return combineErrors(errs)
+}
+
+func combineErrors(errs []error) error {
+	var msgs []string
+
+	for i, err := range errs {
+		if err != nil {
+			msgs = append(msgs, fmt.Sprintf("replica #%v: %v", i, err))
+		}
+	}
+
+	if len(msgs) == 0 {
+		return nil
+	}
+
+	return errors.New(strings.Join(msgs, "; "))
+}
+
+// callbackError wraps errors returned by ListBlobs callback, so they can be told apart from listing errors.
+type callbackError struct {
+	error
+}
+
+// ListBlobs reports the union of blobs from all replicas, each blob reported only once.
+// Replicas that fail to list are skipped as long as at least one replica can be listed successfully.
+func (s *mirrorStorage) ListBlobs(ctx context.Context, prefix blob.ID, callback func(blob.Metadata) error) error {
+	reported := map[blob.ID]bool{}
+	errs := make([]error, len(s.replicas))
+	succeeded := false
+
+	for i, r := range s.replicas {
+		err := r.ListBlobs(ctx, prefix, func(bm blob.Metadata) error {
+			if reported[bm.BlobID] {
+				return nil
+			}
+
+			reported[bm.BlobID] = true
+
+			if err := callback(bm); err != nil {
+				return callbackError{err}
+			}
+
+			return nil
+		})
+
+		if ce, ok := err.(callbackError); ok {
+			return ce.error
+		}
+
+		if err != nil {
+			log.Warningf("unable to list blobs in replica #%v: %v", i, err)
+			errs[i] = err
+
+			continue
+		}
+
+		succeeded = true
+	}
+
+	if !succeeded {
+		return combineErrors(errs)
+	}
+
+	return nil
+}
+
+func (s *mirrorStorage) ConnectionInfo() blob.ConnectionInfo {
+	return blob.ConnectionInfo{
+		Type:   mirrorStorageType,
+		Config: &s.Options,
+	}
+}
+
+func (s *mirrorStorage) Close(ctx context.Context) error {
+	errs := make([]error, len(s.replicas))
+
+	for i, r := range s.replicas {
+		errs[i] = r.Close(ctx)
+	}
+
+	return combineErrors(errs)
+}
+
+func (s *mirrorStorage) String() string {
+	var parts []string
+
+	for _, r := range s.replicas {
+		parts = append(parts, fmt.Sprintf("%v", r))
+	}
+
+	return "mirror(" + strings.Join(parts, ",") + ")"
+}
+
+// OpenReplicas opens all replica storages specified in the options.
+func OpenReplicas(ctx context.Context, opt *Options) ([]blob.Storage, error) {
+	var replicas []blob.Storage
+
+	for i, ci := range opt.Replicas {
+		r, err := blob.NewStorage(ctx, ci)
+		if err != nil {
+			for _, opened := range replicas {
+				opened.Close(ctx) //nolint:errcheck
+			}
+
+			return nil, errors.Wrapf(err, "unable to open replica #%v", i)
+		}
+
+		replicas = append(replicas, r)
+	}
+
+	return replicas, nil
+}
+
+// New creates new mirrored storage with specified options:
+//
+// - the 'Replicas' field must specify at least two storages.
+func New(ctx context.Context, opt *Options) (blob.Storage, error) {
+	if len(opt.Replicas) < 2 { // nolint:gomnd
+		return nil, errors.New("at least two replicas must be specified")
+	}
+
+	replicas, err := OpenReplicas(ctx, opt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &mirrorStorage{
+		Options:  *opt,
+		replicas: replicas,
+	}, nil
+}
+
+func init() {
+	blob.AddSupportedStorage(
+		mirrorStorageType,
+		func() interface{} {
+			return &Options{}
+		},
+		func(ctx context.Context, o interface{}) (blob.Storage, error) {
+			return New(ctx, o.(*Options))
+		})
+}
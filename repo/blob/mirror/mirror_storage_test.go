@@ -0,0 +1,176 @@
+package mirror
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/blobtesting"
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/blob/filesystem"
+)
+
+func TestMirrorStorage(t *testing.T) {
+	ctx := context.Background()
+
+	var opt Options
+
+	for i := 0; i < 3; i++ {
+		dir, err := ioutil.TempDir("", "mirror-test")
+		if err != nil {
+			t.Fatalf("unable to create temp dir: %v", err)
+		}
+		defer os.RemoveAll(dir)
+
+		opt.Replicas = append(opt.Replicas, blob.ConnectionInfo{
+			Type:   "filesystem",
+			Config: &filesystem.Options{Path: dir},
+		})
+	}
+
+	st, err := New(ctx, &opt)
+	if err != nil {
+		t.Fatalf("unable to create mirror storage: %v", err)
+	}
+
+	blobtesting.VerifyStorage(ctx, t, st)
+	blobtesting.AssertConnectionInfoRoundTrips(ctx, t, st)
+
+	if err := st.Close(ctx); err != nil {
+		t.Fatalf("unable to close: %v", err)
+	}
+
+	if _, err := New(ctx, &Options{Replicas: opt.Replicas[0:1]}); err == nil {
+		t.Errorf("unexpected success with a single replica")
+	}
+}
+
+func TestMirrorStorageFallback(t *testing.T) {
+	ctx := context.Background()
+
+	data1, data2 := blobtesting.DataMap{}, blobtesting.DataMap{}
+	r1 := &blobtesting.FaultyStorage{Base: blobtesting.NewMapStorage(data1, nil, nil)}
+	r2 := blobtesting.NewMapStorage(data2, nil, nil)
+	st := &mirrorStorage{replicas: []blob.Storage{r1, r2}}
+
+	if err := st.PutBlob(ctx, "a", []byte{1, 2, 3, 4}); err != nil {
+		t.Fatalf("unable to put blob: %v", err)
+	}
+
+	if data1["a"] == nil || data2["a"] == nil {
+		t.Fatalf("blob was not written to all replicas")
+	}
+
+	// blob missing on the first replica is read from the second one.
+	delete(data1, "a")
+	blobtesting.AssertGetBlob(ctx, t, st, "a", []byte{1, 2, 3, 4})
+
+	// first replica failing is ignored.
+	data1["a"] = []byte{1, 2, 3, 4}
+	r1.Faults = map[string][]*blobtesting.Fault{
+		"GetBlob": {{Err: errors.New("some transport error")}},
+	}
+	blobtesting.AssertGetBlob(ctx, t, st, "a", []byte{1, 2, 3, 4})
+
+	// blob missing everywhere.
+	blobtesting.AssertGetBlobNotFound(ctx, t, st, "b")
+
+	// error reading from one replica and missing in another is not reported as not found.
+	r1.Faults = map[string][]*blobtesting.Fault{
+		"GetBlob": {{Err: errors.New("some transport error")}},
+	}
+
+	if _, err := st.GetBlob(ctx, "b", 0, -1); err == nil || err == blob.ErrBlobNotFound {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// failed write to any replica fails the entire write.
+	r1.Faults = map[string][]*blobtesting.Fault{
+		"PutBlob": {{Err: errors.New("some write error")}},
+	}
+
+	if err := st.PutBlob(ctx, "c", []byte{1}); err == nil {
+		t.Errorf("unexpected success")
+	}
+
+	// listing returns union of blobs in all replicas, even if one of them can't be listed.
+	data1["only-in-1"] = []byte{1}
+	blobtesting.AssertListResults(ctx, t, st, "", "a", "c", "only-in-1")
+
+	r1.Faults = map[string][]*blobtesting.Fault{
+		"ListBlobs": {{Err: errors.New("some list error")}},
+	}
+	blobtesting.AssertListResults(ctx, t, st, "", "a", "c")
+
+	if err := st.DeleteBlob(ctx, "a"); err != nil {
+		t.Fatalf("unable to delete: %v", err)
+	}
+
+	if data1["a"] != nil || data2["a"] != nil {
+		t.Errorf("blob was not deleted from all replicas")
+	}
+}
+
+func TestFindAndRepairMissingBlobs(t *testing.T) {
+	ctx := context.Background()
+
+	data := []blobtesting.DataMap{
+		{"a": []byte{1}, "b": []byte{2}, "c": []byte{3}},
+		{"a": []byte{1}, "c": []byte{3}, "d": []byte{4}},
+		{"a": []byte{1}},
+	}
+
+	var replicas []blob.Storage
+	for _, d := range data {
+		replicas = append(replicas, blobtesting.NewMapStorage(d, nil, nil))
+	}
+
+	missing, err := FindMissingBlobs(ctx, replicas, "")
+	if err != nil {
+		t.Fatalf("error finding missing blobs: %v", err)
+	}
+
+	type result struct {
+		id        blob.ID
+		source    int
+		missingOn []int
+	}
+
+	var got []result
+	for _, mb := range missing {
+		got = append(got, result{mb.BlobID, mb.Source, mb.MissingOn})
+	}
+
+	want := []result{
+		{"b", 0, []int{1, 2}},
+		{"c", 0, []int{2}},
+		{"d", 1, []int{0, 2}},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected missing blobs: %v, want %v", got, want)
+	}
+
+	for _, mb := range missing {
+		if err := RepairMissingBlob(ctx, replicas, mb); err != nil {
+			t.Fatalf("unable to repair: %v", err)
+		}
+	}
+
+	missing, err = FindMissingBlobs(ctx, replicas, "")
+	if err != nil {
+		t.Fatalf("error finding missing blobs: %v", err)
+	}
+
+	if len(missing) != 0 {
+		t.Errorf("blobs still missing after repair: %v", missing)
+	}
+
+	for _, r := range replicas {
+		blobtesting.AssertGetBlob(ctx, t, r, "d", []byte{4})
+	}
+}
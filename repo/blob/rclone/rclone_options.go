@@ -0,0 +1,29 @@
+package rclone
+
+// Options defines options for RClone storage.
+type Options struct {
+	// RemotePath is the rclone remote and path where data is stored (e.g. 'myremote:some/path').
+	RemotePath string `json:"remotePath"`
+
+	// RCloneExe is the path to rclone executable (defaults to 'rclone').
+	RCloneExe string `json:"rcloneExe,omitempty"`
+
+	// RCloneArgs specifies additional arguments passed to 'rclone serve'.
+	RCloneArgs []string `json:"rcloneArgs,omitempty"`
+
+	// RCloneEnv specifies additional environment variables passed to rclone.
+	RCloneEnv []string `json:"rcloneEnv,omitempty"`
+
+	// Debug causes the output of rclone to be logged.
+	Debug bool `json:"debug,omitempty"`
+
+	DirectoryShards []int `json:"dirShards"`
+}
+
+func (o *Options) rcloneExe() string {
+	if o.RCloneExe == "" {
+		return defaultRCloneExe
+	}
+
+	return o.RCloneExe
+}
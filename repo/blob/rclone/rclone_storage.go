@@ -0,0 +1,256 @@
+// Package rclone implements blob storage provider backed by rclone (https://rclone.org).
+//
+// The provider launches 'rclone serve webdav' as a subprocess listening on a random local port
+// and communicates with it using WebDAV storage, so any remote supported by rclone can be used.
+package rclone
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/kopia/kopia/internal/repologging"
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/blob/webdav"
+)
+
+const (
+	rcloneStorageType = "rclone"
+	defaultRCloneExe  = "rclone"
+
+	rcloneUsername = "kopia"
+)
+
+var log = repologging.Logger("repo/rclone")
+
+var (
+	// rcloneStartupTimeout is the maximum amount of time to wait for rclone to start serving.
+	rcloneStartupTimeout = 15 * time.Second
+
+	// rcloneStartedPattern matches the log line reported by rclone after WebDAV server has started.
+	rcloneStartedPattern = regexp.MustCompile(`WebDav Server started on \[?(https?://[^\]\s]+)`)
+)
+
+// rcloneStorage implements blob.Storage on top of a WebDAV server provided by rclone subprocess.
+type rcloneStorage struct {
+	blob.Storage // the underlying WebDAV storage used to implement all methods.
+
+	Options
+
+	cmd          *exec.Cmd
+	exited       chan struct{}
+	temporaryDir string
+}
+
+func (r *rcloneStorage) ConnectionInfo() blob.ConnectionInfo {
+	return blob.ConnectionInfo{
+		Type:   rcloneStorageType,
+		Config: &r.Options,
+	}
+}
+
+// Close closes the underlying WebDAV storage and terminates rclone subprocess.
+func (r *rcloneStorage) Close(ctx context.Context) error {
+	var err error
+
+	if r.Storage != nil {
+		err = r.Storage.Close(ctx)
+		r.Storage = nil
+	}
+
+	r.killProcess()
+
+	if r.temporaryDir != "" {
+		if rerr := os.RemoveAll(r.temporaryDir); rerr != nil && err == nil {
+			err = errors.Wrap(rerr, "unable to remove temporary directory")
+		}
+
+		r.temporaryDir = ""
+	}
+
+	return err
+}
+
+// killProcess terminates rclone process, if running, and waits for it to exit.
+func (r *rcloneStorage) killProcess() {
+	if r.cmd == nil || r.cmd.Process == nil {
+		return
+	}
+
+	select {
+	case <-r.exited:
+	default:
+		if err := r.cmd.Process.Kill(); err != nil {
+			log.Warningf("unable to kill rclone: %v", err)
+		}
+
+		<-r.exited
+	}
+
+	r.cmd = nil
+}
+
+func (r *rcloneStorage) String() string {
+	return "rclone://" + r.RemotePath
+}
+
+// waitForStartup reads rclone output until WebDAV server URL is reported, the process exits or the timeout elapses.
+// After startup the output continues to be consumed (and logged when debugging is enabled).
+func (r *rcloneStorage) waitForStartup(stderr io.Reader) (string, error) {
+	urlch := make(chan string, 1)
+
+	go func() {
+		s := bufio.NewScanner(stderr)
+		reported := false
+
+		for s.Scan() {
+			l := s.Text()
+
+			if r.Debug {
+				log.Debugf("[RCLONE] %v", l)
+			}
+
+			if m := rcloneStartedPattern.FindStringSubmatch(l); m != nil && !reported {
+				urlch <- m[1]
+				reported = true
+			}
+		}
+	}()
+
+	select {
+	case u := <-urlch:
+		return u, nil
+
+	case <-r.exited:
+		return "", errors.Errorf("rclone exited before starting WebDAV server: %v", r.cmd.ProcessState)
+
+	case <-time.After(rcloneStartupTimeout):
+		return "", errors.Errorf("timed out waiting for rclone to start WebDAV server")
+	}
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// writeHTPasswd writes htpasswd file with bcrypt-hashed credentials used to protect WebDAV server.
+func writeHTPasswd(fname, username, password string) error {
+	// the password is random and only valid for the lifetime of the process, so minimal cost is sufficient
+	// and keeps the per-request verification overhead low.
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		return errors.Wrap(err, "unable to hash password")
+	}
+
+	return ioutil.WriteFile(fname, []byte(fmt.Sprintf("%v:%s\n", username, hash)), 0600)
+}
+
+// New creates new RClone storage with specified options.
+func New(ctx context.Context, opt *Options) (blob.Storage, error) {
+	if opt.RemotePath == "" {
+		return nil, errors.New("remote path must be specified")
+	}
+
+	r := &rcloneStorage{
+		Options: *opt,
+		exited:  make(chan struct{}),
+	}
+
+	// make sure we release all resources (subprocess, temporary directory) in case of failure.
+	success := false
+
+	defer func() {
+		if !success {
+			r.Close(ctx) //nolint:errcheck
+		}
+	}()
+
+	td, err := ioutil.TempDir("", "kopia-rclone")
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to create temporary directory")
+	}
+
+	r.temporaryDir = td
+
+	password, err := randomHex(16)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to generate password")
+	}
+
+	htpasswdFile := filepath.Join(td, "htpasswd")
+	if err = writeHTPasswd(htpasswdFile, rcloneUsername, password); err != nil {
+		return nil, err
+	}
+
+	args := append([]string{
+		"serve", "webdav", opt.RemotePath,
+		"--addr", "127.0.0.1:0", // allocate random port
+		"--htpasswd", htpasswdFile,
+	}, opt.RCloneArgs...)
+
+	r.cmd = exec.Command(opt.rcloneExe(), args...) //nolint:gosec
+	r.cmd.Env = append(os.Environ(), opt.RCloneEnv...)
+
+	stderr, err := r.cmd.StderrPipe()
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to get stderr pipe")
+	}
+
+	if err = r.cmd.Start(); err != nil {
+		return nil, errors.Wrap(err, "unable to start rclone")
+	}
+
+	go func() {
+		r.cmd.Wait() //nolint:errcheck
+		close(r.exited)
+	}()
+
+	u, err := r.waitForStartup(stderr)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Debugf("rclone started serving %v on %v", opt.RemotePath, u)
+
+	r.Storage, err = webdav.New(ctx, &webdav.Options{
+		URL:             u,
+		DirectoryShards: opt.DirectoryShards,
+		Username:        rcloneUsername,
+		Password:        password,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to create WebDAV storage")
+	}
+
+	success = true
+
+	return r, nil
+}
+
+func init() {
+	blob.AddSupportedStorage(
+		rcloneStorageType,
+		func() interface{} {
+			return &Options{}
+		},
+		func(ctx context.Context, o interface{}) (blob.Storage, error) {
+			return New(ctx, o.(*Options))
+		})
+}
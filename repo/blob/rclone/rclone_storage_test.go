@@ -0,0 +1,192 @@
+package rclone
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/net/webdav"
+
+	"github.com/kopia/kopia/internal/blobtesting"
+	"github.com/kopia/kopia/repo/blob"
+)
+
+// fakeRCloneEnv is set when the test binary is launched as a fake rclone subprocess.
+const fakeRCloneEnv = "KOPIA_TEST_FAKE_RCLONE"
+
+func TestMain(m *testing.M) {
+	switch os.Getenv(fakeRCloneEnv) {
+	case "":
+	case "fail":
+		fmt.Fprintf(os.Stderr, "simulated failure\n")
+		os.Exit(1)
+	default:
+		runFakeRClone(os.Args[1:])
+		return
+	}
+
+	os.Exit(m.Run())
+}
+
+// runFakeRClone emulates 'rclone serve webdav <path> --addr <addr> --htpasswd <file>' for local paths.
+func runFakeRClone(args []string) {
+	if len(args) < 3 || args[0] != "serve" || args[1] != "webdav" {
+		fmt.Fprintf(os.Stderr, "unsupported arguments: %v\n", args)
+		os.Exit(1)
+	}
+
+	dir := args[2]
+
+	var addr, htpasswd string
+
+	for i := 3; i+1 < len(args); i += 2 {
+		switch args[i] {
+		case "--addr":
+			addr = args[i+1]
+		case "--htpasswd":
+			htpasswd = args[i+1]
+		}
+	}
+
+	creds, err := ioutil.ReadFile(htpasswd) //nolint:gosec
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to read htpasswd: %v\n", err)
+		os.Exit(1)
+	}
+
+	parts := strings.SplitN(strings.TrimSpace(string(creds)), ":", 2)
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to listen: %v\n", err)
+		os.Exit(1)
+	}
+
+	handler := &webdav.Handler{
+		FileSystem: webdav.Dir(dir),
+		LockSystem: webdav.NewMemLS(),
+	}
+
+	fmt.Fprintf(os.Stderr, "2019/12/01 10:00:00 NOTICE: Local file system at %v: WebDav Server started on http://%v/\n", dir, l.Addr())
+
+	_ = http.Serve(l, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		if !ok || user != parts[0] || bcrypt.CompareHashAndPassword([]byte(parts[1]), []byte(pass)) != nil {
+			w.Header().Set("WWW-Authenticate", `Basic realm="rclone"`)
+			http.Error(w, "not authorized", http.StatusUnauthorized)
+
+			return
+		}
+
+		handler.ServeHTTP(w, r)
+	}))
+}
+
+func fakeRCloneOptions(t *testing.T, dir string) *Options {
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatalf("unable to determine test executable: %v", err)
+	}
+
+	return &Options{
+		RemotePath: dir,
+		RCloneExe:  exe,
+		RCloneEnv:  []string{fakeRCloneEnv + "=1"},
+	}
+}
+
+func TestRCloneStorageFake(t *testing.T) {
+	ctx := context.Background()
+
+	dir, err := ioutil.TempDir("", "rclone-test")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	st, err := New(ctx, fakeRCloneOptions(t, dir))
+	if err != nil {
+		t.Fatalf("unable to connect to rclone: %v", err)
+	}
+
+	rst := st.(*rcloneStorage)
+	td := rst.temporaryDir
+	exited := rst.exited
+
+	blobtesting.VerifyStorage(ctx, t, st)
+	blobtesting.AssertConnectionInfoRoundTrips(ctx, t, st)
+
+	if err := st.Close(ctx); err != nil {
+		t.Fatalf("unable to close: %v", err)
+	}
+
+	select {
+	case <-exited:
+	default:
+		t.Errorf("rclone process still running after Close()")
+	}
+
+	if _, err := os.Stat(td); !os.IsNotExist(err) {
+		t.Errorf("temporary directory was not removed: %v", err)
+	}
+}
+
+func TestRCloneStorageStartupFailure(t *testing.T) {
+	ctx := context.Background()
+
+	opt := fakeRCloneOptions(t, "/some/dir")
+	opt.RCloneEnv = []string{fakeRCloneEnv + "=fail"}
+
+	if _, err := New(ctx, opt); err == nil {
+		t.Fatalf("unexpected success")
+	}
+
+	opt.RCloneExe = "no-such-rclone-executable"
+	if _, err := New(ctx, opt); err == nil {
+		t.Fatalf("unexpected success")
+	}
+}
+
+func TestRCloneStorageRealRClone(t *testing.T) {
+	exe := os.Getenv("KOPIA_RCLONE_EXE")
+	if exe == "" {
+		var err error
+
+		if exe, err = exec.LookPath(defaultRCloneExe); err != nil {
+			t.Skip("rclone not installed")
+		}
+	}
+
+	ctx := context.Background()
+
+	dir, err := ioutil.TempDir("", "rclone-test")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	st, err := New(ctx, &Options{
+		RemotePath: dir,
+		RCloneExe:  exe,
+	})
+	if err != nil {
+		t.Fatalf("unable to connect to rclone: %v", err)
+	}
+
+	defer st.Close(ctx) //nolint:errcheck
+
+	if err := st.ListBlobs(ctx, "", func(bm blob.Metadata) error {
+		return st.DeleteBlob(ctx, bm.BlobID)
+	}); err != nil {
+		t.Fatalf("unable to clear rclone storage: %v", err)
+	}
+
+	blobtesting.VerifyStorage(ctx, t, st)
+}
@@ -0,0 +1,46 @@
+// Package readonly implements wrapper around Storage that prevents all modifications.
+package readonly
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo/blob"
+)
+
+// ErrReadonly is returned when an attempt is made to modify read-only storage.
+var ErrReadonly = errors.New("storage is read-only")
+
+type readonlyStorage struct {
+	base blob.Storage
+}
+
+func (s *readonlyStorage) GetBlob(ctx context.Context, id blob.ID, offset, length int64) ([]byte, error) {
+	return s.base.GetBlob(ctx, id, offset, length)
+}
+
+func (s *readonlyStorage) PutBlob(ctx context.Context, id blob.ID, data []byte) error {
+	return ErrReadonly
+}
+
+func (s *readonlyStorage) DeleteBlob(ctx context.Context, id blob.ID) error {
+	return ErrReadonly
+}
+
+func (s *readonlyStorage) ListBlobs(ctx context.Context, prefix blob.ID, callback func(blob.Metadata) error) error {
+	return s.base.ListBlobs(ctx, prefix, callback)
+}
+
+func (s *readonlyStorage) Close(ctx context.Context) error {
+	return s.base.Close(ctx)
+}
+
+func (s *readonlyStorage) ConnectionInfo() blob.ConnectionInfo {
+	return s.base.ConnectionInfo()
+}
+
+// NewWrapper returns a Storage wrapper that rejects all attempts to write or delete blobs.
+func NewWrapper(wrapped blob.Storage) blob.Storage {
+	return &readonlyStorage{base: wrapped}
+}
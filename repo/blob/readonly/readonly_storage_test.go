@@ -0,0 +1,47 @@
+package readonly
+
+import (
+	"context"
+	"testing"
+
+	"github.com/kopia/kopia/internal/blobtesting"
+)
+
+func TestReadonlyStorage(t *testing.T) {
+	ctx := context.Background()
+
+	data := blobtesting.DataMap{}
+	underlying := blobtesting.NewMapStorage(data, nil, nil)
+
+	if err := underlying.PutBlob(ctx, "existing", []byte{1, 2, 3, 4}); err != nil {
+		t.Fatalf("unable to put blob: %v", err)
+	}
+
+	st := NewWrapper(underlying)
+
+	blobtesting.AssertGetBlob(ctx, t, st, "existing", []byte{1, 2, 3, 4})
+	blobtesting.AssertListResults(ctx, t, st, "", "existing")
+
+	if got, want := st.PutBlob(ctx, "new", []byte{5, 6, 7, 8}), ErrReadonly; got != want {
+		t.Errorf("unexpected PutBlob() error: %v, want %v", got, want)
+	}
+
+	if got, want := st.PutBlob(ctx, "existing", []byte{5, 6, 7, 8}), ErrReadonly; got != want {
+		t.Errorf("unexpected PutBlob() error: %v, want %v", got, want)
+	}
+
+	if got, want := st.DeleteBlob(ctx, "existing"), ErrReadonly; got != want {
+		t.Errorf("unexpected DeleteBlob() error: %v, want %v", got, want)
+	}
+
+	blobtesting.AssertGetBlob(ctx, t, underlying, "existing", []byte{1, 2, 3, 4})
+	blobtesting.AssertGetBlobNotFound(ctx, t, underlying, "new")
+
+	if got, want := st.ConnectionInfo().Type, underlying.ConnectionInfo().Type; got != want {
+		t.Errorf("unexpected connection info %v, want %v", got, want)
+	}
+
+	if err := st.Close(ctx); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+}
@@ -0,0 +1,18 @@
+package routing
+
+import "github.com/kopia/kopia/repo/blob"
+
+// Route directs blobs whose IDs start with the given prefix to a particular storage.
+type Route struct {
+	Prefix  blob.ID             `json:"prefix"`
+	Storage blob.ConnectionInfo `json:"storage"`
+}
+
+// Options defines options for routing storage.
+type Options struct {
+	// Routes is the list of prefix-based routes, the longest matching prefix wins.
+	Routes []Route `json:"routes"`
+
+	// Default is the storage used for blobs that don't match any route.
+	Default blob.ConnectionInfo `json:"default"`
+}
@@ -0,0 +1,168 @@
+// Package routing implements Storage that dispatches blobs to different underlying storages based on blob ID prefix.
+package routing
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo/blob"
+)
+
+const routingStorageType = "routing"
+
+type routingStorage struct {
+	Options
+
+	// storages[i] holds blobs routed by Routes[i], the last element is the default storage.
+	storages []blob.Storage
+}
+
+// storageIndexFor returns the index of the storage that holds the blob with the given ID.
+func (s *routingStorage) storageIndexFor(id blob.ID) int {
+	result := len(s.Routes)
+	longest := -1
+
+	for i, r := range s.Routes {
+		if strings.HasPrefix(string(id), string(r.Prefix)) && len(r.Prefix) > longest {
+			result = i
+			longest = len(r.Prefix)
+		}
+	}
+
+	return result
+}
+
+func (s *routingStorage) storageFor(id blob.ID) blob.Storage {
+	return s.storages[s.storageIndexFor(id)]
+}
+
+func (s *routingStorage) GetBlob(ctx context.Context, id blob.ID, offset, length int64) ([]byte, error) {
+	return s.storageFor(id).GetBlob(ctx, id, offset, length)
+}
+
+func (s *routingStorage) PutBlob(ctx context.Context, id blob.ID, data []byte) error {
+	return s.storageFor(id).PutBlob(ctx, id, data)
+}
+
+func (s *routingStorage) DeleteBlob(ctx context.Context, id blob.ID) error {
+	return s.storageFor(id).DeleteBlob(ctx, id)
+}
+
+// ListBlobs lists all storages that may contain blobs with the given prefix, only reporting
+// blobs that are stored where they would be routed to.
+func (s *routingStorage) ListBlobs(ctx context.Context, prefix blob.ID, callback func(blob.Metadata) error) error {
+	for i, st := range s.storages {
+		if i < len(s.Routes) && !prefixesOverlap(prefix, s.Routes[i].Prefix) {
+			continue
+		}
+
+		i := i
+
+		if err := st.ListBlobs(ctx, prefix, func(bm blob.Metadata) error {
+			if s.storageIndexFor(bm.BlobID) != i {
+				return nil
+			}
+
+			return callback(bm)
+		}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// prefixesOverlap returns true if there may exist blob IDs that start with both prefixes.
+func prefixesOverlap(p1, p2 blob.ID) bool {
+	return strings.HasPrefix(string(p1), string(p2)) || strings.HasPrefix(string(p2), string(p1))
+}
+
+func (s *routingStorage) ConnectionInfo() blob.ConnectionInfo {
+	return blob.ConnectionInfo{
+		Type:   routingStorageType,
+		Config: &s.Options,
+	}
+}
+
+func (s *routingStorage) Close(ctx context.Context) error {
+	var firstErr error
+
+	for _, st := range s.storages {
+		if err := st.Close(ctx); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
+
+func (s *routingStorage) String() string {
+	var parts []string
+
+	for i, r := range s.Routes {
+		parts = append(parts, fmt.Sprintf("%q:%v", r.Prefix, s.storages[i]))
+	}
+
+	parts = append(parts, fmt.Sprintf("default:%v", s.storages[len(s.Routes)]))
+
+	return "routing(" + strings.Join(parts, ",") + ")"
+}
+
+// New creates new routing storage with specified options:
+//
+// - the 'Default' field is required and all routes must have unique prefixes.
+func New(ctx context.Context, opt *Options) (blob.Storage, error) {
+	if opt.Default.Type == "" {
+		return nil, errors.New("default storage must be specified")
+	}
+
+	seen := map[blob.ID]bool{}
+
+	for _, r := range opt.Routes {
+		if seen[r.Prefix] {
+			return nil, errors.Errorf("duplicate route for prefix %q", r.Prefix)
+		}
+
+		seen[r.Prefix] = true
+	}
+
+	s := &routingStorage{
+		Options: *opt,
+	}
+
+	for _, ci := range append(routeStorages(opt.Routes), opt.Default) {
+		st, err := blob.NewStorage(ctx, ci)
+		if err != nil {
+			s.Close(ctx) //nolint:errcheck
+			return nil, errors.Wrapf(err, "unable to open %v storage", ci.Type)
+		}
+
+		s.storages = append(s.storages, st)
+	}
+
+	return s, nil
+}
+
+func routeStorages(routes []Route) []blob.ConnectionInfo {
+	var result []blob.ConnectionInfo
+
+	for _, r := range routes {
+		result = append(result, r.Storage)
+	}
+
+	return result
+}
+
+func init() {
+	blob.AddSupportedStorage(
+		routingStorageType,
+		func() interface{} {
+			return &Options{}
+		},
+		func(ctx context.Context, o interface{}) (blob.Storage, error) {
+			return New(ctx, o.(*Options))
+		})
+}
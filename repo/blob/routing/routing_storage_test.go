@@ -0,0 +1,121 @@
+package routing
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/kopia/kopia/internal/blobtesting"
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/blob/filesystem"
+)
+
+func newFilesystemConnectionInfo(t *testing.T) blob.ConnectionInfo {
+	dir, err := ioutil.TempDir("", "routing-test")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+
+	return blob.ConnectionInfo{
+		Type:   "filesystem",
+		Config: &filesystem.Options{Path: dir},
+	}
+}
+
+func TestRoutingStorage(t *testing.T) {
+	ctx := context.Background()
+
+	opt := &Options{
+		Routes: []Route{
+			{Prefix: "a", Storage: newFilesystemConnectionInfo(t)},
+			{Prefix: "ab", Storage: newFilesystemConnectionInfo(t)},
+		},
+		Default: newFilesystemConnectionInfo(t),
+	}
+
+	defer func() {
+		for _, r := range opt.Routes {
+			os.RemoveAll(r.Storage.Config.(*filesystem.Options).Path)
+		}
+
+		os.RemoveAll(opt.Default.Config.(*filesystem.Options).Path)
+	}()
+
+	st, err := New(ctx, opt)
+	if err != nil {
+		t.Fatalf("unable to create routing storage: %v", err)
+	}
+
+	blobtesting.VerifyStorage(ctx, t, st)
+	blobtesting.AssertConnectionInfoRoundTrips(ctx, t, st)
+
+	if err := st.Close(ctx); err != nil {
+		t.Fatalf("unable to close: %v", err)
+	}
+
+	if _, err := New(ctx, &Options{Routes: opt.Routes}); err == nil {
+		t.Errorf("unexpected success without default storage")
+	}
+
+	if _, err := New(ctx, &Options{Routes: append(opt.Routes, opt.Routes[0]), Default: opt.Default}); err == nil {
+		t.Errorf("unexpected success with duplicate routes")
+	}
+}
+
+func TestRoutingStoragePlacement(t *testing.T) {
+	ctx := context.Background()
+
+	dataN, dataNX, dataDefault := blobtesting.DataMap{}, blobtesting.DataMap{}, blobtesting.DataMap{}
+
+	st := &routingStorage{
+		Options: Options{
+			Routes: []Route{{Prefix: "n"}, {Prefix: "nx"}},
+		},
+		storages: []blob.Storage{
+			blobtesting.NewMapStorage(dataN, nil, nil),
+			blobtesting.NewMapStorage(dataNX, nil, nil),
+			blobtesting.NewMapStorage(dataDefault, nil, nil),
+		},
+	}
+
+	for _, id := range []blob.ID{"n1", "nx1", "nxy", "p1", "kopia.repository"} {
+		if err := st.PutBlob(ctx, id, []byte{1, 2, 3, 4}); err != nil {
+			t.Fatalf("unable to put %v: %v", id, err)
+		}
+	}
+
+	verifyKeys(t, dataN, "n1")
+	verifyKeys(t, dataNX, "nx1", "nxy")
+	verifyKeys(t, dataDefault, "p1", "kopia.repository")
+
+	// blob stored in the wrong place is not visible.
+	dataDefault["n2"] = []byte{1}
+
+	blobtesting.AssertListResults(ctx, t, st, "", "kopia.repository", "n1", "nx1", "nxy", "p1")
+	blobtesting.AssertListResults(ctx, t, st, "n", "n1", "nx1", "nxy")
+	blobtesting.AssertListResults(ctx, t, st, "nx", "nx1", "nxy")
+	blobtesting.AssertListResults(ctx, t, st, "p", "p1")
+	blobtesting.AssertGetBlob(ctx, t, st, "nxy", []byte{1, 2, 3, 4})
+	blobtesting.AssertGetBlobNotFound(ctx, t, st, "n2")
+
+	if err := st.DeleteBlob(ctx, "nxy"); err != nil {
+		t.Fatalf("unable to delete: %v", err)
+	}
+
+	verifyKeys(t, dataNX, "nx1")
+}
+
+func verifyKeys(t *testing.T, data blobtesting.DataMap, want ...blob.ID) {
+	t.Helper()
+
+	if len(data) != len(want) {
+		t.Errorf("unexpected number of blobs %v, want %v", len(data), len(want))
+	}
+
+	for _, id := range want {
+		if data[id] == nil {
+			t.Errorf("blob %v not found", id)
+		}
+	}
+}
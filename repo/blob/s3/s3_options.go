@@ -1,5 +1,7 @@
 package s3
 
+import "time"
+
 // Options defines options for S3-based storage.
 type Options struct {
 	// BucketName is the name of the bucket where data is stored.
@@ -20,4 +22,11 @@ type Options struct {
 	MaxUploadSpeedBytesPerSecond int `json:"maxUploadSpeedBytesPerSecond,omitempty"`
 
 	MaxDownloadSpeedBytesPerSecond int `json:"maxDownloadSpeedBytesPerSecond,omitempty"`
+
+	// RetentionMode is an optional S3 Object Lock mode ("GOVERNANCE" or "COMPLIANCE") applied to all written blobs.
+	// The bucket must have been created with Object Lock enabled.
+	RetentionMode string `json:"retentionMode,omitempty"`
+
+	// RetentionPeriod is the amount of time written blobs remain locked, required if RetentionMode is set.
+	RetentionPeriod time.Duration `json:"retentionPeriod,omitempty"`
 }
@@ -4,10 +4,14 @@ package s3
 import (
 	"bytes"
 	"context"
+	"crypto/md5" //nolint:gosec
+	"encoding/base64"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/efarrer/iothrottler"
 	minio "github.com/minio/minio-go/v6"
@@ -19,6 +23,8 @@ import (
 
 const (
 	s3storageType = "s3"
+
+	kopiaContentType = "application/x-kopia"
 )
 
 type s3Storage struct {
@@ -54,7 +60,10 @@ func (s *s3Storage) GetBlob(ctx context.Context, b blob.ID, offset, length int64
 			return nil, err
 		}
 
-		b, err := ioutil.ReadAll(throttled)
+		r, done := blob.ThrottleDownload(ctx, throttled)
+		defer done()
+
+		b, err := ioutil.ReadAll(r)
 		if err != nil {
 			return nil, err
 		}
@@ -100,40 +109,124 @@ func translateError(err error) error {
 		if me.StatusCode == http.StatusNotFound {
 			return blob.ErrBlobNotFound
 		}
+
+		if isObjectLockedError(me) {
+			return blob.ErrBlobLocked
+		}
 	}
 
 	return err
 }
 
-func (s *s3Storage) PutBlob(ctx context.Context, b blob.ID, data []byte) error {
-	throttled, err := s.uploadThrottler.AddReader(ioutil.NopCloser(bytes.NewReader(data)))
-	if err != nil {
-		return err
+// isObjectLockedError returns true if the error indicates that the operation was rejected because of object lock.
+func isObjectLockedError(me minio.ErrorResponse) bool {
+	if me.Code == "ObjectLocked" {
+		return true
 	}
 
+	return me.StatusCode == http.StatusForbidden && strings.Contains(strings.ToLower(me.Message), "object lock")
+}
+
+func (s *s3Storage) PutBlob(ctx context.Context, b blob.ID, data []byte) error {
 	progressCallback := blob.ProgressCallback(ctx)
 	if progressCallback != nil {
 		progressCallback(string(b), 0, int64(len(data)))
 		defer progressCallback(string(b), int64(len(data)), int64(len(data)))
 	}
 
-	n, err := s.cli.PutObject(s.BucketName, s.getObjectNameString(b), throttled, -1, minio.PutObjectOptions{
-		ContentType: "application/x-kopia",
+	if s.RetentionMode != "" {
+		body := blob.NewUploadBody(ctx, data, s.throttleUpload, func(r io.Reader) (io.Reader, func()) {
+			if pr := newProgressReader(progressCallback, string(b), int64(len(data))); pr != nil {
+				return io.TeeReader(r, pr.(io.Writer)), func() {}
+			}
+
+			return r, func() {}
+		})
+		defer body.Close() //nolint:errcheck
+
+		return s.putBlobWithRetention(ctx, b, body, data)
+	}
+
+	body := blob.NewUploadBody(ctx, data, s.throttleUpload)
+	defer body.Close() //nolint:errcheck
+
+	// passing the length makes the client stream the body in a single request instead of buffering it first.
+	n, err := s.cli.PutObject(s.BucketName, s.getObjectNameString(b), body, int64(len(data)), minio.PutObjectOptions{
+		ContentType: kopiaContentType,
 		Progress:    newProgressReader(progressCallback, string(b), int64(len(data))),
 	})
 
 	if err == io.EOF && n == 0 {
 		// special case empty stream
 		_, err = s.cli.PutObject(s.BucketName, s.getObjectNameString(b), bytes.NewBuffer(nil), 0, minio.PutObjectOptions{
-			ContentType: "application/x-kopia",
+			ContentType: kopiaContentType,
+		})
+	}
+
+	return translateError(err)
+}
+
+// throttleUpload passes uploaded data through the upload throttler configured for the storage.
+func (s *s3Storage) throttleUpload(r io.Reader) (io.Reader, func()) {
+	throttled, err := s.uploadThrottler.AddReader(ioutil.NopCloser(r))
+	if err != nil {
+		return r, func() {}
+	}
+
+	return throttled, func() {
+		throttled.Close() //nolint:errcheck
+	}
+}
+
+// putBlobWithRetention uploads the blob in a single request with object lock headers.
+// S3 requires Content-MD5 on all writes to buckets with object lock enabled, which is why
+// the upload can't go through the regular (possibly multipart) code path.
+func (s *s3Storage) putBlobWithRetention(ctx context.Context, b blob.ID, r io.Reader, data []byte) error {
+	h := md5.Sum(data) //nolint:gosec
+
+	_, err := minio.Core{Client: s.cli}.PutObjectWithContext(ctx, s.BucketName, s.getObjectNameString(b), r, int64(len(data)),
+		base64.StdEncoding.EncodeToString(h[:]), "", map[string]string{
+			"Content-Type":                        kopiaContentType,
+			"X-Amz-Object-Lock-Mode":              s.RetentionMode,
+			"X-Amz-Object-Lock-Retain-Until-Date": s.retainUntil().Format(time.RFC3339),
+		}, nil)
+
+	return translateError(err)
+}
+
+// retainUntil returns the time until which blobs written or extended now should be retained.
+func (s *s3Storage) retainUntil() time.Time {
+	return time.Now().Add(s.RetentionPeriod).UTC()
+}
+
+// ExtendRetention extends the retention period of the provided blob to 'RetentionPeriod' from now.
+func (s *s3Storage) ExtendRetention(ctx context.Context, b blob.ID) error {
+	if s.RetentionMode == "" {
+		return errors.New("retention is not configured for this storage")
+	}
+
+	mode := minio.RetentionMode(s.RetentionMode)
+
+	attempt := func() (interface{}, error) {
+		until := s.retainUntil()
+
+		return nil, s.cli.PutObjectRetention(s.BucketName, s.getObjectNameString(b), minio.PutObjectRetentionOptions{
+			Mode:            &mode,
+			RetainUntilDate: &until,
 		})
 	}
 
+	_, err := exponentialBackoff(fmt.Sprintf("ExtendRetention(%q)", b), attempt)
+
 	return translateError(err)
 }
 
 func (s *s3Storage) DeleteBlob(ctx context.Context, b blob.ID) error {
 	attempt := func() (interface{}, error) {
+		if s.RetentionMode != "" {
+			return nil, s.deleteAllVersions(b)
+		}
+
 		return nil, s.cli.RemoveObject(s.BucketName, s.getObjectNameString(b))
 	}
 
@@ -142,6 +235,38 @@ func (s *s3Storage) DeleteBlob(ctx context.Context, b blob.ID) error {
 	return translateError(err)
 }
 
+// deleteAllVersions permanently deletes all versions of the blob.
+// Object lock requires a versioned bucket, where deleting an object without version ID only adds a delete marker,
+// which always succeeds and leaves locked data in place, and deleting only the current version makes the previous
+// one current again. Deleting a specific version is rejected while it is locked.
+func (s *s3Storage) deleteAllVersions(b blob.ID) error {
+	deleted := map[string]bool{}
+
+	for {
+		oi, err := s.cli.StatObject(s.BucketName, s.getObjectNameString(b), minio.StatObjectOptions{})
+		if err != nil {
+			if me, ok := err.(minio.ErrorResponse); ok && me.StatusCode == http.StatusNotFound {
+				return nil
+			}
+
+			return err
+		}
+
+		versionID := oi.Metadata.Get("X-Amz-Version-Id")
+		if deleted[versionID] {
+			return errors.Errorf("version %q of %v was not deleted", versionID, b)
+		}
+
+		if err := s.cli.RemoveObjectWithOptions(s.BucketName, s.getObjectNameString(b), minio.RemoveObjectOptions{
+			VersionID: versionID,
+		}); err != nil {
+			return err
+		}
+
+		deleted[versionID] = true
+	}
+}
+
 func (s *s3Storage) getObjectNameString(b blob.ID) string {
 	return s.Prefix + string(b)
 }
@@ -200,6 +325,11 @@ func (r *progressReader) Read(b []byte) (int, error) {
 	return len(b), nil
 }
 
+// Write allows progressReader to observe data passed through io.TeeReader.
+func (r *progressReader) Write(b []byte) (int, error) {
+	return r.Read(b)
+}
+
 func newProgressReader(cb blob.ProgressFunc, blobID string, totalLength int64) io.Reader {
 	if cb == nil {
 		return nil
@@ -219,11 +349,23 @@ func toBandwidth(bytesPerSecond int) iothrottler.Bandwidth {
 // New creates new S3-backed storage with specified options:
 //
 // - the 'BucketName' field is required and all other parameters are optional.
+//
+// - when 'RetentionMode' is set, 'RetentionPeriod' must be positive.
 func New(ctx context.Context, opt *Options) (blob.Storage, error) {
 	if opt.BucketName == "" {
 		return nil, errors.New("bucket name must be specified")
 	}
 
+	if opt.RetentionMode != "" {
+		if !minio.RetentionMode(opt.RetentionMode).IsValid() {
+			return nil, errors.Errorf("invalid retention mode %q, must be %v or %v", opt.RetentionMode, minio.Governance, minio.Compliance)
+		}
+
+		if opt.RetentionPeriod <= 0 {
+			return nil, errors.New("retention period must be specified when retention mode is set")
+		}
+	}
+
 	cli, err := minio.NewWithRegion(opt.Endpoint, opt.AccessKeyID, opt.SecretAccessKey, !opt.DoNotUseTLS, opt.Region)
 	if err != nil {
 		return nil, errors.Wrap(err, "unable to create client")
@@ -5,13 +5,19 @@ import (
 	"crypto/rand"
 	"crypto/sha1"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"net"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	minio "github.com/minio/minio-go/v6"
+	"github.com/pkg/errors"
 
 	"github.com/kopia/kopia/internal/blobtesting"
 	"github.com/kopia/kopia/repo/blob"
@@ -118,3 +124,266 @@ func cleanupOldData(ctx context.Context, t *testing.T) {
 		return nil
 	})
 }
+
+// fakeObjectLockServer emulates a minimal subset of S3 API for a versioned bucket with object lock enabled.
+type fakeObjectLockServer struct {
+	mu sync.Mutex
+
+	nextVersion int
+	versions    map[string][]string // versions of each object, the last one is current
+	lockedUntil map[string]time.Time
+	headers     map[string]http.Header
+	retention   map[string]string
+}
+
+func (s *fakeObjectLockServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := r.URL.Path
+	versionID := r.URL.Query().Get("versionId")
+
+	_, isRetention := r.URL.Query()["retention"]
+
+	switch {
+	case r.Method == http.MethodPut && isRetention:
+		body, _ := ioutil.ReadAll(r.Body)
+		s.retention[key] = string(body)
+
+	case r.Method == http.MethodPut:
+		if r.Header.Get("Content-Md5") == "" {
+			http.Error(w, "missing Content-MD5", http.StatusBadRequest)
+			return
+		}
+
+		until, err := time.Parse(time.RFC3339, r.Header.Get("X-Amz-Object-Lock-Retain-Until-Date"))
+		if err != nil {
+			http.Error(w, "invalid retain until date", http.StatusBadRequest)
+			return
+		}
+
+		s.nextVersion++
+		v := fmt.Sprintf("v%v", s.nextVersion)
+
+		s.headers[key] = r.Header
+		s.versions[key] = append(s.versions[key], v)
+		s.lockedUntil[v] = until
+
+		w.Header().Set("X-Amz-Version-Id", v)
+
+	case r.Method == http.MethodHead:
+		vs := s.versions[key]
+		if len(vs) == 0 {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+		w.Header().Set("X-Amz-Version-Id", vs[len(vs)-1])
+
+	case r.Method == http.MethodDelete && versionID == "":
+		// deleting without version ID only adds a delete marker.
+		delete(s.versions, key)
+		w.WriteHeader(http.StatusNoContent)
+
+	case r.Method == http.MethodDelete:
+		if time.Now().Before(s.lockedUntil[versionID]) {
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<Error><Code>AccessDenied</Code><Message>Access Denied because object protected by object lock.</Message></Error>`)
+
+			return
+		}
+
+		var remaining []string
+
+		for _, v := range s.versions[key] {
+			if v != versionID {
+				remaining = append(remaining, v)
+			}
+		}
+
+		s.versions[key] = remaining
+
+		delete(s.lockedUntil, versionID)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "not implemented", http.StatusNotImplemented)
+	}
+}
+
+func TestS3StorageRetention(t *testing.T) {
+	ctx := context.Background()
+
+	fs := &fakeObjectLockServer{
+		versions:    map[string][]string{},
+		lockedUntil: map[string]time.Time{},
+		headers:     map[string]http.Header{},
+		retention:   map[string]string{},
+	}
+
+	server := httptest.NewServer(fs)
+	defer server.Close()
+
+	opt := &Options{
+		Endpoint:        strings.TrimPrefix(server.URL, "http://"),
+		DoNotUseTLS:     true,
+		AccessKeyID:     "key",
+		SecretAccessKey: "secret",
+		Region:          "us-east-1",
+		BucketName:      "bucket",
+		Prefix:          "p/",
+		RetentionMode:   "COMPLIANCE",
+		RetentionPeriod: time.Hour,
+	}
+
+	st, err := New(ctx, opt)
+	if err != nil {
+		t.Fatalf("unable to create storage: %v", err)
+	}
+
+	if err := st.PutBlob(ctx, "blob1", []byte{1, 2, 3, 4}); err != nil {
+		t.Fatalf("unable to put blob: %v", err)
+	}
+
+	h := fs.headers["/bucket/p/blob1"]
+	if h == nil {
+		t.Fatalf("blob was not written")
+	}
+
+	if got, want := h.Get("X-Amz-Object-Lock-Mode"), "COMPLIANCE"; got != want {
+		t.Errorf("invalid lock mode: %q, want %q", got, want)
+	}
+
+	if got, want := h.Get("Content-Type"), kopiaContentType; got != want {
+		t.Errorf("invalid content type: %q, want %q", got, want)
+	}
+
+	if err := st.DeleteBlob(ctx, "blob1"); err != blob.ErrBlobLocked {
+		t.Errorf("unexpected error when deleting locked blob: %v, want %v", err, blob.ErrBlobLocked)
+	}
+
+	if len(fs.versions["/bucket/p/blob1"]) == 0 {
+		t.Errorf("locked blob was deleted")
+	}
+
+	var intermediateProgressCalls int
+
+	pctx := blob.WithUploadProgressCallback(ctx, func(desc string, completed, total int64) {
+		if completed > 0 && completed < total {
+			intermediateProgressCalls++
+		}
+	})
+
+	if err := st.PutBlob(pctx, "blob2", make([]byte, 3000000)); err != nil {
+		t.Fatalf("unable to put blob: %v", err)
+	}
+
+	if intermediateProgressCalls == 0 {
+		t.Errorf("upload progress was not reported")
+	}
+
+	// blob overwritten with another version.
+	if err := st.PutBlob(ctx, "blob2", []byte{5, 6, 7}); err != nil {
+		t.Fatalf("unable to put blob: %v", err)
+	}
+
+	for _, v := range fs.versions["/bucket/p/blob2"] {
+		fs.lockedUntil[v] = time.Now().Add(-time.Hour)
+	}
+
+	if err := st.DeleteBlob(ctx, "blob2"); err != nil {
+		t.Errorf("unable to delete blob with expired lock: %v", err)
+	}
+
+	if len(fs.lockedUntil) != 1 || len(fs.versions["/bucket/p/blob2"]) != 0 {
+		t.Errorf("blob versions with expired lock were not deleted: %v", fs.versions)
+	}
+
+	if err := st.(*s3Storage).ExtendRetention(ctx, "blob1"); err != nil {
+		t.Fatalf("unable to extend retention: %v", err)
+	}
+
+	if r := fs.retention["/bucket/p/blob1"]; !strings.Contains(r, "COMPLIANCE") {
+		t.Errorf("invalid retention request: %v", r)
+	}
+}
+
+func TestS3StorageRetentionOptions(t *testing.T) {
+	ctx := context.Background()
+
+	cases := []*Options{
+		{BucketName: "bucket", RetentionMode: "SOMETHING", RetentionPeriod: time.Hour},
+		{BucketName: "bucket", RetentionMode: "GOVERNANCE"},
+	}
+
+	for _, opt := range cases {
+		if _, err := New(ctx, opt); err == nil {
+			t.Errorf("unexpected success for %+v", opt)
+		}
+	}
+}
+
+func TestS3StorageObjectLockMinio(t *testing.T) {
+	endpoint := os.Getenv("KOPIA_S3_OBJECT_LOCK_TEST_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("KOPIA_S3_OBJECT_LOCK_TEST_ENDPOINT not provided")
+	}
+
+	ctx := context.Background()
+
+	opt := &Options{
+		Endpoint:        endpoint,
+		DoNotUseTLS:     os.Getenv("KOPIA_S3_OBJECT_LOCK_TEST_USE_TLS") == "",
+		AccessKeyID:     os.Getenv("KOPIA_S3_OBJECT_LOCK_TEST_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("KOPIA_S3_OBJECT_LOCK_TEST_SECRET_ACCESS_KEY"),
+		BucketName:      fmt.Sprintf("kopia-lock-test-%v", time.Now().UnixNano()),
+		RetentionMode:   "COMPLIANCE",
+		RetentionPeriod: 3 * time.Second,
+	}
+
+	cli, err := minio.New(opt.Endpoint, opt.AccessKeyID, opt.SecretAccessKey, !opt.DoNotUseTLS)
+	if err != nil {
+		t.Fatalf("can't initialize minio client: %v", err)
+	}
+
+	if err = cli.MakeBucketWithObjectLock(opt.BucketName, ""); err != nil {
+		t.Fatalf("unable to create bucket with object lock: %v", err)
+	}
+
+	defer cli.RemoveBucket(opt.BucketName) //nolint:errcheck
+
+	st, err := New(ctx, opt)
+	if err != nil {
+		t.Fatalf("unable to create storage: %v", err)
+	}
+
+	// overwriting a blob in a versioned bucket keeps the previous version.
+	for _, b := range [][]byte{{1, 2, 3}, {4, 5, 6}} {
+		if err = st.PutBlob(ctx, "blob1", b); err != nil {
+			t.Fatalf("unable to put blob: %v", err)
+		}
+	}
+
+	if err = st.DeleteBlob(ctx, "blob1"); err != blob.ErrBlobLocked {
+		t.Errorf("unexpected error when deleting locked blob: %v, want %v", err, blob.ErrBlobLocked)
+	}
+
+	time.Sleep(opt.RetentionPeriod + time.Second)
+
+	if err = st.DeleteBlob(ctx, "blob1"); err != nil {
+		t.Fatalf("unable to delete blob with expired lock: %v", err)
+	}
+
+	// no previous version reappears.
+	if _, err = st.GetBlob(ctx, "blob1", 0, -1); err != blob.ErrBlobNotFound {
+		t.Errorf("unexpected error reading deleted blob: %v, want %v", err, blob.ErrBlobNotFound)
+	}
+
+	if err = st.ListBlobs(ctx, "", func(m blob.Metadata) error {
+		return errors.Errorf("unexpected blob %v", m.BlobID)
+	}); err != nil {
+		t.Error(err)
+	}
+}
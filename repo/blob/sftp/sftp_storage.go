@@ -7,6 +7,7 @@ import (
 	"context"
 	"crypto/rand"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -55,10 +56,13 @@ func (s *sftpImpl) GetBlobFromPath(ctx context.Context, dirPath, path string, of
 	}
 	defer r.Close() //nolint:errcheck
 
-	// pkg/sftp doesn't have a `ioutil.Readall`, so we WriteTo to a buffer
+	throttled, done := blob.ThrottleDownload(ctx, r)
+	defer done()
+
+	// pkg/sftp doesn't have a `ioutil.Readall`, so we copy to a buffer, which uses WriteTo when not throttled,
 	// and either return it all or return the offset/length bytes
 	buf := new(bytes.Buffer)
-	n, err := r.WriteTo(buf)
+	n, err := io.Copy(buf, throttled)
 
 	if err != nil {
 		return nil, err
@@ -93,7 +97,10 @@ func (s *sftpImpl) PutBlobInPath(ctx context.Context, dirPath, path string, data
 		return errors.Wrap(err, "cannot create temporary file")
 	}
 
-	if _, err = f.Write(data); err != nil {
+	body, done := blob.ThrottleUpload(ctx, bytes.NewReader(data))
+	defer done()
+
+	if _, err = io.Copy(f, body); err != nil {
 		return errors.Wrap(err, "can't write temporary file")
 	}
 
@@ -58,6 +58,9 @@ type Metadata struct {
 // ErrBlobNotFound is returned when a BLOB cannot be found in storage.
 var ErrBlobNotFound = errors.New("BLOB not found")
 
+// ErrBlobLocked is returned when a BLOB cannot be deleted or modified because it is protected by a retention policy.
+var ErrBlobLocked = errors.New("BLOB is locked by retention policy")
+
 // ListAllBlobs returns Metadata for all blobs in a given storage that have the provided name prefix.
 func ListAllBlobs(ctx context.Context, st Storage, prefix ID) ([]Metadata, error) {
 	var result []Metadata
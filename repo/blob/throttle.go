@@ -0,0 +1,135 @@
+package blob
+
+import (
+	"bytes"
+	"context"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	uploadThrottleContextKey   contextKey = "upload-throttle"
+	downloadThrottleContextKey contextKey = "download-throttle"
+)
+
+// ThrottleFunc wraps the reader of data transferred to or from storage in a reader that limits transfer speed.
+// The returned function must be called when the transfer completes.
+type ThrottleFunc func(r io.Reader) (io.Reader, func())
+
+// WithUploadThrottle returns a context that passes function used by storage to throttle uploads.
+func WithUploadThrottle(ctx context.Context, f ThrottleFunc) context.Context {
+	return context.WithValue(ctx, uploadThrottleContextKey, f)
+}
+
+// WithDownloadThrottle returns a context that passes function used by storage to throttle downloads.
+func WithDownloadThrottle(ctx context.Context, f ThrottleFunc) context.Context {
+	return context.WithValue(ctx, downloadThrottleContextKey, f)
+}
+
+// ThrottleUpload wraps the reader of request body sent to storage using the upload throttle function from the
+// context, if any. The returned function must be called when the upload completes.
+func ThrottleUpload(ctx context.Context, r io.Reader) (io.Reader, func()) {
+	return throttle(ctx, uploadThrottleContextKey, r)
+}
+
+// ThrottleDownload wraps the reader of response body received from storage using the download throttle function
+// from the context, if any. The returned function must be called when the download completes.
+func ThrottleDownload(ctx context.Context, r io.Reader) (io.Reader, func()) {
+	return throttle(ctx, downloadThrottleContextKey, r)
+}
+
+func throttle(ctx context.Context, key contextKey, r io.Reader) (io.Reader, func()) {
+	f, _ := ctx.Value(key).(ThrottleFunc)
+	if f == nil {
+		return r, func() {}
+	}
+
+	return f(r)
+}
+
+// UploadBody is a request body of data uploaded to storage, which is throttled using the upload throttle function
+// from the context. The body is seekable, which allows clients to determine its length and retry failed requests.
+type UploadBody struct {
+	ctx      context.Context
+	data     []byte
+	wrappers []ThrottleFunc
+
+	pos  int64
+	r    io.Reader
+	done []func()
+}
+
+// NewUploadBody returns UploadBody of the provided data, optionally passing it through additional wrappers
+// before the upload throttle.
+func NewUploadBody(ctx context.Context, data []byte, wrappers ...ThrottleFunc) *UploadBody {
+	return &UploadBody{ctx: ctx, data: data, wrappers: wrappers}
+}
+
+func (b *UploadBody) Read(p []byte) (int, error) {
+	if b.r == nil {
+		var r io.Reader = bytes.NewReader(b.remaining())
+
+		for _, w := range append(b.wrappers, func(r io.Reader) (io.Reader, func()) {
+			return ThrottleUpload(b.ctx, r)
+		}) {
+			var done func()
+
+			r, done = w(r)
+			b.done = append(b.done, done)
+		}
+
+		b.r = r
+	}
+
+	n, err := b.r.Read(p)
+	b.pos += int64(n)
+
+	return n, err
+}
+
+func (b *UploadBody) remaining() []byte {
+	if b.pos >= int64(len(b.data)) {
+		return nil
+	}
+
+	return b.data[b.pos:]
+}
+
+// Seek changes the position of the next Read, which restarts reading through the wrappers and the throttle.
+func (b *UploadBody) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += b.pos
+	case io.SeekEnd:
+		offset += int64(len(b.data))
+	default:
+		return 0, errors.Errorf("invalid whence %v", whence)
+	}
+
+	if offset < 0 {
+		return 0, errors.Errorf("invalid seek offset %v", offset)
+	}
+
+	if offset == b.pos {
+		return b.pos, nil
+	}
+
+	err := b.Close()
+	b.pos = offset
+
+	return b.pos, err
+}
+
+// Close releases resources used by the body.
+func (b *UploadBody) Close() error {
+	for _, done := range b.done {
+		done()
+	}
+
+	b.r = nil
+	b.done = nil
+
+	return nil
+}
@@ -0,0 +1,101 @@
+package blob_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/kopia/kopia/repo/blob"
+)
+
+func TestUploadBody(t *testing.T) {
+	var throttled, released int
+
+	ctx := blob.WithUploadThrottle(context.Background(), func(r io.Reader) (io.Reader, func()) {
+		throttled++
+		return r, func() { released++ }
+	})
+
+	data := []byte("some data")
+	body := blob.NewUploadBody(ctx, data)
+
+	if n, err := body.Seek(0, io.SeekEnd); err != nil || n != int64(len(data)) {
+		t.Fatalf("unexpected seek result: %v %v", n, err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := body.Seek(0, io.SeekStart); err != nil {
+			t.Fatalf("unable to rewind: %v", err)
+		}
+
+		b, err := ioutil.ReadAll(body)
+		if err != nil {
+			t.Fatalf("unable to read: %v", err)
+		}
+
+		if !bytes.Equal(b, data) {
+			t.Errorf("unexpected data %q, want %q", b, data)
+		}
+	}
+
+	if n, err := body.Seek(0, io.SeekCurrent); err != nil || n != int64(len(data)) {
+		t.Errorf("unexpected current position: %v %v", n, err)
+	}
+
+	if _, err := body.Seek(-1, io.SeekStart); err == nil {
+		t.Errorf("unexpected success seeking before the beginning")
+	}
+
+	body.Close() //nolint:errcheck
+
+	if throttled != 2 || released != 2 {
+		t.Errorf("unexpected throttle calls: %v, released %v", throttled, released)
+	}
+}
+
+func TestUploadBodySeekCurrent(t *testing.T) {
+	data := []byte("some data")
+	body := blob.NewUploadBody(context.Background(), data)
+
+	// position is tracked across reads, as expected by clients validating seekable bodies.
+	if n, err := body.Seek(0, io.SeekCurrent); err != nil || n != 0 {
+		t.Fatalf("unexpected initial position: %v %v", n, err)
+	}
+
+	b := make([]byte, 4)
+	if _, err := io.ReadFull(body, b); err != nil {
+		t.Fatalf("unable to read: %v", err)
+	}
+
+	if n, err := body.Seek(0, io.SeekCurrent); err != nil || n != 4 {
+		t.Fatalf("unexpected position after read: %v %v", n, err)
+	}
+
+	if n, err := body.Seek(-2, io.SeekCurrent); err != nil || n != 2 {
+		t.Fatalf("unexpected position after relative seek: %v %v", n, err)
+	}
+
+	rest, err := ioutil.ReadAll(body)
+	if err != nil {
+		t.Fatalf("unable to read: %v", err)
+	}
+
+	if !bytes.Equal(rest, data[2:]) {
+		t.Errorf("unexpected data %q, want %q", rest, data[2:])
+	}
+
+	if n, err := body.Seek(-4, io.SeekEnd); err != nil || n != int64(len(data))-4 {
+		t.Fatalf("unexpected position after seeking from the end: %v %v", n, err)
+	}
+
+	rest, err = ioutil.ReadAll(body)
+	if err != nil {
+		t.Fatalf("unable to read: %v", err)
+	}
+
+	if !bytes.Equal(rest, data[len(data)-4:]) {
+		t.Errorf("unexpected data %q, want %q", rest, data[len(data)-4:])
+	}
+}
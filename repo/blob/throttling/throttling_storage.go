@@ -0,0 +1,258 @@
+// Package throttling implements wrapper around Storage that limits upload and download bandwidth.
+package throttling
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"sync"
+	"sync/atomic"
+
+	"github.com/efarrer/iothrottler"
+
+	"github.com/kopia/kopia/repo/blob"
+)
+
+// Limits specifies maximum upload and download speeds, zero or negative values mean unlimited.
+type Limits struct {
+	MaxUploadSpeedBytesPerSecond   int `json:"maxUploadSpeedBytesPerSecond,omitempty"`
+	MaxDownloadSpeedBytesPerSecond int `json:"maxDownloadSpeedBytesPerSecond,omitempty"`
+}
+
+// Throttler allows inspecting and changing bandwidth limits of throttling storage at runtime.
+type Throttler interface {
+	// Limits returns configured bandwidth limits.
+	Limits() Limits
+
+	// SetLimits changes configured bandwidth limits.
+	SetLimits(l Limits)
+
+	// EffectiveLimits returns bandwidth limits currently in effect, which are the most restrictive of configured
+	// limits and limits of active overrides.
+	EffectiveLimits() Limits
+
+	// NewOverride returns a new override of configured limits, which is initially inactive.
+	NewOverride() *Override
+}
+
+// Override temporarily lowers configured bandwidth limits, for example during a scheduled window.
+// The most restrictive of configured limits and limits of all active overrides apply in each direction.
+type Override struct {
+	s *throttlingStorage
+}
+
+// Set activates the override with the provided limits.
+func (o *Override) Set(l Limits) {
+	o.s.mu.Lock()
+	defer o.s.mu.Unlock()
+
+	o.s.overrides[o] = l
+	o.s.applyLimitsLocked()
+}
+
+// Clear deactivates the override.
+func (o *Override) Clear() {
+	o.s.mu.Lock()
+	defer o.s.mu.Unlock()
+
+	delete(o.s.overrides, o)
+	o.s.applyLimitsLocked()
+}
+
+type throttlingStorage struct {
+	base blob.Storage
+
+	downloadPool *iothrottler.IOThrottlerPool
+	uploadPool   *iothrottler.IOThrottlerPool
+
+	mu        sync.RWMutex
+	limits    Limits
+	overrides map[*Override]Limits
+	effective Limits
+}
+
+func (s *throttlingStorage) GetBlob(ctx context.Context, id blob.ID, offset, length int64) ([]byte, error) {
+	limit := s.EffectiveLimits().MaxDownloadSpeedBytesPerSecond
+	if limit <= 0 {
+		return s.base.GetBlob(ctx, id, offset, length)
+	}
+
+	t := &transferThrottle{pool: s.downloadPool}
+
+	data, err := s.base.GetBlob(blob.WithDownloadThrottle(ctx, t.wrap), id, offset, length)
+	if err != nil {
+		return nil, err
+	}
+
+	if !t.wasUsed() {
+		if err := s.throttle(s.downloadPool, limit, data); err != nil {
+			return nil, err
+		}
+	}
+
+	return data, nil
+}
+
+func (s *throttlingStorage) PutBlob(ctx context.Context, id blob.ID, data []byte) error {
+	limit := s.EffectiveLimits().MaxUploadSpeedBytesPerSecond
+	if limit <= 0 {
+		return s.base.PutBlob(ctx, id, data)
+	}
+
+	t := &transferThrottle{pool: s.uploadPool}
+
+	if err := s.base.PutBlob(blob.WithUploadThrottle(ctx, t.wrap), id, data); err != nil {
+		return err
+	}
+
+	if !t.wasUsed() {
+		return s.throttle(s.uploadPool, limit, data)
+	}
+
+	return nil
+}
+
+// throttle blocks until the provided data has passed through the throttler pool, unless the limit is disabled.
+// It's used for storage that does not stream transferred data through the throttler, such as local filesystem,
+// to keep the average transfer speed within the limit.
+func (s *throttlingStorage) throttle(pool *iothrottler.IOThrottlerPool, limit int, data []byte) error {
+	if limit <= 0 || len(data) == 0 {
+		return nil
+	}
+
+	r, err := pool.AddReader(ioutil.NopCloser(bytes.NewReader(data)))
+	if err != nil {
+		return err
+	}
+
+	defer r.Close() //nolint:errcheck
+
+	_, err = io.Copy(ioutil.Discard, r)
+
+	return err
+}
+
+// transferThrottle throttles readers of request and response bodies streamed by the underlying storage.
+type transferThrottle struct {
+	pool *iothrottler.IOThrottlerPool
+	used int32
+}
+
+func (t *transferThrottle) wrap(r io.Reader) (io.Reader, func()) {
+	tr, err := t.pool.AddReader(ioutil.NopCloser(r))
+	if err != nil {
+		// pool has been released, don't throttle.
+		return r, func() {}
+	}
+
+	atomic.StoreInt32(&t.used, 1)
+
+	return tr, func() {
+		tr.Close() //nolint:errcheck
+	}
+}
+
+func (t *transferThrottle) wasUsed() bool {
+	return atomic.LoadInt32(&t.used) != 0
+}
+
+func (s *throttlingStorage) DeleteBlob(ctx context.Context, id blob.ID) error {
+	return s.base.DeleteBlob(ctx, id)
+}
+
+func (s *throttlingStorage) ListBlobs(ctx context.Context, prefix blob.ID, callback func(blob.Metadata) error) error {
+	return s.base.ListBlobs(ctx, prefix, callback)
+}
+
+func (s *throttlingStorage) Close(ctx context.Context) error {
+	s.downloadPool.ReleasePool()
+	s.uploadPool.ReleasePool()
+
+	return s.base.Close(ctx)
+}
+
+func (s *throttlingStorage) ConnectionInfo() blob.ConnectionInfo {
+	return s.base.ConnectionInfo()
+}
+
+// Limits returns configured bandwidth limits.
+func (s *throttlingStorage) Limits() Limits {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.limits
+}
+
+// SetLimits changes configured bandwidth limits, affecting all subsequent and in-flight transfers
+// unless the limits are overridden.
+func (s *throttlingStorage) SetLimits(l Limits) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.limits = l
+	s.applyLimitsLocked()
+}
+
+// EffectiveLimits returns bandwidth limits currently in effect.
+func (s *throttlingStorage) EffectiveLimits() Limits {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.effective
+}
+
+// NewOverride returns a new inactive override of configured limits.
+func (s *throttlingStorage) NewOverride() *Override {
+	return &Override{s}
+}
+
+func (s *throttlingStorage) applyLimitsLocked() {
+	l := s.limits
+
+	for _, o := range s.overrides {
+		l.MaxUploadSpeedBytesPerSecond = minLimit(l.MaxUploadSpeedBytesPerSecond, o.MaxUploadSpeedBytesPerSecond)
+		l.MaxDownloadSpeedBytesPerSecond = minLimit(l.MaxDownloadSpeedBytesPerSecond, o.MaxDownloadSpeedBytesPerSecond)
+	}
+
+	s.effective = l
+	s.downloadPool.SetBandwidth(toBandwidth(l.MaxDownloadSpeedBytesPerSecond))
+	s.uploadPool.SetBandwidth(toBandwidth(l.MaxUploadSpeedBytesPerSecond))
+}
+
+// minLimit returns the more restrictive of two limits, where zero or negative values mean unlimited.
+func minLimit(a, b int) int {
+	switch {
+	case a <= 0:
+		return b
+	case b <= 0:
+		return a
+	case a < b:
+		return a
+	default:
+		return b
+	}
+}
+
+func toBandwidth(bytesPerSecond int) iothrottler.Bandwidth {
+	if bytesPerSecond <= 0 {
+		return iothrottler.Unlimited
+	}
+
+	return iothrottler.Bandwidth(bytesPerSecond) * iothrottler.BytesPerSecond
+}
+
+// NewWrapper returns a Storage wrapper that limits upload and download bandwidth.
+// Storage providers that stream request and response bodies throttle them using blob.ThrottleUpload() and
+// blob.ThrottleDownload(), other transfers are delayed to keep the average speed within the limits.
+// The returned storage also implements Throttler, which allows the limits to be changed later.
+func NewWrapper(wrapped blob.Storage, limits Limits) blob.Storage {
+	return &throttlingStorage{
+		base:         wrapped,
+		downloadPool: iothrottler.NewIOThrottlerPool(toBandwidth(limits.MaxDownloadSpeedBytesPerSecond)),
+		uploadPool:   iothrottler.NewIOThrottlerPool(toBandwidth(limits.MaxUploadSpeedBytesPerSecond)),
+		limits:       limits,
+		overrides:    map[*Override]Limits{},
+		effective:    limits,
+	}
+}
@@ -0,0 +1,117 @@
+package throttling
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/kopia/kopia/internal/blobtesting"
+	"github.com/kopia/kopia/repo/blob"
+)
+
+func TestThrottlingStorage(t *testing.T) {
+	ctx := context.Background()
+
+	data := blobtesting.DataMap{}
+	underlying := blobtesting.NewMapStorage(data, nil, nil)
+	st := NewWrapper(underlying, Limits{})
+
+	blobtesting.VerifyStorage(ctx, t, st)
+
+	if got, want := st.ConnectionInfo().Type, underlying.ConnectionInfo().Type; got != want {
+		t.Errorf("unexpected connection info %v, want %v", got, want)
+	}
+
+	if err := st.Close(ctx); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+}
+
+func TestThrottlingStorageLimits(t *testing.T) {
+	ctx := context.Background()
+
+	data := blobtesting.DataMap{}
+	st := NewWrapper(blobtesting.NewMapStorage(data, nil, nil), Limits{})
+
+	defer st.Close(ctx) //nolint:errcheck
+
+	payload := make([]byte, 3000)
+
+	th := st.(Throttler)
+	th.SetLimits(Limits{MaxUploadSpeedBytesPerSecond: 1000})
+
+	if got, want := th.Limits().MaxUploadSpeedBytesPerSecond, 1000; got != want {
+		t.Errorf("unexpected upload limit: %v, want %v", got, want)
+	}
+
+	t0 := time.Now()
+
+	if err := st.PutBlob(ctx, "blob1", payload); err != nil {
+		t.Fatalf("unable to put blob: %v", err)
+	}
+
+	// 3000 bytes at 1000 bytes/sec should take ~2-3 seconds.
+	if dt := time.Since(t0); dt < 1500*time.Millisecond {
+		t.Errorf("upload was not throttled, took %v", dt)
+	}
+
+	// download is unlimited
+	t0 = time.Now()
+
+	if _, err := st.GetBlob(ctx, "blob1", 0, -1); err != nil {
+		t.Fatalf("unable to get blob: %v", err)
+	}
+
+	if dt := time.Since(t0); dt > 500*time.Millisecond {
+		t.Errorf("download was unexpectedly throttled, took %v", dt)
+	}
+}
+
+// streamingStorage emulates storage that streams transferred data through the throttler.
+type streamingStorage struct {
+	blob.Storage
+
+	transferDuration time.Duration
+}
+
+func (s *streamingStorage) PutBlob(ctx context.Context, id blob.ID, data []byte) error {
+	r, done := blob.ThrottleUpload(ctx, bytes.NewReader(data))
+	defer done()
+
+	t0 := time.Now()
+
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	s.transferDuration = time.Since(t0)
+
+	return s.Storage.PutBlob(ctx, id, b)
+}
+
+func TestThrottlingStorageStreaming(t *testing.T) {
+	ctx := context.Background()
+
+	underlying := &streamingStorage{Storage: blobtesting.NewMapStorage(blobtesting.DataMap{}, nil, nil)}
+	st := NewWrapper(underlying, Limits{MaxUploadSpeedBytesPerSecond: 1000})
+
+	defer st.Close(ctx) //nolint:errcheck
+
+	t0 := time.Now()
+
+	if err := st.PutBlob(ctx, "blob1", make([]byte, 3000)); err != nil {
+		t.Fatalf("unable to put blob: %v", err)
+	}
+
+	// the transfer itself must be throttled, without additional delay afterwards.
+	if underlying.transferDuration < 1500*time.Millisecond {
+		t.Errorf("transfer was not throttled, took %v", underlying.transferDuration)
+	}
+
+	if dt := time.Since(t0); dt > underlying.transferDuration+time.Second {
+		t.Errorf("upload was throttled twice, took %v", dt)
+	}
+}
@@ -4,6 +4,7 @@ package webdav
 import (
 	"context"
 	"fmt"
+	"io/ioutil"
 	"math/rand"
 	"net/http"
 	"os"
@@ -46,7 +47,17 @@ type davStorageImpl struct {
 
 func (d *davStorageImpl) GetBlobFromPath(ctx context.Context, dirPath, path string, offset, length int64) ([]byte, error) {
 	v, err := retry.WithExponentialBackoff("GetBlobFromPath", func() (interface{}, error) {
-		return d.cli.Read(path)
+		stream, err := d.cli.ReadStream(path)
+		if err != nil {
+			return nil, err
+		}
+
+		defer stream.Close() //nolint:errcheck
+
+		throttled, done := blob.ThrottleDownload(ctx, stream)
+		defer done()
+
+		return ioutil.ReadAll(throttled)
 	}, isRetriable)
 	if err != nil {
 		return nil, d.translateError(err)
@@ -3,6 +3,9 @@ package compression
 // HeaderID is a unique identifier of the compressor stored in the compressed block header.
 type HeaderID uint32
 
+// NoCompression is the header ID indicating that the data is not compressed.
+const NoCompression HeaderID = 0
+
 // defined header IDs
 const (
 	headerGzipDefault         HeaderID = 0x1000
@@ -12,12 +12,20 @@ import (
 	"github.com/pkg/errors"
 
 	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/blob/throttling"
 	"github.com/kopia/kopia/repo/content"
 )
 
 // ConnectOptions specifies options when persisting configuration to connect to a repository.
 type ConnectOptions struct {
 	content.CachingOptions
+
+	ReadOnly   bool // connect in read-only mode, which prevents all modifications
+	AppendOnly bool // connect in append-only mode, which prevents deleting or overwriting blobs
+
+	EnableActions bool // allow running commands defined as actions in snapshot policies
+
+	Throttling throttling.Limits // storage bandwidth limits
 }
 
 // Connect connects to the repository in the specified storage and persists the configuration and credentials in the file provided.
@@ -32,8 +40,16 @@ func Connect(ctx context.Context, configFile string, st blob.Storage, password s
 		return err
 	}
 
+	if opt.ReadOnly && opt.AppendOnly {
+		return errors.New("read-only and append-only modes are mutually exclusive")
+	}
+
 	var lc LocalConfig
 	lc.Storage = st.ConnectionInfo()
+	lc.ReadOnly = opt.ReadOnly
+	lc.AppendOnly = opt.AppendOnly
+	lc.EnableActions = opt.EnableActions
+	lc.Throttling = opt.Throttling
 
 	if err = setupCaching(configFile, &lc, opt.CachingOptions, f.UniqueID); err != nil {
 		return errors.Wrap(err, "unable to set up caching")
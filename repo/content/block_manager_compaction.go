@@ -30,6 +30,10 @@ func (bm *Manager) CompactIndexes(ctx context.Context, opt CompactOptions) error
 
 	log.Debugf("CompactIndexes(%+v)", opt)
 
+	if bm.disableIndexCompaction {
+		return errors.Errorf("index compaction is disabled")
+	}
+
 	if opt.MaxSmallBlobs < opt.MinSmallBlobs {
 		return errors.Errorf("invalid content counts")
 	}
@@ -103,7 +107,7 @@ func (bm *Manager) compactAndDeleteIndexBlobs(ctx context.Context, indexBlobs []
 	}
 
 	var buf bytes.Buffer
-	if err := bld.Build(&buf); err != nil {
+	if err := bld.Build(&buf, bm.indexVersion); err != nil {
 		return errors.Wrap(err, "unable to build an index")
 	}
 
@@ -9,13 +9,31 @@ import (
 	"github.com/pkg/errors"
 
 	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/compression"
 )
 
 const (
 	packHeaderSize = 8
 	deletedMarker  = 0x80000000
 
-	entryFixedHeaderLength = 20
+	entryFixedHeaderLength   = 20
+	entryV2FixedHeaderLength = 36
+	entryV2Length            = entryV2FixedHeaderLength + 8 // including optional original length
+
+	entryV2FlagDeleted = 1
+
+	// maxV1PackOffsetOrLength is the maximum offset and length of a content representable in index format v1.
+	maxV1PackOffsetOrLength = deletedMarker - 1
+)
+
+// Supported versions of pack index format.
+const (
+	IndexVersion1 = 1
+	IndexVersion2 = 2
+
+	// DefaultIndexVersion is the index format version used in new repositories. Repositories using index format v2
+	// can't be opened by older versions of kopia, so it must be requested explicitly or enabled by upgrading.
+	DefaultIndexVersion = IndexVersion1
 )
 
 // packIndexBuilder prepares and writes content index.
@@ -61,6 +79,7 @@ func (b packIndexBuilder) sortedContents() []*Info {
 }
 
 type indexLayout struct {
+	version           int
 	packBlobIDOffsets map[blob.ID]uint32
 	entryCount        int
 	keyLength         int
@@ -68,16 +87,25 @@ type indexLayout struct {
 	extraDataOffset   uint32
 }
 
-// Build writes the pack index to the provided output.
-func (b packIndexBuilder) Build(output io.Writer) error {
+// Build writes the pack index in the specified format version to the provided output.
+func (b packIndexBuilder) Build(output io.Writer, version int) error {
 	allContents := b.sortedContents()
 	layout := &indexLayout{
+		version:           version,
 		packBlobIDOffsets: map[blob.ID]uint32{},
 		keyLength:         -1,
-		entryLength:       entryFixedHeaderLength,
 		entryCount:        len(allContents),
 	}
 
+	switch version {
+	case IndexVersion1:
+		layout.entryLength = entryFixedHeaderLength
+	case IndexVersion2:
+		layout.entryLength = entryV2Length
+	default:
+		return errors.Errorf("unsupported index version: %v", version)
+	}
+
 	w := bufio.NewWriter(output)
 
 	// prepare extra data to be appended at the end of an index.
@@ -85,7 +113,7 @@ func (b packIndexBuilder) Build(output io.Writer) error {
 
 	// write header
 	header := make([]byte, packHeaderSize)
-	header[0] = 1 // version
+	header[0] = byte(version)
 	header[1] = byte(layout.keyLength)
 	binary.BigEndian.PutUint16(header[2:4], uint16(layout.entryLength))
 	binary.BigEndian.PutUint32(header[4:8], uint32(layout.entryCount))
@@ -141,7 +169,12 @@ func writeEntry(w io.Writer, it *Info, layout *indexLayout, entry []byte) error
 		return errors.Errorf("inconsistent key length: %v vs %v", len(k), layout.keyLength)
 	}
 
-	if err := formatEntry(entry, it, layout); err != nil {
+	formatEntryFunc := formatEntry
+	if layout.version == IndexVersion2 {
+		formatEntryFunc = formatEntryV2
+	}
+
+	if err := formatEntryFunc(entry, it, layout); err != nil {
 		return errors.Wrap(err, "unable to format entry")
 	}
 
@@ -167,18 +200,51 @@ func formatEntry(entry []byte, it *Info, layout *indexLayout) error {
 		return errors.Errorf("empty pack content ID for %v", it.ID)
 	}
 
+	if it.PackOffset > maxV1PackOffsetOrLength || it.Length > maxV1PackOffsetOrLength {
+		return errors.Errorf("offset or length of %v can't be represented in index format v1", it.ID)
+	}
+
+	if it.CompressionHeaderID != compression.NoCompression || it.OriginalLength != 0 || it.EncryptionKeyID != 0 {
+		return errors.Errorf("per-content compression and encryption of %v can't be represented in index format v1", it.ID)
+	}
+
 	binary.BigEndian.PutUint32(entryPackFileOffset, layout.extraDataOffset+layout.packBlobIDOffsets[it.PackBlobID])
 
 	if it.Deleted {
-		binary.BigEndian.PutUint32(entryPackedOffset, it.PackOffset|deletedMarker)
+		binary.BigEndian.PutUint32(entryPackedOffset, uint32(it.PackOffset)|deletedMarker)
 	} else {
-		binary.BigEndian.PutUint32(entryPackedOffset, it.PackOffset)
+		binary.BigEndian.PutUint32(entryPackedOffset, uint32(it.PackOffset))
 	}
 
-	binary.BigEndian.PutUint32(entryPackedLength, it.Length)
+	binary.BigEndian.PutUint32(entryPackedLength, uint32(it.Length))
 	timestampAndFlags |= uint64(it.FormatVersion) << 8 // nolint:gomnd
 	timestampAndFlags |= uint64(len(it.PackBlobID))
 	binary.BigEndian.PutUint64(entryTimestampAndFlags, timestampAndFlags)
 
 	return nil
 }
+
+func formatEntryV2(entry []byte, it *Info, layout *indexLayout) error {
+	if len(it.PackBlobID) == 0 {
+		return errors.Errorf("empty pack content ID for %v", it.ID)
+	}
+
+	var flags byte
+
+	if it.Deleted {
+		flags |= entryV2FlagDeleted
+	}
+
+	binary.BigEndian.PutUint64(entry[0:8], uint64(it.TimestampSeconds))
+	binary.BigEndian.PutUint32(entry[8:12], layout.extraDataOffset+layout.packBlobIDOffsets[it.PackBlobID])
+	entry[12] = byte(len(it.PackBlobID))
+	entry[13] = it.FormatVersion
+	entry[14] = flags
+	entry[15] = it.EncryptionKeyID
+	binary.BigEndian.PutUint64(entry[16:24], it.PackOffset)
+	binary.BigEndian.PutUint64(entry[24:32], it.Length)
+	binary.BigEndian.PutUint32(entry[32:36], uint32(it.CompressionHeaderID))
+	binary.BigEndian.PutUint64(entry[36:44], it.OriginalLength)
+
+	return nil
+}
@@ -10,7 +10,8 @@ import (
 )
 
 type committedContentIndex struct {
-	cache committedContentIndexCache
+	cache        committedContentIndexCache
+	consolidated *consolidatedIndex // persistent consolidated index, nil if not available
 
 	mu     sync.Mutex
 	inUse  map[blob.ID]packIndex
@@ -102,42 +103,61 @@ func (b *committedContentIndex) use(packFiles []blob.ID) (bool, error) {
 
 	log.Debugf("set of index files has changed (had %v, now %v)", len(b.inUse), len(packFiles))
 
+	newMerged, newInUse, err := b.openIndexes(packFiles)
+	if err != nil {
+		return false, err
+	}
+
+	b.merged = newMerged
+	b.inUse = newInUse
+
+	if err := b.cache.expireUnused(packFiles); err != nil {
+		log.Warningf("unable to expire unused content index files: %v", err)
+	}
+
+	if b.consolidated != nil {
+		if err := b.consolidated.expireUnused(); err != nil {
+			log.Warningf("unable to expire unused consolidated indexes: %v", err)
+		}
+	}
+
+	return true, nil
+}
+
+// openIndexes opens indexes for all provided pack files, using consolidated index when available.
+func (b *committedContentIndex) openIndexes(packFiles []blob.ID) (mergedIndex, map[blob.ID]packIndex, error) {
+	if b.consolidated != nil {
+		return b.consolidated.open(packFiles, b.cache)
+	}
+
 	var newMerged mergedIndex
 
 	newInUse := map[blob.ID]packIndex{}
 
-	defer func() {
-		newMerged.Close() //nolint:errcheck
-	}()
-
 	for _, e := range packFiles {
 		ndx, err := b.cache.openIndex(e)
 		if err != nil {
-			return false, errors.Wrapf(err, "unable to open pack index %q", e)
+			newMerged.Close() //nolint:errcheck
+			return nil, nil, errors.Wrapf(err, "unable to open pack index %q", e)
 		}
 
 		newMerged = append(newMerged, ndx)
 		newInUse[e] = ndx
 	}
 
-	b.merged = newMerged
-	b.inUse = newInUse
-
-	if err := b.cache.expireUnused(packFiles); err != nil {
-		log.Warningf("unable to expire unused content index files: %v", err)
-	}
-
-	newMerged = nil // prevent closing newMerged indices
-
-	return true, nil
+	return newMerged, newInUse, nil
 }
 
 func newCommittedContentIndex(caching CachingOptions) *committedContentIndex {
-	var cache committedContentIndexCache
+	var (
+		cache        committedContentIndexCache
+		consolidated *consolidatedIndex
+	)
 
 	if caching.CacheDirectory != "" {
 		dirname := filepath.Join(caching.CacheDirectory, "indexes")
 		cache = &diskCommittedContentIndexCache{dirname}
+		consolidated = &consolidatedIndex{dirname}
 	} else {
 		cache = &memoryCommittedContentIndexCache{
 			contents: map[blob.ID]packIndex{},
@@ -145,7 +165,8 @@ func newCommittedContentIndex(caching CachingOptions) *committedContentIndex {
 	}
 
 	return &committedContentIndex{
-		cache: cache,
-		inUse: map[blob.ID]packIndex{},
+		cache:        cache,
+		consolidated: consolidated,
+		inUse:        map[blob.ID]packIndex{},
 	}
 }
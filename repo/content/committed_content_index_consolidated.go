@@ -0,0 +1,290 @@
+package content
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/exp/mmap"
+
+	"github.com/kopia/kopia/repo/blob"
+)
+
+const (
+	consolidatedIndexStateFile = "consolidated.json"
+	consolidatedIndexSuffix    = ".cndx"
+
+	// maxUnconsolidatedIndexBlobs is the number of index blobs that can be used in addition to the consolidated
+	// index before they get merged into a new consolidated index.
+	maxUnconsolidatedIndexBlobs = 8
+)
+
+// consolidatedIndexState describes the current consolidated index file and the set of index blobs it covers.
+type consolidatedIndexState struct {
+	IndexFile  string    `json:"indexFile"`
+	IndexBlobs []blob.ID `json:"indexBlobs"`
+	Created    time.Time `json:"created"`
+}
+
+// consolidatedIndex maintains a persistent local index merging contents of many index blobs
+// into a single sorted memory-mapped file, which is only rebuilt when new index blobs are seen, so that
+// lookups don't need to consult each index blob separately.
+type consolidatedIndex struct {
+	dirname string
+}
+
+func (c *consolidatedIndex) statePath() string {
+	return filepath.Join(c.dirname, consolidatedIndexStateFile)
+}
+
+// readState returns the current state of consolidated index or nil if there's none.
+func (c *consolidatedIndex) readState() (*consolidatedIndexState, error) {
+	b, err := ioutil.ReadFile(c.statePath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read consolidated index state")
+	}
+
+	st := &consolidatedIndexState{}
+	if err := json.Unmarshal(b, st); err != nil {
+		return nil, errors.Wrap(err, "invalid consolidated index state")
+	}
+
+	return st, nil
+}
+
+func (c *consolidatedIndex) writeState(st *consolidatedIndexState) error {
+	b, err := json.Marshal(st)
+	if err != nil {
+		return errors.Wrap(err, "unable to marshal consolidated index state")
+	}
+
+	tmpFile, err := writeTempFileAtomic(c.dirname, b)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmpFile, c.statePath())
+}
+
+func (c *consolidatedIndex) openIndexFile(name string) (packIndex, error) {
+	f, err := mmap.Open(filepath.Join(c.dirname, name))
+	if err != nil {
+		return nil, err
+	}
+
+	ndx, err := openPackIndex(f)
+	if err != nil {
+		f.Close() //nolint:errcheck
+		return nil, err
+	}
+
+	return ndx, nil
+}
+
+// open returns indexes to be used for looking up contents of the provided index blobs, which consist of
+// the consolidated index and any index blobs not covered by it. If the number of index blobs not covered by
+// the consolidated index grows too large or any of the covered index blobs is no longer in use, the consolidated
+// index is rebuilt.
+func (c *consolidatedIndex) open(indexBlobs []blob.ID, cache committedContentIndexCache) (mergedIndex, map[blob.ID]packIndex, error) {
+	inUse := map[blob.ID]packIndex{}
+
+	for _, id := range indexBlobs {
+		inUse[id] = nil
+	}
+
+	base, covered := c.openCurrent(inUse)
+	if covered == nil {
+		covered = map[blob.ID]bool{}
+	}
+
+	var pending []blob.ID
+
+	for _, id := range indexBlobs {
+		if !covered[id] {
+			pending = append(pending, id)
+		}
+	}
+
+	if len(pending) > maxUnconsolidatedIndexBlobs {
+		newBase, err := c.consolidate(base, pending, indexBlobs, cache)
+		if err == nil {
+			if base != nil {
+				base.Close() //nolint:errcheck
+			}
+
+			base = newBase
+			pending = nil
+
+			for _, id := range indexBlobs {
+				covered[id] = true
+			}
+		} else {
+			log.Warningf("unable to consolidate indexes: %v", err)
+		}
+	}
+
+	var result mergedIndex
+
+	if base != nil {
+		result = append(result, base)
+
+		for id := range covered {
+			inUse[id] = base
+		}
+	}
+
+	for _, id := range pending {
+		ndx, err := cache.openIndex(id)
+		if err != nil {
+			result.Close() //nolint:errcheck
+			return nil, nil, errors.Wrapf(err, "unable to open pack index %q", id)
+		}
+
+		result = append(result, ndx)
+		inUse[id] = ndx
+	}
+
+	return result, inUse, nil
+}
+
+// openCurrent opens the current consolidated index if all index blobs it covers are still in use.
+func (c *consolidatedIndex) openCurrent(inUse map[blob.ID]packIndex) (packIndex, map[blob.ID]bool) {
+	st, err := c.readState()
+	if err != nil {
+		log.Warningf("ignoring consolidated index: %v", err)
+		return nil, nil
+	}
+
+	if st == nil {
+		return nil, nil
+	}
+
+	covered := map[blob.ID]bool{}
+
+	for _, id := range st.IndexBlobs {
+		if _, ok := inUse[id]; !ok {
+			log.Debugf("consolidated index is stale, index blob %v is no longer in use", id)
+			return nil, nil
+		}
+
+		covered[id] = true
+	}
+
+	ndx, err := c.openIndexFile(st.IndexFile)
+	if err != nil {
+		log.Warningf("unable to open consolidated index: %v", err)
+		return nil, nil
+	}
+
+	return ndx, covered
+}
+
+// consolidate writes new consolidated index which merges the current one (if any) with the provided pending
+// index blobs and makes it current.
+func (c *consolidatedIndex) consolidate(base packIndex, pending, indexBlobs []blob.ID, cache committedContentIndexCache) (packIndex, error) {
+	t0 := time.Now()
+
+	var sources mergedIndex
+
+	for _, id := range pending {
+		ndx, err := cache.openIndex(id)
+		if err != nil {
+			sources.Close() //nolint:errcheck
+			return nil, errors.Wrapf(err, "unable to open pack index %q", id)
+		}
+
+		sources = append(sources, ndx)
+	}
+
+	defer sources.Close() //nolint:errcheck
+
+	if base != nil {
+		sources = append(mergedIndex{base}, sources...)
+	}
+
+	bld := make(packIndexBuilder)
+
+	if err := sources.Iterate("", func(i Info) error {
+		bld.Add(i)
+		return nil
+	}); err != nil {
+		return nil, errors.Wrap(err, "unable to iterate indexes")
+	}
+
+	var buf bytes.Buffer
+	if err := bld.Build(&buf, IndexVersion2); err != nil {
+		return nil, errors.Wrap(err, "unable to build consolidated index")
+	}
+
+	h := sha256.Sum256(buf.Bytes())
+	name := hex.EncodeToString(h[0:16]) + consolidatedIndexSuffix
+
+	tmpFile, err := writeTempFileAtomic(c.dirname, buf.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.Rename(tmpFile, filepath.Join(c.dirname, name)); err != nil {
+		// identical consolidated index may have been written by another process.
+		if _, serr := os.Stat(filepath.Join(c.dirname, name)); serr != nil {
+			return nil, errors.Wrap(err, "unable to write consolidated index")
+		}
+	}
+
+	if err := c.writeState(&consolidatedIndexState{
+		IndexFile:  name,
+		IndexBlobs: indexBlobs,
+		Created:    time.Now(),
+	}); err != nil {
+		return nil, errors.Wrap(err, "unable to write consolidated index state")
+	}
+
+	log.Debugf("consolidated %v index blobs with %v contents in %v", len(indexBlobs), len(bld), time.Since(t0))
+
+	return c.openIndexFile(name)
+}
+
+// expireUnused removes old consolidated index files which are no longer current.
+func (c *consolidatedIndex) expireUnused() error {
+	st, err := c.readState()
+	if err != nil {
+		return err
+	}
+
+	entries, err := ioutil.ReadDir(c.dirname)
+	if err != nil {
+		return errors.Wrap(err, "can't list cache")
+	}
+
+	for _, ent := range entries {
+		if !strings.HasSuffix(ent.Name(), consolidatedIndexSuffix) {
+			continue
+		}
+
+		if st != nil && ent.Name() == st.IndexFile {
+			continue
+		}
+
+		// other processes may still be using old consolidated indexes.
+		if time.Since(ent.ModTime()) > unusedCommittedContentIndexCleanupTime {
+			log.Debugf("removing unused consolidated index %v %v", ent.Name(), ent.ModTime())
+
+			if err := os.Remove(filepath.Join(c.dirname, ent.Name())); err != nil {
+				log.Warningf("unable to remove unused consolidated index: %v", err)
+			}
+		}
+	}
+
+	return nil
+}
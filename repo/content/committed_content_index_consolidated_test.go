@@ -0,0 +1,126 @@
+package content
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kopia/kopia/repo/blob"
+)
+
+func TestConsolidatedIndex(t *testing.T) {
+	cacheDir, err := ioutil.TempDir("", "consolidated-index")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(cacheDir)
+
+	ci := newCommittedContentIndex(CachingOptions{CacheDirectory: cacheDir})
+	stateFile := filepath.Join(cacheDir, "indexes", consolidatedIndexStateFile)
+
+	var indexBlobs []blob.ID
+
+	for i := 0; i < 20; i++ {
+		b := packIndexBuilder{}
+		b.Add(Info{
+			ID:               deterministicContentID("consolidated", i),
+			PackBlobID:       deterministicPackBlobID(i),
+			PackOffset:       uint64(i),
+			Length:           100,
+			TimestampSeconds: int64(i),
+		})
+
+		var buf bytes.Buffer
+		if err := b.Build(&buf, IndexVersion1); err != nil {
+			t.Fatalf("unable to build index: %v", err)
+		}
+
+		indexBlobID := blob.ID(fmt.Sprintf("n%v", i))
+		if err := ci.addContent(indexBlobID, buf.Bytes(), false); err != nil {
+			t.Fatalf("unable to add index: %v", err)
+		}
+
+		indexBlobs = append(indexBlobs, indexBlobID)
+	}
+
+	verifyFound := func(blobs []int) {
+		t.Helper()
+
+		for _, i := range blobs {
+			info, err := ci.getContent(deterministicContentID("consolidated", i))
+			if err != nil {
+				t.Errorf("unable to find content from index blob %v: %v", i, err)
+				continue
+			}
+
+			if info.PackBlobID != deterministicPackBlobID(i) {
+				t.Errorf("unexpected pack blob ID: %v", info.PackBlobID)
+			}
+		}
+	}
+
+	// small number of index blobs is used directly.
+	mustUse(t, ci, indexBlobs[0:5])
+
+	if _, err := os.Stat(stateFile); !os.IsNotExist(err) {
+		t.Errorf("unexpected consolidated index: %v", err)
+	}
+
+	if got, want := len(ci.merged), 5; got != want {
+		t.Errorf("unexpected number of merged indexes: %v, want %v", got, want)
+	}
+
+	// once there are too many index blobs, they get consolidated.
+	mustUse(t, ci, indexBlobs[0:12])
+
+	if _, err := os.Stat(stateFile); err != nil {
+		t.Errorf("consolidated index not written: %v", err)
+	}
+
+	if got, want := len(ci.merged), 1; got != want {
+		t.Errorf("unexpected number of merged indexes: %v, want %v", got, want)
+	}
+
+	verifyFound([]int{0, 1, 5, 11})
+
+	// new index blobs are used in addition to the consolidated index.
+	mustUse(t, ci, indexBlobs[0:15])
+
+	if got, want := len(ci.merged), 4; got != want {
+		t.Errorf("unexpected number of merged indexes: %v, want %v", got, want)
+	}
+
+	verifyFound([]int{0, 11, 12, 14})
+
+	// consolidated index is persistent.
+	ci2 := newCommittedContentIndex(CachingOptions{CacheDirectory: cacheDir})
+	mustUse(t, ci2, indexBlobs[0:15])
+
+	if got, want := len(ci2.merged), 4; got != want {
+		t.Errorf("unexpected number of merged indexes after reopening: %v, want %v", got, want)
+	}
+
+	// when index blob covered by consolidated index goes away, consolidated index is rebuilt.
+	mustUse(t, ci, indexBlobs[1:20])
+
+	if got, want := len(ci.merged), 1; got != want {
+		t.Errorf("unexpected number of merged indexes: %v, want %v", got, want)
+	}
+
+	verifyFound([]int{1, 11, 19})
+
+	if _, err := ci.getContent(deterministicContentID("consolidated", 0)); err != ErrContentNotFound {
+		t.Errorf("unexpected result for content from removed index blob: %v", err)
+	}
+}
+
+func mustUse(t *testing.T, ci *committedContentIndex, indexBlobs []blob.ID) {
+	t.Helper()
+
+	if _, err := ci.use(indexBlobs); err != nil {
+		t.Fatalf("unable to use index blobs: %v", err)
+	}
+}
@@ -0,0 +1,29 @@
+package content
+
+import (
+	"crypto/aes"
+
+	"github.com/pkg/errors"
+)
+
+// EncryptBlob encrypts data of a blob stored outside of pack blobs, such as a marker, using the current master key.
+// The returned payload includes the IV and can be decrypted using DecryptBlob.
+func (bm *Manager) EncryptBlob(data []byte) ([]byte, error) {
+	hash := bm.hashData(data)
+
+	encrypted, err := bm.encryptor.Encrypt(data, hash)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to encrypt blob")
+	}
+
+	return append(append([]byte(nil), hash[len(hash)-aes.BlockSize:]...), encrypted...), nil
+}
+
+// DecryptBlob decrypts and verifies the payload returned by EncryptBlob using the current or retired master keys.
+func (bm *Manager) DecryptBlob(payload []byte) ([]byte, error) {
+	if len(payload) < aes.BlockSize {
+		return nil, errors.New("encrypted blob too short")
+	}
+
+	return bm.decryptWithAnyKey(payload[aes.BlockSize:], payload[0:aes.BlockSize])
+}
@@ -0,0 +1,53 @@
+package content
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/kopia/kopia/internal/blobtesting"
+)
+
+func TestEncryptBlob(t *testing.T) {
+	bm, err := newManagerWithOptions(context.Background(), blobtesting.NewMapStorage(blobtesting.DataMap{}, nil, nil), &FormattingOptions{
+		Version:     1,
+		Hash:        "HMAC-SHA256-128",
+		Encryption:  "AES-256-CTR",
+		MaxPackSize: maxPackSize,
+		HMACSecret:  []byte("foo"),
+		MasterKey:   []byte("0123456789abcdef0123456789abcdef"),
+	}, CachingOptions{}, fakeTimeNowFrozen(fakeTime), nil, ManagerOptions{})
+	if err != nil {
+		t.Fatalf("can't create bm: %v", err)
+	}
+
+	data := []byte("user@host:/some/path")
+
+	payload, err := bm.EncryptBlob(data)
+	if err != nil {
+		t.Fatalf("unable to encrypt: %v", err)
+	}
+
+	if bytes.Contains(payload, []byte("user@host")) {
+		t.Errorf("payload is not encrypted: %q", payload)
+	}
+
+	decrypted, err := bm.DecryptBlob(payload)
+	if err != nil {
+		t.Fatalf("unable to decrypt: %v", err)
+	}
+
+	if !bytes.Equal(decrypted, data) {
+		t.Errorf("unexpected decrypted data %q, want %q", decrypted, data)
+	}
+
+	payload[len(payload)-1] ^= 1
+
+	if _, err := bm.DecryptBlob(payload); err == nil {
+		t.Errorf("unexpected success decrypting corrupted payload")
+	}
+
+	if _, err := bm.DecryptBlob(payload[0:3]); err == nil {
+		t.Errorf("unexpected success decrypting truncated payload")
+	}
+}
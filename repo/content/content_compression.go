@@ -0,0 +1,51 @@
+package content
+
+import (
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo/compression"
+)
+
+// maybeCompressContent compresses the provided data using the specified compressor and returns the data to store,
+// the compressor that was actually used and the original length of the data (0 if not compressed).
+// The data is stored uncompressed if compression does not reduce its size.
+func maybeCompressContent(data []byte, comp compression.HeaderID) ([]byte, compression.HeaderID, uint64, error) {
+	if comp == compression.NoCompression {
+		return data, compression.NoCompression, 0, nil
+	}
+
+	c := compression.ByHeaderID[comp]
+	if c == nil {
+		return nil, compression.NoCompression, 0, errors.Errorf("unsupported compressor %x", comp)
+	}
+
+	compressed, err := c.Compress(data)
+	if err != nil {
+		return nil, compression.NoCompression, 0, errors.Wrap(err, "compression error")
+	}
+
+	if len(compressed) >= len(data) {
+		return data, compression.NoCompression, 0, nil
+	}
+
+	return compressed, comp, uint64(len(data)), nil
+}
+
+// decompressContent decompresses the data of a content stored using the specified compressor.
+func decompressContent(data []byte, comp compression.HeaderID) ([]byte, error) {
+	if comp == compression.NoCompression {
+		return data, nil
+	}
+
+	c := compression.ByHeaderID[comp]
+	if c == nil {
+		return nil, errors.Errorf("unsupported compressor %x", comp)
+	}
+
+	decompressed, err := c.Decompress(data)
+	if err != nil {
+		return nil, errors.Wrap(err, "decompression error")
+	}
+
+	return decompressed, nil
+}
@@ -0,0 +1,119 @@
+package content
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kopia/kopia/internal/blobtesting"
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/compression"
+)
+
+func newTestContentManagerWithIndexVersion(t *testing.T, st blob.Storage, indexVersion int) *Manager {
+	t.Helper()
+
+	bm, err := newManagerWithOptions(context.Background(), st, &FormattingOptions{
+		Hash:         "HMAC-SHA256",
+		Encryption:   "NONE",
+		HMACSecret:   hmacSecret,
+		MaxPackSize:  maxPackSize,
+		Version:      1,
+		IndexVersion: indexVersion,
+	}, CachingOptions{}, fakeTimeNowWithAutoAdvance(fakeTime, 1*time.Second), nil, ManagerOptions{})
+	if err != nil {
+		t.Fatalf("can't create content manager: %v", err)
+	}
+
+	bm.checkInvariantsOnUnlock = true
+
+	return bm
+}
+
+func TestContentCompression(t *testing.T) {
+	ctx := context.Background()
+	data := blobtesting.DataMap{}
+	st := blobtesting.NewMapStorage(data, nil, nil)
+	bm := newTestContentManagerWithIndexVersion(t, st, IndexVersion2)
+
+	comp := compression.ByName["gzip"].HeaderID()
+	compressible := bytes.Repeat([]byte{1, 2, 3, 4}, 100)
+	incompressible := seededRandomData(1, 100)
+
+	compressedID, err := bm.WriteContent(ctx, compressible, "", comp)
+	if err != nil {
+		t.Fatalf("unable to write content: %v", err)
+	}
+
+	incompressibleID, err := bm.WriteContent(ctx, incompressible, "", comp)
+	if err != nil {
+		t.Fatalf("unable to write content: %v", err)
+	}
+
+	// content ID does not depend on compression.
+	if got, want := compressedID, ID(hashValue(compressible)); got != want {
+		t.Errorf("unexpected content ID %v, want %v", got, want)
+	}
+
+	// pending contents are decompressed transparently.
+	verifyContent(ctx, t, bm, compressedID, compressible)
+	verifyContent(ctx, t, bm, incompressibleID, incompressible)
+
+	if err := bm.Flush(ctx); err != nil {
+		t.Fatalf("flush error: %v", err)
+	}
+
+	bm = newTestContentManagerWithIndexVersion(t, st, IndexVersion2)
+
+	verifyContent(ctx, t, bm, compressedID, compressible)
+	verifyContent(ctx, t, bm, incompressibleID, incompressible)
+
+	ci, err := bm.ContentInfo(ctx, compressedID)
+	if err != nil {
+		t.Fatalf("unable to get content info: %v", err)
+	}
+
+	if ci.CompressionHeaderID != comp || ci.OriginalLength != uint64(len(compressible)) || ci.Length >= ci.OriginalLength {
+		t.Errorf("unexpected compressed content info: %+v", ci)
+	}
+
+	// incompressible data is stored as-is.
+	ci, err = bm.ContentInfo(ctx, incompressibleID)
+	if err != nil {
+		t.Fatalf("unable to get content info: %v", err)
+	}
+
+	if ci.CompressionHeaderID != compression.NoCompression || ci.OriginalLength != 0 {
+		t.Errorf("unexpected incompressible content info: %+v", ci)
+	}
+
+	// rewriting preserves compression.
+	if err := bm.RewriteContent(ctx, compressedID); err != nil {
+		t.Fatalf("unable to rewrite content: %v", err)
+	}
+
+	if err := bm.Flush(ctx); err != nil {
+		t.Fatalf("flush error: %v", err)
+	}
+
+	if ci2, err := bm.ContentInfo(ctx, compressedID); err != nil || ci2.CompressionHeaderID != comp || ci2.PackBlobID == ci.PackBlobID {
+		t.Errorf("unexpected content info after rewrite: %+v (err=%v)", ci2, err)
+	}
+
+	verifyContent(ctx, t, bm, compressedID, compressible)
+}
+
+func TestContentCompressionRequiresIndexV2(t *testing.T) {
+	ctx := context.Background()
+	data := blobtesting.DataMap{}
+	bm := newTestContentManagerWithIndexVersion(t, blobtesting.NewMapStorage(data, nil, nil), IndexVersion1)
+
+	if bm.SupportsContentCompression() {
+		t.Errorf("v1 index unexpectedly supports content compression")
+	}
+
+	if _, err := bm.WriteContent(ctx, []byte{1, 2, 3}, "", compression.ByName["gzip"].HeaderID()); err == nil {
+		t.Errorf("unexpected success writing compressed content with v1 index")
+	}
+}
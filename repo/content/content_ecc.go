@@ -0,0 +1,277 @@
+package content
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/reedsolomon"
+	"github.com/kopia/kopia/repo/blob"
+)
+
+// NoECC disables erasure coding of pack blobs.
+const NoECC = "NONE"
+
+const (
+	eccFooterMagic   = 0x4b454343 // "KECC"
+	eccFooterVersion = 1
+	eccFooterLength  = 24
+	eccChecksumSize  = 4
+)
+
+// eccFooter is stored at the end of pack blobs protected by erasure coding, which are laid out as:
+//
+//	original pack data
+//	parity shards (parityShards * shardSize bytes)
+//	CRC32 of each data and parity shard (4 bytes each, big endian)
+//	footer (eccFooterLength bytes)
+//
+// Keeping original data first means that offsets of contents within pack blobs don't change and reads
+// only need to consult parity when the data is found to be corrupted.
+type eccFooter struct {
+	dataShards     int
+	parityShards   int
+	shardSize      int
+	originalLength int
+}
+
+// SupportedECCSchemes returns the names of supported erasure coding schemes for pack blobs.
+func SupportedECCSchemes() []string {
+	return []string{NoECC, "RS-10-2", "RS-10-4", "RS-20-4"}
+}
+
+// parseECCScheme returns the erasure coding encoder for the provided scheme name or nil if erasure coding is disabled.
+func parseECCScheme(name string) (*reedsolomon.Encoder, error) {
+	if name == "" || name == NoECC {
+		return nil, nil
+	}
+
+	var dataShards, parityShards int
+
+	if _, err := fmt.Sscanf(name, "RS-%d-%d", &dataShards, &parityShards); err != nil {
+		return nil, errors.Errorf("unsupported erasure coding scheme %q", name)
+	}
+
+	if name != fmt.Sprintf("RS-%v-%v", dataShards, parityShards) {
+		return nil, errors.Errorf("unsupported erasure coding scheme %q", name)
+	}
+
+	return reedsolomon.New(dataShards, parityShards)
+}
+
+// eccSplitShards splits data into the provided number of shards of equal size, padding the last ones with zeros.
+func eccSplitShards(data []byte, enc *reedsolomon.Encoder, shardSize int) [][]byte {
+	shards := make([][]byte, enc.DataShards()+enc.ParityShards())
+
+	for i := range shards {
+		shards[i] = make([]byte, shardSize)
+
+		if i < enc.DataShards() && i*shardSize < len(data) {
+			copy(shards[i], data[i*shardSize:])
+		}
+	}
+
+	return shards
+}
+
+// eccEncode returns the provided data with appended parity, shard checksums and footer.
+func eccEncode(data []byte, enc *reedsolomon.Encoder) ([]byte, error) {
+	shardSize := (len(data) + enc.DataShards() - 1) / enc.DataShards()
+	if shardSize == 0 {
+		shardSize = 1
+	}
+
+	shards := eccSplitShards(data, enc, shardSize)
+	if err := enc.Encode(shards); err != nil {
+		return nil, errors.Wrap(err, "unable to compute parity")
+	}
+
+	result := make([]byte, 0, len(data)+enc.ParityShards()*shardSize+len(shards)*eccChecksumSize+eccFooterLength)
+	result = append(result, data...)
+
+	for _, s := range shards[enc.DataShards():] {
+		result = append(result, s...)
+	}
+
+	checksumsStart := len(result)
+
+	for _, s := range shards {
+		result = appendUint32(result, crc32.ChecksumIEEE(s))
+	}
+
+	result = append(result, eccFooterVersion, byte(enc.DataShards()), byte(enc.ParityShards()), 0)
+	result = appendUint32(result, uint32(shardSize))
+	result = appendUint64(result, uint64(len(data)))
+	result = appendUint32(result, crc32.ChecksumIEEE(result[checksumsStart:]))
+	result = appendUint32(result, eccFooterMagic)
+
+	return result, nil
+}
+
+// findECCFooter returns the erasure coding footer of the provided blob or nil if the blob is not protected by erasure coding.
+// Blobs are recognized by the footer itself rather than by the repository format, so that pack blobs written before
+// erasure coding was disabled can still be decoded, while pack blobs that happen to end with the footer magic are not.
+func findECCFooter(b []byte) (*eccFooter, error) {
+	if len(b) < eccFooterLength || binary.BigEndian.Uint32(b[len(b)-4:]) != eccFooterMagic {
+		return nil, nil
+	}
+
+	f := b[len(b)-eccFooterLength:]
+
+	ft := &eccFooter{
+		dataShards:     int(f[1]),
+		parityShards:   int(f[2]),
+		shardSize:      int(binary.BigEndian.Uint32(f[4:8])),
+		originalLength: int(binary.BigEndian.Uint64(f[8:16])),
+	}
+
+	checksumsLength := (ft.dataShards + ft.parityShards) * eccChecksumSize
+	if ft.dataShards == 0 || ft.parityShards == 0 || ft.originalLength < 0 || ft.originalLength > ft.dataShards*ft.shardSize ||
+		len(b) != ft.originalLength+ft.parityShards*ft.shardSize+checksumsLength+eccFooterLength {
+		return nil, nil
+	}
+
+	checksummed := b[len(b)-eccFooterLength-checksumsLength : len(b)-8]
+	if crc32.ChecksumIEEE(checksummed) != binary.BigEndian.Uint32(f[16:20]) {
+		return nil, nil
+	}
+
+	if f[0] != eccFooterVersion {
+		return nil, errors.Errorf("unsupported erasure coding version %v", f[0])
+	}
+
+	return ft, nil
+}
+
+// eccDecode returns the original data of a pack blob, reconstructing any corrupted shards using parity,
+// and the number of shards which were corrupted. Pack blobs not protected by erasure coding are returned as-is.
+func eccDecode(b []byte) (data []byte, corruptedShards int, err error) {
+	ft, err := findECCFooter(b)
+	if err != nil || ft == nil {
+		return b, 0, err
+	}
+
+	enc, err := reedsolomon.New(ft.dataShards, ft.parityShards)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	data = b[0:ft.originalLength]
+	shards := eccSplitShards(data, enc, ft.shardSize)
+	parity := b[ft.originalLength:]
+	checksums := b[len(b)-eccFooterLength-len(shards)*eccChecksumSize:]
+
+	for i := range shards {
+		if i >= ft.dataShards {
+			p := i - ft.dataShards
+			shards[i] = parity[p*ft.shardSize : (p+1)*ft.shardSize]
+		}
+
+		if crc32.ChecksumIEEE(shards[i]) != binary.BigEndian.Uint32(checksums[i*eccChecksumSize:]) {
+			shards[i] = nil
+			corruptedShards++
+		}
+	}
+
+	if corruptedShards == 0 {
+		return data, 0, nil
+	}
+
+	if err := enc.Reconstruct(shards); err != nil {
+		return nil, corruptedShards, errors.Wrapf(err, "unable to reconstruct %v corrupted shards", corruptedShards)
+	}
+
+	repaired := make([]byte, 0, ft.originalLength)
+	for _, s := range shards[0:ft.dataShards] {
+		repaired = append(repaired, s...)
+	}
+
+	return repaired[0:ft.originalLength], corruptedShards, nil
+}
+
+// readRepairedPackRange reads the entire pack blob and returns the provided range of its original data
+// after reconstructing corrupted shards.
+func (bm *lockFreeManager) readRepairedPackRange(ctx context.Context, packFile blob.ID, offset, length int64) ([]byte, error) {
+	b, err := bm.st.GetBlob(ctx, packFile, 0, -1)
+	if err != nil {
+		return nil, err
+	}
+
+	data, corrupted, err := eccDecode(b)
+	if err != nil {
+		return nil, err
+	}
+
+	if corrupted == 0 {
+		return nil, errors.Errorf("pack blob %v is not protected by erasure coding or has no corrupted shards", packFile)
+	}
+
+	if offset < 0 || length < 0 || offset+length > int64(len(data)) {
+		return nil, errors.Errorf("invalid range %v+%v in pack blob %v", offset, length, packFile)
+	}
+
+	log.Warningf("reconstructed %v corrupted shards of pack blob %v", corrupted, packFile)
+
+	return data[offset : offset+length], nil
+}
+
+// RepairPackBlob reconstructs corrupted shards of a pack blob protected by erasure coding and rewrites contents
+// it holds into new pack blobs, which are written and indexed on the next flush. Returns the number of corrupted shards
+// that were repaired. The damaged pack blob is never modified, which works with append-only storage and retention
+// policies, and is removed by blob garbage collection once it's no longer referenced.
+func (bm *Manager) RepairPackBlob(ctx context.Context, packFile blob.ID) (int, error) {
+	b, err := bm.st.GetBlob(ctx, packFile, 0, -1)
+	if err != nil {
+		return 0, err
+	}
+
+	_, corrupted, err := eccDecode(b)
+	if err != nil || corrupted == 0 {
+		return corrupted, err
+	}
+
+	var contentIDs []ID
+
+	if err := bm.IterateContents(IterateOptions{IncludeDeleted: true}, func(ci Info) error {
+		if ci.PackBlobID == packFile {
+			contentIDs = append(contentIDs, ci.ID)
+		}
+
+		return nil
+	}); err != nil {
+		return 0, errors.Wrapf(err, "unable to find contents of pack blob %v", packFile)
+	}
+
+	if len(contentIDs) == 0 {
+		// pack blob is no longer referenced, nothing to repair.
+		return 0, nil
+	}
+
+	for _, contentID := range contentIDs {
+		// contents are reconstructed from parity when read.
+		if err := bm.RewriteContent(ctx, contentID); err != nil {
+			return 0, errors.Wrapf(err, "unable to rewrite content %v of pack blob %v", contentID, packFile)
+		}
+	}
+
+	return corrupted, nil
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	var tmp [4]byte
+
+	binary.BigEndian.PutUint32(tmp[:], v)
+
+	return append(b, tmp[:]...)
+}
+
+func appendUint64(b []byte, v uint64) []byte {
+	var tmp [8]byte
+
+	binary.BigEndian.PutUint64(tmp[:], v)
+
+	return append(b, tmp[:]...)
+}
@@ -0,0 +1,217 @@
+package content
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kopia/kopia/internal/blobtesting"
+)
+
+func TestECCEncodeDecode(t *testing.T) {
+	enc, err := parseECCScheme("RS-10-2")
+	if err != nil {
+		t.Fatalf("unable to parse ECC scheme: %v", err)
+	}
+
+	for _, size := range []int{0, 1, 100, 12345} {
+		data := seededRandomData(size, size)
+
+		encoded, err := eccEncode(data, enc)
+		if err != nil {
+			t.Fatalf("encode error: %v", err)
+		}
+
+		if !bytes.HasPrefix(encoded, data) {
+			t.Fatalf("encoded data does not start with original data")
+		}
+
+		decoded, corrupted, err := eccDecode(encoded)
+		if err != nil || corrupted != 0 || !bytes.Equal(decoded, data) {
+			t.Fatalf("unexpected decode result for %v bytes: corrupted=%v err=%v", size, corrupted, err)
+		}
+
+		if size < 100 {
+			continue
+		}
+
+		// corrupt two data shards, which can be reconstructed.
+		damaged := append([]byte(nil), encoded...)
+		damaged[0] ^= 1
+		damaged[size-1] ^= 1
+
+		decoded, corrupted, err = eccDecode(damaged)
+		if err != nil || corrupted != 2 || !bytes.Equal(decoded, data) {
+			t.Fatalf("unexpected decode result for %v bytes: corrupted=%v err=%v", size, corrupted, err)
+		}
+
+		// corrupting a third shard is beyond what parity can recover.
+		damaged[size/2] ^= 1
+
+		if _, _, err = eccDecode(damaged); err == nil {
+			t.Errorf("unexpected success decoding data with too many corrupted shards")
+		}
+	}
+
+	// data without erasure coding footer is returned as-is.
+	plain := seededRandomData(1, 100)
+	if decoded, corrupted, err := eccDecode(plain); err != nil || corrupted != 0 || !bytes.Equal(decoded, plain) {
+		t.Errorf("unexpected decode result for data without erasure coding: corrupted=%v err=%v", corrupted, err)
+	}
+}
+
+func TestParseECCScheme(t *testing.T) {
+	for _, name := range SupportedECCSchemes() {
+		if _, err := parseECCScheme(name); err != nil {
+			t.Errorf("unable to parse supported scheme %q: %v", name, err)
+		}
+	}
+
+	for _, name := range []string{"RS", "RS-10", "RS-0-2", "RS-10-2x", "XOR-1-1"} {
+		if _, err := parseECCScheme(name); err == nil {
+			t.Errorf("unexpected success parsing %q", name)
+		}
+	}
+}
+
+func TestRequiredVersionECC(t *testing.T) {
+	cases := map[string]int{
+		"":        FormatVersion1,
+		NoECC:     FormatVersion1,
+		"RS-10-2": FormatVersion2,
+	}
+
+	for ecc, want := range cases {
+		f := &FormattingOptions{IndexVersion: IndexVersion1, ECC: ecc}
+		if got := f.RequiredVersion(); got != want {
+			t.Errorf("unexpected required version with ECC %q: %v, want %v", ecc, got, want)
+		}
+	}
+}
+
+func TestContentManagerECC(t *testing.T) {
+	ctx := context.Background()
+	data := blobtesting.DataMap{}
+	st := blobtesting.NewMapStorage(data, nil, nil)
+
+	// the clock is frozen, so that contents are repaired within the same second they were written.
+	timeNow := func() time.Time { return fakeTime }
+
+	newManager := func(ecc string) *Manager {
+		bm, err := newManagerWithOptions(ctx, st, &FormattingOptions{
+			Hash:        "HMAC-SHA256",
+			Encryption:  "NONE",
+			HMACSecret:  hmacSecret,
+			MaxPackSize: maxPackSize,
+			Version:     1,
+			ECC:         ecc,
+		}, CachingOptions{}, timeNow, nil, ManagerOptions{})
+		if err != nil {
+			t.Fatalf("can't create content manager: %v", err)
+		}
+
+		return bm
+	}
+
+	bm := newManager("RS-10-2")
+	content1 := writeContentAndVerify(ctx, t, bm, seededRandomData(1, 1000))
+	content2 := writeContentAndVerify(ctx, t, bm, seededRandomData(2, 1000))
+	assertNoError(t, bm.Flush(ctx))
+
+	ci, err := bm.ContentInfo(ctx, content1)
+	assertNoError(t, err)
+
+	// written bytes include parity.
+	var totalBytes int64
+	for _, v := range data {
+		totalBytes += int64(len(v))
+	}
+
+	if got, want := bm.Stats().WrittenBytes, totalBytes; got != want {
+		t.Errorf("unexpected number of written bytes: %v, want %v", got, want)
+	}
+
+	// local index can be read from pack blobs with parity, even after erasure coding is disabled.
+	for _, ecc := range []string{"RS-10-2", ""} {
+		recovered, err := newManager(ecc).RecoverIndexFromPackBlob(ctx, ci.PackBlobID, 0, false)
+		assertNoError(t, err)
+
+		if got, want := len(recovered), 2; got != want {
+			t.Errorf("unexpected number of recovered contents with ECC %q: %v, want %v", ecc, got, want)
+		}
+	}
+
+	// corrupt the content, which is transparently reconstructed on read, also after erasure coding is disabled.
+	data[ci.PackBlobID][ci.PackOffset+10] ^= 1
+
+	damaged := append([]byte(nil), data[ci.PackBlobID]...)
+
+	verifyContent(ctx, t, newManager("RS-10-2"), content1, seededRandomData(1, 1000))
+
+	bm = newManager("")
+	verifyContent(ctx, t, bm, content1, seededRandomData(1, 1000))
+	verifyContent(ctx, t, bm, content2, seededRandomData(2, 1000))
+
+	repaired, err := bm.RepairPackBlob(ctx, ci.PackBlobID)
+	assertNoError(t, err)
+
+	if repaired != 1 {
+		t.Errorf("unexpected number of repaired shards: %v", repaired)
+	}
+
+	assertNoError(t, bm.Flush(ctx))
+
+	// damaged pack blob is left unchanged and contents are moved to a new one.
+	if !bytes.Equal(data[ci.PackBlobID], damaged) {
+		t.Errorf("damaged pack blob was modified")
+	}
+
+	bm = newManager("")
+
+	for _, contentID := range []ID{content1, content2} {
+		ci2, err := bm.ContentInfo(ctx, contentID)
+		assertNoError(t, err)
+
+		if ci2.PackBlobID == ci.PackBlobID {
+			t.Errorf("content %v was not moved out of damaged pack blob", contentID)
+		}
+	}
+
+	data[ci.PackBlobID] = []byte("unreadable")
+
+	verifyContent(ctx, t, bm, content1, seededRandomData(1, 1000))
+	verifyContent(ctx, t, bm, content2, seededRandomData(2, 1000))
+
+	// nothing left to repair.
+	data[ci.PackBlobID] = damaged
+
+	repaired, err = bm.RepairPackBlob(ctx, ci.PackBlobID)
+	if err != nil || repaired != 0 {
+		t.Errorf("unexpected repair result: %v %v", repaired, err)
+	}
+}
+
+func TestContentManagerWithoutECCIgnoresFooterMagic(t *testing.T) {
+	ctx := context.Background()
+	data := blobtesting.DataMap{}
+	st := blobtesting.NewMapStorage(data, nil, nil)
+	bm := newTestContentManagerWithStorage(st, nil)
+
+	// blob that happens to end with erasure coding footer magic.
+	b := append(seededRandomData(1, 100), 0x4b, 0x45, 0x43, 0x43)
+	assertNoError(t, st.PutBlob(ctx, "pdeadbeef", b))
+
+	repaired, err := bm.RepairPackBlob(ctx, "pdeadbeef")
+	if err != nil || repaired != 0 {
+		t.Errorf("unexpected repair result: %v %v", repaired, err)
+	}
+
+	if _, err := bm.readRepairedPackRange(ctx, "pdeadbeef", 0, 10); err == nil {
+		t.Errorf("unexpected success reading repaired range of pack blob without erasure coding")
+	}
+
+	if !bytes.Equal(data["pdeadbeef"], b) {
+		t.Errorf("pack blob was modified")
+	}
+}
@@ -44,6 +44,12 @@ type Encryptor interface {
 	IsAuthenticated() bool
 }
 
+// checksumVerifier is implemented by authenticated encryptors which can verify the integrity of ciphertext
+// without decrypting it.
+type checksumVerifier interface {
+	VerifyChecksum(cipherText []byte) error
+}
+
 // EncryptorFactory creates new Encryptor for given FormattingOptions
 type EncryptorFactory func(o *FormattingOptions) (Encryptor, error)
 
@@ -132,6 +138,16 @@ func (s salsaEncryptor) IsAuthenticated() bool {
 	return s.hmacSecret != nil
 }
 
+func (s salsaEncryptor) VerifyChecksum(input []byte) error {
+	if s.hmacSecret == nil {
+		return errors.Errorf("encryption is not authenticated")
+	}
+
+	_, err := verifyAndStripHMAC(input, s.hmacSecret)
+
+	return err
+}
+
 func (s salsaEncryptor) encryptDecrypt(input, contentID []byte) ([]byte, error) {
 	if len(contentID) < s.nonceSize {
 		return nil, errors.Errorf("hash too short, expected >=%v bytes, got %v", s.nonceSize, len(contentID))
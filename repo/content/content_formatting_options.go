@@ -7,14 +7,28 @@ import (
 	"golang.org/x/crypto/hkdf"
 )
 
+const (
+	// FormatVersion1 is the format version of repositories that only use the original features.
+	FormatVersion1 = 1
+
+	// FormatVersion2 is required by v2 pack indexes, error correction and key rotation, so that clients
+	// that can't handle them refuse to open the repository.
+	FormatVersion2 = 2
+)
+
 // FormattingOptions describes the rules for formatting contents in repository.
 type FormattingOptions struct {
-	Version     int    `json:"version,omitempty"`     // version number, must be "1"
-	Hash        string `json:"hash,omitempty"`        // identifier of the hash algorithm used
-	Encryption  string `json:"encryption,omitempty"`  // identifier of the encryption algorithm used
-	HMACSecret  []byte `json:"secret,omitempty"`      // HMAC secret used to generate encryption keys
-	MasterKey   []byte `json:"masterKey,omitempty"`   // master encryption key (SIV-mode encryption only)
-	MaxPackSize int    `json:"maxPackSize,omitempty"` // maximum size of a pack object
+	Version      int    `json:"version,omitempty"`      // format version number, see RequiredVersion()
+	Hash         string `json:"hash,omitempty"`         // identifier of the hash algorithm used
+	Encryption   string `json:"encryption,omitempty"`   // identifier of the encryption algorithm used
+	HMACSecret   []byte `json:"secret,omitempty"`       // HMAC secret used to generate encryption keys
+	MasterKey    []byte `json:"masterKey,omitempty"`    // master encryption key (SIV-mode encryption only)
+	MaxPackSize  int    `json:"maxPackSize,omitempty"`  // maximum size of a pack object
+	IndexVersion int    `json:"indexVersion,omitempty"` // pack index format version, 1 if not set
+	ECC          string `json:"ecc,omitempty"`          // erasure coding scheme used to protect pack blobs, none if not set
+
+	EncryptionKeyID   byte            `json:"encryptionKeyID,omitempty"`   // generation of the master key, incremented on each key rotation
+	RetiredMasterKeys map[byte][]byte `json:"retiredMasterKeys,omitempty"` // master keys of previous generations, needed to decrypt existing data
 }
 
 // DeriveKey uses HKDF to derive a key of a given length and a given purpose.
@@ -25,3 +39,12 @@ func (o *FormattingOptions) DeriveKey(purpose []byte, length int) []byte {
 
 	return key
 }
+
+// RequiredVersion returns the minimum format version of repositories using the formatting options.
+func (o *FormattingOptions) RequiredVersion() int {
+	if o.IndexVersion >= IndexVersion2 || (o.ECC != "" && o.ECC != NoECC) || o.EncryptionKeyID != 0 || len(o.RetiredMasterKeys) > 0 {
+		return FormatVersion2
+	}
+
+	return FormatVersion1
+}
@@ -0,0 +1,292 @@
+package content
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo/blob"
+)
+
+const defaultIndexRebuildParallelism = 8
+
+// IndexRebuildOptions provides options for rebuilding indexes from pack blobs.
+type IndexRebuildOptions struct {
+	// Parallel is the number of pack blobs to read in parallel.
+	Parallel int
+
+	// Commit replaces all current index blobs with a fresh index built from the contents of pack blobs.
+	Commit bool
+}
+
+// IndexRebuildConflict describes a content whose committed index entry is inconsistent with the pack blob it points to.
+type IndexRebuildConflict struct {
+	Committed Info `json:"committed"`
+	Recovered Info `json:"recovered"`
+}
+
+// IndexRebuildPackError describes a pack blob whose local index could not be read.
+type IndexRebuildPackError struct {
+	BlobID blob.ID `json:"blobID"`
+	Error  string  `json:"error"`
+}
+
+// IndexRebuildReport summarizes differences between the committed index and index entries recovered from pack blobs.
+type IndexRebuildReport struct {
+	PackBlobsScanned  int                     `json:"packBlobsScanned"`
+	ContentsRecovered int                     `json:"contentsRecovered"`
+	ContentsCommitted int                     `json:"contentsCommitted"`
+	FailedPackBlobs   []IndexRebuildPackError `json:"failedPackBlobs"`
+
+	// Missing contains contents found in pack blobs that are not present in the committed index.
+	Missing []Info `json:"missing"`
+
+	// Extra contains committed contents which cannot be found in the pack blob they point to.
+	Extra []Info `json:"extra"`
+
+	// Conflicting contains committed contents found in their pack blob at a different offset or length.
+	Conflicting []IndexRebuildConflict `json:"conflicting"`
+
+	// Committed is true if a fresh set of index blobs has been written.
+	Committed            bool      `json:"committed"`
+	WrittenIndexBlobs    []blob.ID `json:"writtenIndexBlobs,omitempty"`
+	DeletedIndexBlobs    []blob.ID `json:"deletedIndexBlobs,omitempty"`
+	RebuiltIndexContents int       `json:"rebuiltIndexContents,omitempty"`
+}
+
+// HasDifferences returns true if the committed index differs from the contents of pack blobs.
+func (r *IndexRebuildReport) HasDifferences() bool {
+	return len(r.Missing) > 0 || len(r.Extra) > 0 || len(r.Conflicting) > 0
+}
+
+// recoveredPackIndexes holds index entries recovered from local indexes of pack blobs.
+type recoveredPackIndexes struct {
+	// byPack maps pack blob ID to content entries in that pack
+	byPack map[blob.ID]map[ID]Info
+
+	// latest maps content ID to the most recent entry for that content across all pack blobs.
+	latest map[ID]Info
+}
+
+// RebuildIndex scans local indexes of all pack blobs in parallel, compares the recovered entries against
+// the committed index and returns a report of missing, extra and conflicting entries.
+// When opt.Commit is set, all index blobs are replaced with a fresh index built from recovered entries,
+// preserving deletions recorded in the committed index.
+func (bm *Manager) RebuildIndex(ctx context.Context, opt IndexRebuildOptions) (*IndexRebuildReport, error) {
+	if opt.Commit && bm.disableIndexCompaction {
+		return nil, errors.Errorf("rebuilding indexes requires deleting index blobs, which is disabled")
+	}
+
+	bm.lock()
+	indexBlobs, _, err := bm.loadPackIndexesUnlocked(ctx)
+	bm.unlock()
+
+	if err != nil {
+		return nil, errors.Wrap(err, "error loading indexes")
+	}
+
+	committed := map[ID]Info{}
+
+	if err := bm.committedContents.listContents("", func(i Info) error {
+		committed[i.ID] = i
+		return nil
+	}); err != nil {
+		return nil, errors.Wrap(err, "error listing committed contents")
+	}
+
+	report := &IndexRebuildReport{
+		ContentsCommitted: len(committed),
+	}
+
+	rec, err := bm.recoverAllPackIndexes(ctx, opt.Parallel, report)
+	if err != nil {
+		return nil, err
+	}
+
+	compareRecoveredIndexes(committed, rec, report)
+
+	if !opt.Commit {
+		return report, nil
+	}
+
+	if len(report.FailedPackBlobs) > 0 {
+		return report, errors.Errorf("unable to commit rebuilt index, %v pack blobs could not be read", len(report.FailedPackBlobs))
+	}
+
+	if err := bm.commitRebuiltIndex(ctx, indexBlobs, committed, rec, report); err != nil {
+		return report, err
+	}
+
+	return report, nil
+}
+
+// recoverAllPackIndexes reads local indexes of all pack blobs using the provided number of parallel workers.
+func (bm *Manager) recoverAllPackIndexes(ctx context.Context, parallel int, report *IndexRebuildReport) (*recoveredPackIndexes, error) {
+	if parallel <= 0 {
+		parallel = defaultIndexRebuildParallelism
+	}
+
+	var packs []blob.Metadata
+
+	for _, prefix := range PackBlobIDPrefixes {
+		bms, err := blob.ListAllBlobs(ctx, bm.st, prefix)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error listing pack blobs with prefix %q", prefix)
+		}
+
+		packs = append(packs, bms...)
+	}
+
+	rec := &recoveredPackIndexes{
+		byPack: map[blob.ID]map[ID]Info{},
+		latest: map[ID]Info{},
+	}
+
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		work = make(chan blob.Metadata)
+	)
+
+	for i := 0; i < parallel; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for pb := range work {
+				infos, err := bm.RecoverIndexFromPackBlob(ctx, pb.BlobID, pb.Length, false)
+
+				mu.Lock()
+				if err != nil {
+					log.Warningf("unable to read local index of %v: %v", pb.BlobID, err)
+					report.FailedPackBlobs = append(report.FailedPackBlobs, IndexRebuildPackError{pb.BlobID, err.Error()})
+				} else {
+					rec.add(pb.BlobID, infos)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for _, pb := range packs {
+		work <- pb
+	}
+
+	close(work)
+	wg.Wait()
+
+	report.PackBlobsScanned = len(packs)
+	report.ContentsRecovered = len(rec.latest)
+
+	sort.Slice(report.FailedPackBlobs, func(i, j int) bool {
+		return report.FailedPackBlobs[i].BlobID < report.FailedPackBlobs[j].BlobID
+	})
+
+	return rec, nil
+}
+
+func (r *recoveredPackIndexes) add(packBlobID blob.ID, infos []Info) {
+	entries := map[ID]Info{}
+
+	for _, i := range infos {
+		// deletions are only meaningful in index blobs.
+		if i.Deleted {
+			continue
+		}
+
+		entries[i.ID] = i
+
+		if old, ok := r.latest[i.ID]; !ok || i.TimestampSeconds > old.TimestampSeconds {
+			r.latest[i.ID] = i
+		}
+	}
+
+	r.byPack[packBlobID] = entries
+}
+
+// compareRecoveredIndexes populates the report with differences between committed and recovered entries.
+func compareRecoveredIndexes(committed map[ID]Info, rec *recoveredPackIndexes, report *IndexRebuildReport) {
+	for id, ri := range rec.latest {
+		if _, ok := committed[id]; !ok {
+			report.Missing = append(report.Missing, ri)
+		}
+	}
+
+	for _, ci := range committed {
+		if ci.Deleted || ci.PackBlobID == "" {
+			continue
+		}
+
+		ri, ok := rec.byPack[ci.PackBlobID][ci.ID]
+		if !ok {
+			report.Extra = append(report.Extra, ci)
+			continue
+		}
+
+		if ri.PackOffset != ci.PackOffset || ri.Length != ci.Length {
+			report.Conflicting = append(report.Conflicting, IndexRebuildConflict{Committed: ci, Recovered: ri})
+		}
+	}
+
+	sort.Slice(report.Missing, func(i, j int) bool { return report.Missing[i].ID < report.Missing[j].ID })
+	sort.Slice(report.Extra, func(i, j int) bool { return report.Extra[i].ID < report.Extra[j].ID })
+	sort.Slice(report.Conflicting, func(i, j int) bool { return report.Conflicting[i].Committed.ID < report.Conflicting[j].Committed.ID })
+}
+
+// commitRebuiltIndex writes a single index blob containing entries recovered from pack blobs and deletes
+// the provided old index blobs.
+func (bm *Manager) commitRebuiltIndex(ctx context.Context, oldIndexBlobs []IndexBlobInfo, committed map[ID]Info, rec *recoveredPackIndexes, report *IndexRebuildReport) error {
+	bld := make(packIndexBuilder)
+
+	for id, ri := range rec.latest {
+		ci, ok := committed[id]
+		if ok && ci.Deleted && ci.TimestampSeconds >= ri.TimestampSeconds {
+			// preserve deletion, but point it at the pack blob which has the content.
+			ri.Deleted = true
+			ri.TimestampSeconds = ci.TimestampSeconds
+		}
+
+		bld.Add(ri)
+	}
+
+	var buf bytes.Buffer
+	if err := bld.Build(&buf, bm.indexVersion); err != nil {
+		return errors.Wrap(err, "unable to build rebuilt index")
+	}
+
+	bm.lock()
+	defer bm.unlock()
+
+	newIndexBlob, err := bm.writePackIndexesNew(ctx, buf.Bytes())
+	if err != nil {
+		return errors.Wrap(err, "unable to write rebuilt index")
+	}
+
+	report.Committed = true
+	report.RebuiltIndexContents = len(bld)
+	report.WrittenIndexBlobs = append(report.WrittenIndexBlobs, newIndexBlob)
+
+	for _, ib := range oldIndexBlobs {
+		if ib.BlobID == newIndexBlob {
+			continue
+		}
+
+		bm.listCache.deleteListCache()
+
+		if err := bm.st.DeleteBlob(ctx, ib.BlobID); err != nil && err != blob.ErrBlobNotFound {
+			return errors.Wrapf(err, "unable to delete old index blob %v", ib.BlobID)
+		}
+
+		report.DeletedIndexBlobs = append(report.DeletedIndexBlobs, ib.BlobID)
+	}
+
+	if _, _, err := bm.loadPackIndexesUnlocked(ctx); err != nil {
+		return errors.Wrap(err, "error reloading indexes")
+	}
+
+	return nil
+}
@@ -0,0 +1,133 @@
+package content
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kopia/kopia/internal/blobtesting"
+	"github.com/kopia/kopia/repo/blob"
+)
+
+func TestRebuildIndex(t *testing.T) {
+	ctx := context.Background()
+	data := blobtesting.DataMap{}
+	keyTime := map[blob.ID]time.Time{}
+	bm := newTestContentManager(data, keyTime, nil)
+
+	content1 := writeContentAndVerify(ctx, t, bm, seededRandomData(10, 100))
+	content2 := writeContentAndVerify(ctx, t, bm, seededRandomData(11, 100))
+	assertNoError(t, bm.Flush(ctx))
+
+	content3 := writeContentAndVerify(ctx, t, bm, seededRandomData(12, 100))
+	assertNoError(t, bm.Flush(ctx))
+
+	assertNoError(t, bm.DeleteContent(content2))
+	assertNoError(t, bm.Flush(ctx))
+
+	// consistent repository
+	report, err := bm.RebuildIndex(ctx, IndexRebuildOptions{})
+	assertNoError(t, err)
+
+	if report.HasDifferences() {
+		t.Errorf("unexpected differences: %+v", report)
+	}
+
+	if got, want := report.PackBlobsScanned, 2; got != want {
+		t.Errorf("unexpected number of scanned packs: %v, want %v", got, want)
+	}
+
+	// commit fresh index, which preserves deletions
+	report, err = bm.RebuildIndex(ctx, IndexRebuildOptions{Commit: true})
+	assertNoError(t, err)
+
+	if !report.Committed || len(report.WrittenIndexBlobs) != 1 || len(report.DeletedIndexBlobs) == 0 {
+		t.Errorf("unexpected commit report: %+v", report)
+	}
+
+	indexBlobs, err := blob.ListAllBlobs(ctx, bm.st, newIndexBlobPrefix)
+	assertNoError(t, err)
+
+	if got, want := len(indexBlobs), 1; got != want {
+		t.Errorf("unexpected number of index blobs: %v, want %v", got, want)
+	}
+
+	bm = newTestContentManager(data, keyTime, nil)
+	verifyContent(ctx, t, bm, content1, seededRandomData(10, 100))
+	verifyContentNotFound(ctx, t, bm, content2)
+	verifyContent(ctx, t, bm, content3, seededRandomData(12, 100))
+
+	// remove the pack holding content3, which makes its index entry extra
+	ci3, err := bm.ContentInfo(ctx, content3)
+	assertNoError(t, err)
+	assertNoError(t, bm.st.DeleteBlob(ctx, ci3.PackBlobID))
+
+	report, err = bm.RebuildIndex(ctx, IndexRebuildOptions{Parallel: 1})
+	assertNoError(t, err)
+
+	if len(report.Extra) != 1 || report.Extra[0].ID != content3 || len(report.Missing) != 0 || len(report.Conflicting) != 0 {
+		t.Errorf("unexpected report: %+v", report)
+	}
+
+	_, err = bm.RebuildIndex(ctx, IndexRebuildOptions{Commit: true})
+	assertNoError(t, err)
+
+	bm = newTestContentManager(data, keyTime, nil)
+	verifyContent(ctx, t, bm, content1, seededRandomData(10, 100))
+	verifyContentNotFound(ctx, t, bm, content3)
+
+	// with index blobs gone, all contents in packs are missing
+	assertNoError(t, bm.st.ListBlobs(ctx, newIndexBlobPrefix, func(bi blob.Metadata) error {
+		return bm.st.DeleteBlob(ctx, bi.BlobID)
+	}))
+
+	bm = newTestContentManager(data, keyTime, nil)
+
+	report, err = bm.RebuildIndex(ctx, IndexRebuildOptions{})
+	assertNoError(t, err)
+
+	if len(report.Missing) != 2 || len(report.Extra) != 0 {
+		t.Errorf("unexpected report: %+v", report)
+	}
+
+	_, err = bm.RebuildIndex(ctx, IndexRebuildOptions{Commit: true})
+	assertNoError(t, err)
+
+	bm = newTestContentManager(data, keyTime, nil)
+	verifyContent(ctx, t, bm, content1, seededRandomData(10, 100))
+	verifyContent(ctx, t, bm, content2, seededRandomData(11, 100))
+}
+
+func TestRebuildIndexConflicting(t *testing.T) {
+	ctx := context.Background()
+	data := blobtesting.DataMap{}
+	keyTime := map[blob.ID]time.Time{}
+	bm := newTestContentManager(data, keyTime, nil)
+
+	content1 := writeContentAndVerify(ctx, t, bm, seededRandomData(10, 100))
+	assertNoError(t, bm.Flush(ctx))
+
+	ci, err := bm.ContentInfo(ctx, content1)
+	assertNoError(t, err)
+
+	// commit an index entry with incorrect offset
+	ci.PackOffset++
+	ci.TimestampSeconds++
+	bm.packIndexBuilder.Add(ci)
+	assertNoError(t, bm.Flush(ctx))
+
+	bm = newTestContentManager(data, keyTime, nil)
+
+	report, err := bm.RebuildIndex(ctx, IndexRebuildOptions{})
+	assertNoError(t, err)
+
+	if len(report.Conflicting) != 1 || report.Conflicting[0].Committed.PackOffset != report.Conflicting[0].Recovered.PackOffset+1 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+
+	_, err = bm.RebuildIndex(ctx, IndexRebuildOptions{Commit: true})
+	assertNoError(t, err)
+
+	bm = newTestContentManager(data, keyTime, nil)
+	verifyContent(ctx, t, bm, content1, seededRandomData(10, 100))
+}
@@ -159,7 +159,7 @@ func decodePostamble(payload []byte) *packContentPostamble {
 
 func (bm *lockFreeManager) buildLocalIndex(pending packIndexBuilder) ([]byte, error) {
 	var buf bytes.Buffer
-	if err := pending.Build(&buf); err != nil {
+	if err := pending.Build(&buf, bm.indexVersion); err != nil {
 		return nil, errors.Wrap(err, "unable to build local index")
 	}
 
@@ -219,6 +219,12 @@ func (bm *lockFreeManager) readPackFileLocalIndex(ctx context.Context, packFile
 		return nil, err
 	}
 
+	// erasure coding is detected from the pack blob, which may have been written before it was disabled.
+	payload, _, err = eccDecode(payload)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to decode pack file %v", packFile)
+	}
+
 	postamble := findPostamble(payload)
 	if postamble == nil {
 		return nil, errors.Errorf("unable to find valid postamble in file %v", packFile)
@@ -234,7 +240,7 @@ func (bm *lockFreeManager) readPackFileLocalIndex(ctx context.Context, packFile
 		return nil, errors.Errorf("unable to find valid local index in file %v", packFile)
 	}
 
-	localIndexBytes, err := bm.decryptAndVerify(encryptedLocalIndexBytes, postamble.localIndexIV)
+	localIndexBytes, err := bm.decryptWithAnyKey(encryptedLocalIndexBytes, postamble.localIndexIV)
 	if err != nil {
 		return nil, errors.Wrap(err, "unable to decrypt local index")
 	}
@@ -0,0 +1,116 @@
+package content
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo/compression"
+)
+
+// RotateMasterKey replaces the master key with the provided one and retires the current key, which remains
+// available to decrypt existing contents and index blobs. Contents written afterwards are encrypted with the
+// new key, whose generation is recorded for each content in the index.
+func (o *FormattingOptions) RotateMasterKey(newKey []byte) error {
+	if o.Encryption == "NONE" {
+		return errors.Errorf("repository is not encrypted")
+	}
+
+	if o.IndexVersion < IndexVersion2 {
+		return errors.Errorf("key rotation requires index format v%v, upgrade the repository", IndexVersion2)
+	}
+
+	if o.EncryptionKeyID == math.MaxUint8 {
+		return errors.Errorf("maximum number of key rotations reached")
+	}
+
+	if len(newKey) != len(o.MasterKey) {
+		return errors.Errorf("invalid master key length %v, expected %v", len(newKey), len(o.MasterKey))
+	}
+
+	if o.RetiredMasterKeys == nil {
+		o.RetiredMasterKeys = map[byte][]byte{}
+	}
+
+	o.RetiredMasterKeys[o.EncryptionKeyID] = o.MasterKey
+	o.MasterKey = newKey
+	o.EncryptionKeyID++
+
+	// clients that don't know about retired keys can't read contents encrypted with the new key.
+	if v := o.RequiredVersion(); o.Version < v {
+		o.Version = v
+	}
+
+	return nil
+}
+
+// createRetiredEncryptors returns encryptors for master keys of previous generations.
+func createRetiredEncryptors(f *FormattingOptions) (map[byte]Encryptor, error) {
+	result := map[byte]Encryptor{}
+
+	for keyID, key := range f.RetiredMasterKeys {
+		retired := *f
+		retired.MasterKey = key
+
+		e, err := createEncryptor(&retired)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to create encryptor for retired key %v", keyID)
+		}
+
+		result[keyID] = e
+	}
+
+	return result, nil
+}
+
+// encryptorForKeyID returns the encryptor for the master key of the provided generation.
+func (bm *lockFreeManager) encryptorForKeyID(keyID byte) (Encryptor, error) {
+	if keyID == bm.Format.EncryptionKeyID {
+		return bm.encryptor, nil
+	}
+
+	if e := bm.retiredEncryptors[keyID]; e != nil {
+		return e, nil
+	}
+
+	return nil, errors.Errorf("unknown encryption key %v", keyID)
+}
+
+// decryptWithAnyKey decrypts and verifies data whose key generation is not recorded, such as index blobs,
+// trying the current master key first, followed by retired keys from the most recent one.
+func (bm *lockFreeManager) decryptWithAnyKey(encrypted, iv []byte) ([]byte, error) {
+	decrypted, err := bm.decryptAndVerify(encrypted, iv, compression.NoCompression, bm.Format.EncryptionKeyID)
+	if err == nil {
+		return decrypted, nil
+	}
+
+	var keyIDs []byte
+	for keyID := range bm.retiredEncryptors {
+		keyIDs = append(keyIDs, keyID)
+	}
+
+	sort.Slice(keyIDs, func(i, j int) bool {
+		return keyIDs[i] > keyIDs[j]
+	})
+
+	for _, keyID := range keyIDs {
+		if d, rerr := bm.decryptAndVerify(encrypted, iv, compression.NoCompression, keyID); rerr == nil {
+			return d, nil
+		}
+	}
+
+	return nil, err
+}
+
+// contentCacheKey returns the cache key of a content encrypted with the master key of the provided generation.
+// Keys of contents encrypted with rotated keys include the generation, so that cached data is not used
+// after the content is re-encrypted.
+func contentCacheKey(contentID ID, keyID byte) cacheKey {
+	if keyID == 0 {
+		return cacheKey(contentID)
+	}
+
+	return cacheKey(fmt.Sprintf("%v%02x", contentID, keyID))
+}
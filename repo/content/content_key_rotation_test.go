@@ -0,0 +1,51 @@
+package content
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRotateMasterKey(t *testing.T) {
+	f := &FormattingOptions{
+		Hash:         DefaultHash,
+		Encryption:   DefaultEncryption,
+		MasterKey:    bytes.Repeat([]byte{1}, 32),
+		IndexVersion: IndexVersion2,
+	}
+
+	if err := f.RotateMasterKey([]byte{1, 2, 3}); err == nil {
+		t.Errorf("unexpected success rotating to key of invalid length")
+	}
+
+	assertNoError(t, f.RotateMasterKey(bytes.Repeat([]byte{2}, 32)))
+	assertNoError(t, f.RotateMasterKey(bytes.Repeat([]byte{3}, 32)))
+
+	if got, want := f.EncryptionKeyID, byte(2); got != want {
+		t.Errorf("unexpected key ID %v, want %v", got, want)
+	}
+
+	if !bytes.Equal(f.MasterKey, bytes.Repeat([]byte{3}, 32)) {
+		t.Errorf("unexpected master key")
+	}
+
+	if len(f.RetiredMasterKeys) != 2 || !bytes.Equal(f.RetiredMasterKeys[0], bytes.Repeat([]byte{1}, 32)) || !bytes.Equal(f.RetiredMasterKeys[1], bytes.Repeat([]byte{2}, 32)) {
+		t.Errorf("unexpected retired keys: %v", f.RetiredMasterKeys)
+	}
+
+	retired, err := createRetiredEncryptors(f)
+	assertNoError(t, err)
+
+	if len(retired) != 2 {
+		t.Errorf("unexpected number of retired encryptors: %v", len(retired))
+	}
+
+	unencrypted := &FormattingOptions{Encryption: "NONE", MasterKey: bytes.Repeat([]byte{1}, 32), IndexVersion: IndexVersion2}
+	if err := unencrypted.RotateMasterKey(bytes.Repeat([]byte{2}, 32)); err == nil {
+		t.Errorf("unexpected success rotating key of unencrypted repository")
+	}
+
+	v1 := &FormattingOptions{Encryption: DefaultEncryption, MasterKey: bytes.Repeat([]byte{1}, 32)}
+	if err := v1.RotateMasterKey(bytes.Repeat([]byte{2}, 32)); err == nil {
+		t.Errorf("unexpected success rotating key with index format v1")
+	}
+}
@@ -15,6 +15,7 @@ import (
 
 	"github.com/kopia/kopia/internal/repologging"
 	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/compression"
 )
 
 var (
@@ -42,13 +43,13 @@ const (
 	defaultMaxPreambleLength = 32
 	defaultPaddingUnit       = 4096
 
-	currentWriteVersion = 1
+	currentWriteVersion = 1 // format version of content entries written to pack indexes
 
-	minSupportedWriteVersion = 1
-	maxSupportedWriteVersion = currentWriteVersion
+	minSupportedWriteVersion = FormatVersion1
+	maxSupportedWriteVersion = FormatVersion2
 
-	minSupportedReadVersion = 1
-	maxSupportedReadVersion = currentWriteVersion
+	minSupportedReadVersion = FormatVersion1
+	maxSupportedReadVersion = FormatVersion2
 
 	indexLoadAttempts = 10
 )
@@ -78,6 +79,13 @@ type Manager struct {
 	flushPackIndexesAfter  time.Time // time when those indexes should be flushed
 	closed                 chan struct{}
 
+	sessionID              string           // current write session, empty if none
+	sessionIndexBuilder    packIndexBuilder // contents in packs written during the session, not yet in session index blobs
+	sessionIndexBlobs      []blob.ID        // session index blobs written since indexes were last flushed
+	flushSessionIndexAfter time.Time        // time when session index should be flushed
+
+	pendingDeletion map[ID]bool // contents pending deletion by garbage collection, which are written again instead of being reused
+
 	lockFreeManager
 }
 
@@ -93,10 +101,16 @@ type pendingPackInfo struct {
 // should ever be deleted. That means that contents of such contents should include some element
 // of randomness or a contemporaneous timestamp that will never reappear.
 func (bm *Manager) DeleteContent(contentID ID) error {
+	return bm.DeleteContentAsOf(contentID, bm.timeNow())
+}
+
+// DeleteContentAsOf marks the given contentID as deleted with the provided deletion time.
+// Copies of the content written by other clients after that time take precedence over the deletion.
+func (bm *Manager) DeleteContentAsOf(contentID ID, t time.Time) error {
 	bm.lock()
 	defer bm.unlock()
 
-	log.Debugf("DeleteContent(%q)", contentID)
+	log.Debugf("DeleteContentAsOf(%q, %v)", contentID, t)
 
 	// remove from all pending packs
 	for _, pp := range bm.pendingPacks {
@@ -109,14 +123,14 @@ func (bm *Manager) DeleteContent(contentID ID) error {
 	// remove from all packs that are being written, since they will be committed to index soon
 	for _, pp := range bm.writingPacks {
 		if bi, ok := pp.currentPackItems[contentID]; ok && !bi.Deleted {
-			bm.deletePreexistingContent(bi)
+			bm.deletePreexistingContent(bi, t)
 			return nil
 		}
 	}
 
 	// if found in committed index, add another entry that's marked for deletion
 	if bi, ok := bm.packIndexBuilder[contentID]; ok {
-		bm.deletePreexistingContent(*bi)
+		bm.deletePreexistingContent(*bi, t)
 		return nil
 	}
 
@@ -126,27 +140,32 @@ func (bm *Manager) DeleteContent(contentID ID) error {
 		return err
 	}
 
-	bm.deletePreexistingContent(bi)
+	bm.deletePreexistingContent(bi, t)
 
 	return nil
 }
 
 // Intentionally passing bi by value.
 // nolint:gocritic
-func (bm *Manager) deletePreexistingContent(ci Info) {
+func (bm *Manager) deletePreexistingContent(ci Info, t time.Time) {
 	if ci.Deleted {
 		return
 	}
 
 	pp := bm.getOrCreatePendingPackInfoLocked(packPrefixForContentID(ci.ID))
 	ci.Deleted = true
-	ci.TimestampSeconds = bm.timeNow().Unix()
+	ci.TimestampSeconds = t.Unix()
 	pp.currentPackItems[ci.ID] = ci
 }
 
-func (bm *Manager) addToPackUnlocked(ctx context.Context, contentID ID, data []byte, isDeleted bool) error {
+func (bm *Manager) addToPackUnlocked(ctx context.Context, contentID ID, data []byte, isDeleted bool, comp compression.HeaderID, minTimestampSeconds int64) error {
 	prefix := packPrefixForContentID(contentID)
 
+	data, comp, originalLength, err := maybeCompressContent(data, comp)
+	if err != nil {
+		return errors.Wrapf(err, "unable to compress %v", contentID)
+	}
+
 	data = cloneBytes(data)
 
 	bm.lock()
@@ -177,14 +196,29 @@ func (bm *Manager) addToPackUnlocked(ctx context.Context, contentID ID, data []b
 		}
 	}
 
+	if bm.sessionID != "" && bm.timeNow().After(bm.flushSessionIndexAfter) {
+		if err := bm.flushSessionIndexLocked(ctx); err != nil {
+			bm.unlock()
+			return err
+		}
+	}
+
+	ts := bm.timeNow().Unix()
+	if ts < minTimestampSeconds {
+		ts = minTimestampSeconds
+	}
+
 	pp := bm.getOrCreatePendingPackInfoLocked(prefix)
 	pp.currentPackDataLength += len(data)
 	pp.currentPackItems[contentID] = Info{
 		Deleted:          isDeleted,
 		ID:               contentID,
 		Payload:          data,
-		Length:           uint32(len(data)),
-		TimestampSeconds: bm.timeNow().Unix(),
+		Length:           uint64(len(data)),
+		TimestampSeconds: ts,
+
+		CompressionHeaderID: comp,
+		OriginalLength:      originalLength,
 	}
 
 	shouldWrite := pp.currentPackDataLength >= bm.maxPackSize
@@ -286,7 +320,7 @@ func (bm *Manager) flushPackIndexesLocked(ctx context.Context) error {
 	if len(bm.packIndexBuilder) > 0 {
 		var buf bytes.Buffer
 
-		if err := bm.packIndexBuilder.Build(&buf); err != nil {
+		if err := bm.packIndexBuilder.Build(&buf, bm.indexVersion); err != nil {
 			return errors.Wrap(err, "unable to build pack index")
 		}
 
@@ -305,6 +339,9 @@ func (bm *Manager) flushPackIndexesLocked(ctx context.Context) error {
 		bm.packIndexBuilder = make(packIndexBuilder)
 	}
 
+	// all contents in session index blobs are now committed.
+	bm.deleteSessionIndexBlobsLocked(ctx)
+
 	bm.flushPackIndexesAfter = bm.timeNow().Add(flushPackIndexTimeout)
 
 	return nil
@@ -343,6 +380,10 @@ func (bm *Manager) writePackAndAddToIndex(ctx context.Context, pp *pendingPackIn
 		// success, add pack index builder entries to index.
 		for _, info := range packFileIndex {
 			bm.packIndexBuilder.Add(*info)
+
+			if bm.sessionID != "" {
+				bm.sessionIndexBuilder.Add(*info)
+			}
 		}
 
 		return nil
@@ -447,7 +488,8 @@ func (bm *Manager) RewriteContent(ctx context.Context, contentID ID) error {
 		return err
 	}
 
-	return bm.addToPackUnlocked(ctx, contentID, data, bi.Deleted)
+	// the rewritten content must supersede the existing one, even when rewritten within the same second.
+	return bm.addToPackUnlocked(ctx, contentID, data, bi.Deleted, bi.CompressionHeaderID, bi.TimestampSeconds+1)
 }
 
 func packPrefixForContentID(contentID ID) blob.ID {
@@ -469,27 +511,65 @@ func (bm *Manager) getOrCreatePendingPackInfoLocked(prefix blob.ID) *pendingPack
 	return bm.pendingPacks[prefix]
 }
 
+// SupportsContentCompression returns true if the repository format allows compressing individual contents.
+func (bm *Manager) SupportsContentCompression() bool {
+	return bm.indexVersion >= IndexVersion2
+}
+
 // WriteContent saves a given content of data to a pack group with a provided name and returns a contentID
-// that's based on the contents of data written.
-func (bm *Manager) WriteContent(ctx context.Context, data []byte, prefix ID) (ID, error) {
+// that's based on the contents of data written. Unless comp is compression.NoCompression, the data is
+// compressed using the specified compressor before being stored, which does not affect the content ID.
+func (bm *Manager) WriteContent(ctx context.Context, data []byte, prefix ID, comp compression.HeaderID) (ID, error) {
 	if err := validatePrefix(prefix); err != nil {
 		return "", err
 	}
 
+	if comp != compression.NoCompression && !bm.SupportsContentCompression() {
+		return "", errors.Errorf("content compression requires index format v%v, upgrade the repository", IndexVersion2)
+	}
+
 	contentID := prefix + ID(hex.EncodeToString(bm.hashData(data)))
 
 	// content already tracked
 	if bi, err := bm.getContentInfo(contentID); err == nil {
-		if !bi.Deleted {
+		if !bi.Deleted && !bm.takePendingDeletion(contentID) {
 			return contentID, nil
 		}
 	}
 
-	err := bm.addToPackUnlocked(ctx, contentID, data, false)
+	err := bm.addToPackUnlocked(ctx, contentID, data, false, comp, 0)
 
 	return contentID, err
 }
 
+// SetPendingDeletion sets the contents that garbage collection may delete, which are written again with
+// a new timestamp instead of being reused by WriteContent.
+func (bm *Manager) SetPendingDeletion(ids []ID) {
+	pending := map[ID]bool{}
+	for _, cid := range ids {
+		pending[cid] = true
+	}
+
+	bm.lock()
+	bm.pendingDeletion = pending
+	bm.unlock()
+}
+
+// takePendingDeletion returns true if the provided content is pending deletion and needs to be written again.
+// Subsequent calls for the same content return false.
+func (bm *Manager) takePendingDeletion(contentID ID) bool {
+	bm.lock()
+	defer bm.unlock()
+
+	if !bm.pendingDeletion[contentID] {
+		return false
+	}
+
+	delete(bm.pendingDeletion, contentID)
+
+	return true
+}
+
 // GetContent gets the contents of a given content. If the content is not found returns ErrContentNotFound.
 func (bm *Manager) GetContent(ctx context.Context, contentID ID) ([]byte, error) {
 	bi, err := bm.getContentInfo(contentID)
@@ -576,25 +656,51 @@ func (bm *Manager) Refresh(ctx context.Context) (bool, error) {
 	return updated, err
 }
 
+// ManagerOptions specifies optional behavior of content manager.
+type ManagerOptions struct {
+	// DisableIndexCompaction prevents compaction of index blobs, which requires deleting them.
+	// It must be set when the underlying storage does not allow deletions.
+	DisableIndexCompaction bool
+}
+
 // NewManager creates new content manager with given packing options and a formatter.
-func NewManager(ctx context.Context, st blob.Storage, f *FormattingOptions, caching CachingOptions, repositoryFormatBytes []byte) (*Manager, error) {
-	return newManagerWithOptions(ctx, st, f, caching, time.Now, repositoryFormatBytes)
+func NewManager(ctx context.Context, st blob.Storage, f *FormattingOptions, caching CachingOptions, repositoryFormatBytes []byte, opts ManagerOptions) (*Manager, error) {
+	return newManagerWithOptions(ctx, st, f, caching, time.Now, repositoryFormatBytes, opts)
 }
 
-func newManagerWithOptions(ctx context.Context, st blob.Storage, f *FormattingOptions, caching CachingOptions, timeNow func() time.Time, repositoryFormatBytes []byte) (*Manager, error) {
-	if f.Version < minSupportedReadVersion || f.Version > currentWriteVersion {
+func newManagerWithOptions(ctx context.Context, st blob.Storage, f *FormattingOptions, caching CachingOptions, timeNow func() time.Time, repositoryFormatBytes []byte, opts ManagerOptions) (*Manager, error) {
+	if f.Version < minSupportedReadVersion || f.Version > maxSupportedReadVersion {
 		return nil, errors.Errorf("can't handle repositories created using version %v (min supported %v, max supported %v)", f.Version, minSupportedReadVersion, maxSupportedReadVersion)
 	}
 
-	if f.Version < minSupportedWriteVersion || f.Version > currentWriteVersion {
+	if f.Version < minSupportedWriteVersion || f.Version > maxSupportedWriteVersion {
 		return nil, errors.Errorf("can't handle repositories created using version %v (min supported %v, max supported %v)", f.Version, minSupportedWriteVersion, maxSupportedWriteVersion)
 	}
 
+	indexVersion := f.IndexVersion
+	if indexVersion == 0 {
+		indexVersion = IndexVersion1
+	}
+
+	if indexVersion < IndexVersion1 || indexVersion > IndexVersion2 {
+		return nil, errors.Errorf("can't handle repositories using index version %v (min supported %v, max supported %v)", indexVersion, IndexVersion1, IndexVersion2)
+	}
+
 	hasher, encryptor, err := CreateHashAndEncryptor(f)
 	if err != nil {
 		return nil, err
 	}
 
+	retiredEncryptors, err := createRetiredEncryptors(f)
+	if err != nil {
+		return nil, err
+	}
+
+	ecc, err := parseECCScheme(f.ECC)
+	if err != nil {
+		return nil, err
+	}
+
 	contentCache, err := newContentCache(ctx, st, caching, caching.MaxCacheSizeBytes, "contents")
 	if err != nil {
 		return nil, errors.Wrap(err, "unable to initialize content cache")
@@ -625,6 +731,8 @@ func newManagerWithOptions(ctx context.Context, st blob.Storage, f *FormattingOp
 			timeNow:                 timeNow,
 			maxPackSize:             f.MaxPackSize,
 			encryptor:               encryptor,
+			retiredEncryptors:       retiredEncryptors,
+			ecc:                     ecc,
 			hasher:                  hasher,
 			minPreambleLength:       defaultMinPreambleLength,
 			maxPreambleLength:       defaultMaxPreambleLength,
@@ -635,8 +743,10 @@ func newManagerWithOptions(ctx context.Context, st blob.Storage, f *FormattingOp
 			st:                      st,
 			repositoryFormatBytes:   repositoryFormatBytes,
 			checkInvariantsOnUnlock: os.Getenv("KOPIA_VERIFY_INVARIANTS") != "",
-			writeFormatVersion:      int32(f.Version),
+			writeFormatVersion:      currentWriteVersion,
+			indexVersion:            indexVersion,
 			committedContents:       contentIndex,
+			disableIndexCompaction:  opts.DisableIndexCompaction,
 		},
 
 		mu:   mu,
@@ -645,9 +755,19 @@ func newManagerWithOptions(ctx context.Context, st blob.Storage, f *FormattingOp
 		flushPackIndexesAfter: timeNow().Add(flushPackIndexTimeout),
 		pendingPacks:          map[blob.ID]*pendingPackInfo{},
 		packIndexBuilder:      make(packIndexBuilder),
+		sessionIndexBuilder:   make(packIndexBuilder),
 		closed:                make(chan struct{}),
 	}
 
+	if opts.DisableIndexCompaction {
+		// compaction would have loaded the indexes, so we need to do it explicitly.
+		if _, _, err := m.loadPackIndexesUnlocked(ctx); err != nil {
+			return nil, errors.Wrap(err, "error loading indexes")
+		}
+
+		return m, nil
+	}
+
 	if err := m.CompactIndexes(ctx, autoCompactionOptions); err != nil {
 		return nil, errors.Wrap(err, "error initializing content manager")
 	}
@@ -239,6 +239,23 @@ func (bm *Manager) IterateUnreferencedBlobs(ctx context.Context, parallellism in
 		return errors.Wrap(err, "error iterating packs")
 	}
 
+	// packs written by incomplete write sessions are in use until they are adopted.
+	sessionIndexes, err := bm.listSessionIndexBlobs(ctx, "")
+	if err != nil {
+		return err
+	}
+
+	for _, si := range sessionIndexes {
+		infos, err := bm.readSessionIndex(ctx, si.BlobID)
+		if err != nil {
+			return err
+		}
+
+		for _, i := range infos {
+			usedPacks[i.PackBlobID] = true
+		}
+	}
+
 	log.Infof("found %v pack blobs in use", len(usedPacks))
 
 	unusedCount := 0
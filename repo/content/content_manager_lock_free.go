@@ -15,7 +15,9 @@ import (
 
 	"github.com/pkg/errors"
 
+	"github.com/kopia/kopia/internal/reedsolomon"
 	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/compression"
 )
 
 // lockFreeManager contains parts of Manager state that can be accessed without locking
@@ -33,12 +35,16 @@ type lockFreeManager struct {
 	committedContents *committedContentIndex
 
 	checkInvariantsOnUnlock bool
+	disableIndexCompaction  bool
 
 	writeFormatVersion int32 // format version to write
+	indexVersion       int   // pack index format version to write
 
 	maxPackSize       int
 	hasher            HashFunc
 	encryptor         Encryptor
+	retiredEncryptors map[byte]Encryptor   // encryptors for master keys of previous generations
+	ecc               *reedsolomon.Encoder // erasure coding of new pack blobs, nil if disabled
 	minPreambleLength int
 	maxPreambleLength int
 	paddingUnit       int
@@ -210,10 +216,10 @@ func (bm *lockFreeManager) getCacheForContentID(id ID) *contentCache {
 
 func (bm *lockFreeManager) getContentDataUnlocked(ctx context.Context, bi *Info) ([]byte, error) {
 	if bi.Payload != nil {
-		return cloneBytes(bi.Payload), nil
+		return decompressContent(cloneBytes(bi.Payload), bi.CompressionHeaderID)
 	}
 
-	payload, err := bm.getCacheForContentID(bi.ID).getContent(ctx, cacheKey(bi.ID), bi.PackBlobID, int64(bi.PackOffset), int64(bi.Length))
+	payload, err := bm.getCacheForContentID(bi.ID).getContent(ctx, contentCacheKey(bi.ID, bi.EncryptionKeyID), bi.PackBlobID, int64(bi.PackOffset), int64(bi.Length))
 	if err != nil {
 		return nil, err
 	}
@@ -226,23 +232,43 @@ func (bm *lockFreeManager) getContentDataUnlocked(ctx context.Context, bi *Info)
 		return nil, err
 	}
 
-	decrypted, err := bm.decryptAndVerify(payload, iv)
+	decrypted, err := bm.decryptAndVerify(payload, iv, bi.CompressionHeaderID, bi.EncryptionKeyID)
 	if err != nil {
+		// try reconstructing corrupted data using erasure coding parity, if present.
+		if repaired, rerr := bm.readRepairedPackRange(ctx, bi.PackBlobID, int64(bi.PackOffset), int64(bi.Length)); rerr == nil {
+			if decrypted, rerr = bm.decryptAndVerify(repaired, iv, bi.CompressionHeaderID, bi.EncryptionKeyID); rerr == nil {
+				return decrypted, nil
+			}
+		}
+
 		return nil, errors.Wrapf(err, "invalid checksum at %v offset %v length %v", bi.PackBlobID, bi.PackOffset, len(payload))
 	}
 
 	return decrypted, nil
 }
 
-func (bm *lockFreeManager) decryptAndVerify(encrypted, iv []byte) ([]byte, error) {
-	decrypted, err := bm.encryptor.Decrypt(encrypted, iv)
+// decryptAndVerify decrypts the provided data using the master key of the provided generation, decompresses it
+// and verifies that it matches the provided IV.
+func (bm *lockFreeManager) decryptAndVerify(encrypted, iv []byte, comp compression.HeaderID, keyID byte) ([]byte, error) {
+	e, err := bm.encryptorForKeyID(keyID)
+	if err != nil {
+		return nil, err
+	}
+
+	decrypted, err := e.Decrypt(encrypted, iv)
 	if err != nil {
 		return nil, errors.Wrap(err, "decrypt")
 	}
 
 	atomic.AddInt64(&bm.stats.DecryptedBytes, int64(len(decrypted)))
 
-	if bm.encryptor.IsAuthenticated() {
+	// the IV is derived from uncompressed data, so checksum must be verified after decompression.
+	decrypted, err = decompressContent(decrypted, comp)
+	if err != nil {
+		return nil, err
+	}
+
+	if e.IsAuthenticated() {
 		// already verified
 		return decrypted, nil
 	}
@@ -286,13 +312,17 @@ func (bm *lockFreeManager) preparePackDataContent(ctx context.Context, pp *pendi
 			Deleted:          info.Deleted,
 			FormatVersion:    byte(bm.writeFormatVersion),
 			PackBlobID:       packFile,
-			PackOffset:       uint32(len(contentData)),
-			Length:           uint32(len(encrypted)),
+			PackOffset:       uint64(len(contentData)),
+			Length:           uint64(len(encrypted)),
 			TimestampSeconds: info.TimestampSeconds,
+
+			CompressionHeaderID: info.CompressionHeaderID,
+			OriginalLength:      info.OriginalLength,
+			EncryptionKeyID:     bm.Format.EncryptionKeyID,
 		})
 
 		if contentID.HasPrefix() {
-			bm.metadataCache.put(ctx, cacheKey(contentID), cloneBytes(encrypted))
+			bm.metadataCache.put(ctx, contentCacheKey(contentID, bm.Format.EncryptionKeyID), cloneBytes(encrypted))
 		}
 
 		contentData = append(contentData, encrypted...)
@@ -342,20 +372,8 @@ func (bm *lockFreeManager) getIndexBlobInternal(ctx context.Context, blobID blob
 	atomic.AddInt32(&bm.stats.ReadContents, 1)
 	atomic.AddInt64(&bm.stats.ReadBytes, int64(len(payload)))
 
-	payload, err = bm.encryptor.Decrypt(payload, iv)
-	atomic.AddInt64(&bm.stats.DecryptedBytes, int64(len(payload)))
-
-	if err != nil {
-		return nil, err
-	}
-
-	// Since the encryption key is a function of data, we must be able to generate exactly the same key
-	// after decrypting the content. This serves as a checksum.
-	if err := bm.verifyChecksum(payload, iv); err != nil {
-		return nil, err
-	}
-
-	return payload, nil
+	// index blobs written before key rotation remain encrypted with retired keys until they are compacted.
+	return bm.decryptWithAnyKey(payload, iv)
 }
 
 func getPackedContentIV(contentID ID) ([]byte, error) {
@@ -371,6 +389,15 @@ func getIndexBlobIV(s blob.ID) ([]byte, error) {
 }
 
 func (bm *lockFreeManager) writePackFileNotLocked(ctx context.Context, packFile blob.ID, data []byte) error {
+	if bm.ecc != nil {
+		encoded, err := eccEncode(data, bm.ecc)
+		if err != nil {
+			return err
+		}
+
+		data = encoded
+	}
+
 	atomic.AddInt32(&bm.stats.WrittenContents, 1)
 	atomic.AddInt64(&bm.stats.WrittenBytes, int64(len(data)))
 	bm.listCache.deleteListCache()
@@ -378,9 +405,9 @@ func (bm *lockFreeManager) writePackFileNotLocked(ctx context.Context, packFile
 	return bm.st.PutBlob(ctx, packFile, data)
 }
 
-func (bm *lockFreeManager) encryptAndWriteContentNotLocked(ctx context.Context, data []byte, prefix blob.ID) (blob.ID, error) {
+func (bm *lockFreeManager) encryptAndWriteContentNotLocked(ctx context.Context, data []byte, prefix, suffix blob.ID) (blob.ID, error) {
 	hash := bm.hashData(data)
-	blobID := prefix + blob.ID(hex.EncodeToString(hash))
+	blobID := prefix + blob.ID(hex.EncodeToString(hash)) + suffix
 
 	// Encrypt the content in-place.
 	atomic.AddInt64(&bm.stats.EncryptedBytes, int64(len(data)))
@@ -411,7 +438,7 @@ func (bm *lockFreeManager) hashData(data []byte) []byte {
 }
 
 func (bm *lockFreeManager) writePackIndexesNew(ctx context.Context, data []byte) (blob.ID, error) {
-	return bm.encryptAndWriteContentNotLocked(ctx, data, newIndexBlobPrefix)
+	return bm.encryptAndWriteContentNotLocked(ctx, data, newIndexBlobPrefix, "")
 }
 
 func (bm *lockFreeManager) verifyChecksum(data, contentID []byte) error {
@@ -21,6 +21,7 @@ import (
 
 	"github.com/kopia/kopia/internal/blobtesting"
 	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/compression"
 )
 
 const (
@@ -240,7 +241,7 @@ func TestContentManagerWriteMultiple(t *testing.T) {
 	for i := 0; i < 5000; i++ {
 		b := seededRandomData(i, i%113)
 
-		blkID, err := bm.WriteContent(ctx, b, "")
+		blkID, err := bm.WriteContent(ctx, b, "", compression.NoCompression)
 		if err != nil {
 			t.Errorf("err: %v", err)
 		}
@@ -290,7 +291,7 @@ func TestContentManagerFailedToWritePack(t *testing.T) {
 		MaxPackSize: maxPackSize,
 		HMACSecret:  []byte("foo"),
 		MasterKey:   []byte("0123456789abcdef0123456789abcdef"),
-	}, CachingOptions{}, fakeTimeNowFrozen(fakeTime), nil)
+	}, CachingOptions{}, fakeTimeNowFrozen(fakeTime), nil, ManagerOptions{})
 	if err != nil {
 		t.Fatalf("can't create bm: %v", err)
 	}
@@ -303,7 +304,7 @@ func TestContentManagerFailedToWritePack(t *testing.T) {
 		},
 	}
 
-	b1, err := bm.WriteContent(ctx, seededRandomData(1, 10), "")
+	b1, err := bm.WriteContent(ctx, seededRandomData(1, 10), "", compression.NoCompression)
 	if err != nil {
 		t.Fatalf("can't create content: %v", err)
 	}
@@ -875,6 +876,42 @@ func TestDeleteAndRecreate(t *testing.T) {
 	}
 }
 
+func TestRewritePendingDeletion(t *testing.T) {
+	ctx := context.Background()
+	data := blobtesting.DataMap{}
+	keyTime := map[blob.ID]time.Time{}
+
+	bm := newTestContentManager(data, keyTime, fakeTimeNowFrozen(fakeTime))
+	content1 := writeContentAndVerify(ctx, t, bm, seededRandomData(10, 100))
+	bm.Flush(ctx)
+
+	// garbage collection checks for writers at t0+10 and deletes the content later.
+	gcm := newTestContentManager(data, keyTime, fakeTimeNowFrozen(fakeTime.Add(20*time.Second)))
+
+	// writer that started after the check writes the content again instead of reusing it.
+	bm2 := newTestContentManager(data, keyTime, fakeTimeNowFrozen(fakeTime.Add(15*time.Second)))
+	bm2.SetPendingDeletion([]ID{content1})
+	writeContentAndVerify(ctx, t, bm2, seededRandomData(10, 100))
+	bm2.Flush(ctx)
+
+	if got, want := len(data), 2*2; got != want {
+		t.Errorf("unexpected number of blobs: %v, want %v", got, want)
+	}
+
+	// subsequent writes in the same session are deduplicated.
+	writeContentAndVerify(ctx, t, bm2, seededRandomData(10, 100))
+	bm2.Flush(ctx)
+
+	if got, want := len(data), 2*2; got != want {
+		t.Errorf("unexpected number of blobs after second write: %v, want %v", got, want)
+	}
+
+	assertNoError(t, gcm.DeleteContentAsOf(content1, fakeTime.Add(10*time.Second)))
+	gcm.Flush(ctx)
+
+	verifyContent(ctx, t, newTestContentManager(data, keyTime, nil), content1, seededRandomData(10, 100))
+}
+
 // nolint:funlen
 func TestIterateContents(t *testing.T) {
 	ctx := context.Background()
@@ -1185,6 +1222,22 @@ func TestVersionCompatibility(t *testing.T) {
 	}
 }
 
+func TestUnsupportedFormatVersion(t *testing.T) {
+	ctx := context.Background()
+	st := blobtesting.NewMapStorage(blobtesting.DataMap{}, nil, nil)
+
+	_, err := newManagerWithOptions(ctx, st, &FormattingOptions{
+		Hash:        "HMAC-SHA256",
+		Encryption:  "NONE",
+		HMACSecret:  hmacSecret,
+		MaxPackSize: maxPackSize,
+		Version:     maxSupportedReadVersion + 1,
+	}, CachingOptions{}, nil, nil, ManagerOptions{})
+	if err == nil {
+		t.Fatalf("unexpected success opening repository with unsupported format version")
+	}
+}
+
 func verifyVersionCompat(t *testing.T, writeVersion int) {
 	ctx := context.Background()
 
@@ -1200,7 +1253,7 @@ func verifyVersionCompat(t *testing.T, writeVersion int) {
 		data := make([]byte, i)
 		cryptorand.Read(data) //nolint:errcheck
 
-		cid, err := mgr.WriteContent(ctx, data, "")
+		cid, err := mgr.WriteContent(ctx, data, "", compression.NoCompression)
 		if err != nil {
 			t.Fatalf("unable to write %v bytes: %v", len(data), err)
 		}
@@ -1281,7 +1334,7 @@ func newTestContentManagerWithStorage(st blob.Storage, timeFunc func() time.Time
 		HMACSecret:  hmacSecret,
 		MaxPackSize: maxPackSize,
 		Version:     1,
-	}, CachingOptions{}, timeFunc, nil)
+	}, CachingOptions{}, timeFunc, nil, ManagerOptions{})
 	if err != nil {
 		panic("can't create content manager: " + err.Error())
 	}
@@ -1348,7 +1401,12 @@ func verifyContent(ctx context.Context, t *testing.T, bm *Manager, contentID ID,
 		t.Errorf("error getting content info %q: %v", contentID, err)
 	}
 
-	if got, want := bi.Length, uint32(len(b)); got != want {
+	length := bi.Length
+	if bi.CompressionHeaderID != compression.NoCompression {
+		length = bi.OriginalLength
+	}
+
+	if got, want := length, uint64(len(b)); got != want {
 		t.Errorf("invalid content size for %q: %v, wanted %v", contentID, got, want)
 	}
 }
@@ -1356,7 +1414,7 @@ func verifyContent(ctx context.Context, t *testing.T, bm *Manager, contentID ID,
 func writeContentAndVerify(ctx context.Context, t *testing.T, bm *Manager, b []byte) ID {
 	t.Helper()
 
-	contentID, err := bm.WriteContent(ctx, b, "")
+	contentID, err := bm.WriteContent(ctx, b, "", compression.NoCompression)
 	if err != nil {
 		t.Errorf("err: %v", err)
 	}
@@ -1392,13 +1450,13 @@ func flushWithRetries(ctx context.Context, t *testing.T, bm *Manager) int {
 func writeContentWithRetriesAndVerify(ctx context.Context, t *testing.T, bm *Manager, b []byte) (contentID ID, retryCount int) {
 	t.Helper()
 
-	contentID, err := bm.WriteContent(ctx, b, "")
+	contentID, err := bm.WriteContent(ctx, b, "", compression.NoCompression)
 	for i := 0; err != nil && i < maxRetries; i++ {
 		retryCount++
 
 		log.Warningf("WriteContent failed %v, retrying", err)
 
-		contentID, err = bm.WriteContent(ctx, b, "")
+		contentID, err = bm.WriteContent(ctx, b, "", compression.NoCompression)
 	}
 
 	if err != nil {
@@ -0,0 +1,245 @@
+package content
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo/blob"
+)
+
+// RepackMarkerBlobPrefix is the prefix for blobs listing pack blobs whose contents have been rewritten by Repack
+// and which will be deleted once the safety delay elapses.
+const RepackMarkerBlobPrefix blob.ID = "r"
+
+// DefaultRepackSafetyDelay is the default minimum amount of time between rewriting contents of a pack blob and
+// deleting it, which gives other clients a chance to pick up the new indexes.
+const DefaultRepackSafetyDelay = 4 * time.Hour
+
+// RepackOptions provides options for repacking.
+type RepackOptions struct {
+	// MinLiveFraction specifies the fraction of pack blob length occupied by live contents, below which the pack is repacked.
+	MinLiveFraction float64
+
+	// SafetyDelay is the minimum time between rewriting live contents of a pack blob and deleting it.
+	SafetyDelay time.Duration
+
+	// DryRun only computes statistics without making any changes.
+	DryRun bool
+}
+
+// RepackStats contains statistics of a repack operation.
+type RepackStats struct {
+	RepackedPacks     int   `json:"repackedPacks"`
+	RewrittenContents int   `json:"rewrittenContents"`
+	RewrittenBytes    int64 `json:"rewrittenBytes"`
+	ReclaimableBytes  int64 `json:"reclaimableBytes"`
+	DeletedPacks      int   `json:"deletedPacks"`
+	DeletedBytes      int64 `json:"deletedBytes"`
+	PendingPacks      int   `json:"pendingPacks"`
+}
+
+// repackMarker is the JSON structure of repack marker blobs.
+type repackMarker struct {
+	Time  time.Time       `json:"time"`
+	Packs []blob.Metadata `json:"packs"`
+}
+
+type packUsage struct {
+	blob.Metadata
+
+	liveBytes    int64
+	liveContents []ID
+}
+
+// Repack rewrites live contents of pack blobs where the fraction of live data is below the threshold into new packs.
+// Pack blobs whose contents have been rewritten are deleted by a subsequent Repack after the safety delay has passed,
+// so that other clients which may still be using old indexes can continue reading from them in the meantime.
+func (bm *Manager) Repack(ctx context.Context, opt RepackOptions) (RepackStats, error) {
+	var stats RepackStats
+
+	if opt.MinLiveFraction < 0 || opt.MinLiveFraction > 1 {
+		return stats, errors.Errorf("invalid live fraction %v, must be between 0 and 1", opt.MinLiveFraction)
+	}
+
+	packs, err := bm.getPackUsage(ctx)
+	if err != nil {
+		return stats, err
+	}
+
+	pendingDeletion, err := bm.processRepackMarkers(ctx, packs, opt, &stats)
+	if err != nil {
+		return stats, err
+	}
+
+	var repacked []blob.Metadata
+
+	for _, pu := range packs {
+		if pendingDeletion[pu.BlobID] || pu.Length == 0 {
+			continue
+		}
+
+		if float64(pu.liveBytes)/float64(pu.Length) >= opt.MinLiveFraction {
+			continue
+		}
+
+		log.Debugf("repacking %v (%v of %v bytes live)", pu.BlobID, pu.liveBytes, pu.Length)
+
+		stats.RepackedPacks++
+		stats.RewrittenContents += len(pu.liveContents)
+		stats.RewrittenBytes += pu.liveBytes
+		stats.ReclaimableBytes += pu.Length - pu.liveBytes
+
+		repacked = append(repacked, pu.Metadata)
+
+		if opt.DryRun {
+			continue
+		}
+
+		for _, contentID := range pu.liveContents {
+			if err := bm.RewriteContent(ctx, contentID); err != nil {
+				return stats, errors.Wrapf(err, "unable to rewrite content %v", contentID)
+			}
+		}
+	}
+
+	if opt.DryRun || len(repacked) == 0 {
+		return stats, nil
+	}
+
+	// make sure new packs and indexes are written before recording old packs for deletion.
+	if err := bm.Flush(ctx); err != nil {
+		return stats, errors.Wrap(err, "error flushing")
+	}
+
+	if err := bm.writeRepackMarker(ctx, repacked); err != nil {
+		return stats, err
+	}
+
+	stats.PendingPacks += len(repacked)
+
+	return stats, nil
+}
+
+// getPackUsage returns the usage information about all pack blobs in storage.
+func (bm *Manager) getPackUsage(ctx context.Context) (map[blob.ID]*packUsage, error) {
+	packs := map[blob.ID]*packUsage{}
+
+	for _, prefix := range PackBlobIDPrefixes {
+		if err := bm.st.ListBlobs(ctx, prefix, func(bm blob.Metadata) error {
+			packs[bm.BlobID] = &packUsage{Metadata: bm}
+			return nil
+		}); err != nil {
+			return nil, errors.Wrap(err, "error listing pack blobs")
+		}
+	}
+
+	if err := bm.IterateContents(IterateOptions{}, func(ci Info) error {
+		if pu := packs[ci.PackBlobID]; pu != nil {
+			pu.liveBytes += int64(ci.Length)
+			pu.liveContents = append(pu.liveContents, ci.ID)
+		}
+
+		return nil
+	}); err != nil {
+		return nil, errors.Wrap(err, "error iterating contents")
+	}
+
+	return packs, nil
+}
+
+// processRepackMarkers deletes packs listed in repack markers older than the safety delay and returns the set of
+// packs still waiting for deletion.
+func (bm *Manager) processRepackMarkers(ctx context.Context, packs map[blob.ID]*packUsage, opt RepackOptions, stats *RepackStats) (map[blob.ID]bool, error) {
+	pending := map[blob.ID]bool{}
+
+	markers, err := blob.ListAllBlobs(ctx, bm.st, RepackMarkerBlobPrefix)
+	if err != nil {
+		return nil, errors.Wrap(err, "error listing repack markers")
+	}
+
+	for _, mb := range markers {
+		m, err := bm.readRepackMarker(ctx, mb.BlobID)
+		if err != nil {
+			return nil, err
+		}
+
+		expired := bm.timeNow().Sub(m.Time) >= opt.SafetyDelay
+
+		for _, p := range m.Packs {
+			pu := packs[p.BlobID]
+			if pu == nil {
+				// already deleted.
+				continue
+			}
+
+			pending[p.BlobID] = true
+
+			if !expired || opt.DryRun {
+				stats.PendingPacks++
+				continue
+			}
+
+			if len(pu.liveContents) > 0 {
+				// should not happen, but it's not safe to delete packs that are still in use.
+				log.Warningf("not deleting %v because it still has %v live contents", p.BlobID, len(pu.liveContents))
+				continue
+			}
+
+			log.Debugf("deleting repacked pack %v", p.BlobID)
+
+			if err := bm.st.DeleteBlob(ctx, p.BlobID); err != nil && err != blob.ErrBlobNotFound {
+				return nil, errors.Wrapf(err, "unable to delete pack %v", p.BlobID)
+			}
+
+			stats.DeletedPacks++
+			stats.DeletedBytes += pu.Length
+		}
+
+		if expired && !opt.DryRun {
+			if err := bm.st.DeleteBlob(ctx, mb.BlobID); err != nil && err != blob.ErrBlobNotFound {
+				return nil, errors.Wrapf(err, "unable to delete repack marker %v", mb.BlobID)
+			}
+		}
+	}
+
+	return pending, nil
+}
+
+func (bm *Manager) readRepackMarker(ctx context.Context, blobID blob.ID) (*repackMarker, error) {
+	b, err := bm.st.GetBlob(ctx, blobID, 0, -1)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to read repack marker %v", blobID)
+	}
+
+	m := &repackMarker{}
+	if err := json.Unmarshal(b, m); err != nil {
+		return nil, errors.Wrapf(err, "invalid repack marker %v", blobID)
+	}
+
+	return m, nil
+}
+
+func (bm *Manager) writeRepackMarker(ctx context.Context, packs []blob.Metadata) error {
+	m := &repackMarker{
+		Time:  bm.timeNow(),
+		Packs: packs,
+	}
+
+	b, err := json.Marshal(m)
+	if err != nil {
+		return errors.Wrap(err, "unable to marshal repack marker")
+	}
+
+	suffix, err := appendRandomBytes(nil, 8) //nolint:gomnd
+	if err != nil {
+		return errors.Wrap(err, "unable to generate marker ID")
+	}
+
+	blobID := RepackMarkerBlobPrefix + blob.ID(fmt.Sprintf("%x-%x", m.Time.UnixNano(), suffix))
+
+	return bm.st.PutBlob(ctx, blobID, b)
+}
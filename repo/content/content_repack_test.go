@@ -0,0 +1,154 @@
+package content
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kopia/kopia/internal/blobtesting"
+	"github.com/kopia/kopia/repo/blob"
+)
+
+func TestRepack(t *testing.T) {
+	ctx := context.Background()
+	data := blobtesting.DataMap{}
+	keyTime := map[blob.ID]time.Time{}
+
+	now := fakeTime
+	timeFunc := func() time.Time {
+		now = now.Add(1 * time.Second)
+		return now
+	}
+
+	bm := newTestContentManager(data, keyTime, timeFunc)
+	bm.paddingUnit = 0
+
+	var contentIDs []ID
+
+	for i := 0; i < 6; i++ {
+		contentIDs = append(contentIDs, writeContentAndVerify(ctx, t, bm, seededRandomData(i, 1000)))
+	}
+
+	if err := bm.Flush(ctx); err != nil {
+		t.Fatalf("error flushing: %v", err)
+	}
+
+	// delete all but one content in the pack holding the first content.
+	ci, err := bm.ContentInfo(ctx, contentIDs[0])
+	if err != nil {
+		t.Fatalf("unable to get content info: %v", err)
+	}
+
+	live := map[ID][]byte{}
+
+	for i, contentID := range contentIDs {
+		ci2, err := bm.ContentInfo(ctx, contentID)
+		if err != nil {
+			t.Fatalf("unable to get content info: %v", err)
+		}
+
+		if i > 0 && ci2.PackBlobID == ci.PackBlobID {
+			if err := bm.DeleteContent(contentID); err != nil {
+				t.Fatalf("unable to delete %v: %v", contentID, err)
+			}
+
+			continue
+		}
+
+		live[contentID] = seededRandomData(i, 1000)
+	}
+
+	if err := bm.Flush(ctx); err != nil {
+		t.Fatalf("error flushing: %v", err)
+	}
+
+	packsBefore := listPackBlobs(ctx, t, data)
+
+	opt := RepackOptions{
+		MinLiveFraction: 0.5,
+		SafetyDelay:     time.Hour,
+	}
+
+	dryRunOpt := opt
+	dryRunOpt.DryRun = true
+
+	stats, err := bm.Repack(ctx, dryRunOpt)
+	if err != nil {
+		t.Fatalf("dry run failed: %v", err)
+	}
+
+	if stats.RepackedPacks != 1 || stats.RewrittenContents != 1 {
+		t.Errorf("unexpected dry run stats: %+v", stats)
+	}
+
+	if got := listPackBlobs(ctx, t, data); len(got) != len(packsBefore) {
+		t.Errorf("dry run modified packs: %v, was %v", got, packsBefore)
+	}
+
+	stats, err = bm.Repack(ctx, opt)
+	if err != nil {
+		t.Fatalf("repack failed: %v", err)
+	}
+
+	if stats.RepackedPacks != 1 || stats.RewrittenContents != 1 || stats.PendingPacks != 1 || stats.DeletedPacks != 0 {
+		t.Errorf("unexpected repack stats: %+v", stats)
+	}
+
+	// old pack is still there, because of the safety delay.
+	if got, want := len(listPackBlobs(ctx, t, data)), len(packsBefore)+1; got != want {
+		t.Errorf("unexpected number of packs after repack: %v, want %v", got, want)
+	}
+
+	// running again before safety delay does not repack the same pack again.
+	stats, err = bm.Repack(ctx, opt)
+	if err != nil {
+		t.Fatalf("repack failed: %v", err)
+	}
+
+	if stats.RepackedPacks != 0 || stats.DeletedPacks != 0 || stats.PendingPacks != 1 {
+		t.Errorf("unexpected repack stats: %+v", stats)
+	}
+
+	now = now.Add(2 * time.Hour)
+
+	bm2 := newTestContentManager(data, keyTime, timeFunc)
+	bm2.paddingUnit = 0
+
+	stats, err = bm2.Repack(ctx, opt)
+	if err != nil {
+		t.Fatalf("repack failed: %v", err)
+	}
+
+	if stats.DeletedPacks != 1 || stats.PendingPacks != 0 {
+		t.Errorf("unexpected repack stats: %+v", stats)
+	}
+
+	if got, want := len(listPackBlobs(ctx, t, data)), len(packsBefore); got != want {
+		t.Errorf("unexpected number of packs after deletion: %v, want %v", got, want)
+	}
+
+	if markers, _ := blob.ListAllBlobs(ctx, bm2.st, RepackMarkerBlobPrefix); len(markers) != 0 {
+		t.Errorf("repack markers were not deleted: %v", markers)
+	}
+
+	// live contents are still readable from a fresh manager.
+	bm3 := newTestContentManager(data, keyTime, timeFunc)
+
+	verifyContentManagerDataSet(ctx, t, bm3, live)
+}
+
+func listPackBlobs(ctx context.Context, t *testing.T, data blobtesting.DataMap) []blob.ID {
+	t.Helper()
+
+	var result []blob.ID
+
+	for blobID := range data {
+		for _, prefix := range PackBlobIDPrefixes {
+			if blobID[0:1] == prefix {
+				result = append(result, blobID)
+			}
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,282 @@
+package content
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo/blob"
+)
+
+// DefaultScrubPeriod is the default period over which scrubbing rotates through all pack blobs.
+const DefaultScrubPeriod = 30 * 24 * time.Hour
+
+const defaultScrubParallelism = 4
+
+// ScrubOptions provides options for scrubbing.
+type ScrubOptions struct {
+	// StateFile is the path to the local file which tracks when each pack blob was last verified.
+	StateFile string
+
+	// Percent is the percentage of all pack blobs to verify in a single run.
+	Percent float64
+
+	// Period is the time after which a verified pack blob becomes due for verification again.
+	Period time.Duration
+
+	// ChecksumOnly only verifies authentication codes of encrypted contents without decrypting them,
+	// if supported by the encryption algorithm.
+	ChecksumOnly bool
+
+	// Parallel is the number of pack blobs to verify in parallel.
+	Parallel int
+}
+
+// ScrubError describes an error found during scrubbing.
+type ScrubError struct {
+	PackBlobID blob.ID `json:"packBlobID"`
+	ContentID  ID      `json:"contentID,omitempty"`
+	Error      string  `json:"error"`
+}
+
+// ScrubStats contains statistics of a scrub operation.
+type ScrubStats struct {
+	TotalPacks       int          `json:"totalPacks"`
+	DuePacks         int          `json:"duePacks"`
+	VerifiedPacks    int          `json:"verifiedPacks"`
+	VerifiedContents int          `json:"verifiedContents"`
+	DownloadedBytes  int64        `json:"downloadedBytes"`
+	Errors           []ScrubError `json:"errors,omitempty"`
+}
+
+// scrubState is the JSON structure of the local scrub state file.
+type scrubState struct {
+	Packs map[blob.ID]time.Time `json:"packs"`
+}
+
+// Scrub verifies the integrity of contents in a sample of pack blobs, which are selected so that all pack blobs
+// are verified once per period, starting with those that were never verified or have been verified the longest time ago.
+// Each selected pack blob is downloaded once, reading only the range occupied by its live contents.
+func (bm *Manager) Scrub(ctx context.Context, opt ScrubOptions) (*ScrubStats, error) {
+	if opt.Percent <= 0 || opt.Percent > 100 {
+		return nil, errors.Errorf("invalid percentage %v, must be between 0 and 100", opt.Percent)
+	}
+
+	if opt.Period <= 0 {
+		opt.Period = DefaultScrubPeriod
+	}
+
+	if opt.Parallel <= 0 {
+		opt.Parallel = defaultScrubParallelism
+	}
+
+	st, err := readScrubState(opt.StateFile)
+	if err != nil {
+		return nil, err
+	}
+
+	packs := map[blob.ID][]Info{}
+
+	if err := bm.IteratePacks(IteratePackOptions{IncludeContentInfos: true}, func(pi PackInfo) error {
+		if pi.PackID != "" {
+			packs[pi.PackID] = pi.ContentInfos
+		}
+		return nil
+	}); err != nil {
+		return nil, errors.Wrap(err, "error iterating packs")
+	}
+
+	// forget packs which are no longer in use.
+	for packID := range st.Packs {
+		if _, ok := packs[packID]; !ok {
+			delete(st.Packs, packID)
+		}
+	}
+
+	now := bm.timeNow()
+	stats := &ScrubStats{TotalPacks: len(packs)}
+
+	var due []blob.ID
+
+	for packID := range packs {
+		if now.Sub(st.Packs[packID]) >= opt.Period {
+			due = append(due, packID)
+		}
+	}
+
+	sort.Slice(due, func(i, j int) bool {
+		if ti, tj := st.Packs[due[i]], st.Packs[due[j]]; !ti.Equal(tj) {
+			return ti.Before(tj)
+		}
+
+		return due[i] < due[j]
+	})
+
+	stats.DuePacks = len(due)
+
+	if n := int(math.Ceil(float64(len(packs)) * opt.Percent / 100)); n < len(due) { //nolint:gomnd
+		due = due[0:n]
+	}
+
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		work = make(chan blob.ID)
+	)
+
+	for i := 0; i < opt.Parallel; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for packID := range work {
+				if ctx.Err() != nil {
+					continue
+				}
+
+				downloaded, errs := bm.scrubPack(ctx, packID, packs[packID], opt.ChecksumOnly)
+
+				mu.Lock()
+				stats.DownloadedBytes += downloaded
+				stats.Errors = append(stats.Errors, errs...)
+
+				if len(errs) == 0 {
+					st.Packs[packID] = now
+					stats.VerifiedPacks++
+					stats.VerifiedContents += len(packs[packID])
+				} else {
+					// packs with errors are due again in the next run.
+					delete(st.Packs, packID)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for _, packID := range due {
+		work <- packID
+	}
+
+	close(work)
+	wg.Wait()
+
+	sort.Slice(stats.Errors, func(i, j int) bool {
+		a, b := stats.Errors[i], stats.Errors[j]
+		if a.PackBlobID != b.PackBlobID {
+			return a.PackBlobID < b.PackBlobID
+		}
+
+		return a.ContentID < b.ContentID
+	})
+
+	if err := writeScrubState(opt.StateFile, st); err != nil {
+		return stats, err
+	}
+
+	return stats, ctx.Err()
+}
+
+// scrubPack downloads the range of the pack blob occupied by the provided contents and verifies each of them.
+func (bm *Manager) scrubPack(ctx context.Context, packID blob.ID, contents []Info, checksumOnly bool) (int64, []ScrubError) {
+	if len(contents) == 0 {
+		return 0, nil
+	}
+
+	start, end := contents[0].PackOffset, contents[0].PackOffset+contents[0].Length
+
+	for _, ci := range contents {
+		if ci.PackOffset < start {
+			start = ci.PackOffset
+		}
+
+		if e := ci.PackOffset + ci.Length; e > end {
+			end = e
+		}
+	}
+
+	data, err := bm.st.GetBlob(ctx, packID, int64(start), int64(end-start))
+	if err != nil {
+		return 0, []ScrubError{{PackBlobID: packID, Error: err.Error()}}
+	}
+
+	if uint64(len(data)) != end-start {
+		return int64(len(data)), []ScrubError{{PackBlobID: packID, Error: "pack blob is truncated"}}
+	}
+
+	var errs []ScrubError
+
+	for _, ci := range contents {
+		payload := data[ci.PackOffset-start : ci.PackOffset-start+ci.Length]
+
+		if err := bm.verifyPackedContent(ci, payload, checksumOnly); err != nil {
+			errs = append(errs, ScrubError{PackBlobID: packID, ContentID: ci.ID, Error: err.Error()})
+		}
+	}
+
+	return int64(len(data)), errs
+}
+
+// verifyPackedContent verifies the encrypted payload of a content.
+func (bm *Manager) verifyPackedContent(ci Info, payload []byte, checksumOnly bool) error {
+	e, err := bm.encryptorForKeyID(ci.EncryptionKeyID)
+	if err != nil {
+		return err
+	}
+
+	if v, ok := e.(checksumVerifier); ok && checksumOnly && e.IsAuthenticated() {
+		return v.VerifyChecksum(payload)
+	}
+
+	iv, err := getPackedContentIV(ci.ID)
+	if err != nil {
+		return err
+	}
+
+	_, err = bm.decryptAndVerify(payload, iv, ci.CompressionHeaderID, ci.EncryptionKeyID)
+
+	return err
+}
+
+func readScrubState(fname string) (*scrubState, error) {
+	st := &scrubState{}
+
+	b, err := ioutil.ReadFile(fname) //nolint:gosec
+	if err != nil && !os.IsNotExist(err) {
+		return nil, errors.Wrap(err, "unable to read scrub state")
+	}
+
+	if err == nil {
+		if err := json.Unmarshal(b, st); err != nil {
+			return nil, errors.Wrap(err, "invalid scrub state")
+		}
+	}
+
+	if st.Packs == nil {
+		st.Packs = map[blob.ID]time.Time{}
+	}
+
+	return st, nil
+}
+
+func writeScrubState(fname string, st *scrubState) error {
+	b, err := json.Marshal(st)
+	if err != nil {
+		return errors.Wrap(err, "unable to marshal scrub state")
+	}
+
+	tmpFile, err := writeTempFileAtomic(filepath.Dir(fname), b)
+	if err != nil {
+		return errors.Wrap(err, "unable to write scrub state")
+	}
+
+	return os.Rename(tmpFile, fname)
+}
@@ -0,0 +1,145 @@
+package content
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kopia/kopia/internal/blobtesting"
+	"github.com/kopia/kopia/repo/blob"
+)
+
+func TestScrub(t *testing.T) {
+	ctx := context.Background()
+	data := blobtesting.DataMap{}
+	keyTime := map[blob.ID]time.Time{}
+	bm := newTestContentManager(data, keyTime, nil)
+
+	stateFile, cleanup := scrubTestStateFile(t)
+	defer cleanup()
+
+	for i := 0; i < 4; i++ {
+		writeContentAndVerify(ctx, t, bm, seededRandomData(i, 100))
+		writeContentAndVerify(ctx, t, bm, seededRandomData(i+10, 100))
+		assertNoError(t, bm.Flush(ctx))
+	}
+
+	opt := ScrubOptions{StateFile: stateFile, Percent: 50, Period: time.Hour}
+
+	// two runs rotate through all packs.
+	verified := map[blob.ID]bool{}
+
+	for i := 0; i < 2; i++ {
+		stats, err := bm.Scrub(ctx, opt)
+		assertNoError(t, err)
+
+		if stats.TotalPacks != 4 || stats.VerifiedPacks != 2 || stats.VerifiedContents != 4 || len(stats.Errors) != 0 {
+			t.Fatalf("unexpected stats: %+v", stats)
+		}
+
+		st, err := readScrubState(stateFile)
+		assertNoError(t, err)
+
+		for packID := range st.Packs {
+			verified[packID] = true
+		}
+	}
+
+	if got, want := len(verified), 4; got != want {
+		t.Errorf("unexpected number of verified packs: %v, want %v", got, want)
+	}
+
+	// all packs were verified within the period.
+	stats, err := bm.Scrub(ctx, opt)
+	assertNoError(t, err)
+
+	if stats.DuePacks != 0 || stats.VerifiedPacks != 0 || stats.DownloadedBytes != 0 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+
+	// corrupt a content and verify all packs again.
+	ci, err := bm.ContentInfo(ctx, ID(hashValue(seededRandomData(2, 100))))
+	assertNoError(t, err)
+
+	data[ci.PackBlobID][ci.PackOffset+1] ^= 1
+
+	opt.Percent = 100
+	opt.Period = time.Nanosecond
+
+	stats, err = bm.Scrub(ctx, opt)
+	assertNoError(t, err)
+
+	if stats.VerifiedPacks != 3 || len(stats.Errors) != 1 || stats.Errors[0].ContentID != ci.ID || stats.Errors[0].PackBlobID != ci.PackBlobID {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+
+	// pack with errors is verified again.
+	opt.Period = time.Hour
+
+	stats, err = bm.Scrub(ctx, opt)
+	assertNoError(t, err)
+
+	if stats.DuePacks != 1 || len(stats.Errors) != 1 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestScrubChecksumOnly(t *testing.T) {
+	ctx := context.Background()
+	data := blobtesting.DataMap{}
+	st := blobtesting.NewMapStorage(data, nil, nil)
+
+	bm, err := newManagerWithOptions(ctx, st, &FormattingOptions{
+		Hash:        "HMAC-SHA256",
+		Encryption:  "SALSA20-HMAC",
+		HMACSecret:  hmacSecret,
+		MasterKey:   []byte("0123456789abcdef0123456789abcdef"),
+		MaxPackSize: maxPackSize,
+		Version:     1,
+	}, CachingOptions{}, fakeTimeNowWithAutoAdvance(fakeTime, 1*time.Second), nil, ManagerOptions{})
+	if err != nil {
+		t.Fatalf("can't create content manager: %v", err)
+	}
+
+	contentID := writeContentAndVerify(ctx, t, bm, seededRandomData(1, 100))
+	writeContentAndVerify(ctx, t, bm, seededRandomData(2, 100))
+	assertNoError(t, bm.Flush(ctx))
+
+	stateFile, cleanup := scrubTestStateFile(t)
+	defer cleanup()
+
+	opt := ScrubOptions{StateFile: stateFile, Percent: 100, Period: time.Nanosecond, ChecksumOnly: true}
+
+	stats, err := bm.Scrub(ctx, opt)
+	assertNoError(t, err)
+
+	if stats.VerifiedContents != 2 || len(stats.Errors) != 0 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+
+	ci, err := bm.ContentInfo(ctx, contentID)
+	assertNoError(t, err)
+
+	data[ci.PackBlobID][ci.PackOffset] ^= 1
+
+	stats, err = bm.Scrub(ctx, opt)
+	assertNoError(t, err)
+
+	if len(stats.Errors) != 1 || stats.Errors[0].ContentID != contentID {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+}
+
+func scrubTestStateFile(t *testing.T) (string, func()) {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "scrub")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+
+	return filepath.Join(dir, "scrub.json"), func() { os.RemoveAll(dir) } //nolint:errcheck
+}
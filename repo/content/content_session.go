@@ -0,0 +1,253 @@
+package content
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo/blob"
+)
+
+// SessionIndexBlobPrefix is the prefix of index blobs written during write sessions, which describe contents of
+// pack blobs that have been written but not yet committed to regular index blobs. Session index blobs are named
+// x<hash>-<sessionID> and are removed once their contents are committed.
+const SessionIndexBlobPrefix blob.ID = "x"
+
+// sessionIndexFlushInterval is the interval at which contents of packs written during a write session
+// are saved in session index blobs.
+var sessionIndexFlushInterval = 1 * time.Minute
+
+// BeginSession starts a write session with the provided identifier, during which contents of written pack blobs
+// are periodically saved in session index blobs, so they can be adopted by a subsequent session if this one
+// does not complete. Only one session can be active at a time.
+func (bm *Manager) BeginSession(sessionID string) error {
+	bm.lock()
+	defer bm.unlock()
+
+	if bm.sessionID != "" {
+		return errors.Errorf("write session %v is already in progress", bm.sessionID)
+	}
+
+	if sessionID == "" || strings.Contains(sessionID, "-") {
+		return errors.Errorf("invalid session ID %q", sessionID)
+	}
+
+	bm.sessionID = sessionID
+	bm.sessionIndexBuilder = make(packIndexBuilder)
+	bm.flushSessionIndexAfter = bm.timeNow().Add(sessionIndexFlushInterval)
+
+	return nil
+}
+
+// EndSession ends the write session. Session index blobs written so far are removed by the next flush,
+// which commits their contents.
+func (bm *Manager) EndSession(sessionID string) {
+	bm.lock()
+	defer bm.unlock()
+
+	if bm.sessionID == sessionID {
+		bm.sessionID = ""
+		bm.sessionIndexBuilder = make(packIndexBuilder)
+	}
+}
+
+// FlushSessionIndex saves contents of pack blobs written during the current write session in a session index blob.
+func (bm *Manager) FlushSessionIndex(ctx context.Context) error {
+	bm.lock()
+	defer bm.unlock()
+
+	return bm.flushSessionIndexLocked(ctx)
+}
+
+func (bm *Manager) flushSessionIndexLocked(ctx context.Context) error {
+	bm.flushSessionIndexAfter = bm.timeNow().Add(sessionIndexFlushInterval)
+
+	if bm.sessionID == "" || len(bm.sessionIndexBuilder) == 0 {
+		return nil
+	}
+
+	var buf bytes.Buffer
+
+	if err := bm.sessionIndexBuilder.Build(&buf, bm.indexVersion); err != nil {
+		return errors.Wrap(err, "unable to build session index")
+	}
+
+	blobID, err := bm.encryptAndWriteContentNotLocked(ctx, buf.Bytes(), SessionIndexBlobPrefix, blob.ID("-"+bm.sessionID))
+	if err != nil {
+		return errors.Wrap(err, "unable to write session index")
+	}
+
+	log.Debugf("wrote session index %v with %v contents", blobID, len(bm.sessionIndexBuilder))
+
+	bm.sessionIndexBlobs = append(bm.sessionIndexBlobs, blobID)
+	bm.sessionIndexBuilder = make(packIndexBuilder)
+
+	return nil
+}
+
+// deleteSessionIndexBlobsLocked removes session index blobs after their contents have been committed.
+func (bm *Manager) deleteSessionIndexBlobsLocked(ctx context.Context) {
+	for _, blobID := range bm.sessionIndexBlobs {
+		if err := bm.st.DeleteBlob(ctx, blobID); err != nil && err != blob.ErrBlobNotFound {
+			log.Warningf("unable to delete session index %v: %v", blobID, err)
+		}
+	}
+
+	bm.sessionIndexBlobs = nil
+	bm.sessionIndexBuilder = make(packIndexBuilder)
+}
+
+// listSessionIndexBlobs returns session index blobs of the provided session or of all sessions if sessionID is empty.
+func (bm *Manager) listSessionIndexBlobs(ctx context.Context, sessionID string) ([]blob.Metadata, error) {
+	all, err := blob.ListAllBlobs(ctx, bm.st, SessionIndexBlobPrefix)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to list session indexes")
+	}
+
+	if sessionID == "" {
+		return all, nil
+	}
+
+	var result []blob.Metadata
+
+	for _, bm := range all {
+		if strings.HasSuffix(string(bm.BlobID), "-"+sessionID) {
+			result = append(result, bm)
+		}
+	}
+
+	return result, nil
+}
+
+// SessionIDsWithIndexes returns identifiers of write sessions that have session index blobs in the repository.
+func (bm *Manager) SessionIDsWithIndexes(ctx context.Context) ([]string, error) {
+	blobs, err := bm.listSessionIndexBlobs(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+
+	var result []string
+
+	seen := map[string]bool{}
+
+	for _, b := range blobs {
+		p := strings.Index(string(b.BlobID), "-")
+		if p < 0 {
+			continue
+		}
+
+		if id := string(b.BlobID[p+1:]); !seen[id] {
+			seen[id] = true
+			result = append(result, id)
+		}
+	}
+
+	return result, nil
+}
+
+// readSessionIndex returns contents of the provided session index blob.
+func (bm *Manager) readSessionIndex(ctx context.Context, blobID blob.ID) ([]Info, error) {
+	data, err := bm.getIndexBlobInternal(ctx, blobID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to read session index %v", blobID)
+	}
+
+	ndx, err := openPackIndex(bytes.NewReader(data))
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to open session index %v", blobID)
+	}
+	defer ndx.Close() //nolint:errcheck
+
+	var result []Info
+
+	err = ndx.Iterate("", func(i Info) error {
+		result = append(result, i)
+		return nil
+	})
+
+	return result, err
+}
+
+// AdoptSession commits contents of pack blobs written during a previous write session that did not complete,
+// which were saved in its session index blobs, and removes those session index blobs.
+// Returns the number of adopted contents.
+func (bm *Manager) AdoptSession(ctx context.Context, sessionID string) (int, error) {
+	blobs, err := bm.listSessionIndexBlobs(ctx, sessionID)
+	if err != nil {
+		return 0, err
+	}
+
+	var adopted []Info
+
+	existingPacks := map[blob.ID]bool{}
+
+	for _, b := range blobs {
+		infos, err := bm.readSessionIndex(ctx, b.BlobID)
+		if err != nil {
+			return 0, err
+		}
+
+		for _, i := range infos {
+			exists, ok := existingPacks[i.PackBlobID]
+			if !ok {
+				exists, err = bm.packBlobExists(ctx, i.PackBlobID)
+				if err != nil {
+					return 0, err
+				}
+
+				existingPacks[i.PackBlobID] = exists
+			}
+
+			if !exists {
+				log.Debugf("not adopting %v, pack %v no longer exists", i.ID, i.PackBlobID)
+				continue
+			}
+
+			adopted = append(adopted, i)
+		}
+	}
+
+	if len(blobs) == 0 {
+		return 0, nil
+	}
+
+	bm.lock()
+	defer bm.unlock()
+
+	for _, i := range adopted {
+		bm.packIndexBuilder.Add(i)
+	}
+
+	if err := bm.flushPackIndexesLocked(ctx); err != nil {
+		return 0, errors.Wrap(err, "unable to commit adopted contents")
+	}
+
+	for _, b := range blobs {
+		if err := bm.st.DeleteBlob(ctx, b.BlobID); err != nil && err != blob.ErrBlobNotFound {
+			return 0, errors.Wrapf(err, "unable to delete session index %v", b.BlobID)
+		}
+	}
+
+	log.Debugf("adopted %v contents from session %v", len(adopted), sessionID)
+
+	return len(adopted), nil
+}
+
+func (bm *Manager) packBlobExists(ctx context.Context, packBlobID blob.ID) (bool, error) {
+	found := false
+
+	if err := bm.st.ListBlobs(ctx, packBlobID, func(m blob.Metadata) error {
+		if m.BlobID == packBlobID {
+			found = true
+		}
+
+		return nil
+	}); err != nil {
+		return false, errors.Wrapf(err, "unable to check pack blob %v", packBlobID)
+	}
+
+	return found, nil
+}
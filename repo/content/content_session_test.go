@@ -0,0 +1,105 @@
+package content
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kopia/kopia/internal/blobtesting"
+	"github.com/kopia/kopia/repo/blob"
+)
+
+func TestContentManagerSessionAdoption(t *testing.T) {
+	ctx := context.Background()
+	data := blobtesting.DataMap{}
+	keyTime := map[blob.ID]time.Time{}
+
+	bm := newTestContentManager(data, keyTime, nil)
+	assertNoError(t, bm.BeginSession("s1"))
+
+	var contentIDs []ID
+
+	// write enough contents to produce several pack blobs.
+	for i := 0; i < 100; i++ {
+		contentIDs = append(contentIDs, writeContentAndVerify(ctx, t, bm, seededRandomData(i, maxPackSize/10)))
+	}
+
+	assertNoError(t, bm.FlushSessionIndex(ctx))
+
+	if got := countBlobsWithPrefix(data, SessionIndexBlobPrefix); got == 0 {
+		t.Fatalf("session indexes not written")
+	}
+
+	// simulate crash, without flushing - contents in pack blobs written so far are not in regular indexes.
+	bm = newTestContentManager(data, keyTime, nil)
+	verifyContentNotFound(ctx, t, bm, contentIDs[0])
+
+	// adopting a different session is a no-op.
+	n, err := bm.AdoptSession(ctx, "s2")
+	if err != nil || n != 0 {
+		t.Fatalf("unexpected result of adopting other session: %v %v", n, err)
+	}
+
+	n, err = bm.AdoptSession(ctx, "s1")
+	assertNoError(t, err)
+
+	if n == 0 {
+		t.Fatalf("no contents adopted")
+	}
+
+	if got := countBlobsWithPrefix(data, SessionIndexBlobPrefix); got != 0 {
+		t.Errorf("unexpected session indexes after adoption: %v", got)
+	}
+
+	// adopted contents are committed and visible to new managers.
+	bm = newTestContentManager(data, keyTime, nil)
+
+	for i, cid := range contentIDs[0:n] {
+		verifyContent(ctx, t, bm, cid, seededRandomData(i, maxPackSize/10))
+	}
+}
+
+func TestContentManagerSessionIndexDeletedOnFlush(t *testing.T) {
+	ctx := context.Background()
+	data := blobtesting.DataMap{}
+	keyTime := map[blob.ID]time.Time{}
+
+	bm := newTestContentManager(data, keyTime, nil)
+	assertNoError(t, bm.BeginSession("s1"))
+
+	if err := bm.BeginSession("s2"); err == nil {
+		t.Errorf("unexpected success beginning second session")
+	}
+
+	for i := 0; i < 100; i++ {
+		writeContentAndVerify(ctx, t, bm, seededRandomData(i, maxPackSize/10))
+	}
+
+	assertNoError(t, bm.FlushSessionIndex(ctx))
+	bm.EndSession("s1")
+
+	if got := countBlobsWithPrefix(data, SessionIndexBlobPrefix); got == 0 {
+		t.Errorf("session indexes removed before flush")
+	}
+
+	assertNoError(t, bm.Flush(ctx))
+
+	if got := countBlobsWithPrefix(data, SessionIndexBlobPrefix); got != 0 {
+		t.Errorf("unexpected session indexes after flush: %v", got)
+	}
+
+	assertNoError(t, bm.BeginSession("s2"))
+}
+
+func countBlobsWithPrefix(data blobtesting.DataMap, prefix blob.ID) int {
+	count := 0
+
+	for k := range data {
+		if strings.HasPrefix(string(k), string(prefix)) {
+			count++
+		}
+	}
+
+	return count
+}
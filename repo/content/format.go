@@ -4,25 +4,42 @@ import (
 	"encoding/binary"
 
 	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo/compression"
 )
 
 // Format describes a format of a single pack index. The actual structure is not used,
 // it's purely for documentation purposes.
 // The struct is byte-aligned.
 type Format struct {
-	Version    byte   // format version number must be 0x01
+	Version    byte   // format version number must be 0x01 or 0x02
 	KeySize    byte   // size of each key in bytes
 	EntrySize  uint16 // size of each entry in bytes, big-endian
 	EntryCount uint32 // number of sorted (key,value) entries that follow
 
 	Entries []struct {
 		Key   []byte // key bytes (KeySize)
-		Entry entry
+		Entry entry  // entryV2 when Version == 0x02
 	}
 
 	ExtraData []byte // extra data
 }
 
+// indexEntry provides access to information stored in an index entry, regardless of index version.
+type indexEntry interface {
+	parse(b []byte) error
+	IsDeleted() bool
+	TimestampSeconds() int64
+	PackedFormatVersion() byte
+	PackFileLength() byte
+	PackFileOffset() uint32
+	PackedOffset() uint64
+	PackedLength() uint64
+	CompressionHeaderID() compression.HeaderID
+	OriginalLength() uint64
+	EncryptionKeyID() byte
+}
+
 type entry struct {
 	// big endian:
 	// 48 most significant bits - 48-bit timestamp in seconds since 1970/01/01 UTC
@@ -48,7 +65,7 @@ func (e *entry) parse(b []byte) error {
 }
 
 func (e *entry) IsDeleted() bool {
-	return e.packedOffset&0x80000000 != 0
+	return e.packedOffset&deletedMarker != 0
 }
 
 func (e *entry) TimestampSeconds() int64 {
@@ -67,10 +84,102 @@ func (e *entry) PackFileOffset() uint32 {
 	return e.packFileOffset
 }
 
-func (e *entry) PackedOffset() uint32 {
-	return e.packedOffset & 0x7fffffff
+func (e *entry) PackedOffset() uint64 {
+	return uint64(e.packedOffset &^ deletedMarker)
+}
+
+func (e *entry) PackedLength() uint64 {
+	return uint64(e.packedLength)
+}
+
+func (e *entry) CompressionHeaderID() compression.HeaderID {
+	return compression.NoCompression
+}
+
+func (e *entry) OriginalLength() uint64 {
+	return 0
+}
+
+func (e *entry) EncryptionKeyID() byte {
+	return 0
+}
+
+// entryV2 is an index entry in version 2 of the index format, which uses 64-bit offsets and lengths
+// and stores flags and per-content metadata in separate fields.
+type entryV2 struct {
+	// big endian:
+	timestampSeconds    int64  // 8 bytes, timestamp in seconds since 1970/01/01 UTC
+	packFileOffset      uint32 // 4 bytes, offset within index file where pack (blob) ID begins
+	packFileLength      byte   // 1 byte, length of pack (blob) ID
+	formatVersion       byte   // 1 byte, format version of the content
+	flags               byte   // 1 byte, combination of entryV2Flag* values
+	encryptionKeyID     byte   // 1 byte, identifier of the encryption key used to encrypt the content
+	packedOffset        uint64 // 8 bytes, offset within pack file where the contents begin
+	packedLength        uint64 // 8 bytes, content length
+	compressionHeaderID uint32 // 4 bytes, identifier of the compression method (0 == none)
+
+	// optional fields, present when entry size allows:
+	originalLength uint64 // 8 bytes, length of compressed content before compression
+}
+
+func (e *entryV2) parse(b []byte) error {
+	if len(b) < entryV2FixedHeaderLength {
+		return errors.Errorf("invalid entry length: %v", len(b))
+	}
+
+	e.timestampSeconds = int64(binary.BigEndian.Uint64(b[0:8]))
+	e.packFileOffset = binary.BigEndian.Uint32(b[8:12])
+	e.packFileLength = b[12]
+	e.formatVersion = b[13]
+	e.flags = b[14]
+	e.encryptionKeyID = b[15]
+	e.packedOffset = binary.BigEndian.Uint64(b[16:24])
+	e.packedLength = binary.BigEndian.Uint64(b[24:32])
+	e.compressionHeaderID = binary.BigEndian.Uint32(b[32:36])
+
+	if len(b) >= entryV2Length {
+		e.originalLength = binary.BigEndian.Uint64(b[36:44])
+	}
+
+	return nil
+}
+
+func (e *entryV2) IsDeleted() bool {
+	return e.flags&entryV2FlagDeleted != 0
+}
+
+func (e *entryV2) TimestampSeconds() int64 {
+	return e.timestampSeconds
+}
+
+func (e *entryV2) PackedFormatVersion() byte {
+	return e.formatVersion
+}
+
+func (e *entryV2) PackFileLength() byte {
+	return e.packFileLength
+}
+
+func (e *entryV2) PackFileOffset() uint32 {
+	return e.packFileOffset
+}
+
+func (e *entryV2) PackedOffset() uint64 {
+	return e.packedOffset
 }
 
-func (e *entry) PackedLength() uint32 {
+func (e *entryV2) PackedLength() uint64 {
 	return e.packedLength
 }
+
+func (e *entryV2) CompressionHeaderID() compression.HeaderID {
+	return compression.HeaderID(e.compressionHeaderID)
+}
+
+func (e *entryV2) OriginalLength() uint64 {
+	return e.originalLength
+}
+
+func (e *entryV2) EncryptionKeyID() byte {
+	return e.encryptionKeyID
+}
@@ -26,6 +26,7 @@ type index struct {
 }
 
 type headerInfo struct {
+	version    int
 	keySize    int
 	valueSize  int
 	entryCount int
@@ -38,11 +39,12 @@ func readHeader(readerAt io.ReaderAt) (headerInfo, error) {
 		return headerInfo{}, errors.Wrap(err, "invalid header")
 	}
 
-	if header[0] != 1 {
+	if header[0] != IndexVersion1 && header[0] != IndexVersion2 {
 		return headerInfo{}, errors.Errorf("invalid header format: %v", header[0])
 	}
 
 	hi := headerInfo{
+		version:    int(header[0]),
 		keySize:    int(header[1]),
 		valueSize:  int(binary.BigEndian.Uint16(header[2:4])),
 		entryCount: int(binary.BigEndian.Uint32(header[4:8])),
@@ -163,8 +165,16 @@ func (b *index) GetInfo(contentID ID) (*Info, error) {
 	return &i, err
 }
 
+func (b *index) newEntry() indexEntry {
+	if b.hdr.version == IndexVersion2 {
+		return &entryV2{}
+	}
+
+	return &entry{}
+}
+
 func (b *index) entryToInfo(contentID ID, entryData []byte) (Info, error) {
-	var e entry
+	e := b.newEntry()
 	if err := e.parse(entryData); err != nil {
 		return Info{}, err
 	}
@@ -177,13 +187,16 @@ func (b *index) entryToInfo(contentID ID, entryData []byte) (Info, error) {
 	}
 
 	return Info{
-		ID:               contentID,
-		Deleted:          e.IsDeleted(),
-		TimestampSeconds: e.TimestampSeconds(),
-		FormatVersion:    e.PackedFormatVersion(),
-		PackOffset:       e.PackedOffset(),
-		Length:           e.PackedLength(),
-		PackBlobID:       blob.ID(packFile),
+		ID:                  contentID,
+		Deleted:             e.IsDeleted(),
+		TimestampSeconds:    e.TimestampSeconds(),
+		FormatVersion:       e.PackedFormatVersion(),
+		PackOffset:          e.PackedOffset(),
+		Length:              e.PackedLength(),
+		PackBlobID:          blob.ID(packFile),
+		CompressionHeaderID: e.CompressionHeaderID(),
+		OriginalLength:      e.OriginalLength(),
+		EncryptionKeyID:     e.EncryptionKeyID(),
 	}, nil
 }
 
@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/compression"
 )
 
 // ID is an identifier of content in content-addressable storage.
@@ -26,13 +27,18 @@ func (i ID) HasPrefix() bool {
 // Info is an information about a single piece of content managed by Manager.
 type Info struct {
 	ID               ID      `json:"contentID"`
-	Length           uint32  `json:"length"`
+	Length           uint64  `json:"length"`
 	TimestampSeconds int64   `json:"time"`
 	PackBlobID       blob.ID `json:"packFile,omitempty"`
-	PackOffset       uint32  `json:"packOffset,omitempty"`
+	PackOffset       uint64  `json:"packOffset,omitempty"`
 	Deleted          bool    `json:"deleted"`
 	Payload          []byte  `json:"payload"` // set for payloads stored inline
 	FormatVersion    byte    `json:"formatVersion"`
+
+	// CompressionHeaderID, OriginalLength and EncryptionKeyID are only persisted by index format v2.
+	CompressionHeaderID compression.HeaderID `json:"compression,omitempty"`
+	OriginalLength      uint64               `json:"originalLength,omitempty"` // length before compression, set for compressed contents
+	EncryptionKeyID     byte                 `json:"encryptionKeyID,omitempty"`
 }
 
 // Timestamp returns the time when a content was created or deleted.
@@ -32,7 +32,7 @@ func (m mergedIndex) GetInfo(id ID) (*Info, error) {
 		}
 
 		if i != nil {
-			if best == nil || i.TimestampSeconds > best.TimestampSeconds || (i.TimestampSeconds == best.TimestampSeconds && !i.Deleted) {
+			if best == nil || i.TimestampSeconds > best.TimestampSeconds || (i.TimestampSeconds == best.TimestampSeconds && !i.Deleted && (best.Deleted || i.EncryptionKeyID >= best.EncryptionKeyID)) {
 				best = i
 			}
 		}
@@ -58,7 +58,12 @@ func (h nextInfoHeap) Less(i, j int) bool {
 		return a < b
 	}
 
-	return !h[i].it.Deleted
+	if a, b := h[i].it.Deleted, h[j].it.Deleted; a != b {
+		return !a
+	}
+
+	// contents re-encrypted within the same second take precedence.
+	return h[i].it.EncryptionKeyID > h[j].it.EncryptionKeyID
 }
 
 func (h nextInfoHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
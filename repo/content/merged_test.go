@@ -45,7 +45,7 @@ func TestMerged(t *testing.T) {
 		t.Fatalf("unable to get info: %v", err)
 	}
 
-	if got, want := i.PackOffset, uint32(33); got != want {
+	if got, want := i.PackOffset, uint64(33); got != want {
 		t.Errorf("invalid pack offset %v, wanted %v", got, want)
 	}
 
@@ -85,7 +85,42 @@ func TestMerged(t *testing.T) {
 	}
 }
 
+func TestMergedPrefersRecentEncryptionKey(t *testing.T) {
+	// content re-encrypted within the same second as it was originally written.
+	i1, err := indexWithVersionAndItems(IndexVersion2, Info{ID: "aabbcc", TimestampSeconds: 1, PackBlobID: "xx", PackOffset: 11})
+	if err != nil {
+		t.Fatalf("can't create index: %v", err)
+	}
+
+	i2, err := indexWithVersionAndItems(IndexVersion2, Info{ID: "aabbcc", TimestampSeconds: 1, PackBlobID: "yy", PackOffset: 22, EncryptionKeyID: 1})
+	if err != nil {
+		t.Fatalf("can't create index: %v", err)
+	}
+
+	for _, m := range []mergedIndex{{i1, i2}, {i2, i1}} {
+		i, err := m.GetInfo("aabbcc")
+		if err != nil || i == nil {
+			t.Fatalf("unable to get info: %v", err)
+		}
+
+		if got, want := i.EncryptionKeyID, byte(1); got != want {
+			t.Errorf("GetInfo returned content encrypted with key %v, want %v", got, want)
+		}
+
+		assertNoError(t, m.Iterate("", func(i Info) error {
+			if got, want := i.EncryptionKeyID, byte(1); got != want {
+				t.Errorf("Iterate returned content encrypted with key %v, want %v", got, want)
+			}
+			return nil
+		}))
+	}
+}
+
 func indexWithItems(items ...Info) (packIndex, error) {
+	return indexWithVersionAndItems(IndexVersion1, items...)
+}
+
+func indexWithVersionAndItems(version int, items ...Info) (packIndex, error) {
 	b := make(packIndexBuilder)
 
 	for _, it := range items {
@@ -93,7 +128,7 @@ func indexWithItems(items ...Info) (packIndex, error) {
 	}
 
 	var buf bytes.Buffer
-	if err := b.Build(&buf); err != nil {
+	if err := b.Build(&buf, version); err != nil {
 		return nil, errors.Wrap(err, "build error")
 	}
 
@@ -11,6 +11,7 @@ import (
 	"testing"
 
 	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/compression"
 )
 
 func deterministicContentID(prefix string, id int) ID {
@@ -39,17 +40,17 @@ func deterministicPackBlobID(id int) blob.ID {
 	return blob.ID(fmt.Sprintf("%x", h.Sum(nil)))
 }
 
-func deterministicPackedOffset(id int) uint32 {
+func deterministicPackedOffset(id int) uint64 {
 	s := rand.NewSource(int64(id + 1))
 	rnd := rand.New(s)
 
-	return uint32(rnd.Int31())
+	return uint64(rnd.Int31())
 }
-func deterministicPackedLength(id int) uint32 {
+func deterministicPackedLength(id int) uint64 {
 	s := rand.NewSource(int64(id + 2))
 	rnd := rand.New(s)
 
-	return uint32(rnd.Int31())
+	return uint64(rnd.Int31())
 }
 func deterministicFormatVersion(id int) byte {
 	return byte(id % 100)
@@ -59,8 +60,16 @@ func randomUnixTime() int64 {
 	return int64(rand.Int31())
 }
 
+func TestPackIndex_V1(t *testing.T) {
+	testPackIndex(t, IndexVersion1)
+}
+
+func TestPackIndex_V2(t *testing.T) {
+	testPackIndex(t, IndexVersion2)
+}
+
 //nolint:gocyclo,funlen
-func TestPackIndex(t *testing.T) {
+func testPackIndex(t *testing.T, version int) {
 	var infos []Info
 
 	// deleted contents with all information
@@ -87,6 +96,17 @@ func TestPackIndex(t *testing.T) {
 		})
 	}
 
+	if version == IndexVersion2 {
+		// exercise values that can't be represented in v1 format.
+		for i := range infos {
+			infos[i].PackOffset += 1 << 40
+			infos[i].Length += 1 << 33
+			infos[i].CompressionHeaderID = compression.HeaderID(i % 3)
+			infos[i].OriginalLength = uint64(i)
+			infos[i].EncryptionKeyID = byte(i % 2)
+		}
+	}
+
 	infoMap := map[ID]Info{}
 	b1 := make(packIndexBuilder)
 	b2 := make(packIndexBuilder)
@@ -101,15 +121,15 @@ func TestPackIndex(t *testing.T) {
 
 	var buf1, buf2, buf3 bytes.Buffer
 
-	if err := b1.Build(&buf1); err != nil {
+	if err := b1.Build(&buf1, version); err != nil {
 		t.Errorf("unable to build: %v", err)
 	}
 
-	if err := b1.Build(&buf2); err != nil {
+	if err := b1.Build(&buf2, version); err != nil {
 		t.Errorf("unable to build: %v", err)
 	}
 
-	if err := b1.Build(&buf3); err != nil {
+	if err := b1.Build(&buf3, version); err != nil {
 		t.Errorf("unable to build: %v", err)
 	}
 
@@ -191,6 +211,31 @@ func TestPackIndex(t *testing.T) {
 	}
 }
 
+func TestPackIndexV1Limits(t *testing.T) {
+	cases := []Info{
+		{ID: "abcdef", PackBlobID: "p1", PackOffset: 1 << 31, Length: 10},
+		{ID: "abcdef", PackBlobID: "p1", PackOffset: 10, Length: 1 << 32},
+		{ID: "abcdef", PackBlobID: "p1", PackOffset: 10, Length: 10, CompressionHeaderID: 1, OriginalLength: 20},
+	}
+
+	for _, tc := range cases {
+		b := make(packIndexBuilder)
+		b.Add(tc)
+
+		var buf bytes.Buffer
+
+		if err := b.Build(&buf, IndexVersion1); err == nil {
+			t.Errorf("unexpected success building v1 index for %+v", tc)
+		}
+
+		buf.Reset()
+
+		if err := b.Build(&buf, IndexVersion2); err != nil {
+			t.Errorf("unable to build v2 index for %+v: %v", tc, err)
+		}
+	}
+}
+
 func fuzzTestIndexOpen(originalData []byte) {
 	// use consistent random
 	rnd := rand.New(rand.NewSource(12345))
@@ -3,11 +3,16 @@ package repo
 import (
 	"context"
 	"crypto/sha256"
+	"io/ioutil"
+	"os"
 	"reflect"
 	"testing"
 
 	"github.com/kopia/kopia/internal/blobtesting"
 	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/blob/filesystem"
+	"github.com/kopia/kopia/repo/content"
+	"github.com/kopia/kopia/repo/object"
 )
 
 func TestFormatBlobRecovery(t *testing.T) {
@@ -81,3 +86,122 @@ func assertNoError(t *testing.T, err error) {
 		t.Errorf("err: %v", err)
 	}
 }
+
+func TestCachedFormatBlobRefreshed(t *testing.T) {
+	ctx := context.Background()
+
+	storageDir, err := ioutil.TempDir("", "kopia-repo")
+	if err != nil {
+		t.Fatalf("unable to create storage directory: %v", err)
+	}
+
+	defer os.RemoveAll(storageDir) //nolint:errcheck
+
+	st, err := filesystem.New(ctx, &filesystem.Options{Path: storageDir})
+	if err != nil {
+		t.Fatalf("unable to create storage: %v", err)
+	}
+
+	if err = Initialize(ctx, st, &NewRepositoryOptions{
+		BlockFormat: content.FormattingOptions{
+			Hash:         content.DefaultHash,
+			Encryption:   content.DefaultEncryption,
+			IndexVersion: content.IndexVersion2,
+		},
+	}, "password"); err != nil {
+		t.Fatalf("unable to initialize: %v", err)
+	}
+
+	openWithCache := func(cacheDir, password string) (*Repository, error) {
+		return OpenWithConfig(ctx, st, &LocalConfig{}, password, &Options{}, content.CachingOptions{CacheDirectory: cacheDir})
+	}
+
+	mustOpenWithCache := func(cacheDir, password string) *Repository {
+		t.Helper()
+
+		r, err := openWithCache(cacheDir, password)
+		if err != nil {
+			t.Fatalf("unable to open: %v", err)
+		}
+
+		return r
+	}
+
+	staleCacheDir, err := ioutil.TempDir("", "kopia-format-cache")
+	if err != nil {
+		t.Fatalf("unable to create cache directory: %v", err)
+	}
+
+	defer os.RemoveAll(staleCacheDir) //nolint:errcheck
+
+	mustOpenWithCache(staleCacheDir, "password").Close(ctx) //nolint:errcheck
+
+	// the cached format blob is used without reading it from storage.
+	original, err := st.GetBlob(ctx, FormatBlobID, 0, -1)
+	if err != nil {
+		t.Fatalf("unable to read format blob: %v", err)
+	}
+
+	if err = st.DeleteBlob(ctx, FormatBlobID); err != nil {
+		t.Fatalf("unable to delete format blob: %v", err)
+	}
+
+	mustOpenWithCache(staleCacheDir, "password").Close(ctx) //nolint:errcheck
+
+	if err = st.PutBlob(ctx, FormatBlobID, original); err != nil {
+		t.Fatalf("unable to restore format blob: %v", err)
+	}
+
+	// another client changes the password and rotates the key within the same second.
+	r := mustOpenWithCache("", "password")
+
+	if err = r.ChangePassword(ctx, "new-password"); err != nil {
+		t.Fatalf("unable to change password: %v", err)
+	}
+
+	r.Close(ctx) //nolint:errcheck
+
+	for keyID := byte(1); keyID <= 2; keyID++ {
+		r = mustOpenWithCache("", "new-password")
+
+		if _, err = r.RotateKey(ctx); err != nil {
+			t.Fatalf("unable to rotate key: %v", err)
+		}
+
+		r.Close(ctx) //nolint:errcheck
+
+		r = mustOpenWithCache("", "new-password")
+
+		w := r.Objects.NewWriter(ctx, object.WriterOptions{})
+		w.Write([]byte{1, 2, keyID}) //nolint:errcheck
+
+		oid, err := w.Result()
+		if err != nil {
+			t.Fatalf("unable to write object: %v", err)
+		}
+
+		if err = r.Flush(ctx); err != nil {
+			t.Fatalf("unable to flush: %v", err)
+		}
+
+		r.Close(ctx) //nolint:errcheck
+
+		// the stale cached format blob is replaced once index blobs encrypted with the new key can't be decrypted.
+		r = mustOpenWithCache(staleCacheDir, "new-password")
+
+		if got := r.Content.Format.EncryptionKeyID; got != keyID {
+			t.Errorf("unexpected key generation: %v, want %v", got, keyID)
+		}
+
+		or, err := r.Objects.Open(ctx, oid)
+		if err != nil {
+			t.Fatalf("unable to open object: %v", err)
+		}
+
+		if b, err := ioutil.ReadAll(or); err != nil || !reflect.DeepEqual(b, []byte{1, 2, keyID}) {
+			t.Errorf("unexpected object contents: %v %v", b, err)
+		}
+
+		r.Close(ctx) //nolint:errcheck
+	}
+}
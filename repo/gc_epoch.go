@@ -0,0 +1,135 @@
+package repo
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/content"
+)
+
+// GCEpochBlobPrefix is the prefix of blobs recording GC epochs.
+const GCEpochBlobPrefix blob.ID = "e"
+
+// GCEpoch records the set of contents found to be unreferenced by a single garbage collection run.
+// Those contents are deleted by the next run, if they are still unreferenced at that time.
+// Epoch blobs are encrypted, since they describe the structure of the repository.
+type GCEpoch struct {
+	Number     int          `json:"epoch"`
+	Time       time.Time    `json:"time"`
+	Candidates []content.ID `json:"candidates"`
+}
+
+func (e *GCEpoch) blobID() blob.ID {
+	return GCEpochBlobPrefix + blob.ID(fmt.Sprintf("%016x", e.Number))
+}
+
+// CandidateSet returns the set of contents pending deletion in the epoch, which is empty for nil epoch.
+func (e *GCEpoch) CandidateSet() map[content.ID]bool {
+	result := map[content.ID]bool{}
+
+	if e == nil {
+		return result
+	}
+
+	for _, cid := range e.Candidates {
+		result[cid] = true
+	}
+
+	return result
+}
+
+// listGCEpochBlobs returns metadata of all epoch blobs sorted by epoch number.
+func listGCEpochBlobs(ctx context.Context, st blob.Storage) ([]blob.Metadata, error) {
+	blobs, err := blob.ListAllBlobs(ctx, st, GCEpochBlobPrefix)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to list GC epochs")
+	}
+
+	sort.Slice(blobs, func(i, j int) bool {
+		return blobs[i].BlobID < blobs[j].BlobID
+	})
+
+	return blobs, nil
+}
+
+// LoadLatestGCEpoch returns the most recent GC epoch or nil if garbage collection has never run.
+func (r *Repository) LoadLatestGCEpoch(ctx context.Context) (*GCEpoch, error) {
+	blobs, err := listGCEpochBlobs(ctx, r.Blobs)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(blobs) == 0 {
+		return nil, nil
+	}
+
+	latest := blobs[len(blobs)-1].BlobID
+
+	b, err := r.Blobs.GetBlob(ctx, latest, 0, -1)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to read GC epoch %v", latest)
+	}
+
+	b, err = r.Content.DecryptBlob(b)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to decrypt GC epoch %v", latest)
+	}
+
+	gz, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid GC epoch %v", latest)
+	}
+
+	e := &GCEpoch{}
+	if err := json.NewDecoder(gz).Decode(e); err != nil {
+		return nil, errors.Wrapf(err, "invalid GC epoch %v", latest)
+	}
+
+	return e, nil
+}
+
+// WriteGCEpoch writes the provided epoch and removes all older epochs.
+func (r *Repository) WriteGCEpoch(ctx context.Context, e *GCEpoch) error {
+	var buf bytes.Buffer
+
+	gz := gzip.NewWriter(&buf)
+	if err := json.NewEncoder(gz).Encode(e); err != nil {
+		return errors.Wrap(err, "unable to encode GC epoch")
+	}
+
+	if err := gz.Close(); err != nil {
+		return errors.Wrap(err, "unable to compress GC epoch")
+	}
+
+	b, err := r.Content.EncryptBlob(buf.Bytes())
+	if err != nil {
+		return errors.Wrap(err, "unable to encrypt GC epoch")
+	}
+
+	if err := r.Blobs.PutBlob(ctx, e.blobID(), b); err != nil {
+		return errors.Wrap(err, "unable to write GC epoch")
+	}
+
+	blobs, err := listGCEpochBlobs(ctx, r.Blobs)
+	if err != nil {
+		return err
+	}
+
+	for _, bm := range blobs {
+		if bm.BlobID < e.blobID() {
+			if err := r.Blobs.DeleteBlob(ctx, bm.BlobID); err != nil && err != blob.ErrBlobNotFound {
+				return errors.Wrapf(err, "unable to delete old GC epoch %v", bm.BlobID)
+			}
+		}
+	}
+
+	return nil
+}
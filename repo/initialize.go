@@ -87,12 +87,13 @@ func formatBlobFromOptions(opt *NewRepositoryOptions) *formatBlob {
 func repositoryObjectFormatFromOptions(opt *NewRepositoryOptions) *repositoryObjectFormat {
 	f := &repositoryObjectFormat{
 		FormattingOptions: content.FormattingOptions{
-			Version:     1,
-			Hash:        applyDefaultString(opt.BlockFormat.Hash, content.DefaultHash),
-			Encryption:  applyDefaultString(opt.BlockFormat.Encryption, content.DefaultEncryption),
-			HMACSecret:  applyDefaultRandomBytes(opt.BlockFormat.HMACSecret, hmacSecretLength), //nolint:gomnd
-			MasterKey:   applyDefaultRandomBytes(opt.BlockFormat.MasterKey, masterKeyLength),   //nolint:gomnd
-			MaxPackSize: applyDefaultInt(opt.BlockFormat.MaxPackSize, 20<<20),                  //nolint:gomnd
+			Hash:         applyDefaultString(opt.BlockFormat.Hash, content.DefaultHash),
+			Encryption:   applyDefaultString(opt.BlockFormat.Encryption, content.DefaultEncryption),
+			HMACSecret:   applyDefaultRandomBytes(opt.BlockFormat.HMACSecret, hmacSecretLength), //nolint:gomnd
+			MasterKey:    applyDefaultRandomBytes(opt.BlockFormat.MasterKey, masterKeyLength),   //nolint:gomnd
+			MaxPackSize:  applyDefaultInt(opt.BlockFormat.MaxPackSize, 20<<20),                  //nolint:gomnd
+			IndexVersion: applyDefaultInt(opt.BlockFormat.IndexVersion, content.DefaultIndexVersion),
+			ECC:          opt.BlockFormat.ECC,
 		},
 		Format: object.Format{
 			Splitter: applyDefaultString(opt.ObjectFormat.Splitter, object.DefaultSplitter),
@@ -103,6 +104,8 @@ func repositoryObjectFormatFromOptions(opt *NewRepositoryOptions) *repositoryObj
 		f.HMACSecret = nil
 	}
 
+	f.Version = f.RequiredVersion()
+
 	return f
 }
 
@@ -0,0 +1,96 @@
+package repo
+
+import (
+	"context"
+	"crypto/rand"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// ChangePassword re-encrypts the format blob using a key derived from the new password. Contents are not
+// affected, since they are encrypted with master keys stored in the format blob, which remain unchanged.
+func (r *Repository) ChangePassword(ctx context.Context, newPassword string) error {
+	if r.readOnly {
+		return ErrReadOnly
+	}
+
+	f := r.formatBlob
+	if f.EncryptionAlgorithm == "NONE" {
+		return errors.Errorf("repository format is not encrypted")
+	}
+
+	repoConfig, err := f.decryptFormatBytes(r.masterKey)
+	if err != nil {
+		return errors.Wrap(err, "unable to decrypt repository config")
+	}
+
+	newMasterKey, err := f.deriveMasterKeyFromPassword(newPassword)
+	if err != nil {
+		return errors.Wrap(err, "unable to derive master key")
+	}
+
+	if err := r.updateFormatBlob(ctx, repoConfig, newMasterKey); err != nil {
+		return err
+	}
+
+	r.masterKey = newMasterKey
+
+	return nil
+}
+
+// RotateKey generates a new master key used to encrypt contents and index blobs written afterwards and returns
+// its generation. Existing data remains readable using retired keys until it is re-encrypted. The new key takes
+// effect when the repository is opened next time. Other clients keep using their cached format blob until they find
+// index blobs they can't decrypt with it, at which point they read the format blob from storage.
+//
+// Since master keys are stored in the format blob, the password should be changed as well if it may have leaked.
+func (r *Repository) RotateKey(ctx context.Context) (byte, error) {
+	if r.readOnly {
+		return 0, ErrReadOnly
+	}
+
+	repoConfig, err := r.formatBlob.decryptFormatBytes(r.masterKey)
+	if err != nil {
+		return 0, errors.Wrap(err, "unable to decrypt repository config")
+	}
+
+	newKey := make([]byte, masterKeyLength)
+	if _, err := io.ReadFull(rand.Reader, newKey); err != nil {
+		return 0, errors.Wrap(err, "unable to generate master key")
+	}
+
+	if err := repoConfig.FormattingOptions.RotateMasterKey(newKey); err != nil {
+		return 0, err
+	}
+
+	if err := r.updateFormatBlob(ctx, repoConfig, r.masterKey); err != nil {
+		return 0, err
+	}
+
+	return repoConfig.FormattingOptions.EncryptionKeyID, nil
+}
+
+// updateFormatBlob encrypts the repository config with the provided master key, writes the format blob and
+// removes its locally cached copy.
+func (r *Repository) updateFormatBlob(ctx context.Context, repoConfig *repositoryObjectFormat, masterKey []byte) error {
+	f := r.formatBlob
+
+	if err := encryptFormatBytes(f, repoConfig, masterKey, f.UniqueID); err != nil {
+		return errors.Wrap(err, "unable to encrypt format bytes")
+	}
+
+	if err := writeFormatBlob(ctx, r.Blobs, f); err != nil {
+		return err
+	}
+
+	if d := r.Content.CachingOptions.CacheDirectory; d != "" {
+		if err := os.Remove(filepath.Join(d, FormatBlobID)); err != nil && !os.IsNotExist(err) {
+			return errors.Wrap(err, "unable to remove cached format blob")
+		}
+	}
+
+	return nil
+}
@@ -6,6 +6,7 @@ import (
 	"os"
 
 	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/blob/throttling"
 	"github.com/kopia/kopia/repo/content"
 	"github.com/kopia/kopia/repo/object"
 )
@@ -14,6 +15,13 @@ import (
 type LocalConfig struct {
 	Storage blob.ConnectionInfo    `json:"storage"`
 	Caching content.CachingOptions `json:"caching"`
+
+	ReadOnly   bool `json:"readonly,omitempty"`   // prevents all modifications of the repository
+	AppendOnly bool `json:"appendOnly,omitempty"` // allows adding data, but prevents deleting or overwriting blobs
+
+	EnableActions bool `json:"enableActions,omitempty"` // allows running commands defined as actions in snapshot policies
+
+	Throttling throttling.Limits `json:"throttling"` // storage bandwidth limits
 }
 
 // repositoryObjectFormat describes the format of objects in a repository.
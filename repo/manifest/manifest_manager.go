@@ -15,6 +15,7 @@ import (
 	"github.com/pkg/errors"
 
 	"github.com/kopia/kopia/internal/repologging"
+	"github.com/kopia/kopia/repo/compression"
 	"github.com/kopia/kopia/repo/content"
 )
 
@@ -34,7 +35,7 @@ const TypeLabelKey = "type"
 
 type contentManager interface {
 	GetContent(ctx context.Context, contentID content.ID) ([]byte, error)
-	WriteContent(ctx context.Context, data []byte, prefix content.ID) (content.ID, error)
+	WriteContent(ctx context.Context, data []byte, prefix content.ID, comp compression.HeaderID) (content.ID, error)
 	DeleteContent(contentID content.ID) error
 	IterateContents(content.IterateOptions, content.IterateCallback) error
 	DisableIndexFlush()
@@ -240,7 +241,8 @@ func (m *Manager) flushPendingEntriesLocked(ctx context.Context) (content.ID, er
 	mustSucceed(gz.Flush())
 	mustSucceed(gz.Close())
 
-	contentID, err := m.b.WriteContent(ctx, buf.Bytes(), ContentPrefix)
+	// manifests are already gzip-compressed.
+	contentID, err := m.b.WriteContent(ctx, buf.Bytes(), ContentPrefix, compression.NoCompression)
 	if err != nil {
 		return "", err
 	}
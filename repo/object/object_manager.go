@@ -6,6 +6,7 @@ import (
 	"context"
 	"encoding/json"
 	"io"
+	"sync"
 
 	"github.com/pkg/errors"
 
@@ -27,7 +28,8 @@ type Reader interface {
 type contentManager interface {
 	ContentInfo(ctx context.Context, contentID content.ID) (content.Info, error)
 	GetContent(ctx context.Context, contentID content.ID) ([]byte, error)
-	WriteContent(ctx context.Context, data []byte, prefix content.ID) (content.ID, error)
+	WriteContent(ctx context.Context, data []byte, prefix content.ID, comp compression.HeaderID) (content.ID, error)
+	SupportsContentCompression() bool
 }
 
 // Format describes the format of objects in a repository.
@@ -43,6 +45,18 @@ type Manager struct {
 	trace      func(message string, args ...interface{})
 
 	newSplitter func() Splitter
+
+	zeroChunksMutex sync.Mutex
+	zeroChunks      map[zeroChunkKey]ID
+}
+
+// zeroChunkSize is the maximum length of a shared chunk of zeros written by Writer.WriteZeros().
+const zeroChunkSize = 4 << 20
+
+type zeroChunkKey struct {
+	prefix     content.ID
+	compressor compression.HeaderID
+	length     int64
 }
 
 // NewWriter creates an ObjectWriter for writing to the repository.
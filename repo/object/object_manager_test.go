@@ -23,6 +23,10 @@ import (
 type fakeContentManager struct {
 	mu   sync.Mutex
 	data map[content.ID][]byte
+
+	supportsContentCompression bool
+	compressedContents         map[content.ID]compression.HeaderID
+	writtenBytes               int64
 }
 
 func (f *fakeContentManager) GetContent(ctx context.Context, contentID content.ID) ([]byte, error) {
@@ -36,7 +40,7 @@ func (f *fakeContentManager) GetContent(ctx context.Context, contentID content.I
 	return nil, content.ErrContentNotFound
 }
 
-func (f *fakeContentManager) WriteContent(ctx context.Context, data []byte, prefix content.ID) (content.ID, error) {
+func (f *fakeContentManager) WriteContent(ctx context.Context, data []byte, prefix content.ID, comp compression.HeaderID) (content.ID, error) {
 	h := sha256.New()
 	h.Write(data) //nolint:errcheck
 	contentID := prefix + content.ID(hex.EncodeToString(h.Sum(nil)))
@@ -45,16 +49,25 @@ func (f *fakeContentManager) WriteContent(ctx context.Context, data []byte, pref
 	defer f.mu.Unlock()
 
 	f.data[contentID] = append([]byte(nil), data...)
+	f.writtenBytes += int64(len(data))
+
+	if comp != compression.NoCompression {
+		f.compressedContents[contentID] = comp
+	}
 
 	return contentID, nil
 }
 
+func (f *fakeContentManager) SupportsContentCompression() bool {
+	return f.supportsContentCompression
+}
+
 func (f *fakeContentManager) ContentInfo(ctx context.Context, contentID content.ID) (content.Info, error) {
 	f.mu.Lock()
 	defer f.mu.Unlock()
 
 	if d, ok := f.data[contentID]; ok {
-		return content.Info{ID: contentID, Length: uint32(len(d))}, nil
+		return content.Info{ID: contentID, Length: uint64(len(d))}, nil
 	}
 
 	return content.Info{}, blob.ErrBlobNotFound
@@ -69,14 +82,18 @@ func setupTest(t *testing.T) (map[content.ID][]byte, *Manager) {
 }
 
 func setupTestWithData(t *testing.T, data map[content.ID][]byte, opts ManagerOptions) (map[content.ID][]byte, *Manager) {
-	r, err := NewObjectManager(context.Background(), &fakeContentManager{data: data}, Format{
+	return setupTestWithContentManager(t, &fakeContentManager{data: data, compressedContents: map[content.ID]compression.HeaderID{}}, opts)
+}
+
+func setupTestWithContentManager(t *testing.T, cm *fakeContentManager, opts ManagerOptions) (map[content.ID][]byte, *Manager) {
+	r, err := NewObjectManager(context.Background(), cm, Format{
 		Splitter: "FIXED-1M",
 	}, opts)
 	if err != nil {
 		t.Fatalf("can't create object manager: %v", err)
 	}
 
-	return data, r
+	return cm.data, r
 }
 
 func TestWriters(t *testing.T) {
@@ -124,6 +141,61 @@ func TestWriters(t *testing.T) {
 	}
 }
 
+func TestWriteZeros(t *testing.T) {
+	ctx := context.Background()
+	cm := &fakeContentManager{data: map[content.ID][]byte{}, compressedContents: map[content.ID]compression.HeaderID{}}
+	_, om := setupTestWithContentManager(t, cm, ManagerOptions{})
+
+	head := makeCompressibleData(1000)
+	tail := makeCompressibleData(300)
+	holeSize := int64(2*zeroChunkSize + 100)
+
+	for i := 0; i < 2; i++ {
+		writtenBefore := cm.writtenBytes
+
+		writer := om.NewWriter(ctx, WriterOptions{Description: "sparse"})
+		writer.Write(head) //nolint:errcheck
+
+		if err := writer.WriteZeros(holeSize); err != nil {
+			t.Fatalf("unable to write zeros: %v", err)
+		}
+
+		writer.Write(tail) //nolint:errcheck
+
+		if err := writer.WriteZeros(100); err != nil {
+			t.Fatalf("unable to write zeros: %v", err)
+		}
+
+		oid, err := writer.Result()
+		if err != nil {
+			t.Fatalf("unable to write: %v", err)
+		}
+
+		if indirectionLevel(oid) != 1 {
+			t.Errorf("expected indirect object, got %v", oid)
+		}
+
+		expected := append(append(append(append([]byte(nil), head...), make([]byte, holeSize)...), tail...), make([]byte, 100)...)
+
+		verify(ctx, t, om, oid, expected, "sparse")
+
+		r, err := om.Open(ctx, oid)
+		if err != nil {
+			t.Fatalf("open error: %v", err)
+		}
+
+		got, err := ioutil.ReadAll(r)
+		if err != nil || !bytes.Equal(got, expected) {
+			t.Errorf("invalid contents read: %v", err)
+		}
+
+		// zero chunks are stored only once and never re-hashed.
+		if got, max := cm.writtenBytes-writtenBefore, int64(len(head)+len(tail)+zeroChunkSize+200+4096); got > max {
+			t.Errorf("too many bytes written on attempt %v: %v, expected at most %v", i, got, max)
+		}
+	}
+}
+
 func objectIDsEqual(o1, o2 ID) bool {
 	return o1 == o2
 }
@@ -369,6 +441,58 @@ func TestEndToEndReadAndSeekWithCompression(t *testing.T) {
 	}
 }
 
+func TestContentLevelCompression(t *testing.T) {
+	ctx := context.Background()
+
+	cm := &fakeContentManager{
+		data:                       map[content.ID][]byte{},
+		compressedContents:         map[content.ID]compression.HeaderID{},
+		supportsContentCompression: true,
+	}
+
+	_, om := setupTestWithContentManager(t, cm, ManagerOptions{})
+
+	randomData := makeCompressibleData(1000)
+
+	writer := om.NewWriter(ctx, WriterOptions{Compressor: "gzip"})
+	if _, err := writer.Write(randomData); err != nil {
+		t.Fatalf("write error: %v", err)
+	}
+
+	objectID, err := writer.Result()
+	if err != nil {
+		t.Fatalf("cannot get writer result: %v", err)
+	}
+
+	writer.Close()
+
+	contentID, compressed, ok := objectID.ContentID()
+	if !ok || compressed {
+		t.Errorf("unexpected object ID %v, expected uncompressed direct object", objectID)
+	}
+
+	if got, want := cm.compressedContents[contentID], compression.ByName["gzip"].HeaderID(); got != want {
+		t.Errorf("unexpected content compression %x, want %x", got, want)
+	}
+
+	// object ID does not depend on the compressor.
+	writer2 := om.NewWriter(ctx, WriterOptions{})
+	if _, err := writer2.Write(randomData); err != nil {
+		t.Fatalf("write error: %v", err)
+	}
+
+	objectID2, err := writer2.Result()
+	if err != nil {
+		t.Fatalf("cannot get writer result: %v", err)
+	}
+
+	writer2.Close()
+
+	if objectID != objectID2 {
+		t.Errorf("object ID depends on compressor: %v vs %v", objectID, objectID2)
+	}
+}
+
 func makeCompressibleData(size int) []byte {
 	phrase := []byte("quick brown fox")
 	return append(append([]byte(nil), phrase[0:size%len(phrase)]...), bytes.Repeat(phrase, size/len(phrase))...)
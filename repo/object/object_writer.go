@@ -18,6 +18,10 @@ import (
 type Writer interface {
 	io.WriteCloser
 
+	// WriteZeros appends the provided number of zero bytes by referencing shared chunks of zeros,
+	// which are neither split nor hashed again.
+	WriteZeros(length int64) error
+
 	Result() (ID, error)
 }
 
@@ -98,18 +102,39 @@ func (w *objectWriter) flushBuffer() error {
 	w.indirectIndex[chunkID].Length = int64(length)
 	w.currentPosition += int64(length)
 
-	contentBytes, isCompressed, err := maybeCompressedContentBytes(w.compressor, w.buffer.Bytes())
+	oid, err := w.storeChunk(w.buffer.Bytes())
+	w.repo.trace("OBJECT_WRITER(%q) stored %v (%v bytes)", w.description, oid, length)
+
+	w.buffer.Reset()
+
 	if err != nil {
-		return errors.Wrap(err, "unable to prepare content bytes")
+		return errors.Wrapf(err, "error when flushing chunk %d of %s", chunkID, w.description)
 	}
 
-	w.buffer.Reset()
+	w.indirectIndex[chunkID].Object = oid
+
+	return nil
+}
+
+// storeChunk writes the provided chunk of data as a content and returns its object ID.
+func (w *objectWriter) storeChunk(b []byte) (ID, error) {
+	comp := compression.NoCompression
+	compressor := w.compressor
+
+	if compressor != nil && w.repo.contentMgr.SupportsContentCompression() {
+		// compress at the content level, which keeps object IDs independent of the compressor.
+		comp = compressor.HeaderID()
+		compressor = nil
+	}
 
-	contentID, err := w.repo.contentMgr.WriteContent(w.ctx, contentBytes, w.prefix)
-	w.repo.trace("OBJECT_WRITER(%q) stored %v (%v bytes)", w.description, contentID, length)
+	contentBytes, isCompressed, err := maybeCompressedContentBytes(compressor, b)
+	if err != nil {
+		return "", errors.Wrap(err, "unable to prepare content bytes")
+	}
 
+	contentID, err := w.repo.contentMgr.WriteContent(w.ctx, contentBytes, w.prefix, comp)
 	if err != nil {
-		return errors.Wrapf(err, "error when flushing chunk %d of %s", chunkID, w.description)
+		return "", err
 	}
 
 	oid := DirectObjectID(contentID)
@@ -118,11 +143,75 @@ func (w *objectWriter) flushBuffer() error {
 		oid = Compressed(oid)
 	}
 
-	w.indirectIndex[chunkID].Object = oid
+	return oid, nil
+}
+
+func (w *objectWriter) WriteZeros(length int64) error {
+	if length <= 0 {
+		return nil
+	}
+
+	// end the current chunk, so that the zeros start at a chunk boundary.
+	if w.buffer.Len() > 0 {
+		if err := w.flushBuffer(); err != nil {
+			return err
+		}
+	}
+
+	w.totalLength += length
+
+	for length > 0 {
+		n := length
+		if n > zeroChunkSize {
+			n = zeroChunkSize
+		}
+
+		oid, err := w.zeroChunk(n)
+		if err != nil {
+			return errors.Wrapf(err, "error writing zeros of %s", w.description)
+		}
+
+		w.indirectIndex = append(w.indirectIndex, indirectObjectEntry{
+			Start:  w.currentPosition,
+			Length: n,
+			Object: oid,
+		})
+		w.currentPosition += n
+		length -= n
+	}
 
 	return nil
 }
 
+// zeroChunk returns the ID of an object consisting of the provided number of zero bytes,
+// which is stored only once per object manager.
+func (w *objectWriter) zeroChunk(length int64) (ID, error) {
+	key := zeroChunkKey{prefix: w.prefix, length: length}
+	if w.compressor != nil {
+		key.compressor = w.compressor.HeaderID()
+	}
+
+	w.repo.zeroChunksMutex.Lock()
+	defer w.repo.zeroChunksMutex.Unlock()
+
+	if oid, ok := w.repo.zeroChunks[key]; ok {
+		return oid, nil
+	}
+
+	oid, err := w.storeChunk(make([]byte, length))
+	if err != nil {
+		return "", err
+	}
+
+	if w.repo.zeroChunks == nil {
+		w.repo.zeroChunks = map[zeroChunkKey]ID{}
+	}
+
+	w.repo.zeroChunks[key] = oid
+
+	return oid, nil
+}
+
 func maybeCompressedContentBytes(comp compression.Compressor, b []byte) (data []byte, isCompressed bool, err error) {
 	if comp != nil {
 		compressedBytes, err := comp.Compress(b)
@@ -10,7 +10,10 @@ import (
 
 	"github.com/kopia/kopia/internal/repologging"
 	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/blob/appendonly"
 	"github.com/kopia/kopia/repo/blob/logging"
+	"github.com/kopia/kopia/repo/blob/readonly"
+	"github.com/kopia/kopia/repo/blob/throttling"
 	"github.com/kopia/kopia/repo/content"
 	"github.com/kopia/kopia/repo/manifest"
 	"github.com/kopia/kopia/repo/object"
@@ -70,12 +73,39 @@ func Open(ctx context.Context, configFile, password string, options *Options) (r
 
 // OpenWithConfig opens the repository with a given configuration, avoiding the need for a config file.
 func OpenWithConfig(ctx context.Context, st blob.Storage, lc *LocalConfig, password string, options *Options, caching content.CachingOptions) (*Repository, error) {
+	// storage is always wrapped so that the limits can be changed while the repository is open.
+	st = throttling.NewWrapper(st, lc.Throttling)
+	throttler := st.(throttling.Throttler)
+
+	switch {
+	case lc.ReadOnly:
+		st = readonly.NewWrapper(st)
+
+	case lc.AppendOnly:
+		st = appendonly.NewWrapper(st)
+	}
+
 	// Read format blob, potentially from cache.
-	fb, err := readAndCacheFormatBlobBytes(ctx, st, caching.CacheDirectory)
+	fb, cached, err := readAndCacheFormatBlobBytes(ctx, st, caching.CacheDirectory)
 	if err != nil {
 		return nil, errors.Wrap(err, "unable to read format blob")
 	}
 
+	r, err := openWithFormatBlob(ctx, st, throttler, lc, fb, password, options, caching)
+	if err != nil && cached {
+		// the cached format blob is outdated if another client has changed the password or has rotated the master
+		// key and written index blobs with it, so retry with the format blob read from storage.
+		if fb, err = refreshCachedFormatBlobBytes(ctx, st, caching.CacheDirectory); err != nil {
+			return nil, errors.Wrap(err, "unable to read format blob")
+		}
+
+		r, err = openWithFormatBlob(ctx, st, throttler, lc, fb, password, options, caching)
+	}
+
+	return r, err
+}
+
+func openWithFormatBlob(ctx context.Context, st blob.Storage, throttler throttling.Throttler, lc *LocalConfig, fb []byte, password string, options *Options, caching content.CachingOptions) (*Repository, error) {
 	f, err := parseFormatBlob(fb)
 	if err != nil {
 		return nil, errors.Wrap(err, "can't parse format blob")
@@ -105,7 +135,10 @@ func OpenWithConfig(ctx context.Context, st blob.Storage, lc *LocalConfig, passw
 		fo.MaxPackSize = 20 << 20 // nolint:gomnd
 	}
 
-	cm, err := content.NewManager(ctx, st, fo, caching, fb)
+	cm, err := content.NewManager(ctx, st, fo, caching, fb, content.ManagerOptions{
+		// index compaction deletes index blobs, which is not possible in read-only or append-only mode.
+		DisableIndexCompaction: lc.ReadOnly || lc.AppendOnly,
+	})
 	if err != nil {
 		return nil, errors.Wrap(err, "unable to open content manager")
 	}
@@ -129,6 +162,11 @@ func OpenWithConfig(ctx context.Context, st blob.Storage, lc *LocalConfig, passw
 
 		formatBlob: f,
 		masterKey:  masterKey,
+		readOnly:   lc.ReadOnly,
+		appendOnly: lc.AppendOnly,
+		throttler:  throttler,
+
+		enableActions: lc.EnableActions,
 	}, nil
 }
 
@@ -155,24 +193,65 @@ func (r *Repository) SetCachingConfig(opt content.CachingOptions) error {
 	return nil
 }
 
-func readAndCacheFormatBlobBytes(ctx context.Context, st blob.Storage, cacheDirectory string) ([]byte, error) {
-	cachedFile := filepath.Join(cacheDirectory, "kopia.repository")
+// SetThrottlingLimits changes storage bandwidth limits of the repository and persists them in the configuration file.
+func (r *Repository) SetThrottlingLimits(l throttling.Limits) error {
+	r.throttler.SetLimits(l)
+
+	if r.ConfigFile == "" {
+		return nil
+	}
+
+	lc, err := loadConfigFromFile(r.ConfigFile)
+	if err != nil {
+		return err
+	}
+
+	lc.Throttling = l
+
+	d, err := json.MarshalIndent(&lc, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(r.ConfigFile, d, 0600)
+}
+
+// ThrottlingLimits returns current storage bandwidth limits of the repository.
+func (r *Repository) ThrottlingLimits() throttling.Limits {
+	return r.throttler.Limits()
+}
+
+// Throttler returns the throttler of repository storage, which allows changing bandwidth limits temporarily
+// without persisting them in the configuration file.
+func (r *Repository) Throttler() throttling.Throttler {
+	return r.throttler
+}
 
+// readAndCacheFormatBlobBytes reads the format blob from the cache directory if it has been cached before and
+// from storage otherwise, in which case the cached copy is written.
+func readAndCacheFormatBlobBytes(ctx context.Context, st blob.Storage, cacheDirectory string) (b []byte, cached bool, err error) {
 	if cacheDirectory != "" {
-		b, err := ioutil.ReadFile(cachedFile) //nolint:gosec
+		b, err := ioutil.ReadFile(filepath.Join(cacheDirectory, FormatBlobID)) //nolint:gosec
 		if err == nil {
 			// read from cache.
-			return b, nil
+			return b, true, nil
 		}
 	}
 
+	b, err = refreshCachedFormatBlobBytes(ctx, st, cacheDirectory)
+
+	return b, false, err
+}
+
+// refreshCachedFormatBlobBytes reads the format blob from storage and replaces its cached copy.
+func refreshCachedFormatBlobBytes(ctx context.Context, st blob.Storage, cacheDirectory string) ([]byte, error) {
 	b, err := st.GetBlob(ctx, FormatBlobID, 0, -1)
 	if err != nil {
 		return nil, err
 	}
 
 	if cacheDirectory != "" {
-		if err := ioutil.WriteFile(cachedFile, b, 0600); err != nil {
+		if err := ioutil.WriteFile(filepath.Join(cacheDirectory, FormatBlobID), b, 0600); err != nil {
 			log.Warningf("warning: unable to write cache: %v", err)
 		}
 	}
@@ -7,11 +7,20 @@ import (
 	"github.com/pkg/errors"
 
 	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/blob/throttling"
 	"github.com/kopia/kopia/repo/content"
 	"github.com/kopia/kopia/repo/manifest"
 	"github.com/kopia/kopia/repo/object"
 )
 
+var (
+	// ErrReadOnly is returned when attempting to modify a repository connected in read-only mode.
+	ErrReadOnly = errors.New("repository is connected in read-only mode")
+
+	// ErrAppendOnly is returned when attempting to delete or rewrite data in a repository connected in append-only mode.
+	ErrAppendOnly = errors.New("repository is connected in append-only mode, which does not allow deleting or rewriting data")
+)
+
 // Repository represents storage where both content-addressable and user-addressable data is kept.
 type Repository struct {
 	Blobs     blob.Storage
@@ -24,6 +33,32 @@ type Repository struct {
 
 	formatBlob *formatBlob
 	masterKey  []byte
+	readOnly   bool
+	appendOnly bool
+	throttler  throttling.Throttler
+
+	enableActions bool
+}
+
+// CheckDeletionAllowed returns an error if the repository is connected in a mode that does not allow
+// deleting or rewriting existing data, which is required by garbage collection and compaction.
+func (r *Repository) CheckDeletionAllowed() error {
+	switch {
+	case r.readOnly:
+		return ErrReadOnly
+
+	case r.appendOnly:
+		return ErrAppendOnly
+
+	default:
+		return nil
+	}
+}
+
+// ActionsEnabled returns true if the repository is connected with actions enabled, which allows snapshots
+// to run commands defined in policies stored in the repository.
+func (r *Repository) ActionsEnabled() bool {
+	return r.enableActions
 }
 
 // Close closes the repository and releases all resources.
@@ -2,6 +2,7 @@ package repo_test
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
 	"io/ioutil"
 	"math/rand"
@@ -10,6 +11,9 @@ import (
 
 	"github.com/kopia/kopia/internal/repotesting"
 	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/blob/throttling"
+	"github.com/kopia/kopia/repo/compression"
 	"github.com/kopia/kopia/repo/content"
 	"github.com/kopia/kopia/repo/object"
 )
@@ -177,6 +181,184 @@ func TestUpgrade(t *testing.T) {
 	}
 }
 
+func TestUpgradeIndexVersion(t *testing.T) {
+	var env repotesting.Environment
+	defer env.Setup(t).Close(t)
+
+	ctx := context.Background()
+
+	oid := writeObject(ctx, t, env.Repository, []byte{1, 2, 3, 4}, "written with v1 index")
+
+	if err := env.Repository.Flush(ctx); err != nil {
+		t.Fatalf("flush error: %v", err)
+	}
+
+	if got, want := env.Repository.Content.Format.IndexVersion, content.IndexVersion1; got != want {
+		t.Fatalf("unexpected index version %v, want %v", got, want)
+	}
+
+	if got, want := env.Repository.Content.Format.Version, content.FormatVersion1; got != want {
+		t.Fatalf("unexpected format version %v, want %v", got, want)
+	}
+
+	if err := env.Repository.Upgrade(ctx); err != nil {
+		t.Fatalf("upgrade error: %v", err)
+	}
+
+	env.MustReopen(t)
+
+	if got, want := env.Repository.Content.Format.IndexVersion, content.IndexVersion2; got != want {
+		t.Fatalf("unexpected index version after upgrade %v, want %v", got, want)
+	}
+
+	// clients that only support the original format version refuse to open the upgraded repository.
+	if got, want := env.Repository.Content.Format.Version, content.FormatVersion2; got != want {
+		t.Fatalf("unexpected format version after upgrade %v, want %v", got, want)
+	}
+
+	// contents indexed using v1 format remain readable after upgrade.
+	verify(ctx, t, env.Repository, oid, []byte{1, 2, 3, 4}, "written with v1 index")
+
+	oid2 := writeObject(ctx, t, env.Repository, []byte{5, 6, 7, 8}, "written with v2 index")
+
+	if err := env.Repository.Flush(ctx); err != nil {
+		t.Fatalf("flush error: %v", err)
+	}
+
+	env.MustReopen(t)
+
+	verify(ctx, t, env.Repository, oid, []byte{1, 2, 3, 4}, "written with v1 index")
+	verify(ctx, t, env.Repository, oid2, []byte{5, 6, 7, 8}, "written with v2 index")
+}
+
+func TestChangePassword(t *testing.T) {
+	var env repotesting.Environment
+	defer env.Setup(t, func(opt *repo.NewRepositoryOptions) {
+		opt.BlockFormat.Hash = content.DefaultHash
+		opt.BlockFormat.Encryption = content.DefaultEncryption
+	}).Close(t)
+
+	ctx := context.Background()
+
+	oid := writeObject(ctx, t, env.Repository, []byte{1, 2, 3, 4}, "before password change")
+
+	if err := env.Repository.Flush(ctx); err != nil {
+		t.Fatalf("flush error: %v", err)
+	}
+
+	originalPassword := "foobarbazfoobarbaz"
+
+	if err := env.Repository.ChangePassword(ctx, "new-password"); err != nil {
+		t.Fatalf("unable to change password: %v", err)
+	}
+
+	if _, err := repo.Open(ctx, env.Repository.ConfigFile, originalPassword, &repo.Options{}); err == nil {
+		t.Fatalf("unexpected success opening repository with old password")
+	}
+
+	r2, err := repo.Open(ctx, env.Repository.ConfigFile, "new-password", &repo.Options{})
+	if err != nil {
+		t.Fatalf("unable to open repository with new password: %v", err)
+	}
+
+	verify(ctx, t, r2, oid, []byte{1, 2, 3, 4}, "after password change")
+
+	if err := r2.Close(ctx); err != nil {
+		t.Fatalf("close error: %v", err)
+	}
+
+	// change the password back, which must work using the in-memory key.
+	if err := env.Repository.ChangePassword(ctx, originalPassword); err != nil {
+		t.Fatalf("unable to change password back: %v", err)
+	}
+
+	env.MustReopen(t)
+	verify(ctx, t, env.Repository, oid, []byte{1, 2, 3, 4}, "after changing password back")
+}
+
+func TestRotateKey(t *testing.T) {
+	var env repotesting.Environment
+	defer env.Setup(t, func(opt *repo.NewRepositoryOptions) {
+		opt.BlockFormat.Hash = content.DefaultHash
+		opt.BlockFormat.Encryption = content.DefaultEncryption
+		opt.BlockFormat.IndexVersion = content.IndexVersion2
+	}).Close(t)
+
+	ctx := context.Background()
+
+	oid := writeObject(ctx, t, env.Repository, []byte{1, 2, 3, 4}, "written with original key")
+
+	if err := env.Repository.Flush(ctx); err != nil {
+		t.Fatalf("flush error: %v", err)
+	}
+
+	keyID, err := env.Repository.RotateKey(ctx)
+	if err != nil {
+		t.Fatalf("unable to rotate key: %v", err)
+	}
+
+	if keyID != 1 {
+		t.Errorf("unexpected key ID: %v", keyID)
+	}
+
+	env.MustReopen(t)
+
+	if got := env.Repository.Content.Format.EncryptionKeyID; got != keyID {
+		t.Fatalf("unexpected key ID after reopening: %v, want %v", got, keyID)
+	}
+
+	verify(ctx, t, env.Repository, oid, []byte{1, 2, 3, 4}, "written with original key")
+
+	oid2 := writeObject(ctx, t, env.Repository, []byte{5, 6, 7, 8}, "written with rotated key")
+
+	if err := env.Repository.Flush(ctx); err != nil {
+		t.Fatalf("flush error: %v", err)
+	}
+
+	env.MustReopen(t)
+
+	verify(ctx, t, env.Repository, oid, []byte{1, 2, 3, 4}, "written with original key")
+	verify(ctx, t, env.Repository, oid2, []byte{5, 6, 7, 8}, "written with rotated key")
+
+	// re-encrypt contents written using the retired key.
+	var retired []content.ID
+
+	if err := env.Repository.Content.IterateContents(content.IterateOptions{}, func(ci content.Info) error {
+		if ci.EncryptionKeyID != keyID {
+			retired = append(retired, ci.ID)
+		}
+
+		return nil
+	}); err != nil {
+		t.Fatalf("unable to iterate contents: %v", err)
+	}
+
+	if len(retired) == 0 {
+		t.Fatalf("no contents encrypted with retired key")
+	}
+
+	for _, cid := range retired {
+		if err := env.Repository.Content.RewriteContent(ctx, cid); err != nil {
+			t.Fatalf("unable to rewrite %v: %v", cid, err)
+		}
+	}
+
+	if err := env.Repository.Flush(ctx); err != nil {
+		t.Fatalf("flush error: %v", err)
+	}
+
+	env.MustReopen(t)
+
+	for _, cid := range retired {
+		ci, err := env.Repository.Content.ContentInfo(ctx, cid)
+		if err != nil || ci.EncryptionKeyID != keyID {
+			t.Errorf("content %v was not re-encrypted: %v %v", cid, ci.EncryptionKeyID, err)
+		}
+	}
+
+	verify(ctx, t, env.Repository, oid, []byte{1, 2, 3, 4}, "re-encrypted")
+}
+
 func TestReaderStoredBlockNotFound(t *testing.T) {
 	var env repotesting.Environment
 	defer env.Setup(t).Close(t)
@@ -318,3 +500,216 @@ func TestFormats(t *testing.T) {
 		}
 	}
 }
+
+func TestAppendOnlyMode(t *testing.T) {
+	var env repotesting.Environment
+	defer env.Setup(t).Close(t)
+
+	ctx := context.Background()
+
+	oid1 := writeObject(ctx, t, env.Repository, []byte("hello world"), "before")
+	env.Repository.Content.Flush(ctx) //nolint:errcheck
+
+	if err := env.Repository.CheckDeletionAllowed(); err != nil {
+		t.Fatalf("deletion should be allowed by default: %v", err)
+	}
+
+	env.MustReconnect(t, repo.ConnectOptions{AppendOnly: true})
+
+	if got, want := env.Repository.CheckDeletionAllowed(), repo.ErrAppendOnly; got != want {
+		t.Errorf("unexpected CheckDeletionAllowed() result: %v, want %v", got, want)
+	}
+
+	// adding data is allowed.
+	oid2 := writeObject(ctx, t, env.Repository, []byte("goodbye world"), "after")
+
+	if err := env.Repository.Flush(ctx); err != nil {
+		t.Fatalf("unable to flush: %v", err)
+	}
+
+	var blobIDs []blob.ID
+
+	if err := env.Repository.Blobs.ListBlobs(ctx, "", func(bm blob.Metadata) error {
+		blobIDs = append(blobIDs, bm.BlobID)
+		return nil
+	}); err != nil {
+		t.Fatalf("unable to list blobs: %v", err)
+	}
+
+	for _, id := range blobIDs {
+		if err := env.Repository.Blobs.DeleteBlob(ctx, id); err == nil {
+			t.Errorf("unexpected success deleting %v", id)
+		}
+
+		if err := env.Repository.Blobs.PutBlob(ctx, id, []byte("overwritten")); err == nil {
+			t.Errorf("unexpected success overwriting %v", id)
+		}
+	}
+
+	env.MustReopen(t)
+	verify(ctx, t, env.Repository, oid1, []byte("hello world"), "before")
+	verify(ctx, t, env.Repository, oid2, []byte("goodbye world"), "after")
+
+	env.MustReconnect(t, repo.ConnectOptions{ReadOnly: true})
+
+	if got, want := env.Repository.CheckDeletionAllowed(), repo.ErrReadOnly; got != want {
+		t.Errorf("unexpected CheckDeletionAllowed() result: %v, want %v", got, want)
+	}
+
+	verify(ctx, t, env.Repository, oid1, []byte("hello world"), "before")
+
+	if err := env.Repository.Blobs.PutBlob(ctx, "new-blob", []byte("data")); err == nil {
+		t.Errorf("unexpected success writing to read-only repository")
+	}
+}
+
+func TestThrottlingLimits(t *testing.T) {
+	var env repotesting.Environment
+	defer env.Setup(t).Close(t)
+
+	if got, want := env.Repository.ThrottlingLimits(), (throttling.Limits{}); got != want {
+		t.Errorf("unexpected default limits: %v, want %v", got, want)
+	}
+
+	limits := throttling.Limits{
+		MaxUploadSpeedBytesPerSecond:   1000000,
+		MaxDownloadSpeedBytesPerSecond: 2000000,
+	}
+
+	if err := env.Repository.SetThrottlingLimits(limits); err != nil {
+		t.Fatalf("unable to set limits: %v", err)
+	}
+
+	if got, want := env.Repository.ThrottlingLimits(), limits; got != want {
+		t.Errorf("unexpected limits: %v, want %v", got, want)
+	}
+
+	// limits are persisted in the configuration file.
+	env.MustReopen(t)
+
+	if got, want := env.Repository.ThrottlingLimits(), limits; got != want {
+		t.Errorf("unexpected limits after reopening: %v, want %v", got, want)
+	}
+}
+
+func TestWriteSessions(t *testing.T) {
+	ctx := context.Background()
+
+	var env repotesting.Environment
+	defer env.Setup(t).Close(t)
+
+	s, err := env.Repository.BeginWriteSession(ctx, "user@host", "some session")
+	if err != nil {
+		t.Fatalf("unable to begin write session: %v", err)
+	}
+
+	sessions, err := env.Repository.ListWriteSessions(ctx)
+	if err != nil {
+		t.Fatalf("unable to list write sessions: %v", err)
+	}
+
+	if len(sessions) != 1 || sessions[0].ID != s.Info().ID || sessions[0].Description != "some session" || sessions[0].ClientID != "user@host" {
+		t.Errorf("unexpected sessions: %v", sessions)
+	}
+
+	if err := s.End(ctx); err != nil {
+		t.Fatalf("unable to end write session: %v", err)
+	}
+
+	sessions, err = env.Repository.ListWriteSessions(ctx)
+	if err != nil {
+		t.Fatalf("unable to list write sessions: %v", err)
+	}
+
+	if len(sessions) != 0 {
+		t.Errorf("unexpected sessions after End(): %v", sessions)
+	}
+}
+
+func TestWriteSessionLiveSessionNotAdopted(t *testing.T) {
+	ctx := context.Background()
+
+	var env repotesting.Environment
+	defer env.Setup(t, func(opt *repo.NewRepositoryOptions) {
+		opt.BlockFormat.MaxPackSize = 10000
+	}).Close(t)
+
+	s1, err := env.Repository.BeginWriteSession(ctx, "user@host", "first")
+	if err != nil {
+		t.Fatalf("unable to begin write session: %v", err)
+	}
+
+	defer s1.End(ctx) //nolint:errcheck
+
+	// write enough contents to produce pack blobs recorded in session indexes.
+	for i := 0; i < 100; i++ {
+		data := make([]byte, 1000)
+		rand.Read(data) //nolint:errcheck
+
+		if _, err := env.Repository.Content.WriteContent(ctx, data, "", compression.NoCompression); err != nil {
+			t.Fatalf("unable to write content: %v", err)
+		}
+	}
+
+	if err := env.Repository.Content.FlushSessionIndex(ctx); err != nil {
+		t.Fatalf("unable to flush session index: %v", err)
+	}
+
+	// another process of the same client must not adopt contents of a session that is still live.
+	r2 := env.MustOpenAnother(t)
+	defer r2.Close(ctx) //nolint:errcheck
+
+	s2, err := r2.BeginWriteSession(ctx, "user@host", "second")
+	if err != nil {
+		t.Fatalf("unable to begin second write session: %v", err)
+	}
+
+	defer s2.End(ctx) //nolint:errcheck
+
+	ids, err := r2.Content.SessionIDsWithIndexes(ctx)
+	if err != nil {
+		t.Fatalf("unable to list session indexes: %v", err)
+	}
+
+	if len(ids) != 1 || ids[0] != s1.Info().ID {
+		t.Errorf("unexpected sessions with indexes: %v, want %v", ids, s1.Info().ID)
+	}
+}
+
+func TestGCEpochEncrypted(t *testing.T) {
+	var env repotesting.Environment
+	defer env.Setup(t, func(opt *repo.NewRepositoryOptions) {
+		opt.BlockFormat.Hash = content.DefaultHash
+		opt.BlockFormat.Encryption = content.DefaultEncryption
+	}).Close(t)
+
+	ctx := context.Background()
+
+	want := &repo.GCEpoch{Number: 1, Candidates: []content.ID{"abcdef0123456789"}}
+	if err := env.Repository.WriteGCEpoch(ctx, want); err != nil {
+		t.Fatalf("unable to write GC epoch: %v", err)
+	}
+
+	blobs, err := blob.ListAllBlobs(ctx, env.Repository.Blobs, repo.GCEpochBlobPrefix)
+	if err != nil || len(blobs) != 1 {
+		t.Fatalf("unexpected GC epoch blobs: %v %v", blobs, err)
+	}
+
+	b, err := env.Repository.Blobs.GetBlob(ctx, blobs[0].BlobID, 0, -1)
+	if err != nil {
+		t.Fatalf("unable to read GC epoch blob: %v", err)
+	}
+
+	if _, err := gzip.NewReader(bytes.NewReader(b)); err == nil {
+		t.Errorf("GC epoch blob is not encrypted")
+	}
+
+	got, err := env.Repository.LoadLatestGCEpoch(ctx)
+	if err != nil {
+		t.Fatalf("unable to load GC epoch: %v", err)
+	}
+
+	if got.Number != want.Number || len(got.Candidates) != 1 || got.Candidates[0] != want.Candidates[0] {
+		t.Errorf("unexpected GC epoch: %+v, want %+v", got, want)
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 
 	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo/content"
 )
 
 // Upgrade upgrades repository data structures to the latest version.
@@ -20,6 +22,21 @@ func (r *Repository) Upgrade(ctx context.Context) error {
 	var migrated bool
 
 	// add migration code here
+	if repoConfig.IndexVersion < content.IndexVersion2 {
+		// existing v1 indexes remain readable and are rewritten in the new format during compaction.
+		log.Infof("upgrading index format from v%v to v%v", content.IndexVersion1, content.IndexVersion2)
+
+		repoConfig.IndexVersion = content.IndexVersion2
+		migrated = true
+	}
+
+	if v := repoConfig.RequiredVersion(); repoConfig.Version < v {
+		log.Infof("upgrading repository format from v%v to v%v, older versions of kopia will no longer be able to open the repository", repoConfig.Version, v)
+
+		repoConfig.Version = v
+		migrated = true
+	}
+
 	if !migrated {
 		log.Infof("nothing to do")
 		return nil
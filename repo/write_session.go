@@ -0,0 +1,344 @@
+package repo
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/content"
+)
+
+// WriteSessionBlobPrefix is the prefix of blobs advertising write sessions in progress.
+const WriteSessionBlobPrefix blob.ID = "s"
+
+var (
+	// writeSessionHeartbeatInterval is the interval at which live write sessions refresh their marker blobs.
+	writeSessionHeartbeatInterval = 5 * time.Minute
+
+	// WriteSessionTimeout is the amount of time after the last heartbeat when a write session is considered abandoned.
+	WriteSessionTimeout = 30 * time.Minute
+)
+
+// WriteSessionInfo describes a write session advertised in the repository.
+type WriteSessionInfo struct {
+	ID          string    `json:"id"`
+	ClientID    string    `json:"clientID,omitempty"`
+	Description string    `json:"description"`
+	StartTime   time.Time `json:"startTime"`
+
+	// LastHeartbeat is the time when the session marker was last written, as reported by storage.
+	LastHeartbeat time.Time `json:"-"`
+
+	markers []blob.ID // marker blobs of the session
+}
+
+// WriteSession represents write session in progress, which prevents garbage collection from deleting
+// contents that may be referenced by data being written.
+//
+// Marker blobs are encrypted, since the session describes the client and the source being written.
+type WriteSession struct {
+	info         WriteSessionInfo
+	blobID       blob.ID // current marker blob
+	markerNumber int
+	st           blob.Storage
+	cm           *content.Manager // encrypts marker blobs
+
+	// markers are not removed in append-only mode, they are eventually deleted by garbage collection.
+	appendOnly bool
+
+	// content is the content manager whose pack blobs are tracked in session indexes or nil.
+	content *content.Manager
+
+	stop     chan struct{}
+	stopped  chan struct{}
+	stopOnce sync.Once
+}
+
+// Info returns information about the write session.
+func (s *WriteSession) Info() WriteSessionInfo {
+	return s.info
+}
+
+// writeMarker writes a new marker blob of the session and removes the previous one. Markers are never
+// overwritten, so that heartbeats work with storage that does not allow it.
+func (s *WriteSession) writeMarker(ctx context.Context) error {
+	b, err := json.Marshal(s.info)
+	if err != nil {
+		return errors.Wrap(err, "unable to marshal write session")
+	}
+
+	b, err = s.cm.EncryptBlob(b)
+	if err != nil {
+		return errors.Wrap(err, "unable to encrypt write session")
+	}
+
+	s.markerNumber++
+	blobID := WriteSessionBlobPrefix + blob.ID(fmt.Sprintf("%v-%x", s.info.ID, s.markerNumber))
+
+	if err := s.st.PutBlob(ctx, blobID, b); err != nil {
+		return err
+	}
+
+	if s.blobID != "" && !s.appendOnly {
+		// stale markers are eventually removed by garbage collection.
+		if err := s.st.DeleteBlob(ctx, s.blobID); err != nil && err != blob.ErrBlobNotFound {
+			log.Debugf("unable to remove previous marker of write session %v: %v", s.info.ID, err)
+		}
+	}
+
+	s.blobID = blobID
+
+	return nil
+}
+
+func (s *WriteSession) heartbeat(ctx context.Context) {
+	defer close(s.stopped)
+
+	for {
+		select {
+		case <-s.stop:
+			return
+
+		case <-time.After(writeSessionHeartbeatInterval):
+			if err := s.writeMarker(ctx); err != nil {
+				log.Warningf("unable to refresh write session %v: %v", s.info.ID, err)
+			}
+		}
+	}
+}
+
+// End ends the write session and removes its marker from the repository.
+func (s *WriteSession) End(ctx context.Context) error {
+	s.stopOnce.Do(func() {
+		close(s.stop)
+	})
+
+	<-s.stopped
+
+	if s.content != nil {
+		s.content.EndSession(s.info.ID)
+	}
+
+	if s.blobID == "" || s.appendOnly {
+		return nil
+	}
+
+	if err := s.st.DeleteBlob(ctx, s.blobID); err != nil && err != blob.ErrBlobNotFound {
+		return errors.Wrapf(err, "unable to remove write session marker %v", s.blobID)
+	}
+
+	return nil
+}
+
+// BeginWriteSession advertises a new write session in the repository. The session remains live, periodically
+// refreshing its marker blob, until End() is called.
+//
+// Contents of pack blobs written during the session are periodically recorded in session index blobs. If a previous
+// session of the same client did not complete, its recorded contents are adopted, so they don't need to be uploaded again.
+//
+// In read-only mode the session is not advertised, since nothing can be written. In append-only mode sessions
+// are not adopted and markers are not removed, since that requires deleting blobs.
+func (r *Repository) BeginWriteSession(ctx context.Context, clientID, description string) (*WriteSession, error) {
+	id := make([]byte, 16) //nolint:gomnd
+	if _, err := io.ReadFull(rand.Reader, id); err != nil {
+		return nil, errors.Wrap(err, "unable to generate session ID")
+	}
+
+	s := &WriteSession{
+		info: WriteSessionInfo{
+			ID:          hex.EncodeToString(id),
+			ClientID:    clientID,
+			Description: description,
+			StartTime:   time.Now(),
+		},
+		st:         r.Blobs,
+		cm:         r.Content,
+		appendOnly: r.appendOnly,
+		stop:       make(chan struct{}),
+		stopped:    make(chan struct{}),
+	}
+
+	if r.readOnly {
+		close(s.stopped)
+		return s, nil
+	}
+
+	if clientID != "" && !r.appendOnly {
+		if err := r.adoptIncompleteWriteSessions(ctx, clientID); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.writeMarker(ctx); err != nil {
+		return nil, errors.Wrap(err, "unable to write session marker")
+	}
+
+	// contents that garbage collection may delete are written again instead of being reused, so that
+	// the new copies take precedence over deletions.
+	e, err := r.LoadLatestGCEpoch(ctx)
+	if err != nil {
+		s.st.DeleteBlob(ctx, s.blobID) //nolint:errcheck
+		return nil, err
+	}
+
+	if e != nil {
+		r.Content.SetPendingDeletion(e.Candidates)
+	}
+
+	// only one session at a time can track contents, others still prevent garbage collection.
+	if err := r.Content.BeginSession(s.info.ID); err != nil {
+		log.Debugf("not tracking contents of write session %v: %v", s.info.ID, err)
+	} else {
+		s.content = r.Content
+	}
+
+	go s.heartbeat(ctx)
+
+	return s, nil
+}
+
+// adoptIncompleteWriteSessions commits contents written by previous sessions of the provided client
+// that were abandoned without completing and removes their markers. Contents of sessions which ended without committing
+// them and no longer have a marker are adopted regardless of the client.
+func (r *Repository) adoptIncompleteWriteSessions(ctx context.Context, clientID string) error {
+	sessions, err := r.listWriteSessions(ctx, true)
+	if err != nil {
+		return err
+	}
+
+	sessionIDs, err := r.Content.SessionIDsWithIndexes(ctx)
+	if err != nil {
+		return err
+	}
+
+	markers := map[string]WriteSessionInfo{}
+	for _, si := range sessions {
+		markers[si.ID] = si
+	}
+
+	for _, id := range sessionIDs {
+		// sessions that are still live, possibly in another process of the same client, keep their contents.
+		if si, ok := markers[id]; ok && (si.ClientID != clientID || time.Since(si.LastHeartbeat) <= WriteSessionTimeout) {
+			continue
+		}
+
+		n, err := r.Content.AdoptSession(ctx, id)
+		if err != nil {
+			return errors.Wrapf(err, "unable to adopt write session %v", id)
+		}
+
+		log.Infof("adopted %v contents from incomplete write session %v", n, id)
+	}
+
+	for _, si := range sessions {
+		if si.ClientID != clientID || time.Since(si.LastHeartbeat) <= WriteSessionTimeout {
+			continue
+		}
+
+		for _, m := range si.markers {
+			if err := r.Blobs.DeleteBlob(ctx, m); err != nil && err != blob.ErrBlobNotFound {
+				return errors.Wrapf(err, "unable to remove abandoned write session %v", si.ID)
+			}
+		}
+	}
+
+	return nil
+}
+
+// DeleteAbandonedWriteSessionMarkers removes marker blobs that have not been refreshed within WriteSessionTimeout,
+// which includes markers of abandoned sessions and previous markers of live sessions that could not be removed.
+func (r *Repository) DeleteAbandonedWriteSessionMarkers(ctx context.Context) (int, error) {
+	markers, err := blob.ListAllBlobs(ctx, r.Blobs, WriteSessionBlobPrefix)
+	if err != nil {
+		return 0, errors.Wrap(err, "unable to list write sessions")
+	}
+
+	var deleted int
+
+	for _, bm := range markers {
+		if time.Since(bm.Timestamp) <= WriteSessionTimeout {
+			continue
+		}
+
+		if err := r.Blobs.DeleteBlob(ctx, bm.BlobID); err != nil && err != blob.ErrBlobNotFound {
+			return deleted, errors.Wrapf(err, "unable to remove write session marker %v", bm.BlobID)
+		}
+
+		deleted++
+	}
+
+	return deleted, nil
+}
+
+// ListWriteSessions returns write sessions in the repository whose heartbeat has not timed out.
+func (r *Repository) ListWriteSessions(ctx context.Context) ([]WriteSessionInfo, error) {
+	return r.listWriteSessions(ctx, false)
+}
+
+// listWriteSessions returns sessions advertised by marker blobs. Sessions with multiple markers are reported once,
+// with the most recent heartbeat.
+func (r *Repository) listWriteSessions(ctx context.Context, includeAbandoned bool) ([]WriteSessionInfo, error) {
+	var result []WriteSessionInfo
+
+	byID := map[string]int{}
+
+	markers, err := blob.ListAllBlobs(ctx, r.Blobs, WriteSessionBlobPrefix)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to list write sessions")
+	}
+
+	for _, bm := range markers {
+		if !includeAbandoned && time.Since(bm.Timestamp) > WriteSessionTimeout {
+			log.Debugf("ignoring abandoned write session %v", bm.BlobID)
+			continue
+		}
+
+		b, err := r.Blobs.GetBlob(ctx, bm.BlobID, 0, -1)
+		if err == blob.ErrBlobNotFound {
+			// session ended in the meantime.
+			continue
+		}
+
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to read write session %v", bm.BlobID)
+		}
+
+		b, err = r.Content.DecryptBlob(b)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to decrypt write session %v", bm.BlobID)
+		}
+
+		var si WriteSessionInfo
+		if err := json.Unmarshal(b, &si); err != nil {
+			return nil, errors.Wrapf(err, "invalid write session %v", bm.BlobID)
+		}
+
+		si.LastHeartbeat = bm.Timestamp
+		si.markers = []blob.ID{bm.BlobID}
+
+		n, ok := byID[si.ID]
+		if !ok {
+			byID[si.ID] = len(result)
+			result = append(result, si)
+
+			continue
+		}
+
+		if si.LastHeartbeat.After(result[n].LastHeartbeat) {
+			si.markers = append(si.markers, result[n].markers...)
+			result[n] = si
+		} else {
+			result[n].markers = append(result[n].markers, bm.BlobID)
+		}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,122 @@
+package repo
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kopia/kopia/internal/blobtesting"
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/blob/appendonly"
+	"github.com/kopia/kopia/repo/content"
+)
+
+func TestWriteSessionHeartbeatAppendOnly(t *testing.T) {
+	ctx := context.Background()
+	data := blobtesting.DataMap{}
+	keyTime := map[blob.ID]time.Time{}
+	base := blobtesting.NewMapStorage(data, keyTime, nil)
+	st := appendonly.NewWrapper(base)
+	cm := newContentManagerForTesting(t, st)
+
+	s := &WriteSession{info: WriteSessionInfo{ID: "abcd", ClientID: "user@host"}, st: st, cm: cm, appendOnly: true}
+
+	if err := s.writeMarker(ctx); err != nil {
+		t.Fatalf("unable to write marker: %v", err)
+	}
+
+	first := s.blobID
+
+	// heartbeat writes a new marker even though the previous one can't be removed.
+	if err := s.writeMarker(ctx); err != nil {
+		t.Fatalf("unable to refresh marker: %v", err)
+	}
+
+	if len(data) != 2 {
+		t.Fatalf("unexpected markers: %v", data)
+	}
+
+	for blobID, b := range data {
+		if bytes.Contains(b, []byte("user@host")) {
+			t.Errorf("marker %v is not encrypted", blobID)
+		}
+	}
+
+	r := &Repository{Blobs: st, Content: cm}
+
+	sessions, err := r.ListWriteSessions(ctx)
+	if err != nil {
+		t.Fatalf("unable to list write sessions: %v", err)
+	}
+
+	if len(sessions) != 1 || sessions[0].ID != "abcd" || len(sessions[0].markers) != 2 {
+		t.Fatalf("unexpected sessions: %v", sessions)
+	}
+
+	// previous marker is removed by garbage collection once it times out, the session remains live.
+	keyTime[first] = time.Now().Add(-2 * WriteSessionTimeout)
+
+	r = &Repository{Blobs: base, Content: cm}
+
+	n, err := r.DeleteAbandonedWriteSessionMarkers(ctx)
+	if err != nil {
+		t.Fatalf("unable to delete abandoned markers: %v", err)
+	}
+
+	if n != 1 {
+		t.Errorf("unexpected number of deleted markers: %v", n)
+	}
+
+	if _, ok := data[first]; ok {
+		t.Errorf("stale marker was not removed")
+	}
+
+	sessions, err = r.ListWriteSessions(ctx)
+	if err != nil {
+		t.Fatalf("unable to list write sessions: %v", err)
+	}
+
+	if len(sessions) != 1 || sessions[0].LastHeartbeat.Before(time.Now().Add(-WriteSessionTimeout)) {
+		t.Errorf("unexpected sessions after removing stale marker: %v", sessions)
+	}
+}
+
+func TestWriteSessionReadOnly(t *testing.T) {
+	ctx := context.Background()
+	data := blobtesting.DataMap{}
+	st := blobtesting.NewMapStorage(data, nil, nil)
+
+	r := &Repository{Blobs: st, Content: newContentManagerForTesting(t, st), readOnly: true}
+
+	s, err := r.BeginWriteSession(ctx, "user@host", "some session")
+	if err != nil {
+		t.Fatalf("unable to begin write session: %v", err)
+	}
+
+	if err := s.End(ctx); err != nil {
+		t.Fatalf("unable to end write session: %v", err)
+	}
+
+	if len(data) != 0 {
+		t.Errorf("unexpected blobs written in read-only mode: %v", data)
+	}
+}
+
+func newContentManagerForTesting(t *testing.T, st blob.Storage) *content.Manager {
+	t.Helper()
+
+	cm, err := content.NewManager(context.Background(), st, &content.FormattingOptions{
+		Version:     1,
+		Hash:        "HMAC-SHA256-128",
+		Encryption:  "AES-256-CTR",
+		MaxPackSize: 100000,
+		HMACSecret:  []byte("foo"),
+		MasterKey:   []byte("0123456789abcdef0123456789abcdef"),
+	}, content.CachingOptions{}, nil, content.ManagerOptions{})
+	if err != nil {
+		t.Fatalf("can't create content manager: %v", err)
+	}
+
+	return cm
+}
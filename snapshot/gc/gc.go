@@ -26,6 +26,36 @@ func oidOf(entry fs.Entry) object.ID {
 	return entry.(object.HasObjectID).ObjectID()
 }
 
+// entryID identifies entries by their object and the object holding their extended attributes,
+// so that entries sharing contents but not attributes are all visited.
+type entryID struct {
+	oid      object.ID
+	xattrOID object.ID
+}
+
+func entryIDOf(entry fs.Entry) entryID {
+	id := entryID{oid: oidOf(entry)}
+
+	if h, ok := entry.(snapshot.HasDirEntry); ok {
+		id.xattrOID = h.DirEntry().ExtendedAttributesObjectID
+	}
+
+	return id
+}
+
+func markObjectContentsInUse(ctx context.Context, rep *repo.Repository, oid object.ID, used *sync.Map) error {
+	contentIDs, err := rep.Objects.VerifyObject(ctx, oid)
+	if err != nil {
+		return errors.Wrapf(err, "error verifying %v", oid)
+	}
+
+	for _, cid := range contentIDs {
+		used.Store(cid, nil)
+	}
+
+	return nil
+}
+
 func findInUseContentIDs(ctx context.Context, rep *repo.Repository, used *sync.Map) error {
 	ids, err := snapshot.ListSnapshotManifests(ctx, rep, nil)
 	if err != nil {
@@ -38,7 +68,7 @@ func findInUseContentIDs(ctx context.Context, rep *repo.Repository, used *sync.M
 	}
 
 	w := snapshotfs.NewTreeWalker()
-	w.EntryID = func(e fs.Entry) interface{} { return oidOf(e) }
+	w.EntryID = func(e fs.Entry) interface{} { return entryIDOf(e) }
 
 	for _, m := range manifests {
 		root, err := snapshotfs.SnapshotRoot(rep, m)
@@ -50,15 +80,17 @@ func findInUseContentIDs(ctx context.Context, rep *repo.Repository, used *sync.M
 	}
 
 	w.ObjectCallback = func(entry fs.Entry) error {
-		oid := oidOf(entry)
-		contentIDs, err := rep.Objects.VerifyObject(ctx, oid)
+		id := entryIDOf(entry)
 
-		if err != nil {
-			return errors.Wrapf(err, "error verifying %v", oid)
+		// special files have no object
+		if id.oid != "" {
+			if err := markObjectContentsInUse(ctx, rep, id.oid, used); err != nil {
+				return err
+			}
 		}
 
-		for _, cid := range contentIDs {
-			used.Store(cid, nil)
+		if id.xattrOID != "" {
+			return markObjectContentsInUse(ctx, rep, id.xattrOID, used)
 		}
 
 		return nil
@@ -74,16 +106,36 @@ func findInUseContentIDs(ctx context.Context, rep *repo.Repository, used *sync.M
 }
 
 // Run performs garbage collection on all the snapshots in the repository.
+//
+// Garbage collection is performed in two phases across GC epochs recorded in the repository: each run with
+// gcDelete records unreferenced contents in a new epoch and only deletes contents that were already recorded
+// in the previous epoch and are still unreferenced. Deletion stops while any writer session is live, since
+// in-flight snapshots may reference contents that appear unreferenced.
 // nolint:gocognit
 func Run(ctx context.Context, rep *repo.Repository, minContentAge time.Duration, gcDelete bool) error {
+	if gcDelete {
+		if err := rep.CheckDeletionAllowed(); err != nil {
+			return errors.Wrap(err, "garbage collection is not allowed")
+		}
+	}
+
+	prev, err := rep.LoadLatestGCEpoch(ctx)
+	if err != nil {
+		return err
+	}
+
+	pending := prev.CandidateSet()
+
 	var used sync.Map
 	if err := findInUseContentIDs(ctx, rep, &used); err != nil {
 		return errors.Wrap(err, "unable to find in-use content ID")
 	}
 
-	var unusedCount, inUseCount, systemCount, tooRecentCount int32
+	var unusedCount, inUseCount, systemCount, tooRecentCount, pendingCount int32
+
+	var totalUnusedBytes, totalInUseBytes, totalSystemBytes, totalTooRecentBytes, totalPendingBytes int64
 
-	var totalUnusedBytes, totalInUseBytes, totalSystemBytes, totalTooRecentBytes int64
+	var unused []content.ID
 
 	log.Info("looking for unreferenced contents")
 
@@ -102,22 +154,13 @@ func Run(ctx context.Context, rep *repo.Repository, minContentAge time.Duration,
 				return nil
 			}
 			log.Debugf("unreferenced %v (%v bytes, modified %v)", ci.ID, ci.Length, ci.Timestamp())
-			cnt := atomic.AddInt32(&unusedCount, 1)
-			totalSize := atomic.AddInt64(&totalUnusedBytes, int64(ci.Length))
-			if gcDelete {
-				if err := rep.Content.DeleteContent(ci.ID); err != nil {
-					return errors.Wrap(err, "error deleting content")
-				}
-			}
-
-			if cnt%100000 == 0 {
-				log.Infof("... found %v unused contents so far (%v bytes)", cnt, units.BytesStringBase2(totalSize))
-				if gcDelete {
-					if err := rep.Flush(ctx); err != nil {
-						return errors.Wrap(err, "flush error")
-					}
-				}
+			atomic.AddInt32(&unusedCount, 1)
+			atomic.AddInt64(&totalUnusedBytes, int64(ci.Length))
+			if pending[ci.ID] {
+				atomic.AddInt32(&pendingCount, 1)
+				atomic.AddInt64(&totalPendingBytes, int64(ci.Length))
 			}
+			unused = append(unused, ci.ID)
 		} else {
 			atomic.AddInt32(&inUseCount, 1)
 			atomic.AddInt64(&totalInUseBytes, int64(ci.Length))
@@ -128,13 +171,118 @@ func Run(ctx context.Context, rep *repo.Repository, minContentAge time.Duration,
 	}
 
 	log.Infof("found %v unused contents (%v bytes)", unusedCount, units.BytesStringBase2(totalUnusedBytes))
+	log.Infof("found %v unused contents pending deletion since previous GC epoch (%v bytes)", pendingCount, units.BytesStringBase2(totalPendingBytes))
 	log.Infof("found %v unused contents that are too recent to delete (%v bytes)", tooRecentCount, units.BytesStringBase2(totalTooRecentBytes))
 	log.Infof("found %v in-use contents (%v bytes)", inUseCount, units.BytesStringBase2(totalInUseBytes))
 	log.Infof("found %v in-use system-contents (%v bytes)", systemCount, units.BytesStringBase2(totalSystemBytes))
 
-	if unusedCount > 0 && !gcDelete {
-		return errors.Errorf("Not deleting because '--delete' flag was not set.")
+	if !gcDelete {
+		if unusedCount > 0 {
+			return errors.Errorf("Not deleting because '--delete' flag was not set.")
+		}
+
+		return nil
+	}
+
+	return sweep(ctx, rep, prev, pending, unused)
+}
+
+// deletionBatchSize is the number of contents deleted between checks for live writer sessions.
+const deletionBatchSize = 100000
+
+// sweep deletes unused contents that were pending deletion since the previous epoch, unless there are live
+// writer sessions, and records remaining unused contents in a new epoch.
+//
+// Writer sessions are checked again before each batch of deletions. Deletions are timestamped with the time
+// of the last check, so that pending contents written again by sessions that started later take precedence.
+func sweep(ctx context.Context, rep *repo.Repository, prev *repo.GCEpoch, pending map[content.ID]bool, unused []content.ID) error {
+	next := &repo.GCEpoch{
+		Time: time.Now(),
+	}
+
+	if prev != nil {
+		next.Number = prev.Number + 1
+	}
+
+	canDelete := prev != nil
+
+	if prev == nil {
+		log.Infof("no previous GC epoch, unused contents will be deleted by the next garbage collection")
+	}
+
+	var deletedCount int
+
+	var checkTime time.Time
+
+	for _, cid := range unused {
+		if canDelete && pending[cid] && deletedCount%deletionBatchSize == 0 {
+			if deletedCount > 0 {
+				log.Infof("... deleted %v unused contents so far", deletedCount)
+
+				if err := rep.Flush(ctx); err != nil {
+					return errors.Wrap(err, "flush error")
+				}
+			}
+
+			t, live, err := checkWriteSessions(ctx, rep)
+			if err != nil {
+				return err
+			}
+
+			checkTime = t
+			canDelete = !live
+		}
+
+		if !canDelete || !pending[cid] {
+			next.Candidates = append(next.Candidates, cid)
+			continue
+		}
+
+		if err := rep.Content.DeleteContentAsOf(cid, checkTime); err != nil {
+			return errors.Wrap(err, "error deleting content")
+		}
+
+		deletedCount++
+	}
+
+	if err := rep.Flush(ctx); err != nil {
+		return errors.Wrap(err, "flush error")
+	}
+
+	log.Infof("deleted %v unused contents, %v contents will be deleted by the next garbage collection in GC epoch %v", deletedCount, len(next.Candidates), next.Number)
+
+	if err := rep.WriteGCEpoch(ctx, next); err != nil {
+		return err
+	}
+
+	n, err := rep.DeleteAbandonedWriteSessionMarkers(ctx)
+	if err != nil {
+		return err
+	}
+
+	if n > 0 {
+		log.Infof("removed %v abandoned writer session markers", n)
 	}
 
 	return nil
 }
+
+// checkWriteSessions returns the time of the check and whether any writer sessions are live at that time.
+func checkWriteSessions(ctx context.Context, rep *repo.Repository) (time.Time, bool, error) {
+	t := time.Now()
+
+	sessions, err := rep.ListWriteSessions(ctx)
+	if err != nil {
+		return t, false, errors.Wrap(err, "unable to list writer sessions")
+	}
+
+	for _, s := range sessions {
+		log.Infof("writer session in progress: %v (%v, started %v)", s.ID, s.Description, s.StartTime)
+	}
+
+	if len(sessions) > 0 {
+		log.Infof("not deleting any more contents because %v writer sessions are in progress", len(sessions))
+	}
+
+	return t, len(sessions) > 0, nil
+}
@@ -33,12 +33,26 @@ type EntryType string
 
 // Supported entry types.
 const (
-	EntryTypeUnknown   EntryType = ""  // unknown type
-	EntryTypeFile      EntryType = "f" // file
-	EntryTypeDirectory EntryType = "d" // directory
-	EntryTypeSymlink   EntryType = "s" // symbolic link
+	EntryTypeUnknown     EntryType = ""  // unknown type
+	EntryTypeFile        EntryType = "f" // file
+	EntryTypeDirectory   EntryType = "d" // directory
+	EntryTypeSymlink     EntryType = "s" // symbolic link
+	EntryTypeNamedPipe   EntryType = "p" // named pipe (FIFO)
+	EntryTypeCharDevice  EntryType = "c" // character device
+	EntryTypeBlockDevice EntryType = "b" // block device
+	EntryTypeSocket      EntryType = "S" // UNIX domain socket
 )
 
+// IsKnown returns true if the entry type is supported by this version of kopia.
+func (t EntryType) IsKnown() bool {
+	switch t {
+	case EntryTypeFile, EntryTypeDirectory, EntryTypeSymlink, EntryTypeNamedPipe, EntryTypeCharDevice, EntryTypeBlockDevice, EntryTypeSocket:
+		return true
+	default:
+		return false
+	}
+}
+
 // Permissions encapsulates UNIX permissions for a filesystem entry.
 type Permissions int
 
@@ -82,6 +96,17 @@ type DirEntry struct {
 	GroupID     uint32               `json:"gid,omitempty"`
 	ObjectID    object.ID            `json:"obj,omitempty"`
 	DirSummary  *fs.DirectorySummary `json:"summ,omitempty"`
+
+	// Extended attributes with small values, larger values are stored in a separate object
+	// holding JSON-encoded fs.ExtendedAttributes.
+	ExtendedAttributes         fs.ExtendedAttributes `json:"xattrs,omitempty"`
+	ExtendedAttributesObjectID object.ID             `json:"xattrObj,omitempty"`
+
+	// Major and minor numbers of a device node.
+	Device *fs.DeviceInfo `json:"dev,omitempty"`
+
+	// Holes of a sparse file, which are stored in its object as references to shared chunks of zeros and kept unallocated on restore.
+	Holes []fs.Hole `json:"holes,omitempty"`
 }
 
 // HasDirEntry is implemented by objects that have a DirEntry associated with them.
@@ -96,6 +121,16 @@ type DirManifest struct {
 	StreamType string               `json:"stream"` // legacy
 	Entries    []*DirEntry          `json:"entries"`
 	Summary    *fs.DirectorySummary `json:"summary"`
+	HardLinks  []*HardLinkGroup     `json:"hardLinks,omitempty"`
+}
+
+// HardLinkGroup lists names of directory entries that are hard links to the same file, identified by its
+// device and inode numbers. Other links to the same file may be listed in groups of other directories.
+type HardLinkGroup struct {
+	Device uint64   `json:"dev"`
+	Inode  uint64   `json:"ino"`
+	Links  uint64   `json:"nlink"`
+	Names  []string `json:"names"`
 }
 
 // RootObjectID returns the ID of a root object.
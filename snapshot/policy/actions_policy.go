@@ -0,0 +1,84 @@
+package policy
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Action failure modes.
+const (
+	ActionModeFail = "fail" // fail the snapshot when the action fails (default)
+	ActionModeWarn = "warn" // log a warning and continue when the action fails
+)
+
+const defaultActionTimeout = 5 * time.Minute
+
+// ActionsPolicy describes commands to be invoked when taking snapshots.
+type ActionsPolicy struct {
+	// Commands invoked before and after snapshotting the root of a source, inherited from parent policies
+	// except global and host policies.
+	BeforeSnapshotRoot *ActionCommand `json:"beforeSnapshotRoot,omitempty"`
+	AfterSnapshotRoot  *ActionCommand `json:"afterSnapshotRoot,omitempty"`
+
+	// Commands invoked before and after snapshotting the directory the policy is defined for, which are not inherited.
+	BeforeFolder *ActionCommand `json:"beforeFolder,omitempty"`
+	AfterFolder  *ActionCommand `json:"afterFolder,omitempty"`
+}
+
+// ActionCommand describes a command invoked as an action.
+//
+// The command is invoked with environment variables describing the snapshot, including KOPIA_SOURCE_PATH
+// and KOPIA_SNAPSHOT_PATH. A before-action can redirect the snapshot to a different directory, such as a mount
+// point of a filesystem snapshot, by printing KOPIA_SNAPSHOT_PATH=<path> to its standard output.
+type ActionCommand struct {
+	Command        string   `json:"path"`
+	Arguments      []string `json:"args,omitempty"`
+	TimeoutSeconds int      `json:"timeout,omitempty"`
+	Mode           string   `json:"mode,omitempty"`
+}
+
+// Timeout returns the maximum duration of the command.
+func (a *ActionCommand) Timeout() time.Duration {
+	if a.TimeoutSeconds > 0 {
+		return time.Duration(a.TimeoutSeconds) * time.Second
+	}
+
+	return defaultActionTimeout
+}
+
+// FailOnError returns true if failure of the command should fail the snapshot.
+func (a *ActionCommand) FailOnError() bool {
+	return a.Mode != ActionModeWarn
+}
+
+// Validate returns an error if the command is invalid.
+func (a *ActionCommand) Validate() error {
+	if a.Command == "" {
+		return errors.New("missing command")
+	}
+
+	if a.TimeoutSeconds < 0 {
+		return errors.Errorf("invalid timeout %v", a.TimeoutSeconds)
+	}
+
+	switch a.Mode {
+	case "", ActionModeFail, ActionModeWarn:
+		return nil
+	default:
+		return errors.Errorf("invalid mode %q, must be %q or %q", a.Mode, ActionModeFail, ActionModeWarn)
+	}
+}
+
+// Merge applies default values from the provided policy.
+// Folder actions are not merged, since they only apply to the directory they are defined for.
+// nolint:gocritic
+func (p *ActionsPolicy) Merge(src ActionsPolicy) {
+	if p.BeforeSnapshotRoot == nil {
+		p.BeforeSnapshotRoot = src.BeforeSnapshotRoot
+	}
+
+	if p.AfterSnapshotRoot == nil {
+		p.AfterSnapshotRoot = src.AfterSnapshotRoot
+	}
+}
@@ -0,0 +1,76 @@
+package policy
+
+import (
+	"testing"
+	"time"
+)
+
+func TestActionsPolicyMerge(t *testing.T) {
+	parent := &Policy{
+		Actions: ActionsPolicy{
+			BeforeSnapshotRoot: &ActionCommand{Command: "parent-before-root"},
+			AfterSnapshotRoot:  &ActionCommand{Command: "parent-after-root"},
+			BeforeFolder:       &ActionCommand{Command: "parent-before-folder"},
+		},
+	}
+
+	child := &Policy{
+		Actions: ActionsPolicy{
+			BeforeSnapshotRoot: &ActionCommand{Command: "child-before-root"},
+		},
+	}
+
+	merged := MergePolicies([]*Policy{child, parent})
+
+	if got, want := merged.Actions.BeforeSnapshotRoot.Command, "child-before-root"; got != want {
+		t.Errorf("unexpected before-snapshot-root action %v, want %v", got, want)
+	}
+
+	if got, want := merged.Actions.AfterSnapshotRoot.Command, "parent-after-root"; got != want {
+		t.Errorf("unexpected after-snapshot-root action %v, want %v", got, want)
+	}
+
+	if merged.Actions.BeforeFolder != nil {
+		t.Errorf("folder action was inherited: %v", merged.Actions.BeforeFolder)
+	}
+
+	for _, policyType := range []string{"global", "host"} {
+		parent.Labels = map[string]string{"policyType": policyType}
+
+		if merged := MergePolicies([]*Policy{child, parent}); merged.Actions.AfterSnapshotRoot != nil {
+			t.Errorf("action was inherited from %v policy: %v", policyType, merged.Actions.AfterSnapshotRoot)
+		}
+	}
+}
+
+func TestActionCommand(t *testing.T) {
+	cases := []struct {
+		cmd         ActionCommand
+		valid       bool
+		timeout     time.Duration
+		failOnError bool
+	}{
+		{ActionCommand{}, false, defaultActionTimeout, true},
+		{ActionCommand{Command: "x"}, true, defaultActionTimeout, true},
+		{ActionCommand{Command: "x", TimeoutSeconds: 3, Mode: ActionModeWarn}, true, 3 * time.Second, false},
+		{ActionCommand{Command: "x", Mode: ActionModeFail}, true, defaultActionTimeout, true},
+		{ActionCommand{Command: "x", Mode: "bad"}, false, defaultActionTimeout, true},
+		{ActionCommand{Command: "x", TimeoutSeconds: -1}, false, defaultActionTimeout, true},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		if got := tc.cmd.Validate() == nil; got != tc.valid {
+			t.Errorf("invalid validation result for %+v: %v, want %v", tc.cmd, got, tc.valid)
+		}
+
+		if got := tc.cmd.Timeout(); got != tc.timeout {
+			t.Errorf("invalid timeout for %+v: %v, want %v", tc.cmd, got, tc.timeout)
+		}
+
+		if got := tc.cmd.FailOnError(); got != tc.failOnError {
+			t.Errorf("invalid failOnError for %+v: %v, want %v", tc.cmd, got, tc.failOnError)
+		}
+	}
+}
@@ -1,6 +1,6 @@
 package policy
 
-// FilesPolicy describes files to be ignored when taking snapshots.
+// FilesPolicy describes files to be ignored and file metadata to be captured when taking snapshots.
 type FilesPolicy struct {
 	IgnoreRules         []string `json:"ignore,omitempty"`
 	NoParentIgnoreRules bool     `json:"noParentIgnore,omitempty"`
@@ -9,6 +9,23 @@ type FilesPolicy struct {
 	NoParentDotIgnoreFiles bool     `json:"noParentDotFiles,omitempty"`
 
 	MaxFileSize int64 `json:"maxFileSize,omitempty"`
+
+	// ExtendedAttributes enables capturing extended attributes, including POSIX ACLs and SELinux labels.
+	ExtendedAttributes *bool `json:"xattrs,omitempty"`
+
+	// SpecialFiles enables capturing named pipes, device nodes and sockets, which older versions
+	// of kopia are unable to read.
+	SpecialFiles *bool `json:"specialFiles,omitempty"`
+}
+
+// CaptureExtendedAttributes returns true if extended attributes of files should be captured, which is disabled by default.
+func (p *FilesPolicy) CaptureExtendedAttributes() bool {
+	return p.ExtendedAttributes != nil && *p.ExtendedAttributes
+}
+
+// CaptureSpecialFiles returns true if named pipes, device nodes and sockets should be captured, which is disabled by default.
+func (p *FilesPolicy) CaptureSpecialFiles() bool {
+	return p.SpecialFiles != nil && *p.SpecialFiles
 }
 
 // Merge applies default values from the provided policy.
@@ -24,6 +41,14 @@ func (p *FilesPolicy) Merge(src FilesPolicy) {
 	if len(p.DotIgnoreFiles) == 0 {
 		p.DotIgnoreFiles = src.DotIgnoreFiles
 	}
+
+	if p.ExtendedAttributes == nil {
+		p.ExtendedAttributes = src.ExtendedAttributes
+	}
+
+	if p.SpecialFiles == nil {
+		p.SpecialFiles = src.SpecialFiles
+	}
 }
 
 // defaultFilesPolicy is the default file ignore policy.
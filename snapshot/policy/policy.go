@@ -18,6 +18,7 @@ type Policy struct {
 	FilesPolicy       FilesPolicy       `json:"files,omitempty"`
 	SchedulingPolicy  SchedulingPolicy  `json:"scheduling,omitempty"`
 	CompressionPolicy CompressionPolicy `json:"compression,omitempty"`
+	Actions           ActionsPolicy     `json:"actions,omitempty"`
 	NoParent          bool              `json:"noParent,omitempty"`
 }
 
@@ -48,6 +49,15 @@ func (p *Policy) Target() snapshot.SourceInfo {
 	}
 }
 
+func (p *Policy) isGlobalOrHostPolicy() bool {
+	switch p.Labels["policyType"] {
+	case "global", "host":
+		return true
+	default:
+		return false
+	}
+}
+
 // MergePolicies computes the policy by applying the specified list of policies in order.
 func MergePolicies(policies []*Policy) *Policy {
 	var merged Policy
@@ -61,6 +71,11 @@ func MergePolicies(policies []*Policy) *Policy {
 		merged.FilesPolicy.Merge(p.FilesPolicy)
 		merged.SchedulingPolicy.Merge(p.SchedulingPolicy)
 		merged.CompressionPolicy.Merge(p.CompressionPolicy)
+
+		// actions run commands on the client, so they are not inherited from policies shared by many clients.
+		if !p.isGlobalOrHostPolicy() {
+			merged.Actions.Merge(p.Actions)
+		}
 	}
 
 	// Merge default expiration policy.
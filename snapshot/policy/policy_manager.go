@@ -84,6 +84,12 @@ func GetEffectivePolicy(ctx context.Context, rep *repo.Repository, si snapshot.S
 	merged := MergePolicies(policies)
 	merged.Labels = labelsForSource(si)
 
+	// folder actions are not inherited, only take them from the policy defined for the source
+	if len(policies) > 0 && policies[0].Target() == si {
+		merged.Actions.BeforeFolder = policies[0].Actions.BeforeFolder
+		merged.Actions.AfterFolder = policies[0].Actions.AfterFolder
+	}
+
 	return merged, policies, nil
 }
 
@@ -3,9 +3,13 @@ package policy
 import (
 	"fmt"
 	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo/blob/throttling"
 )
 
 // TimeOfDay represents the time of day (hh:mm) using 24-hour time format.
@@ -16,7 +20,7 @@ type TimeOfDay struct {
 
 // Parse parses the time of day.
 func (t *TimeOfDay) Parse(s string) error {
-	if _, err := fmt.Sscanf(s, "%v:%02v", &t.Hour, &t.Minute); err != nil {
+	if _, err := fmt.Sscanf(s, "%d:%d", &t.Hour, &t.Minute); err != nil {
 		return errors.New("invalid time of day, must be HH:MM")
 	}
 
@@ -36,6 +40,21 @@ func (t TimeOfDay) String() string {
 	return fmt.Sprintf("%v:%02v", t.Hour, t.Minute)
 }
 
+// minutes returns the number of minutes since midnight.
+func (t TimeOfDay) minutes() int {
+	return t.Hour*60 + t.Minute //nolint:gomnd
+}
+
+// nextAfter returns the earliest time strictly after 't' which is at the given time of day.
+func (t TimeOfDay) nextAfter(now time.Time) time.Time {
+	next := time.Date(now.Year(), now.Month(), now.Day(), t.Hour, t.Minute, 0, 0, now.Location())
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+
+	return next
+}
+
 // SortAndDedupeTimesOfDay sorts the slice of times of day and removes duplicates.
 func SortAndDedupeTimesOfDay(tod []TimeOfDay) []TimeOfDay {
 	sort.Slice(tod, func(i, j int) bool {
@@ -48,10 +67,77 @@ func SortAndDedupeTimesOfDay(tod []TimeOfDay) []TimeOfDay {
 	return tod
 }
 
+// BandwidthWindow specifies storage bandwidth limits in effect every day between Start and End.
+// Windows where End is before Start span midnight, windows where both are equal last all day.
+type BandwidthWindow struct {
+	Start TimeOfDay `json:"start"`
+	End   TimeOfDay `json:"end"`
+
+	throttling.Limits
+}
+
+// Parse parses the bandwidth window in the format HH:MM-HH:MM=UPLOAD[/DOWNLOAD], where limits are in bytes per second.
+func (w *BandwidthWindow) Parse(s string) error {
+	parts := strings.SplitN(s, "=", 2)        //nolint:gomnd
+	times := strings.SplitN(parts[0], "-", 2) //nolint:gomnd
+
+	if len(parts) != 2 || len(times) != 2 {
+		return errors.Errorf("invalid bandwidth window %q, must be HH:MM-HH:MM=UPLOAD[/DOWNLOAD]", s)
+	}
+
+	if err := w.Start.Parse(times[0]); err != nil {
+		return err
+	}
+
+	if err := w.End.Parse(times[1]); err != nil {
+		return err
+	}
+
+	limits := strings.SplitN(parts[1], "/", 2) //nolint:gomnd
+
+	var err error
+
+	if w.MaxUploadSpeedBytesPerSecond, err = strconv.Atoi(limits[0]); err != nil {
+		return errors.Errorf("invalid upload speed %q", limits[0])
+	}
+
+	w.MaxDownloadSpeedBytesPerSecond = 0
+
+	if len(limits) > 1 {
+		if w.MaxDownloadSpeedBytesPerSecond, err = strconv.Atoi(limits[1]); err != nil {
+			return errors.Errorf("invalid download speed %q", limits[1])
+		}
+	}
+
+	return nil
+}
+
+func (w BandwidthWindow) String() string {
+	return fmt.Sprintf("%v-%v=%v/%v", w.Start, w.End, w.MaxUploadSpeedBytesPerSecond, w.MaxDownloadSpeedBytesPerSecond)
+}
+
+// Contains returns true if the provided time falls within the window.
+func (w BandwidthWindow) Contains(t time.Time) bool {
+	m := t.Hour()*60 + t.Minute() //nolint:gomnd
+	start, end := w.Start.minutes(), w.End.minutes()
+
+	switch {
+	case start < end:
+		return m >= start && m < end
+
+	case start > end:
+		return m >= start || m < end
+
+	default:
+		return true
+	}
+}
+
 // SchedulingPolicy describes policy for scheduling snapshots.
 type SchedulingPolicy struct {
-	IntervalSeconds int64       `json:"intervalSeconds,omitempty"`
-	TimesOfDay      []TimeOfDay `json:"timeOfDay,omitempty"`
+	IntervalSeconds   int64             `json:"intervalSeconds,omitempty"`
+	TimesOfDay        []TimeOfDay       `json:"timeOfDay,omitempty"`
+	BandwidthSchedule []BandwidthWindow `json:"bandwidthSchedule,omitempty"`
 }
 
 // Interval returns the snapshot interval or zero if not specified.
@@ -64,6 +150,34 @@ func (p *SchedulingPolicy) SetInterval(d time.Duration) {
 	p.IntervalSeconds = int64(d.Seconds())
 }
 
+// BandwidthLimitsAt returns bandwidth limits of the first scheduled window that contains the provided time.
+// The second return value is false when no window applies and repository limits should be used.
+func (p *SchedulingPolicy) BandwidthLimitsAt(t time.Time) (throttling.Limits, bool) {
+	for _, w := range p.BandwidthSchedule {
+		if w.Contains(t) {
+			return w.Limits, true
+		}
+	}
+
+	return throttling.Limits{}, false
+}
+
+// NextBandwidthScheduleChange returns the earliest time after 't' when any of the scheduled windows starts or ends.
+// The second return value is false if there is no bandwidth schedule.
+func (p *SchedulingPolicy) NextBandwidthScheduleChange(t time.Time) (time.Time, bool) {
+	var next time.Time
+
+	for _, w := range p.BandwidthSchedule {
+		for _, tod := range []TimeOfDay{w.Start, w.End} {
+			if n := tod.nextAfter(t); next.IsZero() || n.Before(next) {
+				next = n
+			}
+		}
+	}
+
+	return next, !next.IsZero()
+}
+
 // Merge applies default values from the provided policy.
 func (p *SchedulingPolicy) Merge(src SchedulingPolicy) {
 	if p.IntervalSeconds == 0 {
@@ -72,6 +186,10 @@ func (p *SchedulingPolicy) Merge(src SchedulingPolicy) {
 
 	p.TimesOfDay = SortAndDedupeTimesOfDay(
 		append(append([]TimeOfDay(nil), src.TimesOfDay...), p.TimesOfDay...))
+
+	if len(p.BandwidthSchedule) == 0 {
+		p.BandwidthSchedule = src.BandwidthSchedule
+	}
 }
 
 var defaultSchedulingPolicy = SchedulingPolicy{}
@@ -0,0 +1,85 @@
+package policy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kopia/kopia/repo/blob/throttling"
+)
+
+func mustParseBandwidthWindow(t *testing.T, s string) BandwidthWindow {
+	var w BandwidthWindow
+
+	if err := w.Parse(s); err != nil {
+		t.Fatalf("unable to parse %q: %v", s, err)
+	}
+
+	return w
+}
+
+func TestBandwidthWindowParse(t *testing.T) {
+	w := mustParseBandwidthWindow(t, "8:00-18:30=2000000/5000000")
+
+	want := BandwidthWindow{
+		Start:  TimeOfDay{8, 0},
+		End:    TimeOfDay{18, 30},
+		Limits: throttling.Limits{MaxUploadSpeedBytesPerSecond: 2000000, MaxDownloadSpeedBytesPerSecond: 5000000},
+	}
+
+	if w != want {
+		t.Errorf("unexpected window: %v, want %v", w, want)
+	}
+
+	if got := mustParseBandwidthWindow(t, w.String()); got != w {
+		t.Errorf("window does not round-trip: %v, want %v", got, w)
+	}
+
+	for _, s := range []string{"", "8:00", "8:00-18:00", "8:00=100", "8:00-25:00=100", "8:00-9:00=x", "8:00-9:00=1/x"} {
+		var w BandwidthWindow
+		if err := w.Parse(s); err == nil {
+			t.Errorf("unexpected success parsing %q", s)
+		}
+	}
+}
+
+func TestBandwidthSchedule(t *testing.T) {
+	sp := SchedulingPolicy{
+		BandwidthSchedule: []BandwidthWindow{
+			mustParseBandwidthWindow(t, "08:00-18:00=2000000"),
+			mustParseBandwidthWindow(t, "22:00-02:00=0/1000"),
+		},
+	}
+
+	day := func(h, m int) time.Time {
+		return time.Date(2020, 1, 15, h, m, 0, 0, time.Local)
+	}
+
+	cases := []struct {
+		t          time.Time
+		wantUpload int
+		wantOK     bool
+		wantNext   time.Time
+	}{
+		{day(7, 59), 0, false, day(8, 0)},
+		{day(8, 0), 2000000, true, day(18, 0)},
+		{day(17, 59), 2000000, true, day(18, 0)},
+		{day(18, 0), 0, false, day(22, 0)},
+		{day(23, 0), 0, true, day(26, 0)},
+		{day(1, 0), 0, true, day(2, 0)},
+	}
+
+	for _, tc := range cases {
+		l, ok := sp.BandwidthLimitsAt(tc.t)
+		if ok != tc.wantOK || l.MaxUploadSpeedBytesPerSecond != tc.wantUpload {
+			t.Errorf("invalid limits at %v: %v %v, want %v %v", tc.t, l, ok, tc.wantUpload, tc.wantOK)
+		}
+
+		if next, _ := sp.NextBandwidthScheduleChange(tc.t); !next.Equal(tc.wantNext) {
+			t.Errorf("invalid next change after %v: %v, want %v", tc.t, next, tc.wantNext)
+		}
+	}
+
+	if _, ok := (&SchedulingPolicy{}).NextBandwidthScheduleChange(day(1, 0)); ok {
+		t.Errorf("unexpected schedule change without bandwidth schedule")
+	}
+}
@@ -43,6 +43,14 @@ func (s *repositoryAllSources) Owner() fs.OwnerInfo {
 	return fs.OwnerInfo{}
 }
 
+func (s *repositoryAllSources) ExtendedAttributes(ctx context.Context) (fs.ExtendedAttributes, error) {
+	return nil, nil
+}
+
+func (s *repositoryAllSources) LinkInfo() fs.LinkInfo {
+	return fs.LinkInfo{}
+}
+
 func (s *repositoryAllSources) Sys() interface{} {
 	return nil
 }
@@ -6,23 +6,22 @@ import (
 
 	"github.com/pkg/errors"
 
-	"github.com/kopia/kopia/fs"
 	"github.com/kopia/kopia/snapshot"
 )
 
 const directoryStreamType = "kopia:directory"
 
-// readDirEntries reads all directory entries from the specified reader.
-func readDirEntries(r io.Reader) ([]*snapshot.DirEntry, *fs.DirectorySummary, error) {
+// readDirManifest reads directory manifest from the specified reader.
+func readDirManifest(r io.Reader) (*snapshot.DirManifest, error) {
 	var dir snapshot.DirManifest
 
 	if err := json.NewDecoder(r).Decode(&dir); err != nil {
-		return nil, nil, errors.Wrap(err, "unable to parse directory object")
+		return nil, errors.Wrap(err, "unable to parse directory object")
 	}
 
 	if dir.StreamType != directoryStreamType {
-		return nil, nil, errors.Errorf("invalid directory stream type")
+		return nil, errors.Errorf("invalid directory stream type")
 	}
 
-	return dir.Entries, dir.Summary, nil
+	return &dir, nil
 }
@@ -3,6 +3,7 @@ package snapshotfs
 
 import (
 	"context"
+	"encoding/json"
 	"io/ioutil"
 	"os"
 	"time"
@@ -18,6 +19,7 @@ import (
 type repositoryEntry struct {
 	metadata *snapshot.DirEntry
 	repo     *repo.Repository
+	link     fs.LinkInfo
 }
 
 func (e *repositoryEntry) IsDir() bool {
@@ -30,6 +32,14 @@ func (e *repositoryEntry) Mode() os.FileMode {
 		return os.ModeDir | os.FileMode(e.metadata.Permissions)
 	case snapshot.EntryTypeSymlink:
 		return os.ModeSymlink | os.FileMode(e.metadata.Permissions)
+	case snapshot.EntryTypeNamedPipe:
+		return os.ModeNamedPipe | os.FileMode(e.metadata.Permissions)
+	case snapshot.EntryTypeSocket:
+		return os.ModeSocket | os.FileMode(e.metadata.Permissions)
+	case snapshot.EntryTypeCharDevice:
+		return os.ModeDevice | os.ModeCharDevice | os.FileMode(e.metadata.Permissions)
+	case snapshot.EntryTypeBlockDevice:
+		return os.ModeDevice | os.FileMode(e.metadata.Permissions)
 	default:
 		return os.FileMode(e.metadata.Permissions)
 	}
@@ -62,6 +72,43 @@ func (e *repositoryEntry) Owner() fs.OwnerInfo {
 	}
 }
 
+func (e *repositoryEntry) ExtendedAttributes(ctx context.Context) (fs.ExtendedAttributes, error) {
+	if e.metadata.ExtendedAttributesObjectID == "" {
+		return e.metadata.ExtendedAttributes, nil
+	}
+
+	large, err := e.readLargeExtendedAttributes(ctx)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to read extended attributes of %v", e.metadata.Name)
+	}
+
+	for k, v := range e.metadata.ExtendedAttributes {
+		large[k] = v
+	}
+
+	return large, nil
+}
+
+// readLargeExtendedAttributes reads extended attributes stored in a separate object.
+func (e *repositoryEntry) readLargeExtendedAttributes(ctx context.Context) (fs.ExtendedAttributes, error) {
+	r, err := e.repo.Objects.Open(ctx, e.metadata.ExtendedAttributesObjectID)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close() //nolint:errcheck
+
+	result := fs.ExtendedAttributes{}
+	if err := json.NewDecoder(r).Decode(&result); err != nil {
+		return nil, errors.Wrap(err, "unable to decode extended attributes")
+	}
+
+	return result, nil
+}
+
+func (e *repositoryEntry) LinkInfo() fs.LinkInfo {
+	return e.link
+}
+
 func (e *repositoryEntry) DirEntry() *snapshot.DirEntry {
 	return e.metadata
 }
@@ -79,6 +126,10 @@ type repositorySymlink struct {
 	repositoryEntry
 }
 
+type repositorySpecial struct {
+	repositoryEntry
+}
+
 func (rd *repositoryDirectory) Summary() *fs.DirectorySummary {
 	return rd.summary
 }
@@ -94,17 +145,34 @@ func (rd *repositoryDirectory) Readdir(ctx context.Context) (fs.Entries, error)
 	}
 	defer r.Close() //nolint:errcheck
 
-	metadata, _, err := readDirEntries(r)
+	dir, err := readDirManifest(r)
 	if err != nil {
 		return nil, err
 	}
 
-	entries := make(fs.Entries, len(metadata))
-	for i, m := range metadata {
-		entries[i], err = EntryFromDirEntry(rd.repo, m)
+	links := map[string]fs.LinkInfo{}
+
+	for _, g := range dir.HardLinks {
+		for _, n := range g.Names {
+			links[n] = fs.LinkInfo{Device: g.Device, Inode: g.Inode, Links: g.Links}
+		}
+	}
+
+	var entries fs.Entries
+
+	for _, m := range dir.Entries {
+		if !m.Type.IsKnown() {
+			// entries written by newer versions of kopia are skipped, so that the rest of the directory remains readable.
+			log.Warningf("skipping entry %q of unsupported type %q", m.Name, m.Type)
+			continue
+		}
+
+		e, err := entryFromDirEntry(rd.repo, m, links[m.Name])
 		if err != nil {
 			return nil, errors.Wrapf(err, "error parsing entry %v", m)
 		}
+
+		entries = append(entries, e)
 	}
 
 	entries.Sort()
@@ -118,9 +186,21 @@ func (rf *repositoryFile) Open(ctx context.Context) (fs.Reader, error) {
 		return nil, err
 	}
 
+	if holes := rf.metadata.Holes; len(holes) > 0 {
+		return &sparseFileReader{withFileInfo(r, rf), holes}, nil
+	}
+
 	return withFileInfo(r, rf), nil
 }
 
+func (rs *repositorySpecial) Device() fs.DeviceInfo {
+	if d := rs.metadata.Device; d != nil {
+		return *d
+	}
+
+	return fs.DeviceInfo{}
+}
+
 func (rsl *repositorySymlink) Readlink(ctx context.Context) (string, error) {
 	r, err := rsl.repo.Objects.Open(ctx, rsl.metadata.ObjectID)
 	if err != nil {
@@ -139,9 +219,14 @@ func (rsl *repositorySymlink) Readlink(ctx context.Context) (string, error) {
 
 // EntryFromDirEntry returns a filesystem entry based on the directory entry.
 func EntryFromDirEntry(r *repo.Repository, md *snapshot.DirEntry) (fs.Entry, error) {
+	return entryFromDirEntry(r, md, fs.LinkInfo{})
+}
+
+func entryFromDirEntry(r *repo.Repository, md *snapshot.DirEntry, link fs.LinkInfo) (fs.Entry, error) {
 	re := repositoryEntry{
 		metadata: md,
 		repo:     r,
+		link:     link,
 	}
 
 	switch md.Type {
@@ -159,6 +244,9 @@ func EntryFromDirEntry(r *repo.Repository, md *snapshot.DirEntry) (fs.Entry, err
 	case snapshot.EntryTypeFile:
 		return fs.File(&repositoryFile{re}), nil
 
+	case snapshot.EntryTypeNamedPipe, snapshot.EntryTypeSocket, snapshot.EntryTypeCharDevice, snapshot.EntryTypeBlockDevice:
+		return fs.Special(&repositorySpecial{re}), nil
+
 	default:
 		return nil, errors.Errorf("not supported entry metadata type: %q", md.Type)
 	}
@@ -47,6 +47,14 @@ func (s *sourceDirectories) Owner() fs.OwnerInfo {
 	return fs.OwnerInfo{}
 }
 
+func (s *sourceDirectories) ExtendedAttributes(ctx context.Context) (fs.ExtendedAttributes, error) {
+	return nil, nil
+}
+
+func (s *sourceDirectories) LinkInfo() fs.LinkInfo {
+	return fs.LinkInfo{}
+}
+
 func (s *sourceDirectories) Child(ctx context.Context, name string) (fs.Entry, error) {
 	return fs.ReadDirAndFindChild(ctx, s, name)
 }
@@ -47,6 +47,14 @@ func (s *sourceSnapshots) Owner() fs.OwnerInfo {
 	return fs.OwnerInfo{}
 }
 
+func (s *sourceSnapshots) ExtendedAttributes(ctx context.Context) (fs.ExtendedAttributes, error) {
+	return nil, nil
+}
+
+func (s *sourceSnapshots) LinkInfo() fs.LinkInfo {
+	return fs.LinkInfo{}
+}
+
 func safeName(path string) string {
 	path = strings.TrimLeft(path, "/")
 	return strings.Replace(path, "/", "_", -1)
@@ -0,0 +1,16 @@
+package snapshotfs
+
+import (
+	"github.com/kopia/kopia/fs"
+)
+
+// sparseFileReader reads contents of a sparse file and reports its holes, so that they can be
+// kept unallocated on restore.
+type sparseFileReader struct {
+	fs.Reader
+	holes []fs.Hole
+}
+
+func (r *sparseFileReader) Holes() ([]fs.Hole, error) {
+	return r.holes, nil
+}
@@ -0,0 +1,79 @@
+package snapshotfs
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"testing"
+
+	"github.com/kopia/kopia/fs"
+	"github.com/kopia/kopia/repo/object"
+)
+
+type bytesFileReader struct {
+	*bytes.Reader
+}
+
+func (r bytesFileReader) Close() error {
+	return nil
+}
+
+func (r bytesFileReader) Entry() (fs.Entry, error) {
+	return nil, nil
+}
+
+func TestCopyFileDataSkipsHoles(t *testing.T) {
+	ctx := context.Background()
+	th := newUploadTestHarness()
+
+	defer th.cleanup()
+
+	const holeSize = 3 << 20
+
+	// the file reports holes over data that is not zero, so reading them would be noticed.
+	data := bytes.Repeat([]byte{0xff}, 2*holeSize+200)
+	holes := []fs.Hole{{Offset: 100, Length: holeSize}, {Offset: holeSize + 200, Length: holeSize}}
+
+	want := append([]byte(nil), data...)
+	for _, h := range holes {
+		copy(want[h.Offset:h.Offset+h.Length], make([]byte, h.Length))
+	}
+
+	u := NewUploader(th.repo)
+	w := th.repo.Objects.NewWriter(ctx, object.WriterOptions{})
+
+	hashedBefore := th.repo.Content.Stats().HashedBytes
+
+	n, err := u.copyFileData(w, bytesFileReader{bytes.NewReader(data)}, int64(len(data)), holes)
+	if err != nil {
+		t.Fatalf("unable to copy: %v", err)
+	}
+
+	if n != int64(len(data)) {
+		t.Errorf("unexpected length: %v, want %v", n, len(data))
+	}
+
+	oid, err := w.Result()
+	if err != nil {
+		t.Fatalf("unable to write: %v", err)
+	}
+
+	// holes are backed by a single shared chunk of zeros.
+	if hashed := th.repo.Content.Stats().HashedBytes - hashedBefore; hashed >= 2*holeSize {
+		t.Errorf("holes were hashed: %v bytes", hashed)
+	}
+
+	r, err := th.repo.Objects.Open(ctx, oid)
+	if err != nil {
+		t.Fatalf("unable to open: %v", err)
+	}
+
+	got, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("unable to read: %v", err)
+	}
+
+	if !bytes.Equal(got, want) {
+		t.Errorf("unexpected contents")
+	}
+}
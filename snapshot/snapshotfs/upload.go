@@ -25,6 +25,9 @@ import (
 
 const copyBufferSize = 128 * 1024
 
+// maxInlineExtendedAttributeSize is the maximum size of an extended attribute value stored directly in the directory entry.
+const maxInlineExtendedAttributeSize = 1024
+
 var log = kopialogging.Logger("kopia/upload")
 
 var errCancelled = errors.New("canceled")
@@ -49,6 +52,7 @@ type Uploader struct {
 
 	repo *repo.Repository
 
+	actions  *actionContext
 	stats    snapshot.Stats
 	canceled int32
 
@@ -90,7 +94,15 @@ func (u *Uploader) uploadFileInternal(ctx context.Context, f fs.File, pol *polic
 	})
 	defer writer.Close() //nolint:errcheck
 
-	written, err := u.copyWithProgress(writer, file, 0, f.Size())
+	var holes []fs.Hole
+
+	if sr, ok := file.(fs.SparseReader); ok {
+		if holes, err = sr.Holes(); err != nil {
+			return entryResult{err: errors.Wrap(err, "unable to determine holes")}
+		}
+	}
+
+	written, err := u.copyFileData(writer, file, f.Size(), holes)
 	if err != nil {
 		return entryResult{err: err}
 	}
@@ -110,12 +122,64 @@ func (u *Uploader) uploadFileInternal(ctx context.Context, f fs.File, pol *polic
 		return entryResult{err: errors.Wrap(err, "unable to create dir entry")}
 	}
 
+	if err := u.addExtendedAttributes(ctx, de, f, pol); err != nil {
+		return entryResult{err: err}
+	}
+
 	de.FileSize = written
+	de.Holes = holes
+
+	return entryResult{de: de}
+}
+
+// copyFileData copies contents of the file, appending shared chunks of zeros for the provided holes
+// instead of reading and hashing them, so that the object contains the entire file, and returns the size of the file.
+func (u *Uploader) copyFileData(dst object.Writer, src fs.Reader, length int64, holes []fs.Hole) (int64, error) {
+	var offset int64
+
+	for _, h := range holes {
+		n, err := u.copyWithProgress(dst, io.LimitReader(src, h.Offset-offset), offset, length)
+		if err != nil {
+			return 0, err
+		}
+
+		if n != h.Offset-offset {
+			return 0, errors.Errorf("file was truncated while reading")
+		}
+
+		if _, err := src.Seek(h.Length, io.SeekCurrent); err != nil {
+			return 0, errors.Wrap(err, "unable to skip hole")
+		}
+
+		if err := dst.WriteZeros(h.Length); err != nil {
+			return 0, errors.Wrap(err, "unable to write hole")
+		}
+
+		u.addDirProgress(h.Length)
+
+		offset = h.Offset + h.Length
+	}
+
+	n, err := u.copyWithProgress(dst, src, offset, length)
+
+	return offset + n, err
+}
+
+// uploadSpecialInternal records a named pipe, device node or socket, which has no contents and therefore no object.
+func (u *Uploader) uploadSpecialInternal(ctx context.Context, f fs.Special, pol *policy.Policy) entryResult {
+	de, err := newDirEntry(f, "")
+	if err != nil {
+		return entryResult{err: errors.Wrap(err, "unable to create dir entry")}
+	}
+
+	if err := u.addExtendedAttributes(ctx, de, f, pol); err != nil {
+		return entryResult{err: err}
+	}
 
 	return entryResult{de: de}
 }
 
-func (u *Uploader) uploadSymlinkInternal(ctx context.Context, f fs.Symlink) entryResult {
+func (u *Uploader) uploadSymlinkInternal(ctx context.Context, f fs.Symlink, pol *policy.Policy) entryResult {
 	target, err := f.Readlink(ctx)
 	if err != nil {
 		return entryResult{err: errors.Wrap(err, "unable to read symlink")}
@@ -141,6 +205,10 @@ func (u *Uploader) uploadSymlinkInternal(ctx context.Context, f fs.Symlink) entr
 		return entryResult{err: errors.Wrap(err, "unable to create dir entry")}
 	}
 
+	if err := u.addExtendedAttributes(ctx, de, f, pol); err != nil {
+		return entryResult{err: err}
+	}
+
 	de.FileSize = written
 
 	return entryResult{de: de}
@@ -222,10 +290,16 @@ func newDirEntry(md fs.Entry, oid object.ID) (*snapshot.DirEntry, error) {
 		entryType = snapshot.EntryTypeSymlink
 	case fs.File:
 		entryType = snapshot.EntryTypeFile
+	case fs.Special:
+		entryType = specialEntryType(md.Mode())
 	default:
 		return nil, errors.Errorf("invalid entry type %T", md)
 	}
 
+	if entryType == snapshot.EntryTypeUnknown {
+		return nil, errors.Errorf("unsupported entry mode %v", md.Mode())
+	}
+
 	return &snapshot.DirEntry{
 		Name:        md.Name(),
 		Type:        entryType,
@@ -235,9 +309,86 @@ func newDirEntry(md fs.Entry, oid object.ID) (*snapshot.DirEntry, error) {
 		UserID:      md.Owner().UserID,
 		GroupID:     md.Owner().GroupID,
 		ObjectID:    oid,
+		Device:      deviceInfo(md),
 	}, nil
 }
 
+// addExtendedAttributes records extended attributes of the provided entry in the directory entry if enabled by the policy.
+// Values larger than maxInlineExtendedAttributeSize are stored in a separate object to keep directory manifests small.
+func (u *Uploader) addExtendedAttributes(ctx context.Context, de *snapshot.DirEntry, md fs.Entry, pol *policy.Policy) error {
+	if !pol.FilesPolicy.CaptureExtendedAttributes() {
+		return nil
+	}
+
+	attrs, err := md.ExtendedAttributes(ctx)
+	if err != nil {
+		return err
+	}
+
+	large := fs.ExtendedAttributes{}
+
+	for k, v := range attrs {
+		if len(v) > maxInlineExtendedAttributeSize {
+			large[k] = v
+			continue
+		}
+
+		if de.ExtendedAttributes == nil {
+			de.ExtendedAttributes = fs.ExtendedAttributes{}
+		}
+
+		de.ExtendedAttributes[k] = v
+	}
+
+	if len(large) == 0 {
+		return nil
+	}
+
+	writer := u.repo.Objects.NewWriter(ctx, object.WriterOptions{
+		Description: "XATTRS:" + md.Name(),
+	})
+	defer writer.Close() //nolint:errcheck
+
+	if err := json.NewEncoder(writer).Encode(large); err != nil {
+		return errors.Wrap(err, "unable to encode extended attributes")
+	}
+
+	oid, err := writer.Result()
+	if err != nil {
+		return errors.Wrap(err, "unable to write extended attributes")
+	}
+
+	de.ExtendedAttributesObjectID = oid
+
+	return nil
+}
+
+// specialEntryType returns the type of a special entry with the provided mode.
+func specialEntryType(mode os.FileMode) snapshot.EntryType {
+	switch {
+	case mode&os.ModeNamedPipe != 0:
+		return snapshot.EntryTypeNamedPipe
+	case mode&os.ModeSocket != 0:
+		return snapshot.EntryTypeSocket
+	case mode&os.ModeCharDevice != 0:
+		return snapshot.EntryTypeCharDevice
+	case mode&os.ModeDevice != 0:
+		return snapshot.EntryTypeBlockDevice
+	default:
+		return snapshot.EntryTypeUnknown
+	}
+}
+
+// deviceInfo returns major and minor numbers of a device node or nil for other entries.
+func deviceInfo(md fs.Entry) *fs.DeviceInfo {
+	if s, ok := md.(fs.Special); ok && md.Mode()&os.ModeDevice != 0 {
+		di := s.Device()
+		return &di
+	}
+
+	return nil
+}
+
 // uploadFile uploads the specified File to the repository.
 func (u *Uploader) uploadFile(ctx context.Context, file fs.File, pol *policy.Policy) (*snapshot.DirEntry, error) {
 	res := u.uploadFileInternal(ctx, file, pol)
@@ -250,6 +401,10 @@ func (u *Uploader) uploadFile(ctx context.Context, file fs.File, pol *policy.Pol
 		return nil, errors.Wrap(err, "unable to create dir entry")
 	}
 
+	de.ExtendedAttributes = res.de.ExtendedAttributes
+	de.ExtendedAttributesObjectID = res.de.ExtendedAttributesObjectID
+	de.Holes = res.de.Holes
+
 	de.DirSummary = &fs.DirectorySummary{
 		TotalFileCount: 1,
 		TotalFileSize:  res.de.FileSize,
@@ -263,7 +418,7 @@ func (u *Uploader) uploadFile(ctx context.Context, file fs.File, pol *policy.Pol
 // An optional ID of a hash-cache object may be provided, in which case the Uploader will use its
 // contents to avoid hashing
 func (u *Uploader) uploadDir(ctx context.Context, rootDir fs.Directory, policyTree *policy.Tree, previousDirs []fs.Directory) (*snapshot.DirEntry, error) {
-	oid, summ, err := uploadDirInternal(ctx, u, rootDir, policyTree, previousDirs, ".")
+	oid, summ, err := uploadDirWithActions(ctx, u, rootDir, policyTree, previousDirs, ".")
 	if err != nil {
 		return nil, err
 	}
@@ -273,11 +428,49 @@ func (u *Uploader) uploadDir(ctx context.Context, rootDir fs.Directory, policyTr
 		return nil, errors.Wrap(err, "unable to create dir entry")
 	}
 
+	if err := u.addExtendedAttributes(ctx, de, rootDir, policyTree.EffectivePolicy()); err != nil {
+		return nil, err
+	}
+
 	de.DirSummary = &summ
 
 	return de, err
 }
 
+// uploadRootDir uploads the root directory of a snapshot, running before- and after-snapshot-root actions.
+// A before-action can redirect the upload to a different directory.
+func (u *Uploader) uploadRootDir(ctx context.Context, rootDir fs.Directory, policyTree *policy.Tree, previousDirs []fs.Directory) (de *snapshot.DirEntry, err error) {
+	actions := policyTree.EffectivePolicy().Actions
+
+	newPath, err := runAction(ctx, actionBeforeSnapshotRoot, actions.BeforeSnapshotRoot, u.actions)
+	if err != nil {
+		return nil, err
+	}
+
+	if newPath != "" {
+		u.actions.snapshotPath = newPath
+	}
+
+	defer func() {
+		err = finishAction(ctx, actionAfterSnapshotRoot, actions.AfterSnapshotRoot, u.actions, err)
+	}()
+
+	if newPath != "" {
+		if rootDir, err = redirectDirectory(newPath); err != nil {
+			return nil, err
+		}
+	}
+
+	return u.uploadDir(ctx, u.ignoring(rootDir, policyTree), policyTree, previousDirs)
+}
+
+// ignoring returns the directory with files ignored by the policy tree filtered out.
+func (u *Uploader) ignoring(dir fs.Directory, policyTree *policy.Tree) fs.Directory {
+	return ignorefs.New(dir, policyTree, ignorefs.ReportIgnoredFiles(func(_ string, md fs.Entry) {
+		u.stats.AddExcluded(md)
+	}))
+}
+
 func (u *Uploader) foreachEntryUnlessCancelled(relativePath string, entries fs.Entries, cb func(entry fs.Entry, entryRelativePath string) error) error {
 	for _, entry := range entries {
 		if u.IsCancelled() {
@@ -316,7 +509,7 @@ func (u *Uploader) processSubdirectories(ctx context.Context, relativePath strin
 
 		previousDirs = uniqueDirectories(previousDirs)
 
-		oid, subdirsumm, err := uploadDirInternal(ctx, u, dir, policyTree.Child(entry.Name()), previousDirs, entryRelativePath)
+		oid, subdirsumm, err := uploadDirWithActions(ctx, u, dir, policyTree.Child(entry.Name()), previousDirs, entryRelativePath)
 		if err == errCancelled {
 			return err
 		}
@@ -337,6 +530,10 @@ func (u *Uploader) processSubdirectories(ctx context.Context, relativePath strin
 			return errors.Wrap(err, "unable to create dir entry")
 		}
 
+		if err := u.addExtendedAttributes(ctx, de, dir, policyTree.Child(entry.Name()).EffectivePolicy()); err != nil {
+			return err
+		}
+
 		de.DirSummary = &subdirsumm
 		dirManifest.Entries = append(dirManifest.Entries, de)
 		return nil
@@ -386,6 +583,9 @@ func metadataEquals(e1, e2 fs.Entry) bool {
 		return false
 	}
 
+	// extended attributes are not compared, they don't affect contents of the file and cached entries
+	// are recorded with the current attributes, which previous snapshots may not have captured.
+
 	return true
 }
 
@@ -435,6 +635,11 @@ func (u *Uploader) prepareWorkItems(ctx context.Context, dirRelativePath string,
 			return nil
 		}
 
+		if _, ok := entry.(fs.Special); ok && !policyTree.Child(entry.Name()).EffectivePolicy().FilesPolicy.CaptureSpecialFiles() {
+			log.Debugf("skipping special file %v", entryRelativePath)
+			return nil
+		}
+
 		// regular file
 		if entry, ok := entry.(fs.File); ok {
 			u.stats.TotalFileCount++
@@ -457,6 +662,15 @@ func (u *Uploader) prepareWorkItems(ctx context.Context, dirRelativePath string,
 				return errors.Wrap(err, "unable to create dir entry")
 			}
 
+			// holes of a sparse file are carried over, so that they are kept on restore
+			if h, ok := cachedEntry.(snapshot.HasDirEntry); ok {
+				cachedDirEntry.Holes = h.DirEntry().Holes
+			}
+
+			if err := u.addExtendedAttributes(ctx, cachedDirEntry, entry, policyTree.Child(entry.Name()).EffectivePolicy()); err != nil {
+				return err
+			}
+
 			// Avoid hashing by reusing previous object ID.
 			result = append(result, &uploadWorkItem{
 				entry:             entry,
@@ -472,7 +686,16 @@ func (u *Uploader) prepareWorkItems(ctx context.Context, dirRelativePath string,
 					entry:             entry,
 					entryRelativePath: entryRelativePath,
 					uploadFunc: func() entryResult {
-						return u.uploadSymlinkInternal(ctx, entry)
+						return u.uploadSymlinkInternal(ctx, entry, policyTree.Child(entry.Name()).EffectivePolicy())
+					},
+				})
+
+			case fs.Special:
+				result = append(result, &uploadWorkItem{
+					entry:             entry,
+					entryRelativePath: entryRelativePath,
+					uploadFunc: func() entryResult {
+						return u.uploadSpecialInternal(ctx, entry, policyTree.Child(entry.Name()).EffectivePolicy())
 					},
 				})
 
@@ -570,6 +793,39 @@ func (u *Uploader) processUploadWorkItems(workItems []*uploadWorkItem, dirManife
 	return nil
 }
 
+// hardLinkGroups returns groups of files in the directory manifest that are hard links, keyed by the underlying file.
+// Files with links outside of the directory are included, so that links can be recreated across directories.
+func hardLinkGroups(entries fs.Entries, dirEntries []*snapshot.DirEntry) []*snapshot.HardLinkGroup {
+	var result []*snapshot.HardLinkGroup
+
+	groups := map[fs.LinkInfo]*snapshot.HardLinkGroup{}
+
+	for _, de := range dirEntries {
+		if de.Type != snapshot.EntryTypeFile {
+			continue
+		}
+
+		e := entries.FindByName(de.Name)
+		if e == nil || !e.LinkInfo().IsHardLink() {
+			continue
+		}
+
+		li := e.LinkInfo()
+		key := fs.LinkInfo{Device: li.Device, Inode: li.Inode}
+
+		g := groups[key]
+		if g == nil {
+			g = &snapshot.HardLinkGroup{Device: li.Device, Inode: li.Inode, Links: li.Links}
+			groups[key] = g
+			result = append(result, g)
+		}
+
+		g.Names = append(g.Names, de.Name)
+	}
+
+	return result
+}
+
 func maybeReadDirectoryEntries(ctx context.Context, dir fs.Directory) fs.Entries {
 	if dir == nil {
 		return nil
@@ -606,6 +862,47 @@ func uniqueDirectories(dirs []fs.Directory) []fs.Directory {
 	return result
 }
 
+// uploadDirWithActions uploads the provided directory, running before- and after-folder actions defined for it.
+func uploadDirWithActions(
+	ctx context.Context,
+	u *Uploader,
+	directory fs.Directory,
+	policyTree *policy.Tree,
+	previousDirs []fs.Directory,
+	dirRelativePath string,
+) (oid object.ID, summ fs.DirectorySummary, err error) {
+	pol := policyTree.DefinedPolicy()
+	if pol == nil || (pol.Actions.BeforeFolder == nil && pol.Actions.AfterFolder == nil) {
+		return uploadDirInternal(ctx, u, directory, policyTree, previousDirs, dirRelativePath)
+	}
+
+	ac := u.actions.forFolder(dirRelativePath)
+
+	newPath, err := runAction(ctx, actionBeforeFolder, pol.Actions.BeforeFolder, ac)
+	if err != nil {
+		return "", fs.DirectorySummary{}, err
+	}
+
+	if newPath != "" {
+		ac.snapshotPath = newPath
+	}
+
+	defer func() {
+		err = finishAction(ctx, actionAfterFolder, pol.Actions.AfterFolder, ac, err)
+	}()
+
+	if newPath != "" {
+		dir, err := redirectDirectory(newPath)
+		if err != nil {
+			return "", fs.DirectorySummary{}, err
+		}
+
+		directory = u.ignoring(dir, policyTree)
+	}
+
+	return uploadDirInternal(ctx, u, directory, policyTree, previousDirs, dirRelativePath)
+}
+
 func uploadDirInternal(
 	ctx context.Context,
 	u *Uploader,
@@ -670,6 +967,7 @@ func uploadDirInternal(
 	log.Debugf("finished processing uploads %v", dirRelativePath)
 
 	dirManifest.Summary = &summ
+	dirManifest.HardLinks = hardLinkGroups(entries, dirManifest.Entries)
 
 	writer := u.repo.Objects.NewWriter(ctx, object.WriterOptions{
 		Description: "DIR:" + dirRelativePath,
@@ -737,9 +1035,22 @@ func (u *Uploader) Upload(
 
 	defer u.Progress.UploadFinished()
 
-	u.stats = snapshot.Stats{}
+	defer startBandwidthSchedule(u.repo.Throttler(), &policyTree.EffectivePolicy().SchedulingPolicy)()
+
+	// advertise the upload so that garbage collection does not delete contents we may end up referencing.
+	session, err := u.repo.BeginWriteSession(ctx, sourceInfo.UserName+"@"+sourceInfo.Host, "snapshot "+sourceInfo.String())
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to begin write session")
+	}
 
-	var err error
+	defer func() {
+		if err := session.End(ctx); err != nil {
+			log.Warningf("unable to end write session: %v", err)
+		}
+	}()
+
+	u.stats = snapshot.Stats{}
+	u.actions = newActionContext(sourceInfo.Path, u.repo.ActionsEnabled())
 
 	s.StartTime = time.Now()
 
@@ -753,10 +1064,7 @@ func (u *Uploader) Upload(
 			}
 		}
 
-		entry = ignorefs.New(entry, policyTree, ignorefs.ReportIgnoredFiles(func(_ string, md fs.Entry) {
-			u.stats.AddExcluded(md)
-		}))
-		s.RootEntry, err = u.uploadDir(ctx, entry, policyTree, previousDirs)
+		s.RootEntry, err = u.uploadRootDir(ctx, entry, policyTree, previousDirs)
 
 	case fs.File:
 		s.RootEntry, err = u.uploadFile(ctx, entry, policyTree.EffectivePolicy())
@@ -0,0 +1,166 @@
+package snapshotfs
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/fs"
+	"github.com/kopia/kopia/fs/localfs"
+	"github.com/kopia/kopia/snapshot/policy"
+)
+
+// Names of actions passed to commands in KOPIA_ACTION environment variable.
+const (
+	actionBeforeSnapshotRoot = "before-snapshot-root"
+	actionAfterSnapshotRoot  = "after-snapshot-root"
+	actionBeforeFolder       = "before-folder"
+	actionAfterFolder        = "after-folder"
+)
+
+// snapshotPathVariable is the name of environment variable holding the path being snapshotted,
+// which before-actions can print to their standard output to redirect the snapshot.
+const snapshotPathVariable = "KOPIA_SNAPSHOT_PATH"
+
+// actionContext holds information about the snapshot passed to action commands.
+type actionContext struct {
+	snapshotID   string
+	sourcePath   string
+	snapshotPath string
+
+	// actions are only run when enabled for the repository connection, since policies
+	// stored in the repository may be defined by other clients.
+	enabled bool
+}
+
+func newActionContext(sourcePath string, enabled bool) *actionContext {
+	b := make([]byte, 8) //nolint:gomnd
+	rand.Read(b)         //nolint:errcheck
+
+	return &actionContext{
+		snapshotID:   fmt.Sprintf("%x", b),
+		sourcePath:   sourcePath,
+		snapshotPath: sourcePath,
+		enabled:      enabled,
+	}
+}
+
+func (ac *actionContext) environment(action string) []string {
+	return append(os.Environ(),
+		"KOPIA_ACTION="+action,
+		"KOPIA_SNAPSHOT_ID="+ac.snapshotID,
+		"KOPIA_SOURCE_PATH="+ac.sourcePath,
+		snapshotPathVariable+"="+ac.snapshotPath,
+	)
+}
+
+// forFolder returns the context of an action invoked for the directory at the provided relative path.
+func (ac *actionContext) forFolder(dirRelativePath string) *actionContext {
+	return &actionContext{
+		snapshotID:   ac.snapshotID,
+		sourcePath:   filepath.Join(ac.sourcePath, filepath.FromSlash(dirRelativePath)),
+		snapshotPath: filepath.Join(ac.snapshotPath, filepath.FromSlash(dirRelativePath)),
+		enabled:      ac.enabled,
+	}
+}
+
+// runAction runs the provided action command, if any, and returns the snapshot path printed by the
+// command to its standard output or an empty string. Failures of commands in warn mode are only logged.
+func runAction(ctx context.Context, action string, cmd *policy.ActionCommand, ac *actionContext) (string, error) {
+	if cmd == nil {
+		return "", nil
+	}
+
+	if !ac.enabled {
+		log.Warningf("skipping %v action %v, actions are not enabled for this repository connection (use --enable-actions when connecting)", action, cmd.Command)
+		return "", nil
+	}
+
+	newPath, err := runActionCommand(ctx, action, cmd, ac)
+	if err != nil {
+		if cmd.FailOnError() {
+			return "", errors.Wrapf(err, "error running %v action", action)
+		}
+
+		log.Warningf("error running %v action: %v", action, err)
+
+		return "", nil
+	}
+
+	return newPath, nil
+}
+
+func runActionCommand(ctx context.Context, action string, cmd *policy.ActionCommand, ac *actionContext) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, cmd.Timeout())
+	defer cancel()
+
+	log.Debugf("running %v action %v %v", action, cmd.Command, cmd.Arguments)
+
+	c := exec.CommandContext(ctx, cmd.Command, cmd.Arguments...) //nolint:gosec
+	c.Env = ac.environment(action)
+	c.Dir = ac.sourcePath
+	c.Stderr = os.Stderr
+
+	out, err := c.Output()
+	if ctx.Err() == context.DeadlineExceeded {
+		return "", errors.Errorf("command timed out after %v", cmd.Timeout())
+	}
+
+	if err != nil {
+		return "", errors.Wrap(err, "command failed")
+	}
+
+	return parseSnapshotPath(out), nil
+}
+
+// parseSnapshotPath returns the value of the last KOPIA_SNAPSHOT_PATH=<path> line in the command output.
+func parseSnapshotPath(out []byte) string {
+	var result string
+
+	s := bufio.NewScanner(bytes.NewReader(out))
+	for s.Scan() {
+		if l := strings.TrimSpace(s.Text()); strings.HasPrefix(l, snapshotPathVariable+"=") {
+			result = strings.TrimPrefix(l, snapshotPathVariable+"=")
+		}
+	}
+
+	return result
+}
+
+// redirectDirectory returns the directory at the path provided by a before-action.
+func redirectDirectory(path string) (fs.Directory, error) {
+	e, err := localfs.NewEntry(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to open snapshot path %v", path)
+	}
+
+	dir, ok := e.(fs.Directory)
+	if !ok {
+		return nil, errors.Errorf("snapshot path %v is not a directory", path)
+	}
+
+	return dir, nil
+}
+
+// finishAction runs the provided after-action and returns the error of the operation it follows, if any,
+// or the error of the action. Action errors after failed operations are only logged.
+func finishAction(ctx context.Context, action string, cmd *policy.ActionCommand, ac *actionContext, err error) error {
+	if _, aerr := runAction(ctx, action, cmd, ac); aerr != nil {
+		if err != nil {
+			log.Warningf("%v", aerr)
+			return err
+		}
+
+		return aerr
+	}
+
+	return err
+}
@@ -0,0 +1,167 @@
+// +build linux
+
+package snapshotfs
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kopia/kopia/fs"
+	"github.com/kopia/kopia/fs/localfs"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/snapshot"
+	"github.com/kopia/kopia/snapshot/policy"
+)
+
+func shellAction(script, mode string) *policy.ActionCommand {
+	return &policy.ActionCommand{
+		Command:   "/bin/sh",
+		Arguments: []string{"-c", script},
+		Mode:      mode,
+	}
+}
+
+func TestUpload_Actions(t *testing.T) {
+	ctx := context.Background()
+	th := newUploadTestHarnessWithConnectOptions(repo.ConnectOptions{EnableActions: true})
+
+	defer th.cleanup()
+
+	tmp, err := ioutil.TempDir("", "kopia")
+	if err != nil {
+		t.Fatalf("cannot create temp directory: %v", err)
+	}
+
+	defer os.RemoveAll(tmp)
+
+	for _, f := range []string{"src/sub/f1", "mnt/sub/f2", "alt/f3"} {
+		fname := filepath.Join(tmp, f)
+
+		if err = os.MkdirAll(filepath.Dir(fname), 0700); err != nil {
+			t.Fatalf("unable to create directory: %v", err)
+		}
+
+		if err = ioutil.WriteFile(fname, []byte(f), 0600); err != nil {
+			t.Fatalf("unable to write file: %v", err)
+		}
+	}
+
+	src := filepath.Join(tmp, "src")
+	logFile := filepath.Join(tmp, "log")
+	logEnv := `echo "$KOPIA_ACTION $KOPIA_SOURCE_PATH $KOPIA_SNAPSHOT_PATH" >> ` + logFile
+
+	rootPolicy := &policy.Policy{
+		Actions: policy.ActionsPolicy{
+			BeforeSnapshotRoot: shellAction(logEnv+"; echo KOPIA_SNAPSHOT_PATH="+filepath.Join(tmp, "mnt"), ""),
+			AfterSnapshotRoot:  shellAction(logEnv, ""),
+		},
+	}
+
+	subPolicy := &policy.Policy{
+		Actions: policy.ActionsPolicy{
+			BeforeFolder: shellAction(logEnv+"; echo KOPIA_SNAPSHOT_PATH="+filepath.Join(tmp, "alt"), ""),
+			AfterFolder:  shellAction(logEnv, ""),
+		},
+	}
+
+	dir, err := localfs.Directory(src)
+	if err != nil {
+		t.Fatalf("unable to open directory: %v", err)
+	}
+
+	u := NewUploader(th.repo)
+	tree := policy.BuildTree(map[string]*policy.Policy{".": rootPolicy, "./sub": subPolicy}, policy.DefaultPolicy)
+
+	man, err := u.Upload(ctx, dir, tree, snapshot.SourceInfo{Path: src})
+	if err != nil {
+		t.Fatalf("Upload error: %v", err)
+	}
+
+	root, err := SnapshotRoot(th.repo, man)
+	if err != nil {
+		t.Fatalf("unable to get snapshot root: %v", err)
+	}
+
+	e, err := root.(fs.Directory).Child(ctx, "sub")
+	if err != nil {
+		t.Fatalf("unable to get subdirectory: %v", err)
+	}
+
+	if _, err = e.(fs.Directory).Child(ctx, "f3"); err != nil {
+		t.Errorf("folder was not redirected: %v", err)
+	}
+
+	actionsLog, err := ioutil.ReadFile(logFile)
+	if err != nil {
+		t.Fatalf("unable to read log: %v", err)
+	}
+
+	want := []string{
+		"before-snapshot-root " + src + " " + src,
+		"before-folder " + src + "/sub " + tmp + "/mnt/sub",
+		"after-folder " + src + "/sub " + tmp + "/alt",
+		"after-snapshot-root " + src + " " + tmp + "/mnt",
+	}
+
+	if got := strings.Split(strings.TrimSpace(string(actionsLog)), "\n"); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("unexpected actions:\n%v\nwant:\n%v", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	rootPolicy.Actions = policy.ActionsPolicy{BeforeSnapshotRoot: shellAction("exit 1", policy.ActionModeWarn)}
+	if _, err = u.Upload(ctx, dir, tree, snapshot.SourceInfo{Path: src}); err != nil {
+		t.Errorf("unexpected error of failed action in warn mode: %v", err)
+	}
+
+	rootPolicy.Actions = policy.ActionsPolicy{BeforeSnapshotRoot: shellAction("exit 1", "")}
+	if _, err = u.Upload(ctx, dir, tree, snapshot.SourceInfo{Path: src}); err == nil {
+		t.Errorf("unexpected success of failed action in fail mode")
+	}
+
+	rootPolicy.Actions = policy.ActionsPolicy{AfterSnapshotRoot: &policy.ActionCommand{Command: "/bin/sleep", Arguments: []string{"10"}, TimeoutSeconds: 1}}
+	if _, err = u.Upload(ctx, dir, tree, snapshot.SourceInfo{Path: src}); err == nil {
+		t.Errorf("unexpected success of action that timed out")
+	}
+}
+
+func TestUpload_ActionsNotEnabled(t *testing.T) {
+	ctx := context.Background()
+	th := newUploadTestHarness()
+
+	defer th.cleanup()
+
+	tmp, err := ioutil.TempDir("", "kopia")
+	if err != nil {
+		t.Fatalf("cannot create temp directory: %v", err)
+	}
+
+	defer os.RemoveAll(tmp)
+
+	marker := filepath.Join(tmp, "marker")
+
+	rootPolicy := &policy.Policy{
+		Actions: policy.ActionsPolicy{
+			BeforeSnapshotRoot: shellAction("touch "+marker+"; exit 1", ""),
+		},
+	}
+
+	dir, err := localfs.Directory(tmp)
+	if err != nil {
+		t.Fatalf("unable to open directory: %v", err)
+	}
+
+	u := NewUploader(th.repo)
+	tree := policy.BuildTree(map[string]*policy.Policy{".": rootPolicy}, policy.DefaultPolicy)
+
+	// actions are skipped, since they were not enabled when connecting to the repository.
+	if _, err = u.Upload(ctx, dir, tree, snapshot.SourceInfo{Path: tmp}); err != nil {
+		t.Errorf("Upload error: %v", err)
+	}
+
+	if _, err = os.Stat(marker); !os.IsNotExist(err) {
+		t.Errorf("action was run without being enabled: %v", err)
+	}
+}
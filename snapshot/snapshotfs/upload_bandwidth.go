@@ -0,0 +1,58 @@
+package snapshotfs
+
+import (
+	"time"
+
+	"github.com/kopia/kopia/repo/blob/throttling"
+	"github.com/kopia/kopia/snapshot/policy"
+)
+
+// startBandwidthSchedule lowers bandwidth limits according to the scheduling policy and keeps switching them as
+// schedule boundaries pass. Limits configured for the repository always apply, scheduled windows can only make them
+// more restrictive.
+// The returned function stops the schedule and removes the override.
+func startBandwidthSchedule(th throttling.Throttler, sp *policy.SchedulingPolicy) (stop func()) {
+	if len(sp.BandwidthSchedule) == 0 {
+		return func() {}
+	}
+
+	o := th.NewOverride()
+
+	apply := func(now time.Time) {
+		l, ok := sp.BandwidthLimitsAt(now)
+		if !ok {
+			o.Clear()
+			return
+		}
+
+		log.Infof("applying scheduled bandwidth limits: upload %v, download %v bytes/sec", l.MaxUploadSpeedBytesPerSecond, l.MaxDownloadSpeedBytesPerSecond)
+		o.Set(l)
+	}
+
+	apply(time.Now())
+
+	done := make(chan struct{})
+	finished := make(chan struct{})
+
+	go func() {
+		defer close(finished)
+
+		for {
+			next, _ := sp.NextBandwidthScheduleChange(time.Now())
+
+			select {
+			case <-done:
+				return
+
+			case <-time.After(time.Until(next)):
+				apply(time.Now())
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-finished
+		o.Clear()
+	}
+}
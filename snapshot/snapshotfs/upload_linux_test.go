@@ -0,0 +1,259 @@
+// +build linux
+
+package snapshotfs
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/kopia/kopia/fs"
+	"github.com/kopia/kopia/fs/localfs"
+	"github.com/kopia/kopia/snapshot"
+	"github.com/kopia/kopia/snapshot/policy"
+)
+
+func TestUpload_SparseFile(t *testing.T) {
+	ctx := context.Background()
+	th := newUploadTestHarness()
+
+	defer th.cleanup()
+
+	tmp, err := ioutil.TempDir("", "kopia")
+	if err != nil {
+		t.Fatalf("cannot create temp directory: %v", err)
+	}
+
+	defer os.RemoveAll(tmp)
+
+	const size = 2 << 20
+
+	want := make([]byte, size)
+	copy(want[1<<20:], "some data")
+
+	src := filepath.Join(tmp, "src")
+	if err = os.Mkdir(src, 0700); err != nil {
+		t.Fatalf("unable to create directory: %v", err)
+	}
+
+	f, err := os.Create(filepath.Join(src, "sparse"))
+	if err != nil {
+		t.Fatalf("unable to create file: %v", err)
+	}
+
+	_, err = f.WriteAt(want[1<<20:(1<<20)+9], 1<<20)
+	if err == nil {
+		err = f.Truncate(size)
+	}
+
+	f.Close() //nolint:errcheck
+
+	if err != nil {
+		t.Fatalf("unable to write file: %v", err)
+	}
+
+	if allocatedBytes(t, filepath.Join(src, "sparse")) >= size {
+		t.Skip("sparse files not supported by the file system")
+	}
+
+	dir, err := localfs.Directory(src)
+	if err != nil {
+		t.Fatalf("unable to open directory: %v", err)
+	}
+
+	u := NewUploader(th.repo)
+
+	s1, err := u.Upload(ctx, dir, policy.BuildTree(nil, policy.DefaultPolicy), snapshot.SourceInfo{})
+	if err != nil {
+		t.Fatalf("Upload error: %v", err)
+	}
+
+	root, err := SnapshotRoot(th.repo, s1)
+	if err != nil {
+		t.Fatalf("unable to get snapshot root: %v", err)
+	}
+
+	e, err := root.(fs.Directory).Child(ctx, "sparse")
+	if err != nil {
+		t.Fatalf("unable to find file in snapshot: %v", err)
+	}
+
+	de := e.(snapshot.HasDirEntry).DirEntry()
+	if len(de.Holes) == 0 || de.FileSize != size {
+		t.Errorf("unexpected dir entry: %+v", de)
+	}
+
+	// object includes the holes, so that it can be read without knowing about them.
+	or, err := th.repo.Objects.Open(ctx, de.ObjectID)
+	if err != nil {
+		t.Fatalf("unable to open object: %v", err)
+	}
+
+	defer or.Close() //nolint:errcheck
+
+	if got := or.Length(); got != size {
+		t.Errorf("unexpected object length: %v, want %v", got, size)
+	}
+
+	r, err := e.(fs.File).Open(ctx)
+	if err != nil {
+		t.Fatalf("unable to open file: %v", err)
+	}
+
+	defer r.Close() //nolint:errcheck
+
+	got, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("unable to read file: %v", err)
+	}
+
+	if !bytes.Equal(got, want) {
+		t.Errorf("unexpected file contents")
+	}
+
+	dst := filepath.Join(tmp, "dst")
+	if err := localfs.Copy(ctx, dst, root, localfs.CopyOptions{}); err != nil {
+		t.Fatalf("unable to restore: %v", err)
+	}
+
+	got, err = ioutil.ReadFile(filepath.Join(dst, "sparse"))
+	if err != nil {
+		t.Fatalf("unable to read restored file: %v", err)
+	}
+
+	if !bytes.Equal(got, want) {
+		t.Errorf("unexpected contents of restored file")
+	}
+
+	if allocated := allocatedBytes(t, filepath.Join(dst, "sparse")); allocated >= size {
+		t.Errorf("restored file is not sparse, %v bytes allocated", allocated)
+	}
+
+	// holes are also kept when the sparse file is the root of the snapshot.
+	fileEntry, err := localfs.NewEntry(filepath.Join(src, "sparse"))
+	if err != nil {
+		t.Fatalf("unable to open file: %v", err)
+	}
+
+	s2, err := u.Upload(ctx, fileEntry, policy.BuildTree(nil, policy.DefaultPolicy), snapshot.SourceInfo{})
+	if err != nil {
+		t.Fatalf("Upload error: %v", err)
+	}
+
+	if len(s2.RootEntry.Holes) == 0 {
+		t.Errorf("holes of single-file root not recorded: %+v", s2.RootEntry)
+	}
+}
+
+func TestUpload_SpecialFiles(t *testing.T) {
+	ctx := context.Background()
+	th := newUploadTestHarness()
+
+	defer th.cleanup()
+
+	tmp, err := ioutil.TempDir("", "kopia")
+	if err != nil {
+		t.Fatalf("cannot create temp directory: %v", err)
+	}
+
+	defer os.RemoveAll(tmp)
+
+	src := filepath.Join(tmp, "src")
+	if err = os.Mkdir(src, 0700); err != nil {
+		t.Fatalf("unable to create directory: %v", err)
+	}
+
+	if err = syscall.Mkfifo(filepath.Join(src, "fifo"), 0600); err != nil {
+		t.Fatalf("unable to create fifo: %v", err)
+	}
+
+	dir, err := localfs.Directory(src)
+	if err != nil {
+		t.Fatalf("unable to open directory: %v", err)
+	}
+
+	u := NewUploader(th.repo)
+
+	// special files are not captured by default.
+	s0, err := u.Upload(ctx, dir, policy.BuildTree(nil, policy.DefaultPolicy), snapshot.SourceInfo{})
+	if err != nil {
+		t.Fatalf("Upload error: %v", err)
+	}
+
+	root, err := SnapshotRoot(th.repo, s0)
+	if err != nil {
+		t.Fatalf("unable to get snapshot root: %v", err)
+	}
+
+	if _, err = root.(fs.Directory).Child(ctx, "fifo"); err == nil {
+		t.Errorf("special file was captured without being enabled by policy")
+	}
+
+	capture := true
+	policyTree := policy.BuildTree(map[string]*policy.Policy{
+		".": {FilesPolicy: policy.FilesPolicy{SpecialFiles: &capture}},
+	}, policy.DefaultPolicy)
+
+	s1, err := u.Upload(ctx, dir, policyTree, snapshot.SourceInfo{})
+	if err != nil {
+		t.Fatalf("Upload error: %v", err)
+	}
+
+	// second snapshot reuses the entry from the first one
+	s2, err := u.Upload(ctx, dir, policyTree, snapshot.SourceInfo{}, s1)
+	if err != nil {
+		t.Fatalf("Upload error: %v", err)
+	}
+
+	if !objectIDsEqual(s1.RootObjectID(), s2.RootObjectID()) {
+		t.Errorf("expected s1.RootObjectID==s2.RootObjectID, got %v and %v", s1.RootObjectID(), s2.RootObjectID())
+	}
+
+	root, err = SnapshotRoot(th.repo, s2)
+	if err != nil {
+		t.Fatalf("unable to get snapshot root: %v", err)
+	}
+
+	e, err := root.(fs.Directory).Child(ctx, "fifo")
+	if err != nil {
+		t.Fatalf("unable to find fifo in snapshot: %v", err)
+	}
+
+	de := e.(snapshot.HasDirEntry).DirEntry()
+	if got, want := de.Type, snapshot.EntryTypeNamedPipe; got != want {
+		t.Errorf("unexpected entry type: %v, want %v", got, want)
+	}
+
+	if de.ObjectID != "" {
+		t.Errorf("unexpected object of special file: %v", de.ObjectID)
+	}
+
+	dst := filepath.Join(tmp, "dst")
+	if err := localfs.Copy(ctx, dst, root, localfs.CopyOptions{}); err != nil {
+		t.Fatalf("unable to restore: %v", err)
+	}
+
+	fi, err := os.Lstat(filepath.Join(dst, "fifo"))
+	if err != nil {
+		t.Fatalf("unable to stat restored fifo: %v", err)
+	}
+
+	if fi.Mode()&os.ModeNamedPipe == 0 {
+		t.Errorf("unexpected mode of restored fifo: %v", fi.Mode())
+	}
+}
+
+func allocatedBytes(t *testing.T, path string) int64 {
+	t.Helper()
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("unable to stat: %v", err)
+	}
+
+	return fi.Sys().(*syscall.Stat_t).Blocks * 512 //nolint:gomnd
+}
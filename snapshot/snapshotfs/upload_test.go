@@ -1,18 +1,24 @@
 package snapshotfs
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/pkg/errors"
 
+	"github.com/kopia/kopia/fs"
+	"github.com/kopia/kopia/internal/blobtesting"
 	"github.com/kopia/kopia/internal/mockfs"
 	"github.com/kopia/kopia/repo"
 	"github.com/kopia/kopia/repo/blob/filesystem"
+	"github.com/kopia/kopia/repo/blob/throttling"
 	"github.com/kopia/kopia/repo/object"
 	"github.com/kopia/kopia/snapshot"
 	"github.com/kopia/kopia/snapshot/policy"
@@ -36,6 +42,10 @@ func (th *uploadTestHarness) cleanup() {
 }
 
 func newUploadTestHarness() *uploadTestHarness {
+	return newUploadTestHarnessWithConnectOptions(repo.ConnectOptions{})
+}
+
+func newUploadTestHarnessWithConnectOptions(opt repo.ConnectOptions) *uploadTestHarness {
 	ctx := context.Background()
 
 	repoDir, err := ioutil.TempDir("", "kopia-repo")
@@ -58,7 +68,7 @@ func newUploadTestHarness() *uploadTestHarness {
 	log.Debugf("repo dir: %v", repoDir)
 
 	configFile := filepath.Join(repoDir, ".kopia.config")
-	if conerr := repo.Connect(ctx, configFile, storage, masterPassword, repo.ConnectOptions{}); conerr != nil {
+	if conerr := repo.Connect(ctx, configFile, storage, masterPassword, opt); conerr != nil {
 		panic("unable to connect to repository: " + conerr.Error())
 	}
 
@@ -189,6 +199,154 @@ func TestUpload(t *testing.T) {
 	}
 }
 
+func TestUpload_ExtendedAttributes(t *testing.T) {
+	ctx := context.Background()
+	th := newUploadTestHarness()
+
+	defer th.cleanup()
+
+	u := NewUploader(th.repo)
+
+	f1, err := th.sourceDir.Child(ctx, "f1")
+	if err != nil {
+		t.Fatalf("unable to find f1: %v", err)
+	}
+
+	xattrs := fs.ExtendedAttributes{
+		"user.foo":   []byte("bar"),
+		"user.large": bytes.Repeat([]byte{1}, maxInlineExtendedAttributeSize+1),
+	}
+	f1.(*mockfs.File).SetExtendedAttributes(xattrs)
+
+	// extended attributes are not captured by default.
+	s1, err := u.Upload(ctx, th.sourceDir, policy.BuildTree(nil, policy.DefaultPolicy), snapshot.SourceInfo{})
+	if err != nil {
+		t.Fatalf("Upload error: %v", err)
+	}
+
+	if got, err := snapshotEntry(ctx, t, th, s1, "f1").ExtendedAttributes(ctx); err != nil || len(got) != 0 {
+		t.Errorf("unexpected extended attributes: %v", got)
+	}
+
+	capture := true
+	policyTree := policy.BuildTree(map[string]*policy.Policy{
+		".": {FilesPolicy: policy.FilesPolicy{ExtendedAttributes: &capture}},
+	}, policy.DefaultPolicy)
+
+	// file contents are unchanged, so the file is cached, but the attributes are captured.
+	s2, err := u.Upload(ctx, th.sourceDir, policyTree, snapshot.SourceInfo{}, s1)
+	if err != nil {
+		t.Fatalf("Upload error: %v", err)
+	}
+
+	if objectIDsEqual(s1.RootObjectID(), s2.RootObjectID()) {
+		t.Errorf("expected s1.RootObjectID!=s2.RootObjectID, got %v", s2.RootObjectID())
+	}
+
+	if got, want := s2.Stats.NonCachedFiles, 0; got != want {
+		t.Errorf("unexpected s2 non-cached files: %v, want %v", got, want)
+	}
+
+	e := snapshotEntry(ctx, t, th, s2, "f1")
+
+	de := e.(snapshot.HasDirEntry).DirEntry()
+	if de.ExtendedAttributesObjectID == "" || len(de.ExtendedAttributes) != 1 {
+		t.Errorf("large extended attribute was not stored in a separate object: %v", de)
+	}
+
+	if got, err := e.ExtendedAttributes(ctx); err != nil || !got.Equal(xattrs) {
+		t.Errorf("unexpected extended attributes: %v, want %v (err: %v)", got, xattrs, err)
+	}
+
+	// failure to read the separate object is reported.
+	de.ExtendedAttributesObjectID = "Ideadbeef"
+
+	if _, err := e.ExtendedAttributes(ctx); err == nil {
+		t.Errorf("unexpected success reading missing extended attributes object")
+	}
+}
+
+func snapshotEntry(ctx context.Context, t *testing.T, th *uploadTestHarness, man *snapshot.Manifest, name string) fs.Entry {
+	t.Helper()
+
+	root, err := SnapshotRoot(th.repo, man)
+	if err != nil {
+		t.Fatalf("unable to get snapshot root: %v", err)
+	}
+
+	e, err := root.(fs.Directory).Child(ctx, name)
+	if err != nil {
+		t.Fatalf("unable to find %v in snapshot: %v", name, err)
+	}
+
+	return e
+}
+
+func TestUpload_HardLinks(t *testing.T) {
+	ctx := context.Background()
+	th := newUploadTestHarness()
+
+	defer th.cleanup()
+
+	li := fs.LinkInfo{Device: 1, Inode: 2, Links: 2}
+
+	for _, f := range []*mockfs.Directory{th.sourceDir, th.sourceDir.Subdir("d1", "d1")} {
+		e, err := f.Child(ctx, "f1")
+		if err != nil {
+			t.Fatalf("unable to find f1: %v", err)
+		}
+
+		e.(*mockfs.File).SetLinkInfo(li)
+	}
+
+	u := NewUploader(th.repo)
+
+	policyTree := policy.BuildTree(nil, policy.DefaultPolicy)
+
+	s1, err := u.Upload(ctx, th.sourceDir, policyTree, snapshot.SourceInfo{})
+	if err != nil {
+		t.Fatalf("Upload error: %v", err)
+	}
+
+	root, err := SnapshotRoot(th.repo, s1)
+	if err != nil {
+		t.Fatalf("unable to get snapshot root: %v", err)
+	}
+
+	cases := map[string]fs.LinkInfo{
+		"f1":       li,
+		"d1/d1/f1": li,
+		"f2":       {},
+		"d1/d1/f2": {},
+	}
+
+	for path, want := range cases {
+		e, err := findInSnapshot(ctx, root.(fs.Directory), path)
+		if err != nil {
+			t.Fatalf("unable to find %v in snapshot: %v", path, err)
+		}
+
+		if got := e.LinkInfo(); got != want {
+			t.Errorf("unexpected link info of %v: %+v, want %+v", path, got, want)
+		}
+	}
+}
+
+func findInSnapshot(ctx context.Context, dir fs.Directory, path string) (fs.Entry, error) {
+	var e fs.Entry = dir
+
+	for _, p := range strings.Split(path, "/") {
+		var err error
+
+		e, err = e.(fs.Directory).Child(ctx, p)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return e, nil
+}
+
 func TestUpload_Cancel(t *testing.T) {
 }
 
@@ -269,3 +427,129 @@ func TestUpload_SymlinkBecameDirectory(t *testing.T) {
 
 func TestUpload_SymlinkBecameFile(t *testing.T) {
 }
+
+func allDaySchedule(l throttling.Limits) *policy.SchedulingPolicy {
+	// window where start and end are the same applies all day.
+	return &policy.SchedulingPolicy{
+		BandwidthSchedule: []policy.BandwidthWindow{
+			{Start: policy.TimeOfDay{Hour: 10}, End: policy.TimeOfDay{Hour: 10}, Limits: l},
+		},
+	}
+}
+
+func TestUpload_BandwidthSchedule(t *testing.T) {
+	ctx := context.Background()
+
+	original := throttling.Limits{MaxDownloadSpeedBytesPerSecond: 1000}
+
+	st := throttling.NewWrapper(blobtesting.NewMapStorage(blobtesting.DataMap{}, nil, nil), original)
+	defer st.Close(ctx) //nolint:errcheck
+
+	th := st.(throttling.Throttler)
+
+	stop1 := startBandwidthSchedule(th, allDaySchedule(throttling.Limits{MaxUploadSpeedBytesPerSecond: 2000}))
+
+	if got, want := th.EffectiveLimits(), (throttling.Limits{MaxUploadSpeedBytesPerSecond: 2000, MaxDownloadSpeedBytesPerSecond: 1000}); got != want {
+		t.Errorf("scheduled limits not applied: %v, want %v", got, want)
+	}
+
+	// concurrent upload with more restrictive schedule.
+	stop2 := startBandwidthSchedule(th, allDaySchedule(throttling.Limits{MaxUploadSpeedBytesPerSecond: 3000, MaxDownloadSpeedBytesPerSecond: 500}))
+
+	if got, want := th.EffectiveLimits(), (throttling.Limits{MaxUploadSpeedBytesPerSecond: 2000, MaxDownloadSpeedBytesPerSecond: 500}); got != want {
+		t.Errorf("most restrictive limits not applied: %v, want %v", got, want)
+	}
+
+	// configured limits changed while schedules are active.
+	changed := throttling.Limits{MaxUploadSpeedBytesPerSecond: 2500}
+	th.SetLimits(changed)
+
+	if got, want := th.EffectiveLimits(), (throttling.Limits{MaxUploadSpeedBytesPerSecond: 2000, MaxDownloadSpeedBytesPerSecond: 500}); got != want {
+		t.Errorf("most restrictive limits not applied after change: %v, want %v", got, want)
+	}
+
+	stop1()
+
+	if got, want := th.EffectiveLimits(), (throttling.Limits{MaxUploadSpeedBytesPerSecond: 2500, MaxDownloadSpeedBytesPerSecond: 500}); got != want {
+		t.Errorf("remaining schedule not applied: %v, want %v", got, want)
+	}
+
+	stop2()
+
+	if got := th.EffectiveLimits(); got != changed {
+		t.Errorf("configured limits not restored: %v, want %v", got, changed)
+	}
+
+	// no schedule, no changes.
+	startBandwidthSchedule(th, &policy.SchedulingPolicy{})()
+
+	if got := th.EffectiveLimits(); got != changed {
+		t.Errorf("unexpected limits: %v, want %v", got, changed)
+	}
+}
+
+func TestUpload_BandwidthScheduleSingleDirection(t *testing.T) {
+	ctx := context.Background()
+
+	original := throttling.Limits{MaxUploadSpeedBytesPerSecond: 1000, MaxDownloadSpeedBytesPerSecond: 2000}
+
+	st := throttling.NewWrapper(blobtesting.NewMapStorage(blobtesting.DataMap{}, nil, nil), original)
+	defer st.Close(ctx) //nolint:errcheck
+
+	th := st.(throttling.Throttler)
+
+	// schedule limiting only downloads keeps the configured upload limit.
+	stop := startBandwidthSchedule(th, allDaySchedule(throttling.Limits{MaxDownloadSpeedBytesPerSecond: 500}))
+
+	if got, want := th.EffectiveLimits(), (throttling.Limits{MaxUploadSpeedBytesPerSecond: 1000, MaxDownloadSpeedBytesPerSecond: 500}); got != want {
+		t.Errorf("unexpected limits: %v, want %v", got, want)
+	}
+
+	stop()
+
+	// schedule less restrictive than configured limits has no effect.
+	stop = startBandwidthSchedule(th, allDaySchedule(throttling.Limits{MaxUploadSpeedBytesPerSecond: 5000}))
+
+	if got := th.EffectiveLimits(); got != original {
+		t.Errorf("unexpected limits: %v, want %v", got, original)
+	}
+
+	stop()
+
+	if got := th.EffectiveLimits(); got != original {
+		t.Errorf("configured limits not restored: %v, want %v", got, original)
+	}
+}
+
+func TestReaddirSkipsUnknownEntryTypes(t *testing.T) {
+	ctx := context.Background()
+	th := newUploadTestHarness()
+
+	defer th.cleanup()
+
+	w := th.repo.Objects.NewWriter(ctx, object.WriterOptions{Prefix: "k"})
+
+	if err := json.NewEncoder(w).Encode(&snapshot.DirManifest{
+		StreamType: directoryStreamType,
+		Entries: []*snapshot.DirEntry{
+			{Name: "f1", Type: snapshot.EntryTypeFile},
+			{Name: "future", Type: "x"},
+		},
+	}); err != nil {
+		t.Fatalf("unable to write directory: %v", err)
+	}
+
+	oid, err := w.Result()
+	if err != nil {
+		t.Fatalf("unable to write directory: %v", err)
+	}
+
+	entries, err := DirectoryEntry(th.repo, oid, nil).Readdir(ctx)
+	if err != nil {
+		t.Fatalf("unable to read directory: %v", err)
+	}
+
+	if len(entries) != 1 || entries[0].Name() != "f1" {
+		t.Errorf("unexpected entries: %v", entries)
+	}
+}
@@ -0,0 +1,56 @@
+package endtoend_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/kopia/kopia/tests/testenv"
+)
+
+func TestBlobRepack(t *testing.T) {
+	t.Parallel()
+
+	e := testenv.NewCLITest(t)
+	defer e.Cleanup(t)
+	defer e.RunAndExpectSuccess(t, "repo", "disconnect")
+
+	e.RunAndExpectSuccess(t, "repo", "create", "filesystem", "--path", e.RepoDir)
+
+	e.RunAndExpectSuccess(t, "snapshot", "create", sharedTestDataDir1)
+	e.RunAndExpectSuccess(t, "snapshot", "create", sharedTestDataDir2)
+
+	// delete snapshots of the first directory and garbage-collect its contents.
+	for _, line := range e.RunAndExpectSuccess(t, "snapshot", "list", "-m", sharedTestDataDir1) {
+		p := strings.Index(line, "manifest:")
+		if p >= 0 {
+			manifestID := strings.TrimPrefix(strings.Split(line[p:], " ")[0], "manifest:")
+			e.RunAndExpectSuccess(t, "manifest", "rm", manifestID)
+		}
+	}
+
+	e.RunAndExpectSuccess(t, "snapshot", "gc", "--delete", "--min-age", "0s")
+
+	blobsBefore := len(e.RunAndExpectSuccess(t, "blob", "list"))
+
+	// dry run does not change anything.
+	e.RunAndExpectSuccess(t, "blob", "repack", "--dry-run", "--min-live-fraction", "1")
+
+	if got := len(e.RunAndExpectSuccess(t, "blob", "list")); got != blobsBefore {
+		t.Fatalf("dry run changed the number of blobs from %v to %v", blobsBefore, got)
+	}
+
+	// first run rewrites live contents, second run deletes old packs.
+	e.RunAndExpectSuccess(t, "blob", "repack", "--min-live-fraction", "1", "--safety-delay", "0s")
+
+	_, stderr := e.RunAndExpectSuccessWithErrOut(t, "blob", "repack", "--min-live-fraction", "1", "--safety-delay", "0s")
+	if !strings.Contains(strings.Join(stderr, "\n"), "Deleted") {
+		t.Errorf("old packs were not deleted: %v", stderr)
+	}
+
+	e.RunAndExpectSuccess(t, "snapshot", "verify", "--all-sources", "--verify-files-percent", "100")
+
+	// repacking is not allowed in append-only mode.
+	e.RunAndExpectSuccess(t, "repo", "disconnect")
+	e.RunAndExpectSuccess(t, "repo", "connect", "filesystem", "--path", e.RepoDir, "--append-only")
+	e.RunAndExpectFailure(t, "blob", "repack")
+}
@@ -17,7 +17,7 @@ func TestCompression(t *testing.T) {
 	defer e.Cleanup(t)
 	defer e.RunAndExpectSuccess(t, "repo", "disconnect")
 
-	e.RunAndExpectSuccess(t, "repo", "create", "filesystem", "--path", e.RepoDir)
+	e.RunAndExpectSuccess(t, "repo", "create", "filesystem", "--path", e.RepoDir, "--index-version=2")
 
 	// set global policy
 	e.RunAndExpectSuccess(t, "policy", "set", "--global", "--compression", "pgzip")
@@ -50,8 +50,21 @@ func TestCompression(t *testing.T) {
 	oid := sources[0].Snapshots[0].ObjectID
 	entries := e.ListDirectory(t, oid)
 
-	if !strings.HasPrefix(entries[0].ObjectID, "Z") {
-		t.Errorf("expected compressed object, got %v", entries[0].ObjectID)
+	// repositories using index format v2 compress at the content level, so object IDs are not affected.
+	if strings.HasPrefix(entries[0].ObjectID, "Z") {
+		t.Errorf("expected object compressed at the content level, got %v", entries[0].ObjectID)
+	}
+
+	var compressedContents string
+
+	for _, l := range e.RunAndExpectSuccess(t, "content", "stats") {
+		if f := strings.Fields(l); len(f) > 3 && f[0] == "(none)" {
+			compressedContents = f[3]
+		}
+	}
+
+	if compressedContents != "1" {
+		t.Errorf("unexpected number of compressed contents: %q", compressedContents)
 	}
 
 	if lines := e.RunAndExpectSuccess(t, "show", entries[0].ObjectID); !reflect.DeepEqual(dataLines, lines) {
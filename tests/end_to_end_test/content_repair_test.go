@@ -0,0 +1,71 @@
+package endtoend_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kopia/kopia/tests/testenv"
+)
+
+func TestContentVerifyRepair(t *testing.T) {
+	t.Parallel()
+
+	e := testenv.NewCLITest(t)
+	defer e.Cleanup(t)
+
+	e.RunAndExpectSuccess(t, "repo", "create", "filesystem", "--path", e.RepoDir, "--ecc", "RS-10-2")
+	e.RunAndExpectSuccess(t, "snapshot", "create", sharedTestDataDir1)
+
+	// flip a byte in the middle of each pack blob.
+	damaged := map[string]bool{}
+
+	if err := filepath.Walk(e.RepoDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+
+		// pack blobs are sharded into directories starting with the blob prefix.
+		if rel, _ := filepath.Rel(e.RepoDir, path); !strings.HasPrefix(rel, "p") {
+			return nil
+		}
+
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		damaged[path] = true
+		b[len(b)/3] ^= 1
+
+		return ioutil.WriteFile(path, b, info.Mode())
+	}); err != nil {
+		t.Fatalf("unable to corrupt pack blobs: %v", err)
+	}
+
+	if len(damaged) == 0 {
+		t.Fatalf("no pack blobs found")
+	}
+
+	// contents are readable thanks to parity and get rewritten into new pack blobs.
+	e.RunAndExpectSuccess(t, "content", "verify", "--repair", "all")
+
+	for path := range damaged {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("damaged pack blob %v was removed by repair: %v", path, err)
+		}
+	}
+
+	// damaged pack blobs are no longer referenced and can be removed.
+	e.RunAndExpectSuccess(t, "blob", "gc", "--delete=yes")
+
+	for path := range damaged {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("damaged pack blob %v was not removed: %v", path, err)
+		}
+	}
+
+	e.RunAndExpectSuccess(t, "snapshot", "verify", "--all-sources")
+}
@@ -0,0 +1,39 @@
+package endtoend_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/kopia/kopia/tests/testenv"
+)
+
+func TestContentScrub(t *testing.T) {
+	t.Parallel()
+
+	e := testenv.NewCLITest(t)
+	defer e.Cleanup(t)
+
+	e.RunAndExpectSuccess(t, "repo", "create", "filesystem", "--path", e.RepoDir)
+	e.RunAndExpectSuccess(t, "snapshot", "create", sharedTestDataDir1)
+
+	_, stderr := e.RunAndExpectSuccessWithErrOut(t, "content", "scrub", "--percent", "100")
+	if !hasLineWithPrefix(stderr, "Verified ") || hasLineWithPrefix(stderr, "Verified 0 ") {
+		t.Errorf("expected pack blobs to be verified, got %v", stderr)
+	}
+
+	// all pack blobs have been verified in the current period.
+	_, stderr = e.RunAndExpectSuccessWithErrOut(t, "content", "scrub", "--percent", "100", "--checksum-only")
+	if !hasLineWithPrefix(stderr, "Verified 0 of 0 due") {
+		t.Errorf("expected no pack blobs to be due, got %v", stderr)
+	}
+}
+
+func hasLineWithPrefix(lines []string, prefix string) bool {
+	for _, l := range lines {
+		if strings.HasPrefix(l, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -1,11 +1,13 @@
 package endtoend_test
 
 import (
+	"encoding/json"
 	"strings"
 	"testing"
 
 	"github.com/kylelemons/godebug/pretty"
 
+	"github.com/kopia/kopia/repo/content"
 	"github.com/kopia/kopia/tests/testenv"
 )
 
@@ -55,3 +57,56 @@ func TestIndexRecover(t *testing.T) {
 		t.Errorf("unexpected block diff after recovery: %v", d)
 	}
 }
+
+func TestIndexRebuild(t *testing.T) {
+	t.Parallel()
+
+	e := testenv.NewCLITest(t)
+	defer e.Cleanup(t)
+
+	e.RunAndExpectSuccess(t, "repo", "create", "filesystem", "--path", e.RepoDir)
+
+	e.RunAndExpectSuccess(t, "snapshot", "create", sharedTestDataDir1)
+	e.RunAndExpectSuccess(t, "snapshot", "create", sharedTestDataDir2)
+
+	contentsBefore := e.RunAndExpectSuccess(t, "content", "ls")
+
+	if report := runIndexRebuild(t, e); len(report.Missing) != 0 || len(report.Extra) != 0 || len(report.Conflicting) != 0 {
+		t.Errorf("unexpected differences in consistent repository: %+v", report)
+	}
+
+	lines := e.RunAndExpectSuccess(t, "index", "ls")
+	for _, l := range lines {
+		e.RunAndExpectSuccess(t, "blob", "delete", strings.Split(l, " ")[0])
+	}
+
+	e.RunAndVerifyOutputLineCount(t, 0, "index", "ls", "--no-list-caching")
+	e.RunAndVerifyOutputLineCount(t, 0, "content", "ls")
+
+	report := runIndexRebuild(t, e)
+	if got, want := len(report.Missing), len(contentsBefore); got != want {
+		t.Errorf("unexpected number of missing contents: %v, want %v", got, want)
+	}
+
+	runIndexRebuild(t, e, "--commit")
+
+	e.RunAndVerifyOutputLineCount(t, 1, "index", "ls")
+
+	contentsAfter := e.RunAndExpectSuccess(t, "content", "ls")
+	if d := pretty.Compare(contentsBefore, contentsAfter); d != "" {
+		t.Errorf("unexpected content diff after rebuild: %v", d)
+	}
+}
+
+func runIndexRebuild(t *testing.T, e *testenv.CLITest, args ...string) *content.IndexRebuildReport {
+	t.Helper()
+
+	output := e.RunAndExpectSuccess(t, append([]string{"index", "rebuild"}, args...)...)
+
+	report := &content.IndexRebuildReport{}
+	if err := json.Unmarshal([]byte(strings.Join(output, "\n")), report); err != nil {
+		t.Fatalf("invalid index rebuild report: %v", err)
+	}
+
+	return report
+}
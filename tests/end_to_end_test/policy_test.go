@@ -1,6 +1,7 @@
 package endtoend_test
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/kopia/kopia/tests/testenv"
@@ -27,3 +28,30 @@ func TestDefaultGlobalPolicy(t *testing.T) {
 	// make sure the policy is visible in the policy list
 	e.RunAndVerifyOutputLineCount(t, 1, "policy", "list")
 }
+
+func TestBandwidthSchedulePolicy(t *testing.T) {
+	t.Parallel()
+
+	e := testenv.NewCLITest(t)
+	defer e.Cleanup(t)
+
+	e.RunAndExpectSuccess(t, "repo", "create", "filesystem", "--path", e.RepoDir)
+
+	e.RunAndExpectFailure(t, "policy", "set", "--global", "--bandwidth-schedule", "08:00=100")
+	e.RunAndExpectSuccess(t, "policy", "set", "--global", "--bandwidth-schedule", "00:00-00:00=100000000/0")
+
+	out := strings.Join(e.RunAndExpectSuccess(t, "policy", "show", "--global"), "\n")
+	if !strings.Contains(out, "0:00-0:00  upload: 100 MB/s  download: unlimited") {
+		t.Errorf("bandwidth schedule not shown: %v", out)
+	}
+
+	// snapshot succeeds while the schedule is in effect.
+	e.RunAndExpectSuccess(t, "snapshot", "create", sharedTestDataDir1)
+
+	e.RunAndExpectSuccess(t, "policy", "set", "--global", "--bandwidth-schedule", "inherit")
+
+	out = strings.Join(e.RunAndExpectSuccess(t, "policy", "show", "--global"), "\n")
+	if strings.Contains(out, "Bandwidth schedule") {
+		t.Errorf("bandwidth schedule not cleared: %v", out)
+	}
+}
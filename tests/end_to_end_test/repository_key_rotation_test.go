@@ -0,0 +1,53 @@
+package endtoend_test
+
+import (
+	"testing"
+
+	"github.com/kopia/kopia/tests/testenv"
+)
+
+func TestRepositoryChangePassword(t *testing.T) {
+	t.Parallel()
+
+	e := testenv.NewCLITest(t)
+	defer e.Cleanup(t)
+	defer e.RunAndExpectSuccess(t, "repo", "disconnect")
+
+	e.RunAndExpectSuccess(t, "repo", "create", "filesystem", "--path", e.RepoDir, "--index-version=2")
+	e.RunAndExpectSuccess(t, "snapshot", "create", sharedTestDataDir1)
+	e.RunAndExpectSuccess(t, "repo", "change-password", "--new-password", "new-password")
+	e.RunAndExpectSuccess(t, "repo", "disconnect")
+
+	e.RunAndExpectFailure(t, "repo", "connect", "filesystem", "--path", e.RepoDir)
+	e.RunAndExpectSuccess(t, "repo", "connect", "filesystem", "--path", e.RepoDir, "--password", "new-password")
+
+	if got := len(e.ListSnapshotsAndExpectSuccess(t)); got != 1 {
+		t.Errorf("unexpected number of sources after password change: %v", got)
+	}
+}
+
+func TestRepositoryRotateKey(t *testing.T) {
+	t.Parallel()
+
+	e := testenv.NewCLITest(t)
+	defer e.Cleanup(t)
+	defer e.RunAndExpectSuccess(t, "repo", "disconnect")
+
+	e.RunAndExpectSuccess(t, "repo", "create", "filesystem", "--path", e.RepoDir, "--index-version=2")
+	e.RunAndExpectSuccess(t, "snapshot", "create", sharedTestDataDir1)
+	e.RunAndExpectSuccess(t, "repo", "rotate-key")
+	e.RunAndExpectSuccess(t, "snapshot", "create", sharedTestDataDir2)
+	e.RunAndExpectSuccess(t, "snapshot", "verify", "--all-sources", "--verify-files-percent", "100")
+
+	// re-encrypt existing contents and remove pack blobs encrypted with the retired key.
+	e.RunAndExpectSuccess(t, "content", "rewrite", "--retired-keys")
+	e.RunAndExpectSuccess(t, "index", "optimize", "--all")
+	e.RunAndExpectSuccess(t, "blob", "gc", "--delete", "yes")
+
+	_, stderr := e.RunAndExpectSuccessWithErrOut(t, "content", "rewrite", "--retired-keys", "--dry-run")
+	if !hasLineWithPrefix(stderr, "Total bytes rewritten 0") {
+		t.Errorf("contents encrypted with retired key remain after re-encryption: %v", stderr)
+	}
+
+	e.RunAndExpectSuccess(t, "snapshot", "verify", "--all-sources", "--verify-files-percent", "100")
+}
@@ -0,0 +1,72 @@
+package endtoend_test
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/kopia/kopia/tests/testenv"
+)
+
+func TestRepositorySync(t *testing.T) {
+	t.Parallel()
+
+	e := testenv.NewCLITest(t)
+	defer e.Cleanup(t)
+	defer e.RunAndExpectSuccess(t, "repo", "disconnect")
+
+	e.RunAndExpectSuccess(t, "repo", "create", "filesystem", "--path", e.RepoDir)
+
+	e.RunAndExpectSuccess(t, "snapshot", "create", sharedTestDataDir1)
+	e.RunAndExpectSuccess(t, "snapshot", "create", sharedTestDataDir2)
+
+	syncDir := makeScratchDir(t)
+
+	// dry run does not copy anything.
+	e.RunAndExpectSuccess(t, "repo", "sync-to", "filesystem", "--path", syncDir, "--dry-run")
+
+	if entries, _ := ioutil.ReadDir(syncDir); len(entries) != 0 {
+		t.Fatalf("unexpected entries after dry run: %v", len(entries))
+	}
+
+	e.RunAndExpectSuccess(t, "repo", "sync-to", "filesystem", "--path", syncDir)
+
+	// incremental sync after taking another snapshot.
+	e.RunAndExpectSuccess(t, "snapshot", "create", sharedTestDataDir3)
+	e.RunAndExpectSuccess(t, "repo", "sync-to", "filesystem", "--path", syncDir, "--parallel", "2")
+
+	// extraneous blob is deleted only when requested.
+	extraneousFile := filepath.Join(syncDir, "extraneous.f")
+	if err := ioutil.WriteFile(extraneousFile, []byte{1, 2, 3}, 0600); err != nil {
+		t.Fatalf("unable to write file: %v", err)
+	}
+
+	e.RunAndExpectSuccess(t, "repo", "sync-to", "filesystem", "--path", syncDir)
+
+	if _, err := ioutil.ReadFile(extraneousFile); err != nil {
+		t.Fatalf("extraneous file was unexpectedly deleted: %v", err)
+	}
+
+	e.RunAndExpectSuccess(t, "repo", "sync-to", "filesystem", "--path", syncDir, "--delete")
+
+	if _, err := ioutil.ReadFile(extraneousFile); err == nil {
+		t.Fatalf("extraneous file was not deleted")
+	}
+
+	// refuse to sync to a location that has unrelated data.
+	otherDir := makeScratchDir(t)
+	if err := ioutil.WriteFile(filepath.Join(otherDir, "unrelated.f"), []byte{1, 2, 3}, 0600); err != nil {
+		t.Fatalf("unable to write file: %v", err)
+	}
+
+	e.RunAndExpectFailure(t, "repo", "sync-to", "filesystem", "--path", otherDir)
+
+	// the destination is now a usable copy of the repository.
+	e.RunAndExpectSuccess(t, "repo", "disconnect")
+	e.RunAndExpectSuccess(t, "repo", "connect", "filesystem", "--path", syncDir)
+
+	sources := e.ListSnapshotsAndExpectSuccess(t)
+	if got, want := len(sources), 3; got != want {
+		t.Errorf("unexpected number of sources in synchronized repository: %v, want %v", got, want)
+	}
+}
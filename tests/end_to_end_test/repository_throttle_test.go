@@ -0,0 +1,33 @@
+package endtoend_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/kopia/kopia/tests/testenv"
+)
+
+func TestRepositoryThrottle(t *testing.T) {
+	t.Parallel()
+
+	e := testenv.NewCLITest(t)
+	defer e.Cleanup(t)
+	defer e.RunAndExpectSuccess(t, "repo", "disconnect")
+
+	e.RunAndExpectSuccess(t, "repo", "create", "filesystem", "--path", e.RepoDir)
+
+	out := e.RunAndExpectSuccess(t, "repo", "throttle")
+	if got := strings.Join(out, "\n"); strings.Count(got, "unlimited") != 2 {
+		t.Errorf("unexpected default limits: %v", got)
+	}
+
+	e.RunAndExpectSuccess(t, "repo", "throttle", "--max-upload-speed", "10000000")
+
+	// limits are persisted and respected by subsequent commands.
+	out = e.RunAndExpectSuccess(t, "repo", "throttle")
+	if got := strings.Join(out, "\n"); !strings.Contains(got, "10 MB/s") {
+		t.Errorf("unexpected limits: %v", got)
+	}
+
+	e.RunAndExpectSuccess(t, "snapshot", "create", sharedTestDataDir1)
+}
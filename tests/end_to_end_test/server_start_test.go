@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/kopia/kopia/internal/serverapi"
+	"github.com/kopia/kopia/repo/blob/throttling"
 	"github.com/kopia/kopia/tests/testenv"
 )
 
@@ -73,6 +74,20 @@ func TestServerStart(t *testing.T) {
 		t.Errorf("status error: %v", err)
 	}
 
+	limits := throttling.Limits{MaxUploadSpeedBytesPerSecond: 1000000}
+	if err := cli.Post("throttle/set", &limits, &throttling.Limits{}); err != nil {
+		t.Errorf("throttle/set error: %v", err)
+	}
+
+	var gotLimits throttling.Limits
+	if err := cli.Get("throttle", &gotLimits); err != nil {
+		t.Errorf("throttle error: %v", err)
+	}
+
+	if gotLimits != limits {
+		t.Errorf("unexpected throttling limits: %v, want %v", gotLimits, limits)
+	}
+
 	// TODO - add more tests
 
 	// explicit shutdown
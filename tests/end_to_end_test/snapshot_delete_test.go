@@ -318,7 +318,9 @@ func TestSnapshotDeleteRestore(t *testing.T) {
 	e.RunAndExpectFailure(t, "snapshot", "delete", snapID, "--unsafe-ignore-source")
 
 	// garbage-collect to clean up the root object. Otherwise
-	// a restore will succeed
+	// a restore will succeed. The first GC only marks unused contents
+	// for deletion, the second one deletes them.
+	e.RunAndExpectSuccess(t, "snapshot", "gc", "--delete", "--min-age", "0s")
 	e.RunAndExpectSuccess(t, "snapshot", "gc", "--delete", "--min-age", "0s")
 
 	// Run a restore on the deleted snapshot's root ID
@@ -62,7 +62,12 @@ how are you
 	// data block + directory block + manifest block + manifest block from manifest deletion
 	e.RunAndVerifyOutputLineCount(t, expectedContentCount, "content", "list")
 
-	// garbage-collect for real, this time without age limit
+	// garbage-collect for real, this time without age limit - unused contents are only marked
+	// for deletion in a new GC epoch.
+	e.RunAndExpectSuccess(t, "snapshot", "gc", "--delete", "--min-age", "0s")
+	e.RunAndVerifyOutputLineCount(t, expectedContentCount, "content", "list")
+
+	// next garbage collection sweeps contents that remained unused for a full epoch.
 	e.RunAndExpectSuccess(t, "snapshot", "gc", "--delete", "--min-age", "0s")
 
 	// two contents are deleted
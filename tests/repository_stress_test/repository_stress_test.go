@@ -19,6 +19,7 @@ import (
 
 	"github.com/kopia/kopia/repo"
 	"github.com/kopia/kopia/repo/blob/filesystem"
+	"github.com/kopia/kopia/repo/compression"
 	"github.com/kopia/kopia/repo/content"
 )
 
@@ -221,7 +222,7 @@ func writeRandomBlock(ctx context.Context, t *testing.T, r *repo.Repository) err
 	data := make([]byte, 1000)
 	cryptorand.Read(data) //nolint:errcheck
 
-	contentID, err := r.Content.WriteContent(ctx, data, "")
+	contentID, err := r.Content.WriteContent(ctx, data, "", compression.NoCompression)
 	if err == nil {
 		knownBlocksMutex.Lock()
 		if len(knownBlocks) >= 1000 {